@@ -0,0 +1,152 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// LogCollectionPolicySpec limits what the ServerLogs of the namespaces it
+// selects may collect and where they may ship it. A ServerLog must satisfy
+// every policy selecting its namespace.
+type LogCollectionPolicySpec struct {
+	// Namespaces selects the namespaces the policy applies to, every
+	// namespace when it is empty.
+	// +optional
+	Namespaces NamespaceSelection `json:"namespaces,omitempty"`
+	// AllowedPathPrefixes are the directories on the node the sources of
+	// the ServerLogs must be read from, or be under, e.g. the volumes of the
+	// Pods in /var/lib/kubelet/pods. They are matched against the paths the
+	// dirs resolve to, not the dirs in the container. Any directory is
+	// allowed when it is empty, the output of the containers always.
+	// +optional
+	AllowedPathPrefixes []string `json:"allowedPathPrefixes,omitempty"`
+	// AllowedOutputs are the names of the LogOutputs the ServerLogs may ship
+	// to, any when it is empty. The default output of the agent is always
+	// allowed.
+	// +optional
+	AllowedOutputs []string `json:"allowedOutputs,omitempty"`
+	// MaxRate is the highest rate limit a ServerLog may set. ServerLogs
+	// without one are read at MaxRate.
+	// +optional
+	MaxRate *RateLimit `json:"maxRate,omitempty"`
+	// MaxServerLogsPerNamespace is how many ServerLogs a namespace may have,
+	// 0 is unlimited.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxServerLogsPerNamespace int32 `json:"maxServerLogsPerNamespace,omitempty"`
+}
+
+// Selects reports whether namespace is in Include, or Include is empty, and
+// it is not in Exclude.
+func (s *NamespaceSelection) Selects(namespace string) bool {
+	for _, excluded := range s.Exclude {
+		if excluded == namespace {
+			return false
+		}
+	}
+	if len(s.Include) == 0 {
+		return true
+	}
+	for _, included := range s.Include {
+		if included == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Violations returns the fields of spec the policy does not allow. The
+// number of ServerLogs of the namespace is not checked, nor are the dirs,
+// their path on the node is only known once the controller resolved them,
+// see CheckHostPath.
+func (p *LogCollectionPolicy) Violations(spec *ServerLogSpec) field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+	if spec.Output != "" && len(p.Spec.AllowedOutputs) > 0 && !containsString(p.Spec.AllowedOutputs, spec.Output) {
+		errs = append(errs, field.NotSupported(specPath.Child("output"), spec.Output, p.Spec.AllowedOutputs))
+	}
+	if max, rate := p.Spec.MaxRate, spec.RateLimit; max != nil && rate != nil {
+		ratePath := specPath.Child("rateLimit")
+		if max.LinesPerSecond > 0 && rate.LinesPerSecond > max.LinesPerSecond {
+			errs = append(errs, field.Invalid(ratePath.Child("linesPerSecond"), rate.LinesPerSecond,
+				fmt.Sprintf("must be at most %d, the maximum of policy %s", max.LinesPerSecond, p.Name)))
+		}
+		if max.BytesPerSecond != nil && rate.BytesPerSecond != nil && rate.BytesPerSecond.Cmp(*max.BytesPerSecond) > 0 {
+			errs = append(errs, field.Invalid(ratePath.Child("bytesPerSecond"), rate.BytesPerSecond.String(),
+				fmt.Sprintf("must be at most %s, the maximum of policy %s", max.BytesPerSecond, p.Name)))
+		}
+	}
+	return errs
+}
+
+// CheckHostPath returns why the policy does not allow reading hostPath, a
+// directory on the node, nil if it does.
+func (p *LogCollectionPolicy) CheckHostPath(hostPath string) error {
+	if len(p.Spec.AllowedPathPrefixes) == 0 {
+		return nil
+	}
+	for _, prefix := range p.Spec.AllowedPathPrefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if hostPath == prefix || strings.HasPrefix(hostPath, prefix+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("policy %s only allows directories on the node under %s",
+		p.Name, strings.Join(p.Spec.AllowedPathPrefixes, ", "))
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:noStatus
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName={lcp}
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// LogCollectionPolicy is the Schema for the logcollectionpolicies API
+type LogCollectionPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec LogCollectionPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// LogCollectionPolicyList contains a list of LogCollectionPolicy
+type LogCollectionPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LogCollectionPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&LogCollectionPolicy{}, &LogCollectionPolicyList{})
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LogCollectorConfigName is the name of the LogCollectorConfig the
+// controller reads, other objects are ignored.
+const LogCollectorConfigName = "cluster"
+
+// LogCollectorConfigSpec is the cluster wide configuration of the collector.
+type LogCollectorConfigSpec struct {
+	// Namespaces selects the namespaces whose Pods may opt in to collection.
+	// It is merged with the namespace flags of the controller.
+	// +optional
+	Namespaces NamespaceSelection `json:"namespaces,omitempty"`
+	// Defaults are filled in by the webhook on the ServerLogs that do not
+	// set them. The default annotations of a namespace win over them.
+	// +optional
+	Defaults *ServerLogDefaults `json:"defaults,omitempty"`
+}
+
+// ServerLogDefaults are the settings of a ServerLog used when it has none.
+// Only Output applies to a ServerLog with sources, the others to the
+// directory of a ServerLog without.
+type ServerLogDefaults struct {
+	// Dir defaults to /data/log.
+	// +optional
+	Dir string `json:"dir,omitempty"`
+	// FileFilter defaults to *.log.
+	// +optional
+	FileFilter string `json:"fileFilter,omitempty"`
+	// Pattern and MultilineNegate are set together, on a ServerLog without
+	// a pattern.
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+	// +optional
+	MultilineNegate bool `json:"multilineNegate,omitempty"`
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MultilineMaxLines int32 `json:"multilineMaxLines,omitempty"`
+	// +optional
+	MultilineTimeout *metav1.Duration `json:"multilineTimeout,omitempty"`
+	// +optional
+	Output string `json:"output,omitempty"`
+	// +optional
+	Parsers []Parser `json:"parsers,omitempty"`
+}
+
+// NamespaceSelection selects namespaces by name. A namespace is selected
+// when it is in Include, or Include is empty, and it is not in Exclude.
+type NamespaceSelection struct {
+	// +optional
+	Include []string `json:"include,omitempty"`
+	// +optional
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:noStatus
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName={lcc}
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// LogCollectorConfig is the Schema for the logcollectorconfigs API
+type LogCollectorConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec LogCollectorConfigSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// LogCollectorConfigList contains a list of LogCollectorConfig
+type LogCollectorConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LogCollectorConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&LogCollectorConfig{}, &LogCollectorConfigList{})
+}
@@ -0,0 +1,338 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LogOutputType is the kind of sink a LogOutput delivers to.
+type LogOutputType string
+
+const (
+	LogOutputStdout LogOutputType = "stdout"
+	LogOutputFile   LogOutputType = "file"
+	LogOutputHTTP   LogOutputType = "http"
+	// LogOutputElasticsearch also works with OpenSearch.
+	LogOutputElasticsearch LogOutputType = "elasticsearch"
+	LogOutputKafka         LogOutputType = "kafka"
+	LogOutputLoki          LogOutputType = "loki"
+)
+
+// LogOutputSpec defines where the node agent ships the logs of the
+// ServerLogs referencing it.
+type LogOutputSpec struct {
+	// Type selects the sink, the matching section below configures it.
+	// +kubebuilder:validation:Enum=stdout;file;http;elasticsearch;kafka;loki
+	Type LogOutputType `json:"type"`
+	// File writes records to a rolling file on the node.
+	// +optional
+	File *FileOutput `json:"file,omitempty"`
+	// HTTP POSTs batches of records as JSON.
+	// +optional
+	HTTP *HTTPOutput `json:"http,omitempty"`
+	// Elasticsearch indexes records with the _bulk API.
+	// +optional
+	Elasticsearch *ElasticsearchOutput `json:"elasticsearch,omitempty"`
+	// Kafka produces records to a topic.
+	// +optional
+	Kafka *KafkaOutput `json:"kafka,omitempty"`
+	// Loki pushes records to Grafana Loki.
+	// +optional
+	Loki *LokiOutput `json:"loki,omitempty"`
+	// Batch controls how records are grouped before they are written.
+	// +optional
+	Batch *BatchConfig `json:"batch,omitempty"`
+}
+
+// FileOutput configures the rolling file sink.
+type FileOutput struct {
+	// Path is the file on the node records are appended to.
+	// +kubebuilder:validation:MinLength=1
+	Path string `json:"path"`
+	// MaxSizeMB rotates the file once it grows past this size, defaults to 100.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxSizeMB int32 `json:"maxSizeMB,omitempty"`
+	// MaxBackups is the number of rotated files kept, defaults to 5.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxBackups *int32 `json:"maxBackups,omitempty"`
+}
+
+// HTTPOutputFormat is the body format of the HTTP sink.
+type HTTPOutputFormat string
+
+const (
+	// HTTPFormatJSON sends a batch as a JSON array.
+	HTTPFormatJSON HTTPOutputFormat = "json"
+	// HTTPFormatNDJSON sends a batch as one JSON object per line.
+	HTTPFormatNDJSON HTTPOutputFormat = "ndjson"
+)
+
+// HTTPOutput configures the generic HTTP/JSON sink.
+type HTTPOutput struct {
+	// URL receives the batches.
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+	// Method defaults to POST.
+	// +optional
+	Method string `json:"method,omitempty"`
+	// Headers are added to every request.
+	// +optional
+	Headers map[string]string `json:"headers,omitempty"`
+	// Format of the request body, defaults to json.
+	// +kubebuilder:validation:Enum=json;ndjson
+	// +optional
+	Format HTTPOutputFormat `json:"format,omitempty"`
+	// Timeout of a single request, defaults to 10s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// InsecureSkipVerify disables TLS certificate verification.
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// ElasticsearchOutput configures the Elasticsearch/OpenSearch bulk sink.
+type ElasticsearchOutput struct {
+	// URLs of the cluster, tried in turn when a request fails.
+	// +kubebuilder:validation:MinItems=1
+	URLs []string `json:"urls"`
+	// Index is a Go template for the index name of a record, defaults to
+	// "logs-{{ .Namespace }}-{{ .Date }}". It can use .Namespace, .Pod,
+	// .ServerLog, .Labels (e.g. {{ index .Labels "app" }}), .Date (yyyy.MM.dd)
+	// and .Time. The result is lower-cased.
+	// +optional
+	Index string `json:"index,omitempty"`
+	// Pipeline is the ingest pipeline records are sent through.
+	// +optional
+	Pipeline string `json:"pipeline,omitempty"`
+	// Headers are added to every request, e.g. Authorization.
+	// +optional
+	Headers map[string]string `json:"headers,omitempty"`
+	// MaxRetries is how often records failing with 429 or 5xx are retried
+	// before the batch is given back to the agent, defaults to 3.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
+	// DeadLetterPath is a file on the node records rejected by Elasticsearch,
+	// e.g. on mapping errors, are appended to. They are dropped when empty.
+	// +optional
+	DeadLetterPath string `json:"deadLetterPath,omitempty"`
+	// Timeout of a single request, defaults to 30s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// InsecureSkipVerify disables TLS certificate verification.
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// KafkaAcks is how many replicas must have a record before it counts as
+// delivered. Not waiting for the broker at all is not supported, the read
+// offsets would be saved for records the broker may not have.
+type KafkaAcks string
+
+const (
+	KafkaAcksAll    KafkaAcks = "all"
+	KafkaAcksLeader KafkaAcks = "leader"
+)
+
+// KafkaOutput configures the Kafka sink.
+type KafkaOutput struct {
+	// Brokers are the bootstrap brokers as host:port.
+	// +kubebuilder:validation:MinItems=1
+	Brokers []string `json:"brokers"`
+	// Topic is a Go template for the topic of a record, defaults to
+	// "logs-{{ .Namespace }}". It can use the same fields as the
+	// Elasticsearch index. The partition key is always the Pod name, so the
+	// records of a Pod stay in order.
+	// +optional
+	Topic string `json:"topic,omitempty"`
+	// Acks defaults to all.
+	// +kubebuilder:validation:Enum=all;leader
+	// +optional
+	Acks KafkaAcks `json:"acks,omitempty"`
+	// Compression of the record batches, defaults to none.
+	// +kubebuilder:validation:Enum=none;gzip;snappy;lz4;zstd
+	// +optional
+	Compression string `json:"compression,omitempty"`
+	// MaxBatchBytes is the largest record batch sent to one partition in a
+	// request, defaults to 1MiB.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxBatchBytes int32 `json:"maxBatchBytes,omitempty"`
+	// MaxRetries is how often records failing with a retriable error are
+	// sent again before the batch is given back to the agent, defaults to 3.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
+	// Timeout of a single request, defaults to 30s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// ClientID is sent to the brokers, defaults to log-collector.
+	// +optional
+	ClientID string `json:"clientID,omitempty"`
+	// TLS connects to the brokers over TLS when set.
+	// +optional
+	TLS *KafkaTLS `json:"tls,omitempty"`
+	// SASL authenticates to the brokers when set.
+	// +optional
+	SASL *KafkaSASL `json:"sasl,omitempty"`
+}
+
+// KafkaTLS configures the TLS connections to the brokers.
+type KafkaTLS struct {
+	// ServerName overrides the host name the certificates are verified for.
+	// +optional
+	ServerName string `json:"serverName,omitempty"`
+	// InsecureSkipVerify disables TLS certificate verification.
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// KafkaSASLMechanism is how the sink authenticates to the brokers.
+type KafkaSASLMechanism string
+
+const (
+	KafkaSASLPlain       KafkaSASLMechanism = "PLAIN"
+	KafkaSASLScramSHA256 KafkaSASLMechanism = "SCRAM-SHA-256"
+	KafkaSASLScramSHA512 KafkaSASLMechanism = "SCRAM-SHA-512"
+)
+
+// KafkaSASL configures the SASL authentication to the brokers.
+type KafkaSASL struct {
+	// Mechanism defaults to PLAIN.
+	// +kubebuilder:validation:Enum=PLAIN;SCRAM-SHA-256;SCRAM-SHA-512
+	// +optional
+	Mechanism KafkaSASLMechanism `json:"mechanism,omitempty"`
+	// +kubebuilder:validation:MinLength=1
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LokiFormat is the body format of Loki push requests.
+type LokiFormat string
+
+const (
+	// LokiFormatProtobuf sends snappy compressed protobuf.
+	LokiFormatProtobuf LokiFormat = "protobuf"
+	LokiFormatJSON     LokiFormat = "json"
+)
+
+// LokiCardinalityAction is what happens once a label has too many values.
+type LokiCardinalityAction string
+
+const (
+	// LokiCardinalityDrop leaves the label out of new streams.
+	LokiCardinalityDrop LokiCardinalityAction = "drop"
+	// LokiCardinalityReject drops the records that would create a new value.
+	LokiCardinalityReject LokiCardinalityAction = "reject"
+)
+
+// LokiLabel maps a Pod label to a stream label.
+type LokiLabel struct {
+	// PodLabel is the key of the Pod label.
+	// +kubebuilder:validation:MinLength=1
+	PodLabel string `json:"podLabel"`
+	// Name of the stream label, defaults to PodLabel with every character
+	// Loki does not allow replaced by "_". A name of the labels set on every
+	// stream, namespace, server_log and node_name, gets a "pod_" prefix.
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z_][a-zA-Z0-9_]*$`
+	// +optional
+	Name string `json:"name,omitempty"`
+}
+
+// LokiOutput configures the Loki push sink. Streams are labelled with
+// namespace, server_log and node_name plus the Pod labels listed in Labels.
+type LokiOutput struct {
+	// URL of the push API, e.g. http://loki:3100/loki/api/v1/push.
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+	// TenantID is sent as X-Scope-OrgID.
+	// +optional
+	TenantID string `json:"tenantID,omitempty"`
+	// Format of the request body, defaults to protobuf.
+	// +kubebuilder:validation:Enum=protobuf;json
+	// +optional
+	Format LokiFormat `json:"format,omitempty"`
+	// Labels is the allow-list of Pod labels added to the streams.
+	// +optional
+	Labels []LokiLabel `json:"labels,omitempty"`
+	// MaxLabelValues is how many distinct values a Pod label may have,
+	// defaults to 100. Only the values seen in the last hour count.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxLabelValues int32 `json:"maxLabelValues,omitempty"`
+	// OnHighCardinality is what happens to a label past MaxLabelValues,
+	// defaults to drop.
+	// +kubebuilder:validation:Enum=drop;reject
+	// +optional
+	OnHighCardinality LokiCardinalityAction `json:"onHighCardinality,omitempty"`
+	// Headers are added to every request.
+	// +optional
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout of a single request, defaults to 10s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// InsecureSkipVerify disables TLS certificate verification.
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// BatchConfig controls batching in front of a sink.
+type BatchConfig struct {
+	// MaxEvents is the largest batch handed to the sink, defaults to 500.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxEvents int32 `json:"maxEvents,omitempty"`
+	// FlushInterval sends a partial batch after this long, defaults to 1s.
+	// +optional
+	FlushInterval *metav1.Duration `json:"flushInterval,omitempty"`
+}
+
+// LogOutputStatus defines the observed state of LogOutput
+type LogOutputStatus struct {
+}
+
+// +genclient
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName={lo}
+// +kubebuilder:printcolumn:JSONPath=".spec.type",name="type",type="string"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// LogOutput is the Schema for the logoutputs API
+type LogOutput struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   LogOutputSpec   `json:"spec,omitempty"`
+	Status LogOutputStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// LogOutputList contains a list of LogOutput
+type LogOutputList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LogOutput `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&LogOutput{}, &LogOutputList{})
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package v1
 
 import (
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -31,7 +32,166 @@ type ServerLogSpec struct {
 	Dir        string `json:"dir,omitempty"`
 	NodeName   string `json:"nodeName,omitempty"`
 	FileFilter string `json:"fileFilter,omitempty"`
-	Pattern    string `json:"pattern,omitempty"`
+	// Pattern is a regular expression matching the first line of a log event.
+	// Lines that do not match are appended to the previous event, so stack
+	// traces become a single record. Every line is an event when it is empty.
+	Pattern string `json:"pattern,omitempty"`
+	// MultilineNegate inverts Pattern: lines that do NOT match start a new event.
+	// +optional
+	MultilineNegate bool `json:"multilineNegate,omitempty"`
+	// MultilineMaxLines is the maximum number of lines in one event, defaults to 500.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MultilineMaxLines int32 `json:"multilineMaxLines,omitempty"`
+	// MultilineTimeout is how long a partial event waits for more lines before
+	// it is sent anyway, defaults to 5s.
+	// +optional
+	MultilineTimeout *metav1.Duration `json:"multilineTimeout,omitempty"`
+	// Output is the name of the LogOutput in the same namespace the logs are
+	// shipped to. The agent's default output is used when it is empty.
+	// +optional
+	Output string `json:"output,omitempty"`
+	// Parsers turn every event into a structured record. They run in order,
+	// each one adding the fields it extracts; a line one of them fails on is
+	// still shipped, with the error in the _parse_error field.
+	// +optional
+	Parsers []Parser `json:"parsers,omitempty"`
+	// Sources are the directories of the Pod collected with their own
+	// settings. When it is set Dir, FileFilter, the multiline fields and
+	// Parsers above are ignored.
+	// +optional
+	Sources []LogSource `json:"sources,omitempty"`
+	// RateLimit caps how fast the files are read. The limits not set fall
+	// back to the annotations of the namespace, unlimited without them.
+	// +optional
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+}
+
+// RateLimit caps how fast the agent reads the files of a ServerLog. Lines
+// over the limit wait in the files, nothing is dropped.
+type RateLimit struct {
+	// LinesPerSecond is the maximum number of lines read per second.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	LinesPerSecond int64 `json:"linesPerSecond,omitempty"`
+	// BytesPerSecond is the maximum number of bytes read per second, e.g. 1Mi.
+	// +optional
+	BytesPerSecond *resource.Quantity `json:"bytesPerSecond,omitempty"`
+}
+
+// SourceType is where the logs of a source are written.
+type SourceType string
+
+const (
+	// SourceDir reads the files of a directory of the Pod.
+	SourceDir SourceType = "dir"
+	// SourceContainerStdout reads the stdout and stderr of the containers
+	// from the log files of the container runtime under /var/log/pods.
+	SourceContainerStdout SourceType = "containerStdout"
+)
+
+// LogSource is a directory of a Pod with the settings its files are read with.
+type LogSource struct {
+	// Name identifies the source, records carry it in the "source" field.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Type defaults to dir.
+	// +kubebuilder:validation:Enum=dir;containerStdout
+	// +optional
+	Type SourceType `json:"type,omitempty"`
+	// Dir is the directory in the container, required for a dir source.
+	// +kubebuilder:validation:MinLength=2
+	// +optional
+	Dir string `json:"dir,omitempty"`
+	// Containers limits a containerStdout source to the output of these
+	// containers, every container is read when it is empty.
+	// +optional
+	Containers []string `json:"containers,omitempty"`
+	// FileFilter defaults to "*", and to "*.log" for a containerStdout source.
+	// +optional
+	FileFilter string `json:"fileFilter,omitempty"`
+	// Pattern is a regular expression matching the first line of a log event.
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+	// +optional
+	MultilineNegate bool `json:"multilineNegate,omitempty"`
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MultilineMaxLines int32 `json:"multilineMaxLines,omitempty"`
+	// +optional
+	MultilineTimeout *metav1.Duration `json:"multilineTimeout,omitempty"`
+	// +optional
+	Parsers []Parser `json:"parsers,omitempty"`
+}
+
+// IsContainerStdout reports whether the source reads the container output.
+func (s *LogSource) IsContainerStdout() bool {
+	return s.Type == SourceContainerStdout
+}
+
+// EffectiveSources returns Sources, or the single source described by the
+// top level fields when it is empty. It returns nil when there is nothing to
+// collect.
+func (s *ServerLogSpec) EffectiveSources() []LogSource {
+	if len(s.Sources) > 0 {
+		return s.Sources
+	}
+	if s.Dir == "" {
+		return nil
+	}
+	return []LogSource{{
+		Name:              "default",
+		Dir:               s.Dir,
+		FileFilter:        s.FileFilter,
+		Pattern:           s.Pattern,
+		MultilineNegate:   s.MultilineNegate,
+		MultilineMaxLines: s.MultilineMaxLines,
+		MultilineTimeout:  s.MultilineTimeout,
+		Parsers:           s.Parsers,
+	}}
+}
+
+// ParserType is the format a Parser reads.
+type ParserType string
+
+const (
+	ParserJSON   ParserType = "json"
+	ParserLogfmt ParserType = "logfmt"
+	// ParserRegex extracts the named groups of a regular expression.
+	ParserRegex ParserType = "regex"
+	// ParserGrok extracts the fields of a grok pattern, e.g.
+	// "%{IP:client} %{WORD:method} %{URIPATHPARAM:path}".
+	ParserGrok ParserType = "grok"
+)
+
+// Parser configures one stage of the parser pipeline of a ServerLog.
+type Parser struct {
+	// +kubebuilder:validation:Enum=json;logfmt;regex;grok
+	Type ParserType `json:"type"`
+	// Expression is the regular expression of a regex parser or the pattern
+	// of a grok parser.
+	// +optional
+	Expression string `json:"expression,omitempty"`
+	// Patterns defines additional grok patterns by name.
+	// +optional
+	Patterns map[string]string `json:"patterns,omitempty"`
+	// Source is the field parsed, defaults to the raw message.
+	// +optional
+	Source string `json:"source,omitempty"`
+	// TimeKey is the field holding the timestamp of the record. The time the
+	// line was read is used when it is empty.
+	// +optional
+	TimeKey string `json:"timeKey,omitempty"`
+	// TimeFormat is the Go layout of TimeKey, e.g. "2006-01-02 15:04:05.000",
+	// or one of unix, unix_ms and unix_ns. Defaults to RFC3339.
+	// +optional
+	TimeFormat string `json:"timeFormat,omitempty"`
+	// Timezone is the IANA zone of timestamps without an offset, defaults to UTC.
+	// +optional
+	Timezone string `json:"timezone,omitempty"`
+	// SeverityKey is the field holding the level of the record.
+	// +optional
+	SeverityKey string `json:"severityKey,omitempty"`
 }
 
 // ServerLogStatus defines the observed state of ServerLog
@@ -39,7 +199,151 @@ type ServerLogStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	Phase ServerLogPhase `json:"phase,omitempty"`
+	// ObservedGeneration is the generation of the spec the status was
+	// computed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// HostPath is the directory on the node the first source is read from.
+	// +optional
+	HostPath string `json:"hostPath,omitempty"`
+	// Sources are the directories on the node of the sources, resolved by
+	// the controller from the volume mounts of the Pod. The agent only reads
+	// the sources with a HostPath.
+	// +optional
+	Sources []SourceStatus `json:"sources,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Files are the files being read, at most MaxFileStatuses, those
+	// lagging most behind first.
+	// +optional
+	Files []FileStatus `json:"files,omitempty"`
+	// Lag is the number of bytes of all files not shipped yet.
+	// +optional
+	Lag int64 `json:"lag,omitempty"`
+	// LinesShipped and BytesShipped count the records the outputs accepted.
+	// +optional
+	LinesShipped int64 `json:"linesShipped,omitempty"`
+	// +optional
+	BytesShipped int64 `json:"bytesShipped,omitempty"`
+	// LastError is the last error reading the files or shipping the records.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// MaxFileStatuses bounds the files listed in the status of a ServerLog.
+const MaxFileStatuses = 10
+
+// FileStatus is the progress of the agent in one file.
+type FileStatus struct {
+	// Path is the path of the file on the node.
+	Path string `json:"path"`
+	// Offset is the byte offset up to which records were shipped.
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+	// Lag is the number of bytes not shipped yet.
+	Lag int64 `json:"lag"`
+}
+
+// SourceStatus is where a source of a ServerLog is found on the node.
+type SourceStatus struct {
+	Name string `json:"name"`
+	// Dir is the directory in the container HostPath was resolved for.
+	Dir string `json:"dir"`
+	// HostPath is empty when Dir is not on a volume that can be read from
+	// the node.
+	// +optional
+	HostPath string `json:"hostPath,omitempty"`
+	// VolumeRoot is the directory on the node of the volume holding
+	// HostPath. The Pod controls everything below it, so the agent does not
+	// follow symlinks there.
+	// +optional
+	VolumeRoot string `json:"volumeRoot,omitempty"`
+}
+
+// HostPathOf returns the directory on the node of source, empty if it is
+// not resolved for the current Dir of the source.
+func (s *ServerLogStatus) HostPathOf(source LogSource) string {
+	for _, status := range s.Sources {
+		if status.Name == source.Name && status.Dir == source.Dir {
+			return status.HostPath
+		}
+	}
+	return ""
+}
+
+// VolumeRootOf returns the directory on the node of the volume holding the
+// directory of source, empty as HostPathOf.
+func (s *ServerLogStatus) VolumeRootOf(source LogSource) string {
+	for _, status := range s.Sources {
+		if status.Name == source.Name && status.Dir == source.Dir {
+			return status.VolumeRoot
+		}
+	}
+	return ""
 }
+
+const (
+	// ConditionVolumeBacked tells whether every source is on a volume the
+	// agent can read from the node.
+	ConditionVolumeBacked = "VolumeBacked"
+
+	ReasonResolved = "Resolved"
+	// ReasonNotVolumeBacked is set when a directory is in the container
+	// filesystem, which the agent cannot find on the node.
+	ReasonNotVolumeBacked = "NotVolumeBacked"
+	// ReasonVolumeUnresolved is set when a directory is on a volume whose
+	// path on the node is unknown, e.g. an unbound claim or a configMap.
+	ReasonVolumeUnresolved = "VolumeUnresolved"
+	// ReasonSensitiveHostPath is set when a directory is on a hostPath or
+	// local volume whose path on the node is a sensitive directory, e.g.
+	// /etc.
+	ReasonSensitiveHostPath = "SensitiveHostPath"
+
+	// ConditionScheduled tells whether the Pod runs on a node, set by the
+	// controller.
+	ConditionScheduled = "Scheduled"
+	// ConditionSourcesValid tells whether the sources annotation of the Pod
+	// is valid, set by the controller. The controller ignores an invalid
+	// one.
+	ConditionSourcesValid = "SourcesValid"
+	// ConditionCollecting tells whether the agent reads files, set by the
+	// agent like the conditions below.
+	ConditionCollecting = "Collecting"
+	// ConditionSinkHealthy tells whether the output accepts the records.
+	ConditionSinkHealthy = "SinkHealthy"
+	// ConditionDrained is set once the ServerLog is deleted, True when
+	// everything left in the files was shipped.
+	ConditionDrained = "Drained"
+
+	ReasonScheduled         = "Scheduled"
+	ReasonUnscheduled       = "Unscheduled"
+	ReasonValidSources      = "ValidSources"
+	ReasonInvalidSources    = "InvalidSources"
+	ReasonReading           = "Reading"
+	ReasonNoHostPath        = "NoHostPath"
+	ReasonOutputUnavailable = "OutputUnavailable"
+	ReasonDelivering        = "Delivering"
+	ReasonWriteFailed       = "WriteFailed"
+	ReasonDrained           = "Drained"
+	ReasonDrainTimeout      = "DrainTimeout"
+	ReasonDrainFailed       = "DrainFailed"
+	// ReasonPolicyViolation is set when a LogCollectionPolicy does not
+	// allow the dirs or the output of the ServerLog. The controller sets it
+	// on the VolumeBacked condition of a dir whose path on the node is not
+	// allowed.
+	ReasonPolicyViolation = "PolicyViolation"
+
+	// ConditionThrottled tells whether lines waited for the rate limit
+	// since the status was last reported.
+	ConditionThrottled = "Throttled"
+
+	ReasonRateLimited = "RateLimited"
+	ReasonWithinLimit = "WithinLimit"
+	ReasonUnlimited   = "Unlimited"
+)
+
 type ServerLogPhase string
 
 // These are the valid statuses of pods.
@@ -49,10 +353,15 @@ const (
 	ServerLogCompleted ServerLogPhase = "Completed"
 )
 
+// +genclient
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:shortName={sl}
 // +kubebuilder:printcolumn:JSONPath=".status.phase",name="status",type="string"
+// +kubebuilder:printcolumn:JSONPath=".spec.nodeName",name="Node",type="string"
+// +kubebuilder:printcolumn:JSONPath=".status.lag",name="Lag",type="integer",description="Bytes not shipped yet"
+// +kubebuilder:printcolumn:JSONPath=".status.linesShipped",name="Lines",type="integer",priority=1
+// +kubebuilder:printcolumn:JSONPath=".status.hostPath",name="HostPath",type="string",priority=1
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 // +kubebuilder:storageversion
 
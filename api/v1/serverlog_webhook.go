@@ -17,64 +17,416 @@ limitations under the License.
 package v1
 
 import (
-	"errors"
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/yshaojie/log-collector/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
-	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 // log is for logging in this package.
 var serverloglog = logf.Log.WithName("serverlog-resource")
 
-func (r *ServerLog) SetupWebhookWithManager(mgr ctrl.Manager) error {
+// sensitiveDirs are host directories no ServerLog may collect, nor any
+// directory under them. "/" itself is only rejected as a whole.
+var sensitiveDirs = []string{
+	"/boot",
+	"/dev",
+	"/etc",
+	"/proc",
+	"/root",
+	"/run/secrets",
+	"/sys",
+	"/var/lib/kubelet",
+	"/var/run/secrets",
+}
+
+// WebhookOptions configures the ServerLog webhooks.
+// +kubebuilder:object:generate=false
+type WebhookOptions struct {
+	// ControllerUsername is the user the controller runs as, the only one
+	// allowed to change Spec.NodeName of a ServerLog.
+	ControllerUsername string
+}
+
+const (
+	// DefaultDir and DefaultFileFilter are filled in on a ServerLog without
+	// sources when neither it nor the configured defaults set them.
+	DefaultDir        = "/data/log"
+	DefaultFileFilter = "*.log"
+)
+
+func (r *ServerLog) SetupWebhookWithManager(mgr ctrl.Manager, opts WebhookOptions) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
+		WithDefaulter(NewServerLogDefaulter(mgr.GetClient())).
+		WithValidator(NewServerLogValidator(mgr.GetClient(), opts)).
 		Complete()
 }
 
-// TODO(user): EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
+// The webhooks match v1 requests only, v2 has its own.
+//+kubebuilder:webhook:path=/mutate-log-4yxy-io-v1-serverlog,mutating=true,failurePolicy=fail,sideEffects=None,groups=log.4yxy.io,resources=serverlogs,verbs=create;update,versions=v1,name=mserverlog.kb.io,admissionReviewVersions=v1,matchPolicy=Exact
 
-//+kubebuilder:webhook:path=/mutate-log-4yxy-io-v1-serverlog,mutating=true,failurePolicy=fail,sideEffects=None,groups=log.4yxy.io,resources=serverlogs,verbs=create;update,versions=v1,name=mserverlog.kb.io,admissionReviewVersions=v1
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
-var _ webhook.Defaulter = &ServerLog{}
+// serverLogDefaulter fills in the settings a ServerLog does not set from the
+// default annotations of its namespace, the defaults of the
+// LogCollectorConfig and the built in defaults, in that order.
+type serverLogDefaulter struct {
+	reader client.Reader
+}
 
-// Default implements webhook.Defaulter so a webhook will be registered for the type
-func (r *ServerLog) Default() {
+var _ admission.CustomDefaulter = &serverLogDefaulter{}
+
+// NewServerLogDefaulter returns the defaulter of the ServerLog webhook,
+// reading the LogCollectorConfig and the namespaces with reader.
+func NewServerLogDefaulter(reader client.Reader) admission.CustomDefaulter {
+	return &serverLogDefaulter{reader: reader}
+}
+
+// Default implements admission.CustomDefaulter.
+func (d *serverLogDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	r, ok := obj.(*ServerLog)
+	if !ok {
+		return fmt.Errorf("expected a ServerLog but got %T", obj)
+	}
 	serverloglog.Info("default", "name", r.Name)
 
-	// TODO(user): fill in your defaulting logic.
+	var defaults ServerLogDefaults
+	var config LogCollectorConfig
+	err := d.reader.Get(ctx, client.ObjectKey{Name: LogCollectorConfigName}, &config)
+	switch {
+	case err == nil:
+		if config.Spec.Defaults != nil {
+			defaults = *config.Spec.Defaults
+		}
+	case !apierrors.IsNotFound(err):
+		return err
+	}
+	if r.Namespace != "" {
+		var ns corev1.Namespace
+		err := d.reader.Get(ctx, client.ObjectKey{Name: r.Namespace}, &ns)
+		switch {
+		case err == nil:
+			defaults = namespaceDefaults(defaults, ns.Annotations)
+		case !apierrors.IsNotFound(err):
+			return err
+		}
+	}
+	r.SetDefaults(defaults)
+	return nil
 }
 
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
-//+kubebuilder:webhook:path=/validate-log-4yxy-io-v1-serverlog,mutating=false,failurePolicy=fail,sideEffects=None,groups=log.4yxy.io,resources=serverlogs,verbs=create;update,versions=v1,name=vserverlog.kb.io,admissionReviewVersions=v1
+// namespaceDefaults returns defaults with the default annotations of a
+// namespace set on it. A pattern annotation clears MultilineNegate.
+func namespaceDefaults(defaults ServerLogDefaults, annotations map[string]string) ServerLogDefaults {
+	if value := annotations[utils.AnnotationDefaultDir]; value != "" {
+		defaults.Dir = value
+	}
+	if value := annotations[utils.AnnotationDefaultFileFilter]; value != "" {
+		defaults.FileFilter = value
+	}
+	if value := annotations[utils.AnnotationDefaultPattern]; value != "" {
+		defaults.Pattern, defaults.MultilineNegate = value, false
+	}
+	if value := annotations[utils.AnnotationDefaultOutput]; value != "" {
+		defaults.Output = value
+	}
+	return defaults
+}
 
-var _ webhook.Validator = &ServerLog{}
+// Default fills in the built in defaults of the settings r does not set.
+func (r *ServerLog) Default() {
+	r.SetDefaults(ServerLogDefaults{})
+}
 
-// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
-func (r *ServerLog) ValidateCreate() (admission.Warnings, error) {
+// SetDefaults fills in the settings r does not set from defaults, then from
+// the built in defaults. A ServerLog with sources only gets the output.
+func (r *ServerLog) SetDefaults(defaults ServerLogDefaults) {
+	spec := &r.Spec
+	if spec.Output == "" {
+		spec.Output = defaults.Output
+	}
+	if len(spec.Sources) > 0 {
+		return
+	}
+	if spec.Dir == "" {
+		spec.Dir = defaults.Dir
+	}
+	if spec.Dir == "" {
+		spec.Dir = DefaultDir
+	}
+	if spec.FileFilter == "" {
+		spec.FileFilter = defaults.FileFilter
+	}
+	if spec.FileFilter == "" {
+		spec.FileFilter = DefaultFileFilter
+	}
+	if spec.Pattern == "" && defaults.Pattern != "" {
+		spec.Pattern, spec.MultilineNegate = defaults.Pattern, defaults.MultilineNegate
+	}
+	if spec.MultilineMaxLines == 0 {
+		spec.MultilineMaxLines = defaults.MultilineMaxLines
+	}
+	if spec.MultilineTimeout == nil && defaults.MultilineTimeout != nil {
+		spec.MultilineTimeout = defaults.MultilineTimeout.DeepCopy()
+	}
+	if len(spec.Parsers) == 0 && len(defaults.Parsers) > 0 {
+		spec.Parsers = defaults.DeepCopy().Parsers
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-log-4yxy-io-v1-serverlog,mutating=false,failurePolicy=fail,sideEffects=None,groups=log.4yxy.io,resources=serverlogs,verbs=create;update,versions=v1,name=vserverlog.kb.io,admissionReviewVersions=v1,matchPolicy=Exact
+//+kubebuilder:rbac:groups=log.4yxy.io,resources=logcollectionpolicies,verbs=get;list;watch
+
+// ServerLogValidator rejects ServerLogs collecting directories that are not
+// clean absolute paths or are sensitive on the host, with invalid file
+// filters or patterns, and NodeName changes by anyone but the controller.
+// ServerLogs must satisfy the LogCollectionPolicies of their namespace.
+// +kubebuilder:object:generate=false
+type ServerLogValidator struct {
+	controllerUsername string
+	reader             client.Reader
+}
+
+var _ admission.CustomValidator = &ServerLogValidator{}
+
+// NewServerLogValidator returns the validator of the ServerLog webhook,
+// reading the LogCollectionPolicies and the ServerLogs with reader.
+func NewServerLogValidator(reader client.Reader, opts WebhookOptions) *ServerLogValidator {
+	return &ServerLogValidator{controllerUsername: opts.ControllerUsername, reader: reader}
+}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *ServerLogValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	r, ok := obj.(*ServerLog)
+	if !ok {
+		return nil, fmt.Errorf("expected a ServerLog but got %T", obj)
+	}
 	serverloglog.Info("validate create", "name", r.Name)
-	return r.validateCommonField()
+	errs, err := v.Validate(ctx, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	return nil, r.invalid(errs)
 }
 
-// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
-func (r *ServerLog) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+// ValidateUpdate implements admission.CustomValidator.
+func (v *ServerLogValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	r, ok := newObj.(*ServerLog)
+	if !ok {
+		return nil, fmt.Errorf("expected a ServerLog but got %T", newObj)
+	}
+	old, ok := oldObj.(*ServerLog)
+	if !ok {
+		return nil, fmt.Errorf("expected a ServerLog but got %T", oldObj)
+	}
 	serverloglog.Info("validate update", "name", r.Name)
-	return r.validateCommonField()
+	errs, err := v.Validate(ctx, r, old)
+	if err != nil {
+		return nil, err
+	}
+	return nil, r.invalid(errs)
 }
 
-func (r *ServerLog) validateCommonField() (admission.Warnings, error) {
-	if len(r.Spec.Dir) < 2 {
-		return admission.Warnings{"waring1...", "waring2..."}, errors.New("spec.dir length< 2")
+// Validate returns the invalid fields of r, old is nil when r is created.
+// The error is set when r cannot be checked or, on create, the namespace
+// has as many ServerLogs as a policy allows. Updates of a ServerLog being
+// deleted and updates leaving the spec as it is, such as the finalizer being
+// removed, are not checked again, so a ServerLog that became invalid, e.g.
+// by a new policy, can still be labelled and deleted.
+func (v *ServerLogValidator) Validate(ctx context.Context, r, old *ServerLog) (field.ErrorList, error) {
+	if old != nil && (!r.DeletionTimestamp.IsZero() || equality.Semantic.DeepEqual(old.Spec, r.Spec)) {
+		return nil, nil
 	}
-	return admission.Warnings{"new server log"}, nil
+	policies, err := v.policiesOf(ctx, r.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if old == nil {
+		if err := v.checkCount(ctx, r, policies); err != nil {
+			return nil, err
+		}
+	}
+	errs := append(r.validateSpec(), violations(r, policies)...)
+	if old != nil && r.Spec.NodeName != old.Spec.NodeName && !v.fromController(ctx) {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "nodeName"), "only the controller may change the node"))
+	}
+	return errs, nil
 }
 
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
-func (r *ServerLog) ValidateDelete() (admission.Warnings, error) {
-	serverloglog.Info("validate delete", "name", r.Name)
-
-	// TODO(user): fill in your validation logic upon object deletion.
+// ValidateDelete implements admission.CustomValidator.
+func (v *ServerLogValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
 	return nil, nil
 }
+
+// policiesOf returns the LogCollectionPolicies selecting namespace.
+func (v *ServerLogValidator) policiesOf(ctx context.Context, namespace string) ([]LogCollectionPolicy, error) {
+	var policies LogCollectionPolicyList
+	if err := v.reader.List(ctx, &policies); err != nil {
+		return nil, err
+	}
+	var selecting []LogCollectionPolicy
+	for _, policy := range policies.Items {
+		if policy.Spec.Namespaces.Selects(namespace) {
+			selecting = append(selecting, policy)
+		}
+	}
+	return selecting, nil
+}
+
+// checkCount returns a Forbidden error when the namespace of r already has
+// as many ServerLogs as one of policies allows.
+func (v *ServerLogValidator) checkCount(ctx context.Context, r *ServerLog, policies []LogCollectionPolicy) error {
+	var serverLogs *ServerLogList
+	for _, policy := range policies {
+		max := int(policy.Spec.MaxServerLogsPerNamespace)
+		if max <= 0 {
+			continue
+		}
+		if serverLogs == nil {
+			serverLogs = &ServerLogList{}
+			if err := v.reader.List(ctx, serverLogs, client.InNamespace(r.Namespace)); err != nil {
+				return err
+			}
+		}
+		if len(serverLogs.Items) >= max {
+			return apierrors.NewForbidden(GroupVersion.WithResource("serverlogs").GroupResource(), r.Name,
+				fmt.Errorf("namespace %s has %d ServerLogs, policy %s allows %d", r.Namespace, len(serverLogs.Items), policy.Name, max))
+		}
+	}
+	return nil
+}
+
+// violations returns the fields of r the policies do not allow.
+func violations(r *ServerLog, policies []LogCollectionPolicy) field.ErrorList {
+	var errs field.ErrorList
+	for i := range policies {
+		errs = append(errs, policies[i].Violations(&r.Spec)...)
+	}
+	return errs
+}
+
+// fromController reports whether the request was sent by the controller.
+func (v *ServerLogValidator) fromController(ctx context.Context) bool {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return false
+	}
+	return v.controllerUsername != "" && req.UserInfo.Username == v.controllerUsername
+}
+
+// invalid returns errs as the Invalid error of r, nil when it is empty.
+func (r *ServerLog) invalid(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("ServerLog").GroupKind(), r.Name, errs)
+}
+
+func (r *ServerLog) validateSpec() field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+	if len(r.Spec.Sources) == 0 {
+		if r.Spec.Dir == "" {
+			errs = append(errs, field.Required(specPath.Child("dir"), "a dir or sources are required"))
+		} else {
+			errs = append(errs, validateDir(specPath.Child("dir"), r.Spec.Dir)...)
+		}
+		errs = append(errs, validateFileFilter(specPath.Child("fileFilter"), r.Spec.FileFilter)...)
+		errs = append(errs, validatePattern(specPath.Child("pattern"), r.Spec.Pattern)...)
+	}
+	names := map[string]bool{}
+	for i := range r.Spec.Sources {
+		source := &r.Spec.Sources[i]
+		sourcePath := specPath.Child("sources").Index(i)
+		if names[source.Name] {
+			errs = append(errs, field.Duplicate(sourcePath.Child("name"), source.Name))
+		}
+		names[source.Name] = true
+		if !source.IsContainerStdout() {
+			if source.Dir == "" {
+				errs = append(errs, field.Required(sourcePath.Child("dir"), "a dir is required unless the type is "+string(SourceContainerStdout)))
+			} else {
+				errs = append(errs, validateDir(sourcePath.Child("dir"), source.Dir)...)
+			}
+		}
+		errs = append(errs, validateFileFilter(sourcePath.Child("fileFilter"), source.FileFilter)...)
+		errs = append(errs, validatePattern(sourcePath.Child("pattern"), source.Pattern)...)
+	}
+	return errs
+}
+
+// validateDir checks that dir is a clean absolute path outside of the
+// sensitive directories of the host.
+func validateDir(fldPath *field.Path, dir string) field.ErrorList {
+	if !path.IsAbs(dir) {
+		return field.ErrorList{field.Invalid(fldPath, dir, "must be an absolute path")}
+	}
+	for _, element := range strings.Split(dir, "/") {
+		if element == ".." {
+			return field.ErrorList{field.Invalid(fldPath, dir, "must not contain '..'")}
+		}
+	}
+	if path.Clean(dir) != dir {
+		return field.ErrorList{field.Invalid(fldPath, dir, "must be a clean path, "+path.Clean(dir))}
+	}
+	if dir == "/" {
+		return field.ErrorList{field.Forbidden(fldPath, "the root directory must not be collected")}
+	}
+	if sensitive := SensitiveDir(dir); sensitive != "" {
+		return field.ErrorList{field.Forbidden(fldPath, sensitive+" is a sensitive directory and must not be collected")}
+	}
+	return nil
+}
+
+// SensitiveDir returns the sensitive directory of the host dir is, or is
+// under, "" if there is none. The root directory is sensitive only as a
+// whole. The controller checks the paths on the node with it too, which a
+// hostPath volume may put anywhere.
+func SensitiveDir(dir string) string {
+	if dir == "/" {
+		return dir
+	}
+	for _, sensitive := range sensitiveDirs {
+		if dir == sensitive || strings.HasPrefix(dir, sensitive+"/") {
+			return sensitive
+		}
+	}
+	return ""
+}
+
+func validateFileFilter(fldPath *field.Path, filter string) field.ErrorList {
+	if filter == "" {
+		return nil
+	}
+	if strings.Contains(filter, "/") {
+		return field.ErrorList{field.Invalid(fldPath, filter, "must match file names, without '/'")}
+	}
+	if _, err := filepath.Match(filter, ""); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, filter, "must be a valid glob: "+err.Error())}
+	}
+	return nil
+}
+
+func validatePattern(fldPath *field.Path, pattern string) field.ErrorList {
+	if pattern == "" {
+		return nil
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, pattern, "must be a valid regular expression: "+err.Error())}
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package v1
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yshaojie/log-collector/pkg/utils"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const testController = "system:serviceaccount:log-collector-system:controller"
+
+// newReader returns a fake client holding objs.
+func newReader(t *testing.T, objs ...client.Object) client.Reader {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func newServerLog(spec ServerLogSpec) *ServerLog {
+	return &ServerLog{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-0"}, Spec: spec}
+}
+
+// causes returns the fields of the Invalid error err.
+func causes(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	status, ok := err.(apierrors.APIStatus)
+	if !ok || !apierrors.IsInvalid(err) {
+		t.Fatalf("expected an Invalid error, got %v", err)
+	}
+	var fields []string
+	for _, cause := range status.Status().Details.Causes {
+		fields = append(fields, cause.Field)
+	}
+	return fields
+}
+
+func TestValidateCreate(t *testing.T) {
+	tests := []struct {
+		name string
+		spec ServerLogSpec
+		want []string
+	}{
+		{name: "valid", spec: ServerLogSpec{Dir: "/data/log", FileFilter: "*.log", Pattern: `^\d{4}-`}},
+		{name: "no dir", spec: ServerLogSpec{}, want: []string{"spec.dir"}},
+		{name: "relative", spec: ServerLogSpec{Dir: "data/log"}, want: []string{"spec.dir"}},
+		{name: "parent", spec: ServerLogSpec{Dir: "/data/../etc"}, want: []string{"spec.dir"}},
+		{name: "unclean", spec: ServerLogSpec{Dir: "/data//log/"}, want: []string{"spec.dir"}},
+		{name: "root", spec: ServerLogSpec{Dir: "/"}, want: []string{"spec.dir"}},
+		{name: "sensitive", spec: ServerLogSpec{Dir: "/var/run/secrets/kubernetes.io"}, want: []string{"spec.dir"}},
+		{name: "similar prefix", spec: ServerLogSpec{Dir: "/etcd/log"}},
+		{name: "bad glob", spec: ServerLogSpec{Dir: "/data/log", FileFilter: "[a-"}, want: []string{"spec.fileFilter"}},
+		{name: "glob with dir", spec: ServerLogSpec{Dir: "/data/log", FileFilter: "app/*.log"}, want: []string{"spec.fileFilter"}},
+		{name: "bad pattern", spec: ServerLogSpec{Dir: "/data/log", Pattern: "(unclosed"}, want: []string{"spec.pattern"}},
+		{
+			name: "sources",
+			spec: ServerLogSpec{Sources: []LogSource{
+				{Name: "app", Dir: "/data/log"},
+				{Name: "app", Dir: "/proc"},
+				{Name: "out", Type: SourceContainerStdout, Pattern: "["},
+				{Name: "none"},
+			}},
+			want: []string{"spec.sources[1].name", "spec.sources[1].dir", "spec.sources[2].pattern", "spec.sources[3].dir"},
+		},
+	}
+	v := &ServerLogValidator{controllerUsername: testController, reader: newReader(t)}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.ValidateCreate(context.Background(), newServerLog(tt.spec))
+			got := causes(t, err)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("invalid fields %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateUpdateNodeName(t *testing.T) {
+	old := newServerLog(ServerLogSpec{Dir: "/data/log", NodeName: "node-1"})
+	moved := old.DeepCopy()
+	moved.Spec.NodeName = "node-2"
+	v := &ServerLogValidator{controllerUsername: testController, reader: newReader(t)}
+
+	asUser := func(username string) context.Context {
+		return admission.NewContextWithRequest(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{UserInfo: authenticationv1.UserInfo{Username: username}},
+		})
+	}
+	if _, err := v.ValidateUpdate(asUser("alice"), old, moved); strings.Join(causes(t, err), ",") != "spec.nodeName" {
+		t.Errorf("a user moved the server log: %v", err)
+	}
+	if _, err := v.ValidateUpdate(asUser(testController), old, moved); err != nil {
+		t.Errorf("the controller must move the server log: %v", err)
+	}
+	unchanged := old.DeepCopy()
+	unchanged.Labels = map[string]string{"app": "web"}
+	if _, err := v.ValidateUpdate(asUser("alice"), old, unchanged); err != nil {
+		t.Errorf("other updates are allowed: %v", err)
+	}
+}
+
+func TestValidateUpdateDeleting(t *testing.T) {
+	policy := &LogCollectionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "restricted"},
+		Spec:       LogCollectionPolicySpec{AllowedOutputs: []string{"es"}},
+	}
+	v := &ServerLogValidator{controllerUsername: testController, reader: newReader(t, policy)}
+	//策略创建之前就存在的ServerLog
+	old := newServerLog(ServerLogSpec{Dir: "/data/log", Output: "kafka", NodeName: "node-1"})
+	old.Finalizers = []string{utils.FinalizerNameAgentHolder}
+
+	deleting := old.DeepCopy()
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	deleting.Spec.Dir = "/etc"
+	if _, err := v.ValidateUpdate(context.Background(), old, deleting); err != nil {
+		t.Errorf("update of a deleted server log was rejected: %v", err)
+	}
+}
+
+func TestValidateUpdateUnchangedSpec(t *testing.T) {
+	policy := &LogCollectionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "restricted"},
+		Spec:       LogCollectionPolicySpec{AllowedOutputs: []string{"es"}},
+	}
+	v := &ServerLogValidator{controllerUsername: testController, reader: newReader(t, policy)}
+	//策略创建之前就存在的ServerLog
+	old := newServerLog(ServerLogSpec{Dir: "/data/log", Output: "kafka", NodeName: "node-1"})
+	old.Finalizers = []string{utils.FinalizerNameAgentHolder}
+
+	unfinalized := old.DeepCopy()
+	unfinalized.Finalizers = nil
+	if _, err := v.ValidateUpdate(context.Background(), old, unfinalized); err != nil {
+		t.Errorf("removing the finalizer was rejected: %v", err)
+	}
+	changed := old.DeepCopy()
+	changed.Spec.FileFilter = "*.txt"
+	_, err := v.ValidateUpdate(context.Background(), old, changed)
+	if got := causes(t, err); strings.Join(got, ",") != "spec.output" {
+		t.Errorf("invalid fields %v after a spec change, want spec.output", got)
+	}
+}
+
+func newDefaulter(t *testing.T, objs ...client.Object) *serverLogDefaulter {
+	return &serverLogDefaulter{reader: newReader(t, objs...)}
+}
+
+func TestDefaultBuiltin(t *testing.T) {
+	r := newServerLog(ServerLogSpec{})
+	if err := newDefaulter(t).Default(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	want := ServerLogSpec{Dir: DefaultDir, FileFilter: DefaultFileFilter}
+	if !reflect.DeepEqual(r.Spec, want) {
+		t.Errorf("defaulted to %+v, want %+v", r.Spec, want)
+	}
+}
+
+func TestDefaultFromConfigAndNamespace(t *testing.T) {
+	config := &LogCollectorConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: LogCollectorConfigName},
+		Spec: LogCollectorConfigSpec{Defaults: &ServerLogDefaults{
+			Dir:               "/app/logs",
+			FileFilter:        "*.txt",
+			Pattern:           `^\s`,
+			MultilineNegate:   true,
+			MultilineMaxLines: 100,
+			MultilineTimeout:  &metav1.Duration{Duration: time.Second},
+			Output:            "cluster",
+			Parsers:           []Parser{{Type: ParserJSON}},
+		}},
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Annotations: map[string]string{
+		utils.AnnotationDefaultPattern: `^\d{4}-`,
+		utils.AnnotationDefaultOutput:  "team",
+	}}}
+	d := newDefaulter(t, config, ns)
+
+	r := newServerLog(ServerLogSpec{FileFilter: "app.log"})
+	if err := d.Default(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	want := ServerLogSpec{
+		Dir:               "/app/logs",
+		FileFilter:        "app.log",
+		Pattern:           `^\d{4}-`,
+		MultilineMaxLines: 100,
+		MultilineTimeout:  &metav1.Duration{Duration: time.Second},
+		Output:            "team",
+		Parsers:           []Parser{{Type: ParserJSON}},
+	}
+	if !reflect.DeepEqual(r.Spec, want) {
+		t.Errorf("defaulted to %+v, want %+v", r.Spec, want)
+	}
+
+	// the settings of sources are left alone
+	sources := []LogSource{{Name: "app", Dir: "/data/log"}}
+	r = newServerLog(ServerLogSpec{Sources: sources})
+	if err := d.Default(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	want = ServerLogSpec{Output: "team", Sources: sources}
+	if !reflect.DeepEqual(r.Spec, want) {
+		t.Errorf("defaulted to %+v, want %+v", r.Spec, want)
+	}
+}
+
+func TestValidatePolicies(t *testing.T) {
+	maxBytes := resource.MustParse("1Mi")
+	overBytes := resource.MustParse("2Mi")
+	policy := &LogCollectionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "restricted"},
+		Spec: LogCollectionPolicySpec{
+			AllowedPathPrefixes:       []string{"/data/log/"},
+			AllowedOutputs:            []string{"es"},
+			MaxRate:                   &RateLimit{LinesPerSecond: 100, BytesPerSecond: &maxBytes},
+			MaxServerLogsPerNamespace: 2,
+		},
+	}
+	other := &LogCollectionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "other"},
+		Spec: LogCollectionPolicySpec{
+			Namespaces:     NamespaceSelection{Include: []string{"other"}},
+			AllowedOutputs: []string{"kafka"},
+		},
+	}
+	existing := newServerLog(ServerLogSpec{Dir: "/data/log"})
+	v := &ServerLogValidator{reader: newReader(t, policy, other, existing)}
+
+	tests := []struct {
+		name string
+		spec ServerLogSpec
+		want []string
+	}{
+		{name: "allowed", spec: ServerLogSpec{Dir: "/data/log/app", Output: "es", RateLimit: &RateLimit{LinesPerSecond: 100}}},
+		{name: "default output", spec: ServerLogSpec{Dir: "/data/log"}},
+		{name: "output", spec: ServerLogSpec{Dir: "/data/log", Output: "kafka"}, want: []string{"spec.output"}},
+		{
+			name: "rate",
+			spec: ServerLogSpec{Dir: "/data/log", RateLimit: &RateLimit{LinesPerSecond: 101, BytesPerSecond: &overBytes}},
+			want: []string{"spec.rateLimit.linesPerSecond", "spec.rateLimit.bytesPerSecond"},
+		},
+		// the prefixes are checked once the dirs are resolved on the node
+		{name: "dir", spec: ServerLogSpec{Dir: "/tmp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newServerLog(tt.spec)
+			r.Name = "web-1"
+			_, err := v.ValidateCreate(context.Background(), r)
+			got := causes(t, err)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("invalid fields %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// the namespace may have a second ServerLog, but not a third
+	named := func(name string) *ServerLog {
+		r := newServerLog(ServerLogSpec{Dir: "/data/log"})
+		r.Name = name
+		return r
+	}
+	full := &ServerLogValidator{reader: newReader(t, policy, existing, named("web-1"))}
+	if _, err := full.ValidateCreate(context.Background(), named("web-2")); !apierrors.IsForbidden(err) {
+		t.Errorf("created a ServerLog over the maximum of the namespace: %v", err)
+	}
+	// updates of existing ServerLogs are not counted
+	if _, err := full.ValidateUpdate(context.Background(), existing, existing); err != nil {
+		t.Errorf("update in a full namespace: %v", err)
+	}
+}
+
+func TestCheckHostPath(t *testing.T) {
+	policy := &LogCollectionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "restricted"},
+		Spec:       LogCollectionPolicySpec{AllowedPathPrefixes: []string{"/var/lib/kubelet/pods/", "/data/log"}},
+	}
+	tests := map[string]bool{
+		"/var/lib/kubelet/pods/uid/volumes/kubernetes.io~empty-dir/logs": true,
+		"/data/log":     true,
+		"/data/log/app": true,
+		"/data/logs":    false,
+		"/etc":          false,
+	}
+	for hostPath, allowed := range tests {
+		if err := policy.CheckHostPath(hostPath); (err == nil) != allowed {
+			t.Errorf("%s: got %v, want allowed %v", hostPath, err, allowed)
+		}
+	}
+	if err := (&LogCollectionPolicy{}).CheckHostPath("/etc"); err != nil {
+		t.Errorf("a policy without prefixes allows any path: %v", err)
+	}
+}
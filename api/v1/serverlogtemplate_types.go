@@ -0,0 +1,66 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ServerLogTemplateSpec describes the sources of the Pods it selects.
+type ServerLogTemplateSpec struct {
+	// Selector selects the Pods of the namespace the template applies to,
+	// an empty selector selects every Pod.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// +kubebuilder:validation:MinItems=1
+	Sources []LogSource `json:"sources"`
+	// Output is set as the output of the ServerLogs when it is not empty.
+	// +optional
+	Output string `json:"output,omitempty"`
+	// RateLimit is set as the rate limit of the ServerLogs when it is not nil.
+	// +optional
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+}
+
+// +genclient
+// +genclient:noStatus
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName={slt}
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ServerLogTemplate is the Schema for the serverlogtemplates API. The
+// ServerLog of an opted in Pod without a sources annotation takes its sources
+// from the first template, by name, selecting the Pod.
+type ServerLogTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ServerLogTemplateSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ServerLogTemplateList contains a list of ServerLogTemplate
+type ServerLogTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ServerLogTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ServerLogTemplate{}, &ServerLogTemplateList{})
+}
@@ -99,7 +99,7 @@ var _ = BeforeSuite(func() {
 	})
 	Expect(err).NotTo(HaveOccurred())
 
-	err = (&ServerLog{}).SetupWebhookWithManager(mgr)
+	err = (&ServerLog{}).SetupWebhookWithManager(mgr, WebhookOptions{})
 	Expect(err).NotTo(HaveOccurred())
 
 	//+kubebuilder:scaffold:webhook
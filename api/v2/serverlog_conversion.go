@@ -1,47 +1,287 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
 package v2
 
 import (
+	"encoding/json"
+	"fmt"
+
 	v1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"sigs.k8s.io/controller-runtime/pkg/conversion"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 // 实现资源版本转换
 var serverloglog = logf.Log.WithName("serverlog-resource")
+
+// defaultSourceName is the name of the source v1 reads its top level
+// fields as.
+const defaultSourceName = "default"
+
 var _ conversion.Convertible = &ServerLog{}
 
+// v1Fields are the fields of a v1 ServerLog a v2 one cannot hold, kept in
+// the AnnotationV1Fields annotation of the v2 ServerLog.
+type v1Fields struct {
+	// Sources is set when the v1 ServerLog had a single source the v2 one
+	// would otherwise convert back to the top level fields.
+	Sources bool `json:"sources,omitempty"`
+	// Ignored are the top level fields of a v1 ServerLog with sources,
+	// which v1 ignores.
+	Ignored *v1.ServerLogSpec `json:"ignored,omitempty"`
+}
+
+// ConvertTo converts src to the v1 hub. A single source named default is
+// converted to the top level fields, unless the annotation tells it was a
+// source in v1.
 func (src *ServerLog) ConvertTo(dstRaw conversion.Hub) error {
 	dst := dstRaw.(*v1.ServerLog)
-	dst.Spec.Dir = src.Spec.Dir
-	dst.Spec.NodeName = src.Spec.NodeName
-	dst.ObjectMeta = src.ObjectMeta
-	switch src.Status.Phase {
-	case ServerLogInit:
-		dst.Status.Phase = v1.ServerLogPending
-	case ServerLogRunning:
-		dst.Status.Phase = v1.ServerLogRunning
-	case ServerLogCompleted:
-		dst.Status.Phase = v1.ServerLogCompleted
-	default:
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	var fields v1Fields
+	if value, ok := dst.Annotations[utils.AnnotationV1Fields]; ok {
+		if err := json.Unmarshal([]byte(value), &fields); err != nil {
+			return fmt.Errorf("annotation %s: %w", utils.AnnotationV1Fields, err)
+		}
+		delete(dst.Annotations, utils.AnnotationV1Fields)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+	}
+
+	spec := src.Spec.DeepCopy()
+	dst.Spec = v1.ServerLogSpec{}
+	//v1只在有source时忽略顶层字段
+	if fields.Ignored != nil && len(spec.Sources) > 0 {
+		setTopLevel(&dst.Spec, *fields.Ignored)
+	}
+	dst.Spec.NodeName = spec.NodeName
+	if spec.OutputRef != nil {
+		dst.Spec.Output = spec.OutputRef.Name
+	}
+	if spec.RateLimit != nil {
+		dst.Spec.RateLimit = &v1.RateLimit{
+			LinesPerSecond: spec.RateLimit.LinesPerSecond,
+			BytesPerSecond: spec.RateLimit.BytesPerSecond,
+		}
+	}
+	for _, source := range spec.Sources {
+		dst.Spec.Sources = append(dst.Spec.Sources, source.toV1())
+	}
+	if len(dst.Spec.Sources) == 1 && !fields.Sources && fields.Ignored == nil {
+		if topLevel, ok := folded(dst.Spec.Sources[0]); ok {
+			dst.Spec.Sources = nil
+			setTopLevel(&dst.Spec, topLevel)
+		}
+	}
+
+	status := src.Status.DeepCopy()
+	dst.Status = v1.ServerLogStatus{
+		Phase:              v1.ServerLogPhase(status.Phase),
+		ObservedGeneration: status.ObservedGeneration,
+		HostPath:           status.HostPath,
+		Conditions:         status.Conditions,
+		Lag:                status.Lag,
+		LinesShipped:       status.Shipped.Lines,
+		BytesShipped:       status.Shipped.Bytes,
+		LastError:          status.LastError,
+	}
+	if status.Phase == ServerLogInit {
 		dst.Status.Phase = v1.ServerLogPending
 	}
+	for _, source := range status.Sources {
+		dst.Status.Sources = append(dst.Status.Sources, v1.SourceStatus(source))
+	}
+	for _, file := range status.Files {
+		dst.Status.Files = append(dst.Status.Files, v1.FileStatus(file))
+	}
 	return nil
 }
 
+// ConvertFrom converts the v1 hub to dst. The top level fields of a v1
+// ServerLog without sources become a source named default.
 func (dst *ServerLog) ConvertFrom(srcRaw conversion.Hub) error {
 	src := srcRaw.(*v1.ServerLog)
-	dst.Spec.Dir = src.Spec.Dir
-	dst.Spec.NodeName = src.Spec.NodeName
-	dst.ObjectMeta = src.ObjectMeta
-	switch src.Status.Phase {
-	case v1.ServerLogPending:
-		dst.Status.Phase = ServerLogInit
-	case v1.ServerLogRunning:
-		dst.Status.Phase = ServerLogRunning
-	case v1.ServerLogCompleted:
-		dst.Status.Phase = ServerLogCompleted
-	default:
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	delete(dst.Annotations, utils.AnnotationV1Fields)
+
+	spec := src.Spec.DeepCopy()
+	dst.Spec = ServerLogSpec{NodeName: spec.NodeName}
+	if spec.Output != "" {
+		dst.Spec.OutputRef = &OutputReference{Name: spec.Output}
+	}
+	if spec.RateLimit != nil {
+		dst.Spec.RateLimit = &RateLimit{
+			LinesPerSecond: spec.RateLimit.LinesPerSecond,
+			BytesPerSecond: spec.RateLimit.BytesPerSecond,
+		}
+	}
+	var fields v1Fields
+	topLevel := v1.ServerLogSpec{}
+	setTopLevel(&topLevel, *spec)
+	hasTopLevel := !isZero(topLevel)
+	switch {
+	case len(spec.Sources) > 0:
+		for _, source := range spec.Sources {
+			dst.Spec.Sources = append(dst.Spec.Sources, sourceFromV1(source))
+		}
+		if len(spec.Sources) == 1 {
+			_, fields.Sources = folded(spec.Sources[0])
+		}
+		if hasTopLevel {
+			fields.Ignored = &topLevel
+		}
+	case hasTopLevel:
+		dst.Spec.Sources = []LogSource{sourceFromV1(v1.LogSource{
+			Name:              defaultSourceName,
+			Dir:               topLevel.Dir,
+			FileFilter:        topLevel.FileFilter,
+			Pattern:           topLevel.Pattern,
+			MultilineNegate:   topLevel.MultilineNegate,
+			MultilineMaxLines: topLevel.MultilineMaxLines,
+			MultilineTimeout:  topLevel.MultilineTimeout,
+			Parsers:           topLevel.Parsers,
+		})}
+	}
+	if fields.Sources || fields.Ignored != nil {
+		value, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[utils.AnnotationV1Fields] = string(value)
+	}
+
+	status := src.Status.DeepCopy()
+	dst.Status = ServerLogStatus{
+		Phase:              ServerLogPhase(status.Phase),
+		ObservedGeneration: status.ObservedGeneration,
+		HostPath:           status.HostPath,
+		Conditions:         status.Conditions,
+		Lag:                status.Lag,
+		Shipped:            ShippedStatus{Lines: status.LinesShipped, Bytes: status.BytesShipped},
+		LastError:          status.LastError,
+	}
+	if status.Phase == v1.ServerLogPending {
 		dst.Status.Phase = ServerLogInit
 	}
+	for _, source := range status.Sources {
+		dst.Status.Sources = append(dst.Status.Sources, SourceStatus(source))
+	}
+	for _, file := range status.Files {
+		dst.Status.Files = append(dst.Status.Files, FileStatus(file))
+	}
 	return nil
 }
+
+// folded returns the top level fields of v1 that are read as source. It
+// returns false when only a source can hold it: it is not named default,
+// reads the container output or sets none of the top level fields.
+func folded(source v1.LogSource) (v1.ServerLogSpec, bool) {
+	topLevel := v1.ServerLogSpec{
+		Dir:               source.Dir,
+		FileFilter:        source.FileFilter,
+		Pattern:           source.Pattern,
+		MultilineNegate:   source.MultilineNegate,
+		MultilineMaxLines: source.MultilineMaxLines,
+		MultilineTimeout:  source.MultilineTimeout,
+		Parsers:           source.Parsers,
+	}
+	if source.Name != defaultSourceName || source.Type != "" || len(source.Containers) > 0 {
+		return topLevel, false
+	}
+	return topLevel, !isZero(topLevel)
+}
+
+func isZero(spec v1.ServerLogSpec) bool {
+	return equality.Semantic.DeepEqual(spec, v1.ServerLogSpec{})
+}
+
+// setTopLevel sets the top level fields of spec, those describing a single
+// directory, to the ones of from.
+func setTopLevel(spec *v1.ServerLogSpec, from v1.ServerLogSpec) {
+	spec.Dir = from.Dir
+	spec.FileFilter = from.FileFilter
+	spec.Pattern = from.Pattern
+	spec.MultilineNegate = from.MultilineNegate
+	spec.MultilineMaxLines = from.MultilineMaxLines
+	spec.MultilineTimeout = from.MultilineTimeout
+	spec.Parsers = from.Parsers
+}
+
+func (s LogSource) toV1() v1.LogSource {
+	out := v1.LogSource{
+		Name:       s.Name,
+		Type:       v1.SourceType(s.Type),
+		Dir:        s.Dir,
+		Containers: s.Containers,
+		FileFilter: s.FileFilter,
+	}
+	if s.Multiline != nil {
+		out.Pattern = s.Multiline.Pattern
+		out.MultilineNegate = s.Multiline.Negate
+		out.MultilineMaxLines = s.Multiline.MaxLines
+		out.MultilineTimeout = s.Multiline.Timeout
+	}
+	for _, parser := range s.Parsers {
+		out.Parsers = append(out.Parsers, v1.Parser{
+			Type:        v1.ParserType(parser.Type),
+			Expression:  parser.Expression,
+			Patterns:    parser.Patterns,
+			Source:      parser.Source,
+			TimeKey:     parser.TimeKey,
+			TimeFormat:  parser.TimeFormat,
+			Timezone:    parser.Timezone,
+			SeverityKey: parser.SeverityKey,
+		})
+	}
+	return out
+}
+
+func sourceFromV1(s v1.LogSource) LogSource {
+	out := LogSource{
+		Name:       s.Name,
+		Type:       SourceType(s.Type),
+		Dir:        s.Dir,
+		Containers: s.Containers,
+		FileFilter: s.FileFilter,
+	}
+	if s.Pattern != "" || s.MultilineNegate || s.MultilineMaxLines != 0 || s.MultilineTimeout != nil {
+		out.Multiline = &Multiline{
+			Pattern:  s.Pattern,
+			Negate:   s.MultilineNegate,
+			MaxLines: s.MultilineMaxLines,
+			Timeout:  s.MultilineTimeout,
+		}
+	}
+	for _, parser := range s.Parsers {
+		out.Parsers = append(out.Parsers, Parser{
+			Type:        ParserType(parser.Type),
+			Expression:  parser.Expression,
+			Patterns:    parser.Patterns,
+			Source:      parser.Source,
+			TimeKey:     parser.TimeKey,
+			TimeFormat:  parser.TimeFormat,
+			Timezone:    parser.Timezone,
+			SeverityKey: parser.SeverityKey,
+		})
+	}
+	return out
+}
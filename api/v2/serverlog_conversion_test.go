@@ -0,0 +1,183 @@
+package v2
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+	"time"
+
+	fuzz "github.com/google/gofuzz"
+	v1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/diff"
+)
+
+const (
+	fuzzIterations = 2000
+	// fuzzSeed is fixed so a lossy conversion fails every run, not once in
+	// a while.
+	fuzzSeed = 20231018
+)
+
+// newFuzzer returns a fuzzer of ServerLogs of both versions holding what
+// the API server can store. Sources are often the single source named
+// default and the top level fields of v1 often unset, so every way the
+// versions map to each other is tried.
+func newFuzzer(seed int64) *fuzz.Fuzzer {
+	return fuzz.New().NilChance(0.3).NumElements(0, 3).RandSource(rand.NewSource(seed)).Funcs(
+		func(*metav1.TypeMeta, fuzz.Continue) {
+			//apiVersion和kind由转换webhook设置
+		},
+		func(m *metav1.ObjectMeta, c fuzz.Continue) {
+			c.FuzzNoCustom(m)
+			//managedFields的原始JSON无法随机生成
+			m.ManagedFields = nil
+		},
+		func(t *metav1.Time, c fuzz.Continue) {
+			*t = metav1.Unix(c.Int63n(1<<32), 0)
+		},
+		func(d *metav1.Duration, c fuzz.Continue) {
+			d.Duration = time.Duration(c.Int63())
+		},
+		func(q *resource.Quantity, c fuzz.Continue) {
+			*q = *resource.NewQuantity(c.Int63n(1<<40), resource.BinarySI)
+		},
+		func(p *v1.ServerLogPhase, c fuzz.Continue) {
+			phases := []v1.ServerLogPhase{"", v1.ServerLogPending, v1.ServerLogRunning, v1.ServerLogCompleted}
+			*p = phases[c.Intn(len(phases))]
+		},
+		func(p *ServerLogPhase, c fuzz.Continue) {
+			phases := []ServerLogPhase{"", ServerLogInit, ServerLogRunning, ServerLogCompleted}
+			*p = phases[c.Intn(len(phases))]
+		},
+		func(spec *v1.ServerLogSpec, c fuzz.Continue) {
+			c.FuzzNoCustom(spec)
+			switch c.Intn(3) {
+			case 0:
+				spec.Sources = nil
+			case 1:
+				setTopLevel(spec, v1.ServerLogSpec{})
+			}
+		},
+		func(s *v1.LogSource, c fuzz.Continue) {
+			c.FuzzNoCustom(s)
+			if c.RandBool() {
+				s.Name, s.Type, s.Containers = defaultSourceName, "", nil
+			}
+		},
+		func(s *LogSource, c fuzz.Continue) {
+			c.FuzzNoCustom(s)
+			if c.RandBool() {
+				s.Name, s.Type, s.Containers = defaultSourceName, "", nil
+			}
+		},
+		func(ref *OutputReference, c fuzz.Continue) {
+			ref.Name = "output-" + c.RandString()
+		},
+		func(m *Multiline, c fuzz.Continue) {
+			c.FuzzNoCustom(m)
+			//multiline: {}也要覆盖到
+			if c.Intn(4) == 0 {
+				*m = Multiline{}
+			}
+		},
+	)
+}
+
+// viaJSON returns obj after a trip through JSON, as it is sent to the
+// conversion webhook.
+func viaJSON[T any](t *testing.T, obj *T) *T {
+	t.Helper()
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out T
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return &out
+}
+
+// dropEmptyMultiline removes the multiline settings that set nothing, as
+// the defaulter does before a v2 ServerLog is stored. v1 has no way to tell
+// them from no settings at all.
+func dropEmptyMultiline(r *ServerLog) {
+	for i := range r.Spec.Sources {
+		if m := r.Spec.Sources[i].Multiline; m != nil && *m == (Multiline{}) {
+			r.Spec.Sources[i].Multiline = nil
+		}
+	}
+}
+
+func TestRoundTripV1(t *testing.T) {
+	f := newFuzzer(fuzzSeed)
+	for i := 0; i < fuzzIterations; i++ {
+		original := &v1.ServerLog{}
+		f.Fuzz(original)
+		v2 := &ServerLog{}
+		if err := v2.ConvertFrom(original.DeepCopy()); err != nil {
+			t.Fatal(err)
+		}
+		got := &v1.ServerLog{}
+		if err := viaJSON(t, v2).ConvertTo(got); err != nil {
+			t.Fatal(err)
+		}
+		if !equality.Semantic.DeepEqual(original, got) {
+			t.Fatalf("v1 -> v2 -> v1 is lossy:\n%s", diff.ObjectReflectDiff(original, got))
+		}
+	}
+}
+
+func TestRoundTripV2(t *testing.T) {
+	f := newFuzzer(fuzzSeed)
+	for i := 0; i < fuzzIterations; i++ {
+		original := &ServerLog{}
+		f.Fuzz(original)
+		dropEmptyMultiline(original)
+		hub := &v1.ServerLog{}
+		if err := original.DeepCopy().ConvertTo(hub); err != nil {
+			t.Fatal(err)
+		}
+		got := &ServerLog{}
+		if err := got.ConvertFrom(viaJSON(t, hub)); err != nil {
+			t.Fatal(err)
+		}
+		if !equality.Semantic.DeepEqual(original, got) {
+			t.Fatalf("v2 -> v1 -> v2 is lossy:\n%s", diff.ObjectReflectDiff(original, got))
+		}
+	}
+}
+
+func TestConvertFromTopLevel(t *testing.T) {
+	hub := &v1.ServerLog{Spec: v1.ServerLogSpec{Dir: "/data/log", Pattern: `^\d`, Output: "es"}}
+	got := &ServerLog{}
+	if err := got.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	want := ServerLogSpec{
+		Sources:   []LogSource{{Name: "default", Dir: "/data/log", Multiline: &Multiline{Pattern: `^\d`}}},
+		OutputRef: &OutputReference{Name: "es"},
+	}
+	if !equality.Semantic.DeepEqual(got.Spec, want) {
+		t.Errorf("converted to %+v, want %+v", got.Spec, want)
+	}
+	if _, ok := got.Annotations[utils.AnnotationV1Fields]; ok {
+		t.Errorf("the top level fields are held by the source, got annotation %q", got.Annotations[utils.AnnotationV1Fields])
+	}
+
+	// v1 ignores the top level fields of a ServerLog with sources
+	hub.Spec.Sources = []v1.LogSource{{Name: "app", Dir: "/app/logs"}}
+	if err := got.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Spec.Sources) != 1 || got.Spec.Sources[0].Name != "app" {
+		t.Errorf("converted to sources %+v, want only app", got.Spec.Sources)
+	}
+	if got.Annotations[utils.AnnotationV1Fields] == "" {
+		t.Error("the ignored top level fields must be kept in the annotation")
+	}
+}
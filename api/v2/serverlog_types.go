@@ -17,33 +17,227 @@ limitations under the License.
 package v2
 
 import (
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
-
-// ServerLogSpec defines the desired state of ServerLog
+// ServerLogSpec defines the desired state of ServerLog. Unlike v1 every
+// directory is a source, read with its own multiline settings and parsers.
 type ServerLogSpec struct {
-	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// NodeName is the node of the Pod, set by the controller.
+	// +optional
+	NodeName string `json:"nodeName,omitempty"`
+	// Sources are the directories of the Pod collected.
+	// +optional
+	Sources []LogSource `json:"sources,omitempty"`
+	// OutputRef is the LogOutput in the same namespace the logs are shipped
+	// to. The agent's default output is used when it is not set.
+	// +optional
+	OutputRef *OutputReference `json:"outputRef,omitempty"`
+	// RateLimit caps how fast the files are read. The limits not set fall
+	// back to the annotations of the namespace, unlimited without them.
+	// +optional
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+}
+
+// OutputReference names a LogOutput in the namespace of the ServerLog.
+type OutputReference struct {
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// RateLimit caps how fast the agent reads the files of a ServerLog. Lines
+// over the limit wait in the files, nothing is dropped.
+type RateLimit struct {
+	// LinesPerSecond is the maximum number of lines read per second.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	LinesPerSecond int64 `json:"linesPerSecond,omitempty"`
+	// BytesPerSecond is the maximum number of bytes read per second, e.g. 1Mi.
+	// +optional
+	BytesPerSecond *resource.Quantity `json:"bytesPerSecond,omitempty"`
+}
 
+// SourceType is where the logs of a source are written.
+type SourceType string
+
+const (
+	// SourceDir reads the files of a directory of the Pod.
+	SourceDir SourceType = "dir"
+	// SourceContainerStdout reads the stdout and stderr of the containers
+	// from the log files of the container runtime under /var/log/pods.
+	SourceContainerStdout SourceType = "containerStdout"
+)
+
+// LogSource is a directory of a Pod with the settings its files are read with.
+type LogSource struct {
+	// Name identifies the source, records carry it in the "source" field.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Type defaults to dir.
+	// +kubebuilder:validation:Enum=dir;containerStdout
+	// +optional
+	Type SourceType `json:"type,omitempty"`
+	// Dir is the directory in the container, required for a dir source.
 	// +kubebuilder:validation:MinLength=2
-	Dir      string `json:"dir,omitempty"`
-	NodeName string `json:"nodeName,omitempty"`
+	// +optional
+	Dir string `json:"dir,omitempty"`
+	// Containers limits a containerStdout source to the output of these
+	// containers, every container is read when it is empty.
+	// +optional
+	Containers []string `json:"containers,omitempty"`
+	// FileFilter defaults to "*", and to "*.log" for a containerStdout source.
+	// +optional
+	FileFilter string `json:"fileFilter,omitempty"`
+	// Multiline joins the lines of an event, every line is an event when it
+	// is not set.
+	// +optional
+	Multiline *Multiline `json:"multiline,omitempty"`
+	// Parsers turn every event into a structured record. They run in order,
+	// each one adding the fields it extracts; a line one of them fails on is
+	// still shipped, with the error in the _parse_error field.
+	// +optional
+	Parsers []Parser `json:"parsers,omitempty"`
+}
+
+// Multiline configures how the lines of a source are joined into events,
+// so stack traces become a single record.
+type Multiline struct {
+	// Pattern is a regular expression matching the first line of an event.
+	// Lines that do not match are appended to the previous event.
+	// +kubebuilder:validation:MinLength=1
+	Pattern string `json:"pattern"`
+	// Negate inverts Pattern: lines that do NOT match start a new event.
+	// +optional
+	Negate bool `json:"negate,omitempty"`
+	// MaxLines is the maximum number of lines in one event, defaults to 500.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxLines int32 `json:"maxLines,omitempty"`
+	// Timeout is how long a partial event waits for more lines before it is
+	// sent anyway, defaults to 5s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// ParserType is the format a Parser reads.
+type ParserType string
+
+const (
+	ParserJSON   ParserType = "json"
+	ParserLogfmt ParserType = "logfmt"
+	// ParserRegex extracts the named groups of a regular expression.
+	ParserRegex ParserType = "regex"
+	// ParserGrok extracts the fields of a grok pattern, e.g.
+	// "%{IP:client} %{WORD:method} %{URIPATHPARAM:path}".
+	ParserGrok ParserType = "grok"
+)
+
+// Parser configures one stage of the parser pipeline of a source.
+type Parser struct {
+	// +kubebuilder:validation:Enum=json;logfmt;regex;grok
+	Type ParserType `json:"type"`
+	// Expression is the regular expression of a regex parser or the pattern
+	// of a grok parser.
+	// +optional
+	Expression string `json:"expression,omitempty"`
+	// Patterns defines additional grok patterns by name.
+	// +optional
+	Patterns map[string]string `json:"patterns,omitempty"`
+	// Source is the field parsed, defaults to the raw message.
+	// +optional
+	Source string `json:"source,omitempty"`
+	// TimeKey is the field holding the timestamp of the record. The time the
+	// line was read is used when it is empty.
+	// +optional
+	TimeKey string `json:"timeKey,omitempty"`
+	// TimeFormat is the Go layout of TimeKey, e.g. "2006-01-02 15:04:05.000",
+	// or one of unix, unix_ms and unix_ns. Defaults to RFC3339.
+	// +optional
+	TimeFormat string `json:"timeFormat,omitempty"`
+	// Timezone is the IANA zone of timestamps without an offset, defaults to UTC.
+	// +optional
+	Timezone string `json:"timezone,omitempty"`
+	// SeverityKey is the field holding the level of the record.
+	// +optional
+	SeverityKey string `json:"severityKey,omitempty"`
 }
 
 // ServerLogStatus defines the observed state of ServerLog
 type ServerLogStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
 	Phase ServerLogPhase `json:"phase,omitempty"`
+	// ObservedGeneration is the generation of the spec the status was
+	// computed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// HostPath is the directory on the node the first source is read from.
+	// +optional
+	HostPath string `json:"hostPath,omitempty"`
+	// Sources are the directories on the node of the sources, resolved by
+	// the controller from the volume mounts of the Pod.
+	// +optional
+	Sources []SourceStatus `json:"sources,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Files are the files being read, those lagging most behind first.
+	// +optional
+	Files []FileStatus `json:"files,omitempty"`
+	// Lag is the number of bytes of all files not shipped yet.
+	// +optional
+	Lag int64 `json:"lag,omitempty"`
+	// Shipped counts the records the outputs accepted.
+	// +optional
+	Shipped ShippedStatus `json:"shipped,omitempty"`
+	// LastError is the last error reading the files or shipping the records.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// ShippedStatus counts the records of a ServerLog the outputs accepted.
+type ShippedStatus struct {
+	// +optional
+	Lines int64 `json:"lines,omitempty"`
+	// +optional
+	Bytes int64 `json:"bytes,omitempty"`
+}
+
+// FileStatus is the progress of the agent in one file.
+type FileStatus struct {
+	// Path is the path of the file on the node.
+	Path string `json:"path"`
+	// Offset is the byte offset up to which records were shipped.
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+	// Lag is the number of bytes not shipped yet.
+	Lag int64 `json:"lag"`
+}
+
+// SourceStatus is where a source of a ServerLog is found on the node.
+type SourceStatus struct {
+	Name string `json:"name"`
+	// Dir is the directory in the container HostPath was resolved for.
+	Dir string `json:"dir"`
+	// HostPath is empty when Dir is not on a volume that can be read from
+	// the node.
+	// +optional
+	HostPath string `json:"hostPath,omitempty"`
+	// VolumeRoot is the directory on the node of the volume holding
+	// HostPath. The Pod controls everything below it, so the agent does not
+	// follow symlinks there.
+	// +optional
+	VolumeRoot string `json:"volumeRoot,omitempty"`
 }
 
+// +genclient
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:shortName={sl}
 // +kubebuilder:printcolumn:JSONPath=".status.phase",name="status",type="string"
+// +kubebuilder:printcolumn:JSONPath=".spec.nodeName",name="Node",type="string"
+// +kubebuilder:printcolumn:JSONPath=".status.lag",name="Lag",type="integer",description="Bytes not shipped yet"
+// +kubebuilder:printcolumn:JSONPath=".status.shipped.lines",name="Lines",type="integer",priority=1
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // ServerLog is the Schema for the serverlogs API
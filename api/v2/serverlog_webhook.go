@@ -17,13 +17,125 @@ limitations under the License.
 package v2
 
 import (
+	"context"
+	"fmt"
+	"regexp"
+
+	v1 "github.com/yshaojie/log-collector/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
-func (r *ServerLog) SetupWebhookWithManager(mgr ctrl.Manager) error {
+func (r *ServerLog) SetupWebhookWithManager(mgr ctrl.Manager, opts v1.WebhookOptions) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
+		WithDefaulter(&serverLogDefaulter{hub: v1.NewServerLogDefaulter(mgr.GetClient())}).
+		WithValidator(&serverLogValidator{hub: v1.NewServerLogValidator(mgr.GetClient(), opts)}).
 		Complete()
 }
 
-// TODO(user): EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
+//+kubebuilder:webhook:path=/mutate-log-4yxy-io-v2-serverlog,mutating=true,failurePolicy=fail,sideEffects=None,groups=log.4yxy.io,resources=serverlogs,verbs=create;update,versions=v2,name=mserverlog-v2.kb.io,admissionReviewVersions=v1,matchPolicy=Exact
+
+// serverLogDefaulter fills in the defaults of v1 on the v1 version of a
+// ServerLog, so both versions get the same.
+type serverLogDefaulter struct {
+	hub admission.CustomDefaulter
+}
+
+var _ admission.CustomDefaulter = &serverLogDefaulter{}
+
+// Default implements admission.CustomDefaulter. The trip through v1 also
+// drops what v1 cannot hold, e.g. a multiline setting nothing, so a stored
+// v2 ServerLog converts to v1 and back unchanged.
+func (d *serverLogDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	r, ok := obj.(*ServerLog)
+	if !ok {
+		return fmt.Errorf("expected a ServerLog but got %T", obj)
+	}
+	serverloglog.Info("default", "name", r.Name)
+	hub := &v1.ServerLog{}
+	if err := r.ConvertTo(hub); err != nil {
+		return err
+	}
+	if err := d.hub.Default(ctx, hub); err != nil {
+		return err
+	}
+	return r.ConvertFrom(hub)
+}
+
+//+kubebuilder:webhook:path=/validate-log-4yxy-io-v2-serverlog,mutating=false,failurePolicy=fail,sideEffects=None,groups=log.4yxy.io,resources=serverlogs,verbs=create;update,versions=v2,name=vserverlog-v2.kb.io,admissionReviewVersions=v1,matchPolicy=Exact
+
+// serverLogValidator validates the v1 version of a ServerLog and reports
+// the invalid fields by their v2 path.
+type serverLogValidator struct {
+	hub *v1.ServerLogValidator
+}
+
+var _ admission.CustomValidator = &serverLogValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *serverLogValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(ctx, obj, nil)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *serverLogValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(ctx, newObj, oldObj)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *serverLogValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *serverLogValidator) validate(ctx context.Context, obj, oldObj runtime.Object) error {
+	r, ok := obj.(*ServerLog)
+	if !ok {
+		return fmt.Errorf("expected a ServerLog but got %T", obj)
+	}
+	serverloglog.Info("validate", "name", r.Name)
+	hub := &v1.ServerLog{}
+	if err := r.ConvertTo(hub); err != nil {
+		return err
+	}
+	var oldHub *v1.ServerLog
+	if oldObj != nil {
+		old, ok := oldObj.(*ServerLog)
+		if !ok {
+			return fmt.Errorf("expected a ServerLog but got %T", oldObj)
+		}
+		oldHub = &v1.ServerLog{}
+		if err := old.ConvertTo(oldHub); err != nil {
+			return err
+		}
+	}
+	errs, err := v.hub.Validate(ctx, hub, oldHub)
+	if err != nil || len(errs) == 0 {
+		return err
+	}
+	for _, e := range errs {
+		e.Field = v2Path(e.Field)
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("ServerLog").GroupKind(), r.Name, errs)
+}
+
+var sourcePatternPath = regexp.MustCompile(`^spec\.sources\[(\d+)\]\.pattern$`)
+
+// v2Path returns the v2 path of a field of the v1 version of a ServerLog.
+// The top level fields of v1 are the first source of v2.
+func v2Path(path string) string {
+	switch path {
+	case "spec.output":
+		return "spec.outputRef.name"
+	case "spec.dir", "spec.fileFilter":
+		return "spec.sources[0]" + path[len("spec"):]
+	case "spec.pattern":
+		return "spec.sources[0].multiline.pattern"
+	}
+	if m := sourcePatternPath.FindStringSubmatch(path); m != nil {
+		return "spec.sources[" + m[1] + "].multiline.pattern"
+	}
+	return path
+}
@@ -0,0 +1,94 @@
+package v2
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "github.com/yshaojie/log-collector/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newWebhooks(t *testing.T) (*serverLogDefaulter, *serverLogValidator) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	reader := fake.NewClientBuilder().WithScheme(scheme).Build()
+	return &serverLogDefaulter{hub: v1.NewServerLogDefaulter(reader)},
+		&serverLogValidator{hub: v1.NewServerLogValidator(reader, v1.WebhookOptions{})}
+}
+
+// causes returns the fields of the Invalid error err.
+func causes(t *testing.T, err error) []string {
+	t.Helper()
+	status, ok := err.(apierrors.APIStatus)
+	if !ok || !apierrors.IsInvalid(err) {
+		t.Fatalf("expected an Invalid error, got %v", err)
+	}
+	var fields []string
+	for _, cause := range status.Status().Details.Causes {
+		fields = append(fields, cause.Field)
+	}
+	return fields
+}
+
+func TestValidateV2Paths(t *testing.T) {
+	_, v := newWebhooks(t)
+	r := &ServerLog{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-0"},
+		Spec: ServerLogSpec{Sources: []LogSource{
+			{Name: "default", Dir: "/etc", Multiline: &Multiline{Pattern: "("}},
+			{Name: "app", Dir: "/data/log", Multiline: &Multiline{Pattern: "["}},
+		}},
+	}
+	_, err := v.ValidateCreate(context.Background(), r)
+	fields := causes(t, err)
+	want := "spec.sources[0].dir,spec.sources[0].multiline.pattern,spec.sources[1].multiline.pattern"
+	if strings.Join(fields, ",") != want {
+		t.Errorf("invalid fields %v, want %s", fields, want)
+	}
+
+	// the single default source is the top level fields of v1
+	r.Spec.Sources = r.Spec.Sources[:1]
+	_, err = v.ValidateCreate(context.Background(), r)
+	fields = causes(t, err)
+	want = "spec.sources[0].dir,spec.sources[0].multiline.pattern"
+	if strings.Join(fields, ",") != want {
+		t.Errorf("invalid fields %v, want %s", fields, want)
+	}
+}
+
+func TestDefaultV2(t *testing.T) {
+	d, _ := newWebhooks(t)
+	r := &ServerLog{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-0"},
+		Spec:       ServerLogSpec{Sources: []LogSource{{Name: "default", Dir: "/app/logs"}}},
+	}
+	if err := d.Default(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Spec.Sources[0].FileFilter; got != v1.DefaultFileFilter {
+		t.Errorf("file filter defaulted to %q, want %q", got, v1.DefaultFileFilter)
+	}
+	if len(r.Annotations) != 0 {
+		t.Errorf("defaulting added annotations %v", r.Annotations)
+	}
+
+	//空的multiline转换到v1后无法还原，默认值中去掉
+	r.Spec.Sources[0].Multiline = &Multiline{}
+	if err := d.Default(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if m := r.Spec.Sources[0].Multiline; m != nil {
+		t.Errorf("empty multiline defaulted to %+v, want nil", m)
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	// to ensure that exec-entrypoint and run can make use of them.
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/yshaojie/log-collector/internal/agent"
+	"github.com/yshaojie/log-collector/internal/checkpoint"
+	"github.com/yshaojie/log-collector/internal/metadata"
+	"github.com/yshaojie/log-collector/internal/metrics"
+	"github.com/yshaojie/log-collector/internal/serverlog"
+	"github.com/yshaojie/log-collector/internal/sink"
+	"github.com/yshaojie/log-collector/internal/wal"
+	"github.com/yshaojie/log-collector/pkg/client/clientset/versioned"
+	"github.com/yshaojie/log-collector/pkg/client/informers/externalversions"
+	"github.com/yshaojie/log-collector/pkg/utils"
+)
+
+var setupLog = ctrl.Log.WithName("setup")
+
+func main() {
+	var nodeName string
+	var hostRoot string
+	var resyncPeriod time.Duration
+	var scanInterval time.Duration
+	var workers int
+	var metricsAddr string
+	var statusInterval, statusMinInterval time.Duration
+	var statusQPS float64
+	var statusBurst int
+	var checkpointPath string
+	var checkpointInterval time.Duration
+	var bufferDir, bufferMaxSize, bufferPolicy string
+	var includeLabels, excludeLabels string
+	var includeAnnotations, excludeAnnotations string
+	flag.StringVar(&nodeName, "node-name", os.Getenv("NODE_NAME"), "The node this agent collects ServerLogs for.")
+	flag.StringVar(&hostRoot, "host-root", "/", "Where the host filesystem is mounted in the agent container.")
+	flag.DurationVar(&resyncPeriod, "resync-period", 10*time.Minute, "The resync period of the ServerLog informer.")
+	flag.DurationVar(&scanInterval, "scan-interval", 5*time.Second, "How often ServerLog directories are scanned for new files.")
+	flag.IntVar(&workers, "workers", 2, "The number of workers syncing ServerLogs.")
+	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to, \"0\" disables it.")
+	flag.DurationVar(&statusInterval, "status-interval", 10*time.Second, "How often the status of the ServerLogs is reported.")
+	flag.DurationVar(&statusMinInterval, "status-min-interval", time.Minute,
+		"How often the status of a ServerLog is patched when only its counters and lag changed.")
+	flag.Float64Var(&statusQPS, "status-qps", 5, "The maximum rate of status patches of all ServerLogs.")
+	flag.IntVar(&statusBurst, "status-burst", 10, "The maximum burst of status patches of all ServerLogs.")
+	flag.StringVar(&checkpointPath, "checkpoint-path", "/var/lib/log-collector/checkpoints.json",
+		"The file read offsets are saved to. It should be on a host path so it survives agent restarts.")
+	flag.DurationVar(&checkpointInterval, "checkpoint-interval", 5*time.Second, "How often read offsets are saved.")
+	flag.StringVar(&bufferDir, "buffer-dir", "",
+		"The directory events are buffered in on disk until the outputs delivered them, empty disables the buffer.")
+	flag.StringVar(&bufferMaxSize, "buffer-max-size", "1Gi", "The maximum size of the disk buffer.")
+	flag.StringVar(&bufferPolicy, "buffer-overflow-policy", string(wal.Block),
+		"What happens when the disk buffer is full: block, drop-oldest or drop-newest.")
+	flag.StringVar(&includeLabels, "include-labels", "*",
+		"Comma separated Pod label keys attached to records, \"*\" matches any characters.")
+	flag.StringVar(&excludeLabels, "exclude-labels", "", "Comma separated Pod label keys never attached to records.")
+	flag.StringVar(&includeAnnotations, "include-annotations", "",
+		"Comma separated Pod annotation keys attached to records, \"*\" matches any characters.")
+	flag.StringVar(&excludeAnnotations, "exclude-annotations", "", "Comma separated Pod annotation keys never attached to records.")
+	opts := zap.Options{
+		Development: true,
+	}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	klog.SetLogger(ctrl.Log.WithName("agent"))
+
+	if nodeName == "" {
+		setupLog.Info("--node-name or NODE_NAME must be set")
+		os.Exit(1)
+	}
+
+	checkpoints, err := checkpoint.Open(checkpointPath)
+	if err != nil {
+		setupLog.Error(err, "unable to open checkpoint store", "path", checkpointPath)
+		os.Exit(1)
+	}
+
+	var buffer *wal.WAL
+	if bufferDir != "" {
+		maxSize, err := resource.ParseQuantity(bufferMaxSize)
+		if err != nil {
+			setupLog.Error(err, "invalid --buffer-max-size")
+			os.Exit(1)
+		}
+		policy, err := wal.ParseOverflowPolicy(bufferPolicy)
+		if err != nil {
+			setupLog.Error(err, "invalid --buffer-overflow-policy")
+			os.Exit(1)
+		}
+		buffer, err = wal.Open(wal.Options{Dir: bufferDir, MaxSize: maxSize.Value(), Policy: policy})
+		if err != nil {
+			setupLog.Error(err, "unable to open buffer", "dir", bufferDir)
+			os.Exit(1)
+		}
+	}
+
+	config := ctrl.GetConfigOrDie()
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		setupLog.Error(err, "unable to create kubernetes client")
+		os.Exit(1)
+	}
+	logClientset, err := versioned.NewForConfig(config)
+	if err != nil {
+		setupLog.Error(err, "unable to create log client")
+		os.Exit(1)
+	}
+
+	//只关注调度到本节点的ServerLog
+	tweakListOptions := func(options *metav1.ListOptions) {
+		options.LabelSelector = labels.Set{utils.LabelNodeName: nodeName}.String()
+	}
+	factory := informers.NewSharedInformerFactory(clientset, resyncPeriod)
+	logFactory := externalversions.NewSharedInformerFactory(logClientset, resyncPeriod)
+	serverLogFactory := externalversions.NewSharedInformerFactoryWithOptions(logClientset, resyncPeriod,
+		externalversions.WithTweakListOptions(tweakListOptions))
+	serverLogInformer := serverLogFactory.Log().V1().ServerLogs()
+	logOutputInformer := logFactory.Log().V1().LogOutputs()
+	policyInformer := logFactory.Log().V1().LogCollectionPolicies()
+	podFactory := informers.NewSharedInformerFactoryWithOptions(clientset, resyncPeriod,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", nodeName).String()
+		}))
+	pods := metadata.New(podFactory.Core().V1().Pods(), clientset, metadata.Options{
+		Labels:      metadata.NewFilter(strings.Split(includeLabels, ","), strings.Split(excludeLabels, ",")),
+		Annotations: metadata.NewFilter(strings.Split(includeAnnotations, ","), strings.Split(excludeAnnotations, ",")),
+	})
+
+	//未指定output的ServerLog写到stdout
+	a := agent.New(nodeName, logClientset.LogV1(), serverLogInformer, logOutputInformer, policyInformer, factory.Core().V1().Namespaces(), pods, sink.NewStdout(), serverlog.Options{
+		HostRoot:     hostRoot,
+		ScanInterval: scanInterval,
+		Checkpoints:  checkpoints,
+	}, buffer, agent.StatusOptions{
+		Interval:    statusInterval,
+		MinInterval: statusMinInterval,
+		QPS:         float32(statusQPS),
+		Burst:       statusBurst,
+	})
+
+	ctx := ctrl.SetupSignalHandler()
+	factory.Start(ctx.Done())
+	logFactory.Start(ctx.Done())
+	serverLogFactory.Start(ctx.Done())
+	podFactory.Start(ctx.Done())
+	go checkpoints.Run(ctx, checkpointInterval)
+	if metricsAddr != "0" {
+		go serveMetrics(ctx, metricsAddr)
+	}
+
+	setupLog.Info("starting agent", "node", nodeName)
+	if err := a.Run(ctx, workers); err != nil {
+		setupLog.Error(err, "problem running agent")
+		os.Exit(1)
+	}
+	if buffer != nil {
+		if err := buffer.Close(); err != nil {
+			setupLog.Error(err, "unable to close buffer", "dir", bufferDir)
+		}
+	}
+	//所有collector都已停止，保存最终的读取位置
+	if err := checkpoints.Flush(); err != nil {
+		setupLog.Error(err, "unable to save checkpoints", "path", checkpointPath)
+		os.Exit(1)
+	}
+}
+
+// serveMetrics serves the agent metrics on /metrics until ctx is cancelled.
+func serveMetrics(ctx context.Context, addr string) {
+	registry := prometheus.NewRegistry()
+	metrics.Register(registry)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	setupLog.Info("serving metrics", "address", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		setupLog.Error(err, "unable to serve metrics", "address", addr)
+	}
+}
@@ -19,6 +19,8 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -54,11 +56,41 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var includeNamespaces, excludeNamespaces string
+	var kubeletRootDir, podLogDir string
+	var finalizerTimeout time.Duration
+	var controllerUsername string
+	var maxConcurrentReconciles int
+	var reconcileBaseDelay, reconcileMaxDelay time.Duration
+	var reconcileQPS float64
+	var reconcileBurst int
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&includeNamespaces, "include-namespaces", "",
+		"Comma separated namespaces whose Pods may opt in to collection, all namespaces when empty.")
+	flag.StringVar(&excludeNamespaces, "exclude-namespaces", "", "Comma separated namespaces that are never collected.")
+	flag.StringVar(&kubeletRootDir, "kubelet-root-dir", controller.DefaultKubeletRootDir,
+		"The root directory of the kubelet on the nodes, used to find the volumes of Pods.")
+	flag.StringVar(&podLogDir, "pod-log-dir", controller.DefaultPodLogDir,
+		"The directory on the nodes holding the output of the containers.")
+	flag.DurationVar(&finalizerTimeout, "finalizer-timeout", controller.DefaultFinalizerTimeout,
+		"How long the agent may take to drain a deleted ServerLog before its finalizer is removed anyway.")
+	flag.StringVar(&controllerUsername, "controller-username",
+		"system:serviceaccount:log-collector-system:log-collector-controller-manager",
+		"The user the manager runs as, the only one the webhook lets change the node of a ServerLog.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", controller.DefaultMaxConcurrentReconciles,
+		"How many Pods are reconciled at once.")
+	flag.DurationVar(&reconcileBaseDelay, "reconcile-base-delay", controller.DefaultReconcileBaseDelay,
+		"The first delay before a failed reconcile is retried, it doubles on every failure.")
+	flag.DurationVar(&reconcileMaxDelay, "reconcile-max-delay", controller.DefaultReconcileMaxDelay,
+		"The longest delay before a failed reconcile is retried.")
+	flag.Float64Var(&reconcileQPS, "reconcile-qps", controller.DefaultReconcileQPS,
+		"The maximum rate of retried reconciles of all Pods, reconciles triggered by events are not limited.")
+	flag.IntVar(&reconcileBurst, "reconcile-burst", controller.DefaultReconcileBurst,
+		"The maximum burst of retried reconciles of all Pods.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -95,17 +127,27 @@ func main() {
 		Client:        mgr.GetClient(),
 		Scheme:        mgr.GetScheme(),
 		EventRecorder: mgr.GetEventRecorderFor("mykind-controller"),
+		Namespaces: logv1.NamespaceSelection{
+			Include: splitList(includeNamespaces),
+			Exclude: splitList(excludeNamespaces),
+		},
+		KubeletRootDir:          kubeletRootDir,
+		PodLogDir:               podLogDir,
+		FinalizerTimeout:        finalizerTimeout,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		RateLimiter:             controller.NewRateLimiter(reconcileBaseDelay, reconcileMaxDelay, reconcileQPS, reconcileBurst),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ServerLog")
 		os.Exit(1)
 	}
 
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		if err = (&logv1.ServerLog{}).SetupWebhookWithManager(mgr); err != nil {
+		webhookOpts := logv1.WebhookOptions{ControllerUsername: controllerUsername}
+		if err = (&logv1.ServerLog{}).SetupWebhookWithManager(mgr, webhookOpts); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "ServerLog")
 			os.Exit(1)
 		}
-		if err = (&logv2.ServerLog{}).SetupWebhookWithManager(mgr); err != nil {
+		if err = (&logv2.ServerLog{}).SetupWebhookWithManager(mgr, webhookOpts); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "ServerLog")
 			os.Exit(1)
 		}
@@ -128,3 +170,14 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splitList splits a comma separated flag, ignoring empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,65 @@
+#!/usr/bin/env bash
+
+# Generates the clientset, listers and informers of the log.4yxy.io API under
+# pkg/client. CLIENT_GEN, LISTER_GEN and INFORMER_GEN are the generators of
+# k8s.io/code-generator, see the client-gen target of the Makefile.
+
+set -o errexit
+set -o nounset
+set -o pipefail
+
+ROOT=$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)
+MODULE=github.com/yshaojie/log-collector
+OUTPUT_PKG=${MODULE}/pkg/client
+GROUP_VERSIONS="v1 v2"
+
+CLIENT_GEN=${CLIENT_GEN:-client-gen}
+LISTER_GEN=${LISTER_GEN:-lister-gen}
+INFORMER_GEN=${INFORMER_GEN:-informer-gen}
+
+cd "${ROOT}"
+
+# The generators take the group from the directory of a version, so the
+# versions are linked under apis/log while they run, and the imports of the
+# links are rewritten to api afterwards.
+OUTPUT_BASE=$(mktemp -d)
+cleanup() {
+  rm -rf "${ROOT}/apis" "${OUTPUT_BASE}"
+}
+trap cleanup EXIT
+
+mkdir -p apis/log
+inputs=()
+input_dirs=()
+for version in ${GROUP_VERSIONS}; do
+  ln -s "../../api/${version}" "apis/log/${version}"
+  inputs+=("log/${version}")
+  input_dirs+=("${MODULE}/apis/log/${version}")
+done
+
+"${CLIENT_GEN}" \
+  --clientset-name versioned \
+  --input-base "${MODULE}/apis" \
+  --input "$(IFS=,; echo "${inputs[*]}")" \
+  --output-package "${OUTPUT_PKG}/clientset" \
+  --output-base "${OUTPUT_BASE}" \
+  --go-header-file hack/boilerplate.go.txt
+
+"${LISTER_GEN}" \
+  --input-dirs "$(IFS=,; echo "${input_dirs[*]}")" \
+  --output-package "${OUTPUT_PKG}/listers" \
+  --output-base "${OUTPUT_BASE}" \
+  --go-header-file hack/boilerplate.go.txt
+
+"${INFORMER_GEN}" \
+  --input-dirs "$(IFS=,; echo "${input_dirs[*]}")" \
+  --versioned-clientset-package "${OUTPUT_PKG}/clientset/versioned" \
+  --listers-package "${OUTPUT_PKG}/listers" \
+  --output-package "${OUTPUT_PKG}/informers" \
+  --output-base "${OUTPUT_BASE}" \
+  --go-header-file hack/boilerplate.go.txt
+
+rm -rf pkg/client/clientset pkg/client/listers pkg/client/informers
+cp -r "${OUTPUT_BASE}/${OUTPUT_PKG}/." pkg/client/
+find pkg/client -name '*.go' -exec sed -i "s|${MODULE}/apis/log/|${MODULE}/api/|g" {} +
+gofmt -w pkg/client
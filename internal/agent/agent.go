@@ -0,0 +1,393 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/checkpoint"
+	"github.com/yshaojie/log-collector/internal/event"
+	"github.com/yshaojie/log-collector/internal/metadata"
+	"github.com/yshaojie/log-collector/internal/metrics"
+	"github.com/yshaojie/log-collector/internal/serverlog"
+	"github.com/yshaojie/log-collector/internal/sink"
+	"github.com/yshaojie/log-collector/internal/tailer"
+	"github.com/yshaojie/log-collector/internal/wal"
+	clientv1 "github.com/yshaojie/log-collector/pkg/client/clientset/versioned/typed/log/v1"
+	informerv1 "github.com/yshaojie/log-collector/pkg/client/informers/externalversions/log/v1"
+	listerv1 "github.com/yshaojie/log-collector/pkg/client/listers/log/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// checkpointPruneInterval is how often checkpoints of vanished files are dropped.
+	checkpointPruneInterval = 10 * time.Minute
+	// outputDrainTimeout bounds how long an output may take to deliver its
+	// queued events when it is closed.
+	outputDrainTimeout = 20 * time.Second
+	// serverLogDrainTimeout bounds how long a deleted ServerLog may take to
+	// read and deliver what is left of its files.
+	serverLogDrainTimeout = time.Minute
+	// bufferSyncInterval is how often buffered events are made durable and
+	// checkpointed.
+	bufferSyncInterval = time.Second
+)
+
+// Agent runs on every node and collects the ServerLogs scheduled there.
+type Agent struct {
+	nodeName      string
+	client        clientv1.ServerLogsGetter
+	lister        listerv1.ServerLogLister
+	outputLister  listerv1.LogOutputLister
+	policyLister  listerv1.LogCollectionPolicyLister
+	namespaces    corelisters.NamespaceLister
+	pods          *metadata.Cache
+	synced        []cache.InformerSynced
+	queue         workqueue.RateLimitingInterface
+	defaultOutput *sink.Output
+	opts          serverlog.Options
+	buffer        *wal.WAL
+	statusOpts    StatusOptions
+	statusLimiter flowcontrol.RateLimiter
+
+	mu         sync.Mutex
+	collectors map[types.NamespacedName]*serverlog.Collector
+	outputs    map[types.NamespacedName]*outputEntry
+	// drains holds the deleted ServerLogs being drained in the background.
+	drains  map[types.NamespacedName]*drain
+	drainWG sync.WaitGroup
+
+	progressMu sync.Mutex
+	progress   map[types.NamespacedName]*progress
+}
+
+// New returns an Agent for nodeName. The ServerLog informer and the Pod
+// cache should already be restricted to the objects of nodeName. ServerLogs
+// without Spec.Output are shipped to defaultSink. client is used to report
+// the status of the ServerLogs and to remove the finalizer of deleted ones
+// once they are drained. Events are queued in buffer when it is not nil, and
+// checkpointed once buffer synced them. The annotations of the namespaces
+// hold the default rate limits. ServerLogs the LogCollectionPolicies do not
+// allow are not collected.
+func New(nodeName string, client clientv1.ServerLogsGetter, informer informerv1.ServerLogInformer, outputInformer informerv1.LogOutputInformer, policyInformer informerv1.LogCollectionPolicyInformer, namespaces coreinformers.NamespaceInformer, pods *metadata.Cache, defaultSink sink.Sink, opts serverlog.Options, buffer *wal.WAL, statusOpts StatusOptions) *Agent {
+	statusOpts.complete()
+	a := &Agent{
+		nodeName:     nodeName,
+		client:       client,
+		lister:       informer.Lister(),
+		outputLister: outputInformer.Lister(),
+		policyLister: policyInformer.Lister(),
+		namespaces:   namespaces.Lister(),
+		pods:         pods,
+		synced: []cache.InformerSynced{
+			informer.Informer().HasSynced,
+			outputInformer.Informer().HasSynced,
+			policyInformer.Informer().HasSynced,
+			namespaces.Informer().HasSynced,
+			pods.Informer().HasSynced,
+		},
+		queue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "serverlog-agent"),
+		opts:          opts,
+		buffer:        buffer,
+		statusOpts:    statusOpts,
+		statusLimiter: flowcontrol.NewTokenBucketRateLimiter(statusOpts.QPS, statusOpts.Burst),
+		collectors:    map[types.NamespacedName]*serverlog.Collector{},
+		outputs:       map[types.NamespacedName]*outputEntry{},
+		drains:        map[types.NamespacedName]*drain{},
+		progress:      map[types.NamespacedName]*progress{},
+	}
+	a.defaultOutput = sink.NewOutput(defaultOutputName, defaultSink, sink.OutputOptions{Buffer: buffer}, a.delivered)
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    a.enqueue,
+		UpdateFunc: func(_, obj interface{}) { a.enqueue(obj) },
+		DeleteFunc: a.enqueue,
+	})
+	outputInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    a.enqueueForOutput,
+		UpdateFunc: func(_, obj interface{}) { a.enqueueForOutput(obj) },
+		DeleteFunc: a.enqueueForOutput,
+	})
+	policyInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    a.enqueueAll,
+		UpdateFunc: func(_, obj interface{}) { a.enqueueAll(obj) },
+		DeleteFunc: a.enqueueAll,
+	})
+	namespaces.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: a.enqueueForNamespace,
+	})
+	//ServerLog与Pod同名，Pod元数据变化后重新同步
+	pods.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: a.enqueue,
+		UpdateFunc: func(old, obj interface{}) {
+			if metadata.Changed(old.(*corev1.Pod), obj.(*corev1.Pod)) {
+				a.enqueue(obj)
+			}
+		},
+		DeleteFunc: a.enqueue,
+	})
+	return a
+}
+
+func (a *Agent) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	a.queue.Add(key)
+}
+
+// enqueueForOutput enqueues the ServerLogs shipping to a LogOutput.
+func (a *Agent) enqueueForOutput(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	serverLogs, err := a.lister.ServerLogs(namespace).List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, serverLog := range serverLogs {
+		if serverLog.Spec.Output == name {
+			a.enqueue(serverLog)
+		}
+	}
+}
+
+// Run processes ServerLogs until ctx is cancelled, then stops every
+// collector and delivers what is still queued in the outputs.
+func (a *Agent) Run(ctx context.Context, workers int) error {
+	defer utilruntime.HandleCrash()
+	defer a.queue.ShutDown()
+
+	klog.Info("starting agent, node=", a.nodeName)
+	if !cache.WaitForCacheSync(ctx.Done(), a.synced...) {
+		return fmt.Errorf("failed to wait for server log cache to sync")
+	}
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, a.runWorker, time.Second)
+	}
+	if a.buffer != nil {
+		a.resumeBufferedOutputs()
+		go wait.UntilWithContext(ctx, a.syncBuffer, bufferSyncInterval)
+	}
+	go wait.UntilWithContext(ctx, a.reportStatus, a.statusOpts.Interval)
+	if a.opts.Checkpoints != nil {
+		go wait.UntilWithContext(ctx, a.pruneCheckpoints, checkpointPruneInterval)
+	}
+	<-ctx.Done()
+
+	klog.Info("stopping agent, node=", a.nodeName)
+	a.stopAll()
+	a.drainWG.Wait()
+	a.closeOutputs()
+	if a.buffer != nil {
+		a.syncBuffer(context.Background())
+	}
+	return nil
+}
+
+func (a *Agent) runWorker(ctx context.Context) {
+	for a.processNextItem(ctx) {
+	}
+}
+
+func (a *Agent) processNextItem(ctx context.Context) bool {
+	item, shutdown := a.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer a.queue.Done(item)
+
+	key := item.(string)
+	if err := a.sync(ctx, key); err != nil {
+		utilruntime.HandleError(fmt.Errorf("sync server log %q failed: %w", key, err))
+		a.queue.AddRateLimited(item)
+		return true
+	}
+	a.queue.Forget(item)
+	return true
+}
+
+// sync starts, restarts or stops the collector of a ServerLog so it matches
+// the cached object.
+func (a *Agent) sync(ctx context.Context, key string) error {
+	defer a.closeUnusedOutputs()
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	nn := types.NamespacedName{Namespace: namespace, Name: name}
+
+	serverLog, err := a.lister.ServerLogs(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		a.stopCollector(nn)
+		a.forgetDrain(nn)
+		metrics.ForgetServerLog(namespace, name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !serverLog.DeletionTimestamp.IsZero() {
+		return a.finalize(ctx, nn, serverLog)
+	}
+	if !a.shouldCollect(serverLog) {
+		a.stopCollector(nn)
+		return nil
+	}
+	policyErr := a.checkPolicies(serverLog)
+	a.setPolicyError(nn, policyErr)
+	if policyErr != nil {
+		//违反策略时停止采集，策略或ServerLog变化后重新检查
+		klog.Error("server log violates policy, namespace=", namespace, " name=", name, " err=", policyErr)
+		a.stopCollector(nn)
+		return nil
+	}
+	output, release, err := a.acquireOutput(serverLog)
+	a.setSyncError(nn, err)
+	if err != nil {
+		//output不可用时停止采集，等output就绪后从checkpoint继续
+		a.stopCollector(nn)
+		return err
+	}
+	//collector注册之前output不会被当作未使用关闭
+	defer release()
+	labels, md, err := a.podMetadata(ctx, serverLog)
+	if err != nil {
+		return err
+	}
+
+	limits := a.rateLimitOf(serverLog)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if c, ok := a.collectors[nn]; ok {
+		//限速变化不需要重启collector
+		if equality.Semantic.DeepEqual(specWithoutRateLimit(c.Spec()), specWithoutRateLimit(serverLog.Spec)) &&
+			equality.Semantic.DeepEqual(c.HostPaths(), serverLog.Status.Sources) {
+			c.SetLabels(labels)
+			c.SetMetadata(md)
+			c.SetRateLimit(limits)
+			return nil
+		}
+		//spec或source路径变化后重启collector
+		c.Stop()
+		delete(a.collectors, nn)
+	}
+	c := serverlog.NewCollector(serverLog, output, a.collectorOptions(serverLog))
+	c.SetLabels(labels)
+	c.SetMetadata(md)
+	c.SetRateLimit(limits)
+	c.Start(ctx)
+	a.collectors[nn] = c
+	return nil
+}
+
+// podMetadata returns the labels and metadata of the Pod of serverLog. Both
+// are empty until the Pod is in the cache, its Add event syncs serverLog
+// again.
+func (a *Agent) podMetadata(ctx context.Context, serverLog *logv1.ServerLog) (map[string]string, *event.PodMetadata, error) {
+	pod, err := a.pods.Pod(ctx, serverLog.Namespace, serverlog.PodName(serverLog))
+	if err != nil {
+		return nil, nil, err
+	}
+	if pod == nil {
+		return nil, nil, nil
+	}
+	return pod.Labels, pod.Metadata, nil
+}
+
+func (a *Agent) shouldCollect(serverLog *logv1.ServerLog) bool {
+	if serverLog.Spec.NodeName != a.nodeName {
+		return false
+	}
+	//至少有一个source能在节点上找到
+	for _, source := range serverLog.Spec.EffectiveSources() {
+		if serverLog.Status.HostPathOf(source) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Agent) stopCollector(nn types.NamespacedName) {
+	a.mu.Lock()
+	c, ok := a.collectors[nn]
+	delete(a.collectors, nn)
+	a.mu.Unlock()
+	if ok {
+		c.Stop()
+	}
+}
+
+func (a *Agent) stopAll() {
+	a.mu.Lock()
+	collectors := a.collectors
+	a.collectors = map[types.NamespacedName]*serverlog.Collector{}
+	a.mu.Unlock()
+	for _, c := range collectors {
+		c.Stop()
+	}
+}
+
+// delivered records the offsets of the events a sink accepted. With a
+// buffer they were checkpointed when the buffer synced them.
+func (a *Agent) delivered(events []*event.Event) {
+	a.countDelivered(events)
+	if a.buffer == nil {
+		a.checkpoint(events)
+	}
+}
+
+// syncBuffer makes the buffered events durable and checkpoints them.
+func (a *Agent) syncBuffer(ctx context.Context) {
+	events, err := a.buffer.Sync()
+	a.checkpoint(events)
+	if err != nil {
+		klog.Error("sync buffer failed, err=", err)
+	}
+}
+
+func (a *Agent) checkpoint(events []*event.Event) {
+	if a.opts.Checkpoints == nil {
+		return
+	}
+	for _, ev := range events {
+		a.opts.Checkpoints.Set(checkpoint.Key{ServerLog: ev.ServerLog, File: ev.File}, ev.Path, ev.Position())
+	}
+}
+
+// pruneCheckpoints drops the checkpoints of files that no longer exist at
+// their recorded path.
+func (a *Agent) pruneCheckpoints(ctx context.Context) {
+	a.opts.Checkpoints.Prune(func(key checkpoint.Key, pos checkpoint.Position) bool {
+		id, err := tailer.StatFileID(pos.Path)
+		if err != nil {
+			return false
+		}
+		return id == key.File
+	})
+}
@@ -0,0 +1,434 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/checkpoint"
+	"github.com/yshaojie/log-collector/internal/event"
+	"github.com/yshaojie/log-collector/internal/metadata"
+	"github.com/yshaojie/log-collector/internal/serverlog"
+	"github.com/yshaojie/log-collector/internal/tailer"
+	"github.com/yshaojie/log-collector/pkg/client/clientset/versioned/fake"
+	"github.com/yshaojie/log-collector/pkg/client/informers/externalversions"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+const testNode = "node-1"
+
+// testSink records the events written to it.
+type testSink struct {
+	mu     sync.Mutex
+	events []*event.Event
+}
+
+func (s *testSink) Write(ctx context.Context, events []*event.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *testSink) Flush(ctx context.Context) error { return nil }
+
+func (s *testSink) Close() error { return nil }
+
+func (s *testSink) Healthy() error { return nil }
+
+func (s *testSink) messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var messages []string
+	for _, ev := range s.events {
+		messages = append(messages, ev.Message)
+	}
+	sort.Strings(messages)
+	return messages
+}
+
+// fixture is an Agent on testNode with fake clients. The informers are not
+// started: the tests put the objects in the indexers themselves, so the
+// listers only change when a test says so.
+type fixture struct {
+	agent       *Agent
+	client      *fake.Clientset
+	factory     externalversions.SharedInformerFactory
+	kubeFactory informers.SharedInformerFactory
+	sink        *testSink
+	checkpoints *checkpoint.Store
+}
+
+func newFixture(t *testing.T, statusOpts StatusOptions, objects ...runtime.Object) *fixture {
+	t.Helper()
+	var logObjects []runtime.Object
+	for _, obj := range objects {
+		if _, ok := obj.(*corev1.Namespace); !ok {
+			logObjects = append(logObjects, obj)
+		}
+	}
+	client := fake.NewSimpleClientset(logObjects...)
+	factory := externalversions.NewSharedInformerFactory(client, 0)
+	kubeClient := kubefake.NewSimpleClientset()
+	kubeFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+	store, err := checkpoint.Open(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fixture{client: client, factory: factory, kubeFactory: kubeFactory, sink: &testSink{}, checkpoints: store}
+	f.agent = New(testNode, client.LogV1(),
+		factory.Log().V1().ServerLogs(), factory.Log().V1().LogOutputs(), factory.Log().V1().LogCollectionPolicies(),
+		kubeFactory.Core().V1().Namespaces(),
+		metadata.New(kubeFactory.Core().V1().Pods(), kubeClient, metadata.Options{}),
+		f.sink,
+		serverlog.Options{
+			ScanInterval: 20 * time.Millisecond,
+			Tailer:       tailer.Options{PollInterval: 10 * time.Millisecond},
+			Checkpoints:  store,
+		},
+		nil, statusOpts)
+	for _, obj := range objects {
+		f.set(t, obj)
+	}
+	t.Cleanup(func() {
+		f.agent.stopAll()
+		f.agent.drainWG.Wait()
+		f.agent.closeOutputs()
+		f.agent.queue.ShutDown()
+	})
+	return f
+}
+
+// set adds obj to the lister of its kind, or replaces it there.
+func (f *fixture) set(t *testing.T, obj runtime.Object) {
+	t.Helper()
+	var err error
+	switch obj := obj.(type) {
+	case *logv1.ServerLog:
+		err = f.factory.Log().V1().ServerLogs().Informer().GetIndexer().Update(obj)
+	case *logv1.LogOutput:
+		err = f.factory.Log().V1().LogOutputs().Informer().GetIndexer().Update(obj)
+	case *logv1.LogCollectionPolicy:
+		err = f.factory.Log().V1().LogCollectionPolicies().Informer().GetIndexer().Update(obj)
+	case *corev1.Namespace:
+		err = f.kubeFactory.Core().V1().Namespaces().Informer().GetIndexer().Update(obj)
+	default:
+		t.Fatalf("unexpected object %T", obj)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sync syncs the ServerLog named name of the default namespace.
+func (f *fixture) sync(name string) error {
+	return f.agent.sync(context.Background(), "default/"+name)
+}
+
+func (f *fixture) collector(name string) *serverlog.Collector {
+	f.agent.mu.Lock()
+	defer f.agent.mu.Unlock()
+	return f.agent.collectors[types.NamespacedName{Namespace: "default", Name: name}]
+}
+
+func (f *fixture) output(name string) *outputEntry {
+	f.agent.mu.Lock()
+	defer f.agent.mu.Unlock()
+	return f.agent.outputs[types.NamespacedName{Namespace: "default", Name: name}]
+}
+
+// collecting returns the Collecting condition the agent would report for
+// serverLog.
+func (f *fixture) collecting(serverLog *logv1.ServerLog) *metav1.Condition {
+	nn := types.NamespacedName{Namespace: serverLog.Namespace, Name: serverLog.Name}
+	u := f.agent.statusUpdate(nn, serverLog)
+	return meta.FindStatusCondition(u.status.Conditions, logv1.ConditionCollecting)
+}
+
+// newServerLog returns a ServerLog on testNode reading dir, resolved by the
+// controller to the same directory on the node.
+func newServerLog(name, dir string) *logv1.ServerLog {
+	serverLog := &logv1.ServerLog{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, ResourceVersion: "1"}}
+	serverLog.Spec.NodeName = testNode
+	serverLog.Spec.Dir = dir
+	for _, source := range serverLog.Spec.EffectiveSources() {
+		serverLog.Status.Sources = append(serverLog.Status.Sources,
+			logv1.SourceStatus{Name: source.Name, Dir: source.Dir, HostPath: source.Dir})
+	}
+	serverLog.Status.HostPath = dir
+	return serverLog
+}
+
+func newFileOutput(name, path string, generation int64) *logv1.LogOutput {
+	return &logv1.LogOutput{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Generation: generation},
+		Spec:       logv1.LogOutputSpec{Type: logv1.LogOutputFile, File: &logv1.FileOutput{Path: path}},
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitForMessages(t *testing.T, s *testSink, want []string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if reflect.DeepEqual(s.messages(), want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("delivered %q, want %q", s.messages(), want)
+}
+
+func TestSyncDefaultOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.log"), "one\ntwo\n")
+	f := newFixture(t, StatusOptions{}, newServerLog("web-0", dir))
+
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	waitForMessages(t, f.sink, []string{"one", "two"})
+
+	// a ServerLog of another node is not collected
+	other := newServerLog("web-1", dir)
+	other.Spec.NodeName = "node-2"
+	f.set(t, other)
+	if err := f.sync("web-1"); err != nil {
+		t.Fatal(err)
+	}
+	if f.collector("web-1") != nil {
+		t.Error("collecting a ServerLog of another node")
+	}
+}
+
+func TestSyncOutputLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	serverLog := newServerLog("web-0", dir)
+	serverLog.Spec.Output = "file"
+	f := newFixture(t, StatusOptions{}, serverLog, newFileOutput("file", filepath.Join(t.TempDir(), "a.log"), 1))
+
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	c := f.collector("web-0")
+	entry := f.output("file")
+	if c == nil || entry == nil {
+		t.Fatalf("collector %v, output %v, want both", c, entry)
+	}
+	if entry.refs != 0 {
+		t.Errorf("output refs %d after sync, want 0", entry.refs)
+	}
+
+	// a new generation of the LogOutput only swaps the sink
+	f.set(t, newFileOutput("file", filepath.Join(t.TempDir(), "b.log"), 2))
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.output("file"); got != entry || got.generation != 2 {
+		t.Errorf("output %p generation %d, want %p generation 2", got, got.generation, entry)
+	}
+	if f.collector("web-0") != c {
+		t.Error("collector restarted on a LogOutput change")
+	}
+
+	// a spec change restarts the collector
+	updated := serverLog.DeepCopy()
+	updated.Spec.FileFilter = "*.log"
+	f.set(t, updated)
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.collector("web-0"); got == nil || got == c {
+		t.Error("collector not restarted on a spec change")
+	}
+
+	// without its LogOutput the collector stops and the output is closed
+	updated = updated.DeepCopy()
+	updated.Spec.Output = "missing"
+	f.set(t, updated)
+	if err := f.sync("web-0"); err == nil {
+		t.Error("sync succeeded without the LogOutput")
+	}
+	if f.collector("web-0") != nil {
+		t.Error("collector still running without the LogOutput")
+	}
+	if f.output("file") != nil {
+		t.Error("unused output not closed")
+	}
+
+	// the ServerLog is gone
+	if err := f.factory.Log().V1().ServerLogs().Informer().GetIndexer().Delete(updated); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireOutputKeepsOutput(t *testing.T) {
+	serverLog := newServerLog("web-0", t.TempDir())
+	serverLog.Spec.Output = "file"
+	f := newFixture(t, StatusOptions{}, newFileOutput("file", filepath.Join(t.TempDir(), "a.log"), 1))
+
+	_, release, err := f.agent.acquireOutput(serverLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.agent.closeUnusedOutputs()
+	if f.output("file") == nil {
+		t.Fatal("acquired output closed")
+	}
+	release()
+	release()
+	if refs := f.output("file").refs; refs != 0 {
+		t.Errorf("refs %d after releasing twice, want 0", refs)
+	}
+	f.agent.closeUnusedOutputs()
+	if f.output("file") != nil {
+		t.Error("released output not closed")
+	}
+}
+
+func TestSyncRateLimit(t *testing.T) {
+	serverLog := newServerLog("web-0", t.TempDir())
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "default",
+		Annotations: map[string]string{utils.AnnotationRateLimitLines: "20"},
+	}}
+	f := newFixture(t, StatusOptions{}, serverLog, ns)
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	c := f.collector("web-0")
+	if c == nil || c.RateLimit().LinesPerSecond != 20 {
+		t.Fatalf("collector %v, want the rate limit of the namespace", c)
+	}
+
+	// a rate limit is changed on the running collector
+	updated := serverLog.DeepCopy()
+	updated.Spec.RateLimit = &logv1.RateLimit{LinesPerSecond: 10}
+	f.set(t, updated)
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	if f.collector("web-0") != c || c.RateLimit().LinesPerSecond != 10 {
+		t.Errorf("rate limit %v, want 10 lines on the same collector", c.RateLimit())
+	}
+}
+
+func TestSyncPolicyViolation(t *testing.T) {
+	dir := t.TempDir()
+	serverLog := newServerLog("web-0", dir)
+	policy := &logv1.LogCollectionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "restricted"},
+		Spec:       logv1.LogCollectionPolicySpec{AllowedPathPrefixes: []string{"/data/log"}},
+	}
+	f := newFixture(t, StatusOptions{}, serverLog, policy)
+
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	if f.collector("web-0") != nil {
+		t.Fatal("collecting a directory the policy does not allow")
+	}
+	condition := f.collecting(serverLog)
+	if condition.Reason != logv1.ReasonPolicyViolation || !strings.Contains(condition.Message, "status.sources[0].hostPath") {
+		t.Errorf("collecting %s: %s, want %s on the host path", condition.Reason, condition.Message, logv1.ReasonPolicyViolation)
+	}
+
+	policy = policy.DeepCopy()
+	policy.Spec.AllowedPathPrefixes = []string{filepath.Dir(dir)}
+	f.set(t, policy)
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	if f.collector("web-0") == nil {
+		t.Error("not collecting once the policy allows the directory")
+	}
+	if condition := f.collecting(serverLog); condition.Reason != logv1.ReasonReading {
+		t.Errorf("collecting %s, want %s", condition.Reason, logv1.ReasonReading)
+	}
+}
+
+func TestSyncPolicyRealPath(t *testing.T) {
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed := filepath.Join(tmp, "allowed")
+	outside := filepath.Join(tmp, "outside")
+	for _, dir := range []string{allowed, outside} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(outside, "app.log"), "secret\n")
+	// a hostPath volume in the allowed prefix linked out of it
+	volume := filepath.Join(allowed, "app")
+	if err := os.Symlink(outside, volume); err != nil {
+		t.Fatal(err)
+	}
+	serverLog := newServerLog("web-0", volume)
+	policy := &logv1.LogCollectionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "restricted"},
+		Spec:       logv1.LogCollectionPolicySpec{AllowedPathPrefixes: []string{allowed}},
+	}
+	f := newFixture(t, StatusOptions{}, serverLog, policy)
+
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	c := f.collector("web-0")
+	if c == nil {
+		t.Fatal("collector not started for an allowed host path")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := f.sink.messages(); len(got) != 0 {
+		t.Errorf("delivered %q from outside of the allowed prefix", got)
+	}
+	if !strings.Contains(c.LastError(), outside) || !strings.Contains(c.LastError(), "restricted") {
+		t.Errorf("last error %q, want the real path denied by the policy", c.LastError())
+	}
+}
+
+func TestCheckRealPathSensitive(t *testing.T) {
+	f := newFixture(t, StatusOptions{})
+	const emptyDir = "/var/lib/kubelet/pods/web-0-uid/volumes/kubernetes.io~empty-dir/logs"
+	tests := []struct {
+		path, real string
+		wantErr    bool
+	}{
+		{emptyDir + "/app.log", emptyDir + "/app.log", false},
+		{"/var/log/apps/app.log", "/var/log/apps/app.log", false},
+		// a hostPath volume linked into a sensitive directory
+		{"/var/log/apps/passwd", "/etc/passwd", true},
+		{"/var/log/apps", "/root/.ssh", true},
+		{"/data/log", "/var/log/apps", false},
+	}
+	for _, test := range tests {
+		err := f.agent.checkRealPath("default", test.path, test.real)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s at %s: got %v, want error %v", test.path, test.real, err, test.wantErr)
+		}
+	}
+}
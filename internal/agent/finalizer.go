@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/serverlog"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// finalize drains a deleted ServerLog: what is left of its files is read and
+// delivered and the offsets are saved before the finalizer is removed. The
+// drain runs in the background so it does not hold a worker for up to
+// serverLogDrainTimeout; the key is queued again once it is done. A failed
+// or timed out drain keeps the finalizer and is retried, the controller
+// removes it after its --finalizer-timeout.
+func (a *Agent) finalize(ctx context.Context, nn types.NamespacedName, serverLog *logv1.ServerLog) error {
+	index := finalizerIndex(serverLog)
+	if index < 0 {
+		a.stopCollector(nn)
+		return nil
+	}
+	if serverLog.Spec.NodeName != a.nodeName {
+		return nil
+	}
+
+	a.mu.Lock()
+	if d, ok := a.drains[nn]; ok {
+		if !d.finished {
+			//drain还在进行，结束后会重新入队
+			a.mu.Unlock()
+			return nil
+		}
+		delete(a.drains, nn)
+		a.mu.Unlock()
+		if d.err != nil {
+			return d.err
+		}
+		return a.removeFinalizer(ctx, serverLog, index)
+	}
+	c, ok := a.collectors[nn]
+	delete(a.collectors, nn)
+	d := &drain{}
+	a.drains[nn] = d
+	a.drainWG.Add(1)
+	a.mu.Unlock()
+	go func() {
+		defer a.drainWG.Done()
+		err := a.drain(ctx, nn, serverLog.DeepCopy(), c, ok)
+		a.mu.Lock()
+		d.finished, d.err = true, err
+		a.mu.Unlock()
+		a.queue.Add(nn.String())
+	}()
+	return nil
+}
+
+// drain is the result of draining a deleted ServerLog.
+type drain struct {
+	finished bool
+	err      error
+}
+
+// drain reads what is left of the files of serverLog with c, or with a new
+// collector starting at the checkpoints when running is false, and waits
+// until the output delivered it and the offsets are saved.
+func (a *Agent) drain(ctx context.Context, nn types.NamespacedName, serverLog *logv1.ServerLog, c *serverlog.Collector, running bool) error {
+	output, release, err := a.acquireOutput(serverLog)
+	if err != nil {
+		if c != nil {
+			c.Stop()
+		}
+		return err
+	}
+	defer release()
+	//agent重启后collector不存在，从checkpoint开始读完剩余内容
+	if !running && a.shouldCollect(serverLog) {
+		c = serverlog.NewCollector(serverLog, output, a.collectorOptions(serverLog))
+		c.Start(ctx)
+	}
+	drainCtx, cancel := context.WithTimeout(ctx, serverLogDrainTimeout)
+	defer cancel()
+	if c != nil {
+		klog.Info("drain server log, name=", nn)
+		if err := c.Drain(drainCtx); err != nil {
+			a.reportDrained(ctx, serverLog, err)
+			return fmt.Errorf("drain %s: %w", nn, err)
+		}
+	}
+	if err := output.Flush(drainCtx); err != nil {
+		err = fmt.Errorf("flush output of %s: %w", nn, err)
+		a.reportDrained(ctx, serverLog, err)
+		return err
+	}
+	//开启缓冲时事件落盘后才会写checkpoint
+	if a.buffer != nil {
+		a.syncBuffer(drainCtx)
+	}
+	if a.opts.Checkpoints != nil {
+		if err := a.opts.Checkpoints.Flush(); err != nil {
+			err = fmt.Errorf("save checkpoints: %w", err)
+			a.reportDrained(ctx, serverLog, err)
+			return err
+		}
+	}
+	a.reportDrained(ctx, serverLog, nil)
+	return nil
+}
+
+// forgetDrain drops the result of a finished drain once its ServerLog is
+// gone, e.g. because the controller removed the finalizer.
+func (a *Agent) forgetDrain(nn types.NamespacedName) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if d, ok := a.drains[nn]; ok && d.finished {
+		delete(a.drains, nn)
+	}
+}
+
+// finalizerIndex returns the index of the agent finalizer, -1 if the
+// ServerLog does not have it.
+func finalizerIndex(serverLog *logv1.ServerLog) int {
+	for i, f := range serverLog.Finalizers {
+		if f == utils.FinalizerNameAgentHolder {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeFinalizer removes the agent finalizer at index. The test operation
+// makes the patch fail instead of removing another finalizer when the list
+// changed in the meantime.
+func (a *Agent) removeFinalizer(ctx context.Context, serverLog *logv1.ServerLog, index int) error {
+	path := fmt.Sprintf("/metadata/finalizers/%d", index)
+	patch, err := json.Marshal([]map[string]string{
+		{"op": "test", "path": path, "value": utils.FinalizerNameAgentHolder},
+		{"op": "remove", "path": path},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = a.client.ServerLogs(serverLog.Namespace).Patch(ctx, serverLog.Name, types.JSONPatchType, patch, metav1.PatchOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("remove finalizer of %s/%s: %w", serverLog.Namespace, serverLog.Name, err)
+	}
+	klog.Info("removed finalizer of server log, name=", serverLog.Namespace, "/", serverLog.Name)
+	return nil
+}
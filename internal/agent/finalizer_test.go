@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/checkpoint"
+	"github.com/yshaojie/log-collector/internal/tailer"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const otherFinalizer = "example.com/keep"
+
+// newDeletedServerLog returns a deleted ServerLog reading dir that still has
+// the agent finalizer.
+func newDeletedServerLog(name, dir string) *logv1.ServerLog {
+	serverLog := newServerLog(name, dir)
+	now := metav1.Now()
+	serverLog.DeletionTimestamp = &now
+	serverLog.Finalizers = []string{otherFinalizer, utils.FinalizerNameAgentHolder}
+	return serverLog
+}
+
+// waitDrained waits until the drain of name finished and its key was queued
+// again.
+func (f *fixture) waitDrained(t *testing.T, name string) {
+	t.Helper()
+	nn := types.NamespacedName{Namespace: "default", Name: name}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		f.agent.mu.Lock()
+		d, ok := f.agent.drains[nn]
+		finished := ok && d.finished
+		f.agent.mu.Unlock()
+		if finished && f.agent.queue.Len() > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("drain of %s did not finish", nn)
+}
+
+// finalizerPatches returns how many times the finalizer was removed.
+func (f *fixture) finalizerPatches() int {
+	var n int
+	for _, action := range f.client.Actions() {
+		if patch, ok := action.(k8stesting.PatchAction); ok && patch.GetPatchType() == types.JSONPatchType {
+			n++
+		}
+	}
+	return n
+}
+
+func TestFinalizeDrains(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "first\nsecond\n")
+	serverLog := newDeletedServerLog("web-0", dir)
+	f := newFixture(t, StatusOptions{}, serverLog)
+
+	// the agent restarted after the deletion, no collector is running
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	f.waitDrained(t, "web-0")
+	if n := f.finalizerPatches(); n != 0 {
+		t.Fatalf("finalizer removed %d times before the drain was handled", n)
+	}
+	if got, want := f.sink.messages(), []string{"first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %q, want %q", got, want)
+	}
+	id, err := tailer.StatFileID(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nn := types.NamespacedName{Namespace: "default", Name: "web-0"}
+	if pos, ok := f.checkpoints.Get(checkpoint.Key{ServerLog: nn, File: id}); !ok || pos.Offset != 13 {
+		t.Errorf("checkpoint %+v found %v, want offset 13", pos, ok)
+	}
+
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.client.LogV1().ServerLogs("default").Get(context.Background(), "web-0", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{otherFinalizer}; !reflect.DeepEqual(got.Finalizers, want) {
+		t.Errorf("finalizers %v, want %v", got.Finalizers, want)
+	}
+	if got.Status.Phase != logv1.ServerLogCompleted || !meta.IsStatusConditionTrue(got.Status.Conditions, logv1.ConditionDrained) {
+		t.Errorf("phase %s conditions %v, want drained", got.Status.Phase, got.Status.Conditions)
+	}
+	f.agent.mu.Lock()
+	drains := len(f.agent.drains)
+	f.agent.mu.Unlock()
+	if drains != 0 {
+		t.Errorf("%d drains left", drains)
+	}
+}
+
+func TestFinalizeStopsRunningCollector(t *testing.T) {
+	dir := t.TempDir()
+	serverLog := newServerLog("web-0", dir)
+	serverLog.Finalizers = []string{utils.FinalizerNameAgentHolder}
+	f := newFixture(t, StatusOptions{}, serverLog)
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	if f.collector("web-0") == nil {
+		t.Fatal("collector not started")
+	}
+
+	// a line written just before the Pod went away is still shipped
+	writeFile(t, filepath.Join(dir, "app.log"), "last\n")
+	deleted := serverLog.DeepCopy()
+	now := metav1.Now()
+	deleted.DeletionTimestamp = &now
+	f.set(t, deleted)
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	if f.collector("web-0") != nil {
+		t.Error("collector of a deleted ServerLog still registered")
+	}
+	f.waitDrained(t, "web-0")
+	if got, want := f.sink.messages(), []string{"last"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %q, want %q", got, want)
+	}
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.finalizerPatches(); n != 1 {
+		t.Errorf("finalizer removed %d times, want once", n)
+	}
+}
+
+func TestFinalizeFailedDrainKeepsFinalizer(t *testing.T) {
+	serverLog := newDeletedServerLog("web-0", t.TempDir())
+	serverLog.Spec.Output = "gone"
+	f := newFixture(t, StatusOptions{}, serverLog)
+
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	f.waitDrained(t, "web-0")
+	err := f.sync("web-0")
+	if err == nil || !strings.Contains(err.Error(), "gone") {
+		t.Fatalf("error %v, want the missing LogOutput", err)
+	}
+	if n := f.finalizerPatches(); n != 0 {
+		t.Errorf("finalizer removed %d times after a failed drain", n)
+	}
+
+	// the retry drains again
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	f.agent.mu.Lock()
+	_, draining := f.agent.drains[types.NamespacedName{Namespace: "default", Name: "web-0"}]
+	f.agent.mu.Unlock()
+	if !draining {
+		t.Error("failed drain not retried")
+	}
+}
+
+func TestFinalizeSkips(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(serverLog *logv1.ServerLog)
+		// draining registers a drain that did not finish yet.
+		draining bool
+	}{
+		{name: "without the agent finalizer", change: func(serverLog *logv1.ServerLog) { serverLog.Finalizers = []string{otherFinalizer} }},
+		{name: "on another node", change: func(serverLog *logv1.ServerLog) { serverLog.Spec.NodeName = "node-2" }},
+		{name: "draining", draining: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverLog := newDeletedServerLog("web-0", t.TempDir())
+			if tt.change != nil {
+				tt.change(serverLog)
+			}
+			f := newFixture(t, StatusOptions{}, serverLog)
+			nn := types.NamespacedName{Namespace: "default", Name: "web-0"}
+			d := &drain{}
+			if tt.draining {
+				f.agent.drains[nn] = d
+			}
+			if err := f.sync("web-0"); err != nil {
+				t.Fatal(err)
+			}
+			f.agent.drainWG.Wait()
+			f.agent.mu.Lock()
+			got, ok := f.agent.drains[nn]
+			f.agent.mu.Unlock()
+			if tt.draining && got != d {
+				t.Error("running drain replaced")
+			}
+			if !tt.draining && ok {
+				t.Error("drain started")
+			}
+			if n := len(f.client.Actions()); n != 0 {
+				t.Errorf("%d requests sent, want none", n)
+			}
+		})
+	}
+}
+
+func TestForgetDrain(t *testing.T) {
+	f := newFixture(t, StatusOptions{})
+	nn := types.NamespacedName{Namespace: "default", Name: "web-0"}
+	f.agent.drains[nn] = &drain{}
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.agent.drains[nn]; !ok {
+		t.Error("running drain forgotten")
+	}
+	f.agent.drains[nn].finished = true
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.agent.drains[nn]; ok {
+		t.Error("finished drain of a gone ServerLog kept")
+	}
+}
@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"sync"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/metrics"
+	"github.com/yshaojie/log-collector/internal/sink"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// defaultOutputName is the name of the Output of the ServerLogs without
+// Spec.Output, the other Outputs are named after their LogOutput.
+const defaultOutputName = "default"
+
+// outputEntry is the Output built for a LogOutput.
+type outputEntry struct {
+	output     *sink.Output
+	generation int64
+	// refs counts the callers of acquireOutput that did not release the
+	// Output yet. closeUnusedOutputs keeps it until they did.
+	refs int
+}
+
+// acquireOutput returns the Output a ServerLog ships to, building or
+// updating it from its LogOutput. The Output is not closed as unused before
+// release is called, so the caller can register the collector shipping to
+// it first.
+func (a *Agent) acquireOutput(serverLog *logv1.ServerLog) (output *sink.Output, release func(), err error) {
+	if serverLog.Spec.Output == "" {
+		return a.defaultOutput, func() {}, nil
+	}
+	return a.acquireOutputForKey(types.NamespacedName{Namespace: serverLog.Namespace, Name: serverLog.Spec.Output})
+}
+
+// acquireOutputForKey is acquireOutput for the LogOutput key.
+func (a *Agent) acquireOutputForKey(key types.NamespacedName) (*sink.Output, func(), error) {
+	logOutput, err := a.outputLister.LogOutputs(key.Namespace).Get(key.Name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get log output %s: %w", key, err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry, ok := a.outputs[key]
+	if ok && entry.generation == logOutput.Generation {
+		return entry.output, a.acquire(entry), nil
+	}
+	s, err := sink.New(logOutput.Spec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("build log output %s: %w", key, err)
+	}
+	if ok {
+		//LogOutput变化时只替换sink，正在使用它的collector不受影响
+		klog.Info("update log output, name=", key, " type=", logOutput.Spec.Type)
+		entry.output.SetSink(s)
+		entry.generation = logOutput.Generation
+		return entry.output, a.acquire(entry), nil
+	}
+	klog.Info("create log output, name=", key, " type=", logOutput.Spec.Type)
+	opts := sink.OptionsFromSpec(logOutput.Spec.Batch)
+	opts.Buffer = a.buffer
+	entry = &outputEntry{output: sink.NewOutput(key.String(), s, opts, a.delivered), generation: logOutput.Generation}
+	a.outputs[key] = entry
+	return entry.output, a.acquire(entry), nil
+}
+
+// acquire adds a reference to entry and returns the func releasing it.
+// a.mu must be held.
+func (a *Agent) acquire(entry *outputEntry) func() {
+	entry.refs++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			a.mu.Lock()
+			entry.refs--
+			a.mu.Unlock()
+		})
+	}
+}
+
+// resumeBufferedOutputs builds the Outputs with events left in the buffer by
+// the last run, so they are delivered even when no ServerLog uses the
+// LogOutput anymore. The events of deleted LogOutputs are dropped.
+func (a *Agent) resumeBufferedOutputs() {
+	for _, name := range a.buffer.Cursors() {
+		if name == defaultOutputName {
+			continue
+		}
+		namespace, n, err := cache.SplitMetaNamespaceKey(name)
+		if err != nil {
+			utilruntime.HandleError(err)
+			continue
+		}
+		key := types.NamespacedName{Namespace: namespace, Name: n}
+		_, release, err := a.acquireOutputForKey(key)
+		if err != nil {
+			if errors.IsNotFound(goerrors.Unwrap(err)) {
+				klog.Info("log output is gone, drop its buffered events, name=", key)
+				if err := a.buffer.RemoveCursor(name); err != nil {
+					utilruntime.HandleError(err)
+				}
+				continue
+			}
+			utilruntime.HandleError(err)
+			continue
+		}
+		//缓冲中还有事件时closeUnusedOutputs不会关闭它
+		release()
+	}
+}
+
+// closeUnusedOutputs closes the outputs no running collector ships to and
+// nobody acquired. Outputs still delivering buffered events are kept until
+// they are done, their cursor is removed with them.
+func (a *Agent) closeUnusedOutputs() {
+	a.mu.Lock()
+	used := make(map[types.NamespacedName]bool, len(a.collectors))
+	for nn, c := range a.collectors {
+		if output := c.Spec().Output; output != "" {
+			used[types.NamespacedName{Namespace: nn.Namespace, Name: output}] = true
+		}
+	}
+	var unused []*sink.Output
+	for key, entry := range a.outputs {
+		if !used[key] && entry.refs == 0 && !entry.output.Pending() {
+			unused = append(unused, entry.output)
+			delete(a.outputs, key)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, output := range unused {
+		go func(output *sink.Output) {
+			closeOutput(output)
+			a.removeCursor(output.Name())
+		}(output)
+	}
+}
+
+// removeCursor drops the buffer cursor of a closed output unless the output
+// was built again in the meantime.
+func (a *Agent) removeCursor(name string) {
+	if a.buffer == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key := range a.outputs {
+		if key.String() == name {
+			return
+		}
+	}
+	if err := a.buffer.RemoveCursor(name); err != nil {
+		klog.Error("remove buffer cursor failed, output=", name, " err=", err)
+	}
+}
+
+// closeOutputs closes every output once all collectors are stopped.
+func (a *Agent) closeOutputs() {
+	a.mu.Lock()
+	outputs := []*sink.Output{a.defaultOutput}
+	for key, entry := range a.outputs {
+		outputs = append(outputs, entry.output)
+		delete(a.outputs, key)
+	}
+	a.mu.Unlock()
+
+	done := make(chan struct{}, len(outputs))
+	for _, output := range outputs {
+		go func(output *sink.Output) {
+			closeOutput(output)
+			done <- struct{}{}
+		}(output)
+	}
+	for range outputs {
+		<-done
+	}
+}
+
+func closeOutput(output *sink.Output) {
+	ctx, cancel := context.WithTimeout(context.Background(), outputDrainTimeout)
+	defer cancel()
+	klog.Info("close log output, name=", output.Name())
+	if err := output.Close(ctx); err != nil {
+		klog.Error("close log output failed, name=", output.Name(), " err=", err)
+	}
+	metrics.ForgetOutput(output.Name())
+}
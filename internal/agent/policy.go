@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"fmt"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/ratelimit"
+	"github.com/yshaojie/log-collector/internal/serverlog"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// enqueueAll enqueues every ServerLog of the node when a
+// LogCollectionPolicy changes.
+func (a *Agent) enqueueAll(interface{}) {
+	serverLogs, err := a.lister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, serverLog := range serverLogs {
+		a.enqueue(serverLog)
+	}
+}
+
+// policiesOf returns the LogCollectionPolicies selecting namespace.
+func (a *Agent) policiesOf(namespace string) []*logv1.LogCollectionPolicy {
+	policies, err := a.policyLister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return nil
+	}
+	var selecting []*logv1.LogCollectionPolicy
+	for _, policy := range policies {
+		if policy.Spec.Namespaces.Selects(namespace) {
+			selecting = append(selecting, policy)
+		}
+	}
+	return selecting
+}
+
+// checkPolicies returns why the policies of its namespace do not allow
+// serverLog, nil if they do. The webhook and the controller checked it
+// already, this catches ServerLogs admitted or resolved before a policy or
+// without the webhook. The directories are checked where they are on the
+// node, as the collector reads them from Status.Sources. A rate limit over
+// the maximum is lowered by maxRateOf instead.
+func (a *Agent) checkPolicies(serverLog *logv1.ServerLog) error {
+	spec := specWithoutRateLimit(serverLog.Spec)
+	sourcesPath := field.NewPath("status", "sources")
+	var errs field.ErrorList
+	for _, policy := range a.policiesOf(serverLog.Namespace) {
+		errs = append(errs, policy.Violations(&spec)...)
+		for i, source := range serverLog.Status.Sources {
+			//容器输出的目录不受限制
+			if source.Dir == "" || source.HostPath == "" {
+				continue
+			}
+			if err := policy.CheckHostPath(source.HostPath); err != nil {
+				errs = append(errs, field.Forbidden(sourcesPath.Index(i).Child("hostPath"), err.Error()))
+			}
+		}
+	}
+	return errs.ToAggregate()
+}
+
+// collectorOptions returns the options of the collector of serverLog, it
+// checks where the files it opens really are.
+func (a *Agent) collectorOptions(serverLog *logv1.ServerLog) serverlog.Options {
+	opts := a.opts
+	namespace := serverLog.Namespace
+	opts.CheckPath = func(path, real string) error { return a.checkRealPath(namespace, path, real) }
+	return opts
+}
+
+// checkRealPath returns why a file or directory the collector opened at path
+// on the node must not be read from real, where it is with its symlinks
+// resolved. The host paths of the status were checked by the controller and
+// checkPolicies, but a symlink on the way to the volume may point out of the
+// allowed prefixes or into a sensitive directory. The sensitive directories
+// are only checked when a symlink was followed: the volumes of the kubelet
+// are in one.
+func (a *Agent) checkRealPath(namespace, path, real string) error {
+	if sensitive := logv1.SensitiveDir(real); real != path && sensitive != "" {
+		return fmt.Errorf("%s is %s, %s is a sensitive directory and must not be collected", path, real, sensitive)
+	}
+	for _, policy := range a.policiesOf(namespace) {
+		if err := policy.CheckHostPath(real); err != nil {
+			return fmt.Errorf("%s: %w", real, err)
+		}
+	}
+	return nil
+}
+
+// maxRateOf returns the lowest maximum rates of the policies of namespace.
+func (a *Agent) maxRateOf(namespace string) ratelimit.Limits {
+	var max ratelimit.Limits
+	for _, policy := range a.policiesOf(namespace) {
+		limits, _ := ratelimit.LimitsOf(policy.Spec.MaxRate, nil)
+		max = max.Clamp(limits)
+	}
+	return max
+}
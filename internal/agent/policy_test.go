@@ -0,0 +1,177 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/ratelimit"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newPolicy(name string, spec logv1.LogCollectionPolicySpec) *logv1.LogCollectionPolicy {
+	return &logv1.LogCollectionPolicy{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: spec}
+}
+
+func TestCheckPolicies(t *testing.T) {
+	const volumeDir = "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~empty-dir/logs"
+	restricted := logv1.LogCollectionPolicySpec{
+		AllowedPathPrefixes: []string{"/var/lib/kubelet/pods"},
+		AllowedOutputs:      []string{"es"},
+	}
+	stdout := newServerLog("web-0", "")
+	stdout.Spec.Sources = []logv1.LogSource{{Name: "stdout", Type: logv1.SourceContainerStdout}}
+	stdout.Status.Sources = []logv1.SourceStatus{{Name: "stdout", HostPath: "/var/log/pods/default_web-0_uid"}}
+	unresolved := newServerLog("web-0", "/logs")
+	unresolved.Status.Sources[0].HostPath = ""
+
+	tests := []struct {
+		name      string
+		serverLog *logv1.ServerLog
+		policies  []*logv1.LogCollectionPolicy
+		// want is a part of the error, "" for none.
+		want string
+	}{
+		{
+			name:      "no policy",
+			serverLog: newServerLog("web-0", "/etc"),
+		},
+		{
+			name:      "allowed",
+			serverLog: withOutput(newServerLog("web-0", volumeDir), "es"),
+			policies:  []*logv1.LogCollectionPolicy{newPolicy("restricted", restricted)},
+		},
+		{
+			name:      "output not allowed",
+			serverLog: withOutput(newServerLog("web-0", volumeDir), "kafka"),
+			policies:  []*logv1.LogCollectionPolicy{newPolicy("restricted", restricted)},
+			want:      "spec.output",
+		},
+		{
+			name:      "host path not allowed",
+			serverLog: newServerLog("web-0", "/data/log"),
+			policies:  []*logv1.LogCollectionPolicy{newPolicy("restricted", restricted)},
+			want:      "status.sources[0].hostPath",
+		},
+		{
+			name:      "output of the containers",
+			serverLog: stdout,
+			policies:  []*logv1.LogCollectionPolicy{newPolicy("restricted", restricted)},
+		},
+		{
+			name:      "unresolved source",
+			serverLog: unresolved,
+			policies:  []*logv1.LogCollectionPolicy{newPolicy("restricted", restricted)},
+		},
+		{
+			name:      "rate over the maximum",
+			serverLog: withRate(newServerLog("web-0", volumeDir), 1000),
+			policies:  []*logv1.LogCollectionPolicy{newPolicy("slow", logv1.LogCollectionPolicySpec{MaxRate: &logv1.RateLimit{LinesPerSecond: 10}})},
+		},
+		{
+			name:      "policy of another namespace",
+			serverLog: newServerLog("web-0", "/data/log"),
+			policies: []*logv1.LogCollectionPolicy{newPolicy("other", logv1.LogCollectionPolicySpec{
+				Namespaces:          logv1.NamespaceSelection{Include: []string{"other"}},
+				AllowedPathPrefixes: []string{"/var/lib/kubelet/pods"},
+			})},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			for _, policy := range tt.policies {
+				objects = append(objects, policy)
+			}
+			f := newFixture(t, StatusOptions{}, objects...)
+			err := f.agent.checkPolicies(tt.serverLog)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("error %v, want one on %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func withOutput(serverLog *logv1.ServerLog, output string) *logv1.ServerLog {
+	serverLog.Spec.Output = output
+	return serverLog
+}
+
+func withRate(serverLog *logv1.ServerLog, lines int64) *logv1.ServerLog {
+	serverLog.Spec.RateLimit = &logv1.RateLimit{LinesPerSecond: lines}
+	return serverLog
+}
+
+func TestMaxRateOf(t *testing.T) {
+	mib := resource.MustParse("1Mi")
+	kib := resource.MustParse("1Ki")
+	tests := []struct {
+		name     string
+		policies []*logv1.LogCollectionPolicy
+		want     ratelimit.Limits
+	}{
+		{
+			name: "no policy",
+		},
+		{
+			name: "lowest of each rate",
+			policies: []*logv1.LogCollectionPolicy{
+				newPolicy("a", logv1.LogCollectionPolicySpec{MaxRate: &logv1.RateLimit{LinesPerSecond: 100, BytesPerSecond: &kib}}),
+				newPolicy("b", logv1.LogCollectionPolicySpec{MaxRate: &logv1.RateLimit{LinesPerSecond: 50, BytesPerSecond: &mib}}),
+				newPolicy("c", logv1.LogCollectionPolicySpec{}),
+			},
+			want: ratelimit.Limits{LinesPerSecond: 50, BytesPerSecond: 1024},
+		},
+		{
+			name: "policy excluding the namespace",
+			policies: []*logv1.LogCollectionPolicy{
+				newPolicy("a", logv1.LogCollectionPolicySpec{
+					Namespaces: logv1.NamespaceSelection{Exclude: []string{"default"}},
+					MaxRate:    &logv1.RateLimit{LinesPerSecond: 100},
+				}),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			for _, policy := range tt.policies {
+				objects = append(objects, policy)
+			}
+			f := newFixture(t, StatusOptions{}, objects...)
+			if got := f.agent.maxRateOf("default"); got != tt.want {
+				t.Errorf("maxRateOf %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitOfClampsToPolicy(t *testing.T) {
+	f := newFixture(t, StatusOptions{},
+		newPolicy("slow", logv1.LogCollectionPolicySpec{MaxRate: &logv1.RateLimit{LinesPerSecond: 10}}))
+	tests := []struct {
+		name  string
+		lines int64
+		want  int64
+	}{
+		{name: "unlimited", want: 10},
+		{name: "below the maximum", lines: 5, want: 5},
+		{name: "over the maximum", lines: 1000, want: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverLog := newServerLog("web-0", "/logs")
+			if tt.lines > 0 {
+				withRate(serverLog, tt.lines)
+			}
+			if got := f.agent.rateLimitOf(serverLog).LinesPerSecond; got != tt.want {
+				t.Errorf("lines per second %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/ratelimit"
+	"github.com/yshaojie/log-collector/internal/serverlog"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog/v2"
+)
+
+// enqueueForNamespace enqueues the ServerLogs of a namespace whose rate
+// limit annotations changed.
+func (a *Agent) enqueueForNamespace(old, obj interface{}) {
+	oldNs, ok := old.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+	ns, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+	if oldNs.Annotations[utils.AnnotationRateLimitLines] == ns.Annotations[utils.AnnotationRateLimitLines] &&
+		oldNs.Annotations[utils.AnnotationRateLimitBytes] == ns.Annotations[utils.AnnotationRateLimitBytes] {
+		return
+	}
+	serverLogs, err := a.lister.ServerLogs(ns.Name).List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, serverLog := range serverLogs {
+		a.enqueue(serverLog)
+	}
+}
+
+// rateLimitOf returns the rate limits of serverLog, those of its spec or
+// else of its namespace, lowered to the maximum of its policies.
+func (a *Agent) rateLimitOf(serverLog *logv1.ServerLog) ratelimit.Limits {
+	var annotations map[string]string
+	ns, err := a.namespaces.Get(serverLog.Namespace)
+	switch {
+	case err == nil:
+		annotations = ns.Annotations
+	case !errors.IsNotFound(err):
+		utilruntime.HandleError(err)
+	}
+	limits, err := ratelimit.LimitsOf(serverLog.Spec.RateLimit, annotations)
+	if err != nil {
+		klog.Error("invalid rate limit of namespace, ignore it, namespace=", serverLog.Namespace, " err=", err)
+	}
+	return limits.Clamp(a.maxRateOf(serverLog.Namespace))
+}
+
+// specWithoutRateLimit returns spec without the rate limit, which is
+// changed on a running collector.
+func specWithoutRateLimit(spec logv1.ServerLogSpec) logv1.ServerLogSpec {
+	spec.RateLimit = nil
+	return spec
+}
+
+// throttledCondition returns the Throttled condition of a ServerLog whose
+// lines waited for waited since the last report.
+func throttledCondition(serverLog *logv1.ServerLog, c *serverlog.Collector, waited time.Duration) metav1.Condition {
+	limits := c.RateLimit()
+	condition := metav1.Condition{
+		Type:               logv1.ConditionThrottled,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: serverLog.Generation,
+	}
+	switch {
+	case waited > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = logv1.ReasonRateLimited
+		condition.Message = fmt.Sprintf("reading is limited to %s, lines waited %s since the last report",
+			limits, waited.Round(time.Millisecond))
+	case limits.Unlimited():
+		condition.Reason = logv1.ReasonUnlimited
+		condition.Message = "reading is not limited"
+	default:
+		condition.Reason = logv1.ReasonWithinLimit
+		condition.Message = "reading is limited to " + limits.String()
+	}
+	return condition
+}
@@ -0,0 +1,474 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/checkpoint"
+	"github.com/yshaojie/log-collector/internal/event"
+	"github.com/yshaojie/log-collector/internal/metrics"
+	"github.com/yshaojie/log-collector/internal/serverlog"
+	"github.com/yshaojie/log-collector/internal/sink"
+	"github.com/yshaojie/log-collector/internal/tailer"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultStatusInterval    = 10 * time.Second
+	defaultStatusMinInterval = time.Minute
+	defaultStatusQPS         = 5
+	defaultStatusBurst       = 10
+)
+
+// StatusOptions configures how the agent reports the status of the
+// ServerLogs it collects.
+type StatusOptions struct {
+	// Interval is how often the status of every ServerLog is reported.
+	Interval time.Duration
+	// MinInterval is how often a status whose phase, conditions and error
+	// did not change may be patched, the counters and the lag of the
+	// ServerLog are sent together then.
+	MinInterval time.Duration
+	// QPS and Burst limit the status patches of all ServerLogs together.
+	QPS   float32
+	Burst int
+}
+
+func (o *StatusOptions) complete() {
+	if o.Interval <= 0 {
+		o.Interval = defaultStatusInterval
+	}
+	if o.MinInterval <= 0 {
+		o.MinInterval = defaultStatusMinInterval
+	}
+	if o.QPS <= 0 {
+		o.QPS = defaultStatusQPS
+	}
+	if o.Burst <= 0 {
+		o.Burst = defaultStatusBurst
+	}
+}
+
+// progress is what was shipped of a ServerLog since its status was last
+// reported.
+type progress struct {
+	lines int64
+	bytes int64
+	// offsets are the delivered offsets by file, they are used for the lag
+	// when there are no checkpoints.
+	offsets map[tailer.FileID]int64
+	// syncErr is why the ServerLog is not collected, "" if it is.
+	syncErr string
+	// policyErr is why the policies do not allow the ServerLog, "" if they do.
+	policyErr string
+	// throttled is the total time lines of the collector waited for the
+	// rate limit at the last report.
+	throttled time.Duration
+	// patched is when the status was last patched.
+	patched time.Time
+}
+
+// statusUpdate is the status patch of a ServerLog and the progress it
+// reports.
+type statusUpdate struct {
+	nn           types.NamespacedName
+	serverLog    *logv1.ServerLog
+	status       *logv1.ServerLogStatus
+	lines, bytes int64
+	// urgent is set when more than the counters, the lag and the files
+	// changed.
+	urgent  bool
+	patched time.Time
+}
+
+// progressOf returns the progress of nn, a.progressMu must be held.
+func (a *Agent) progressOf(nn types.NamespacedName) *progress {
+	p, ok := a.progress[nn]
+	if !ok {
+		p = &progress{offsets: map[tailer.FileID]int64{}}
+		a.progress[nn] = p
+	}
+	return p
+}
+
+// countDelivered adds the events a sink accepted to the progress of their
+// ServerLogs.
+func (a *Agent) countDelivered(events []*event.Event) {
+	a.progressMu.Lock()
+	defer a.progressMu.Unlock()
+	for _, ev := range events {
+		p := a.progressOf(ev.ServerLog)
+		p.lines++
+		p.bytes += int64(len(ev.Message))
+		p.offsets[ev.File] = ev.Offset
+	}
+}
+
+// setSyncError records why nn is not collected, nil once it is.
+func (a *Agent) setSyncError(nn types.NamespacedName, err error) {
+	a.progressMu.Lock()
+	defer a.progressMu.Unlock()
+	p := a.progressOf(nn)
+	p.syncErr = ""
+	if err != nil {
+		p.syncErr = err.Error()
+	}
+}
+
+// setPolicyError records why the policies do not allow nn, nil once they do.
+func (a *Agent) setPolicyError(nn types.NamespacedName, err error) {
+	a.progressMu.Lock()
+	defer a.progressMu.Unlock()
+	p := a.progressOf(nn)
+	p.policyErr = ""
+	if err != nil {
+		p.policyErr = err.Error()
+	}
+}
+
+// reportStatus patches the status of the ServerLogs of the node that
+// changed since they were last reported. Changed conditions are sent
+// first, changed counters at most every MinInterval, in the order they
+// were last sent. The patches not sent within Interval are left to the
+// next pass, their progress is sent together then.
+func (a *Agent) reportStatus(ctx context.Context) {
+	serverLogs, err := a.lister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	known := make(map[types.NamespacedName]bool, len(serverLogs))
+	var updates []*statusUpdate
+	now := time.Now()
+	for _, serverLog := range serverLogs {
+		nn := types.NamespacedName{Namespace: serverLog.Namespace, Name: serverLog.Name}
+		known[nn] = true
+		if serverLog.Spec.NodeName != a.nodeName || !serverLog.DeletionTimestamp.IsZero() {
+			continue
+		}
+		u := a.statusUpdate(nn, serverLog)
+		if equality.Semantic.DeepEqual(*u.status, serverLog.Status) {
+			continue
+		}
+		if !u.urgent && now.Sub(u.patched) < a.statusOpts.MinInterval {
+			continue
+		}
+		updates = append(updates, u)
+	}
+	sort.SliceStable(updates, func(i, j int) bool {
+		if updates[i].urgent != updates[j].urgent {
+			return updates[i].urgent
+		}
+		return updates[i].patched.Before(updates[j].patched)
+	})
+
+	passCtx, cancel := context.WithTimeout(ctx, a.statusOpts.Interval)
+	defer cancel()
+	for i, u := range updates {
+		if err := a.statusLimiter.Wait(passCtx); err != nil {
+			//剩余的留到下一轮合并上报
+			klog.Info("status patches left to the next report, count=", len(updates)-i)
+			break
+		}
+		if err := a.sendStatus(ctx, u); err != nil {
+			utilruntime.HandleError(fmt.Errorf("report status of server log %q failed: %w", u.nn, err))
+		}
+	}
+	a.progressMu.Lock()
+	for nn := range a.progress {
+		if !known[nn] {
+			delete(a.progress, nn)
+		}
+	}
+	a.progressMu.Unlock()
+}
+
+// statusUpdate computes the status of a ServerLog from its collector and
+// the progress not reported yet.
+func (a *Agent) statusUpdate(nn types.NamespacedName, serverLog *logv1.ServerLog) *statusUpdate {
+	a.mu.Lock()
+	c := a.collectors[nn]
+	output := a.currentOutput(serverLog)
+	a.mu.Unlock()
+
+	var files []serverlog.FileStat
+	if c != nil {
+		files = c.Files()
+	}
+	var waited time.Duration
+	a.progressMu.Lock()
+	p := a.progressOf(nn)
+	lines, bytes, syncErr, policyErr, patched := p.lines, p.bytes, p.syncErr, p.policyErr, p.patched
+	if c != nil {
+		throttled := c.Throttled()
+		waited = throttled - p.throttled
+		if throttled < p.throttled {
+			//collector重启后从0开始计数
+			waited = throttled
+		}
+		p.throttled = throttled
+	}
+	offsets := make(map[tailer.FileID]int64, len(files))
+	for _, f := range files {
+		if offset, ok := p.offsets[f.File]; ok {
+			offsets[f.File] = offset
+		}
+	}
+	//只保留仍在读取的文件
+	p.offsets = offsets
+	a.progressMu.Unlock()
+
+	status := serverLog.Status.DeepCopy()
+	status.LinesShipped += lines
+	status.BytesShipped += bytes
+	collecting := metav1.Condition{Type: logv1.ConditionCollecting, ObservedGeneration: serverLog.Generation}
+	switch {
+	case c != nil:
+		status.Phase = logv1.ServerLogRunning
+		collecting.Status = metav1.ConditionTrue
+		collecting.Reason = logv1.ReasonReading
+		collecting.Message = fmt.Sprintf("reading %d files", len(files))
+		status.Files, status.Lag = a.fileStatuses(nn, files, offsets)
+	case policyErr != "":
+		collecting.Status = metav1.ConditionFalse
+		collecting.Reason = logv1.ReasonPolicyViolation
+		collecting.Message = policyErr
+		status.Files, status.Lag = nil, 0
+	case !a.shouldCollect(serverLog):
+		collecting.Status = metav1.ConditionFalse
+		collecting.Reason = logv1.ReasonNoHostPath
+		collecting.Message = "no source can be read from the node"
+		status.Files, status.Lag = nil, 0
+	default:
+		collecting.Status = metav1.ConditionFalse
+		collecting.Reason = logv1.ReasonOutputUnavailable
+		collecting.Message = "waiting for log output " + serverLog.Spec.Output
+		if syncErr != "" {
+			collecting.Message = syncErr
+		}
+	}
+	meta.SetStatusCondition(&status.Conditions, collecting)
+	if c != nil {
+		meta.SetStatusCondition(&status.Conditions, throttledCondition(serverLog, c, waited))
+	}
+	metrics.CheckpointLag.WithLabelValues(nn.Namespace, nn.Name).Set(float64(status.Lag))
+
+	var sinkErr error
+	if output != nil {
+		sinkErr = output.Healthy()
+		meta.SetStatusCondition(&status.Conditions, sinkCondition(serverLog, sinkErr))
+	}
+	//保留最近一次错误，恢复后不清除
+	switch {
+	case sinkErr != nil:
+		status.LastError = sinkErr.Error()
+	case c != nil && c.LastError() != "":
+		status.LastError = c.LastError()
+	case syncErr != "":
+		status.LastError = syncErr
+	case policyErr != "":
+		status.LastError = policyErr
+	}
+
+	return &statusUpdate{
+		nn:        nn,
+		serverLog: serverLog,
+		status:    status,
+		lines:     lines,
+		bytes:     bytes,
+		urgent:    significantChange(&serverLog.Status, status),
+		patched:   patched,
+	}
+}
+
+// sendStatus patches the status of u and takes the progress it reported
+// off the progress to report.
+func (a *Agent) sendStatus(ctx context.Context, u *statusUpdate) error {
+	if err := a.patchStatus(ctx, u.serverLog, u.status); err != nil {
+		//缓存中的对象已过期，下次再上报
+		if errors.IsConflict(err) || errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	//上报成功后扣除已计入的数量
+	a.progressMu.Lock()
+	p := a.progressOf(u.nn)
+	p.lines -= u.lines
+	p.bytes -= u.bytes
+	p.patched = time.Now()
+	a.progressMu.Unlock()
+	return nil
+}
+
+// significantChange reports whether the phase, the error or the status or
+// reason of a condition differ. Messages, counters and the lag change all
+// the time and are sent less often.
+func significantChange(old, status *logv1.ServerLogStatus) bool {
+	if old.Phase != status.Phase || old.LastError != status.LastError ||
+		len(old.Conditions) != len(status.Conditions) {
+		return true
+	}
+	for _, condition := range status.Conditions {
+		previous := meta.FindStatusCondition(old.Conditions, condition.Type)
+		if previous == nil || previous.Status != condition.Status || previous.Reason != condition.Reason ||
+			previous.ObservedGeneration != condition.ObservedGeneration {
+			return true
+		}
+	}
+	return false
+}
+
+// fileStatuses returns the files lagging most behind and the lag of all
+// files. The offset of a file is the delivered one, or the checkpoint
+// written before the agent restarted.
+func (a *Agent) fileStatuses(nn types.NamespacedName, files []serverlog.FileStat, offsets map[tailer.FileID]int64) ([]logv1.FileStatus, int64) {
+	statuses := make([]logv1.FileStatus, 0, len(files))
+	var lag int64
+	for _, f := range files {
+		offset, ok := offsets[f.File]
+		if !ok && a.opts.Checkpoints != nil {
+			if pos, found := a.opts.Checkpoints.Get(checkpoint.Key{ServerLog: nn, File: f.File}); found {
+				offset = pos.Offset
+			}
+		}
+		//copytruncate后offset可能大于文件大小
+		fileLag := f.Size - offset
+		if fileLag < 0 {
+			fileLag = 0
+		}
+		lag += fileLag
+		statuses = append(statuses, logv1.FileStatus{Path: f.Path, Offset: offset, Size: f.Size, Lag: fileLag})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Lag != statuses[j].Lag {
+			return statuses[i].Lag > statuses[j].Lag
+		}
+		return statuses[i].Path < statuses[j].Path
+	})
+	if len(statuses) > logv1.MaxFileStatuses {
+		statuses = statuses[:logv1.MaxFileStatuses]
+	}
+	if len(statuses) == 0 {
+		statuses = nil
+	}
+	return statuses, lag
+}
+
+func sinkCondition(serverLog *logv1.ServerLog, err error) metav1.Condition {
+	if err != nil {
+		return metav1.Condition{
+			Type:               logv1.ConditionSinkHealthy,
+			Status:             metav1.ConditionFalse,
+			Reason:             logv1.ReasonWriteFailed,
+			Message:            err.Error(),
+			ObservedGeneration: serverLog.Generation,
+		}
+	}
+	return metav1.Condition{
+		Type:               logv1.ConditionSinkHealthy,
+		Status:             metav1.ConditionTrue,
+		Reason:             logv1.ReasonDelivering,
+		Message:            "the output accepts records",
+		ObservedGeneration: serverLog.Generation,
+	}
+}
+
+// currentOutput returns the Output serverLog ships to, nil if it was not
+// built yet. a.mu must be held.
+func (a *Agent) currentOutput(serverLog *logv1.ServerLog) *sink.Output {
+	if serverLog.Spec.Output == "" {
+		return a.defaultOutput
+	}
+	entry, ok := a.outputs[types.NamespacedName{Namespace: serverLog.Namespace, Name: serverLog.Spec.Output}]
+	if !ok {
+		return nil
+	}
+	return entry.output
+}
+
+// patchStatus writes the fields of status owned by the agent through the
+// status subresource. A merge patch replaces lists as a whole, the
+// resourceVersion makes it fail instead of overwriting conditions the
+// controller set in the meantime.
+func (a *Agent) patchStatus(ctx context.Context, serverLog *logv1.ServerLog, status *logv1.ServerLogStatus) error {
+	//nil的files序列化为null，清除原有的值
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": serverLog.ResourceVersion,
+		},
+		"status": map[string]interface{}{
+			"phase":        status.Phase,
+			"conditions":   status.Conditions,
+			"files":        status.Files,
+			"lag":          status.Lag,
+			"linesShipped": status.LinesShipped,
+			"bytesShipped": status.BytesShipped,
+			"lastError":    status.LastError,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = a.client.ServerLogs(serverLog.Namespace).Patch(ctx, serverLog.Name, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
+
+// reportDrained records the outcome of draining a deleted ServerLog. It is
+// best effort, only drainErr decides whether the finalizer is removed.
+func (a *Agent) reportDrained(ctx context.Context, serverLog *logv1.ServerLog, drainErr error) {
+	nn := types.NamespacedName{Namespace: serverLog.Namespace, Name: serverLog.Name}
+	status := serverLog.Status.DeepCopy()
+	a.progressMu.Lock()
+	p := a.progressOf(nn)
+	status.LinesShipped += p.lines
+	status.BytesShipped += p.bytes
+	a.progressMu.Unlock()
+	drained := metav1.Condition{
+		Type:               logv1.ConditionDrained,
+		Status:             metav1.ConditionTrue,
+		Reason:             logv1.ReasonDrained,
+		Message:            "every record left in the files was shipped",
+		ObservedGeneration: serverLog.Generation,
+	}
+	switch {
+	case drainErr == nil:
+		status.Phase = logv1.ServerLogCompleted
+		status.Files, status.Lag = nil, 0
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               logv1.ConditionCollecting,
+			Status:             metav1.ConditionFalse,
+			Reason:             logv1.ReasonDrained,
+			Message:            "the server log is deleted",
+			ObservedGeneration: serverLog.Generation,
+		})
+	case drainErr == context.DeadlineExceeded:
+		drained.Status = metav1.ConditionFalse
+		drained.Reason = logv1.ReasonDrainTimeout
+		drained.Message = fmt.Sprintf("files were not read to the end within %s", serverLogDrainTimeout)
+		status.LastError = drained.Message
+	default:
+		drained.Status = metav1.ConditionFalse
+		drained.Reason = logv1.ReasonDrainFailed
+		drained.Message = drainErr.Error()
+		status.LastError = drainErr.Error()
+	}
+	meta.SetStatusCondition(&status.Conditions, drained)
+	if equality.Semantic.DeepEqual(*status, serverLog.Status) {
+		return
+	}
+	if err := a.patchStatus(ctx, serverLog, status); err != nil && !errors.IsNotFound(err) {
+		klog.Error("report drained status failed, name=", serverLog.Namespace, "/", serverLog.Name, " err=", err)
+	}
+}
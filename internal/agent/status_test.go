@@ -0,0 +1,323 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/event"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// statusPatch is a status patch sent by the agent.
+type statusPatch struct {
+	name   string
+	status logv1.ServerLogStatus
+}
+
+// statusPatches returns the status patches sent since the last call.
+func (f *fixture) statusPatches(t *testing.T) []statusPatch {
+	t.Helper()
+	var patches []statusPatch
+	for _, action := range f.client.Actions() {
+		patch, ok := action.(k8stesting.PatchAction)
+		if !ok || patch.GetSubresource() != "status" {
+			continue
+		}
+		var obj logv1.ServerLog
+		if err := json.Unmarshal(patch.GetPatch(), &obj); err != nil {
+			t.Fatal(err)
+		}
+		patches = append(patches, statusPatch{name: patch.GetName(), status: obj.Status})
+	}
+	f.client.ClearActions()
+	return patches
+}
+
+// ship counts lines events of the ServerLog name as delivered.
+func (f *fixture) ship(name string, lines int) {
+	events := make([]*event.Event, lines)
+	for i := range events {
+		events[i] = &event.Event{ServerLog: types.NamespacedName{Namespace: "default", Name: name}, Message: "hello"}
+	}
+	f.agent.countDelivered(events)
+}
+
+func patchedNames(patches []statusPatch) []string {
+	names := make([]string, 0, len(patches))
+	for _, patch := range patches {
+		names = append(names, patch.name)
+	}
+	return names
+}
+
+// settle caches serverLog with the status the agent reports for it, as if
+// that status was patched ago.
+func (f *fixture) settle(t *testing.T, serverLog *logv1.ServerLog, ago time.Duration) *logv1.ServerLog {
+	t.Helper()
+	nn := types.NamespacedName{Namespace: serverLog.Namespace, Name: serverLog.Name}
+	serverLog = serverLog.DeepCopy()
+	serverLog.Status = *f.agent.statusUpdate(nn, serverLog).status
+	f.set(t, serverLog)
+	f.setPatched(serverLog.Name, time.Now().Add(-ago))
+	return serverLog
+}
+
+func (f *fixture) setPatched(name string, patched time.Time) {
+	f.agent.progressMu.Lock()
+	defer f.agent.progressMu.Unlock()
+	f.agent.progressOf(types.NamespacedName{Namespace: "default", Name: name}).patched = patched
+}
+
+func (f *fixture) progress(name string) progress {
+	f.agent.progressMu.Lock()
+	defer f.agent.progressMu.Unlock()
+	return *f.agent.progressOf(types.NamespacedName{Namespace: "default", Name: name})
+}
+
+func TestReportStatusReading(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.log"), "one\ntwo\n")
+	f := newFixture(t, StatusOptions{}, newServerLog("web-0", dir))
+	if err := f.sync("web-0"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for f.progress("web-0").lines < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("lines not delivered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	f.agent.reportStatus(context.Background())
+	patches := f.statusPatches(t)
+	if len(patches) != 1 {
+		t.Fatalf("%d status patches, want 1", len(patches))
+	}
+	status := patches[0].status
+	if status.Phase != logv1.ServerLogRunning || status.LinesShipped != 2 || status.BytesShipped != 6 {
+		t.Errorf("phase %s, %d lines and %d bytes shipped, want running with 2 lines and 6 bytes", status.Phase, status.LinesShipped, status.BytesShipped)
+	}
+	collecting := meta.FindStatusCondition(status.Conditions, logv1.ConditionCollecting)
+	if collecting == nil || collecting.Reason != logv1.ReasonReading || collecting.Message != "reading 1 files" {
+		t.Errorf("collecting %+v, want reading 1 file", collecting)
+	}
+	if !meta.IsStatusConditionTrue(status.Conditions, logv1.ConditionSinkHealthy) {
+		t.Errorf("conditions %+v, want a healthy sink", status.Conditions)
+	}
+	if len(status.Files) != 1 || status.Files[0].Offset != 8 || status.Files[0].Size != 8 || status.Lag != 0 {
+		t.Errorf("files %+v lag %d, want app.log read to the end", status.Files, status.Lag)
+	}
+	if p := f.progress("web-0"); p.lines != 0 || p.bytes != 0 {
+		t.Errorf("progress %d lines %d bytes after the patch, want it taken off", p.lines, p.bytes)
+	}
+}
+
+func TestReportStatusNotCollecting(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(serverLog *logv1.ServerLog)
+		reason string
+		// message is a part of the message of the Collecting condition.
+		message string
+	}{
+		{
+			name:    "missing output",
+			change:  func(serverLog *logv1.ServerLog) { serverLog.Spec.Output = "missing" },
+			reason:  logv1.ReasonOutputUnavailable,
+			message: "missing",
+		},
+		{
+			name:    "no host path",
+			change:  func(serverLog *logv1.ServerLog) { serverLog.Status.Sources = nil },
+			reason:  logv1.ReasonNoHostPath,
+			message: "no source",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverLog := newServerLog("web-0", t.TempDir())
+			tt.change(serverLog)
+			f := newFixture(t, StatusOptions{}, serverLog)
+			// the sync of a ServerLog without output fails
+			f.sync("web-0")
+
+			f.agent.reportStatus(context.Background())
+			patches := f.statusPatches(t)
+			if len(patches) != 1 {
+				t.Fatalf("%d status patches, want 1", len(patches))
+			}
+			collecting := meta.FindStatusCondition(patches[0].status.Conditions, logv1.ConditionCollecting)
+			if collecting == nil || collecting.Status != metav1.ConditionFalse || collecting.Reason != tt.reason || !strings.Contains(collecting.Message, tt.message) {
+				t.Errorf("collecting %+v, want %s about %q", collecting, tt.reason, tt.message)
+			}
+		})
+	}
+}
+
+func TestReportStatusMinInterval(t *testing.T) {
+	serverLog := newServerLog("web-0", t.TempDir())
+	f := newFixture(t, StatusOptions{MinInterval: time.Minute}, serverLog)
+	ctx := context.Background()
+
+	f.agent.reportStatus(ctx)
+	if patches := f.statusPatches(t); len(patches) != 1 {
+		t.Fatalf("%d patches of a new status, want 1", len(patches))
+	}
+	f.settle(t, serverLog, 0)
+	f.agent.reportStatus(ctx)
+	if patches := f.statusPatches(t); len(patches) != 0 {
+		t.Fatalf("%d patches of an unchanged status, want 0", len(patches))
+	}
+
+	// counters wait for MinInterval
+	f.ship("web-0", 2)
+	f.agent.reportStatus(ctx)
+	if patches := f.statusPatches(t); len(patches) != 0 {
+		t.Fatalf("%d patches of counters within MinInterval, want 0", len(patches))
+	}
+	f.setPatched("web-0", time.Now().Add(-2*time.Minute))
+	f.agent.reportStatus(ctx)
+	patches := f.statusPatches(t)
+	if len(patches) != 1 || patches[0].status.LinesShipped != 2 || patches[0].status.BytesShipped != 10 {
+		t.Fatalf("patches %+v, want 2 lines and 10 bytes", patches)
+	}
+	if p := f.progress("web-0"); p.lines != 0 || p.bytes != 0 || time.Since(p.patched) > time.Minute {
+		t.Errorf("progress %d lines %d bytes patched at %v after the patch, want it taken off", p.lines, p.bytes, p.patched)
+	}
+}
+
+func TestReportStatusOrder(t *testing.T) {
+	var objects []runtime.Object
+	for _, name := range []string{"a", "b", "c", "d"} {
+		objects = append(objects, newServerLog(name, "/logs/"+name))
+	}
+	f := newFixture(t, StatusOptions{MinInterval: time.Minute}, objects...)
+	for _, obj := range objects {
+		f.settle(t, obj.(*logv1.ServerLog), 0)
+	}
+	f.setPatched("a", time.Now().Add(-2*time.Minute))
+	f.setPatched("b", time.Now().Add(-3*time.Minute))
+	f.ship("a", 1)
+	f.ship("b", 1)
+	// c changed within MinInterval but its error changed, d only its
+	// counters
+	f.agent.setSyncError(types.NamespacedName{Namespace: "default", Name: "c"}, errors.New("log output not found"))
+	f.ship("d", 1)
+
+	f.agent.reportStatus(context.Background())
+	got := patchedNames(f.statusPatches(t))
+	if want := []string{"c", "b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("patched %v, want %v", got, want)
+	}
+}
+
+func TestReportStatusCarriesOverUnsent(t *testing.T) {
+	a, b := newServerLog("a", "/logs/a"), newServerLog("b", "/logs/b")
+	f := newFixture(t, StatusOptions{Interval: 50 * time.Millisecond, MinInterval: time.Minute, QPS: 0.1, Burst: 1}, a, b)
+	f.settle(t, a, 3*time.Minute)
+	f.settle(t, b, 2*time.Minute)
+	f.ship("a", 1)
+	f.ship("b", 1)
+
+	// one patch fits within Interval, b waits for the next pass
+	f.agent.reportStatus(context.Background())
+	if got := patchedNames(f.statusPatches(t)); len(got) != 1 || got[0] != "a" {
+		t.Fatalf("patched %v, want [a]", got)
+	}
+	f.ship("b", 2)
+	f.agent.statusLimiter = flowcontrol.NewFakeAlwaysRateLimiter()
+	f.agent.reportStatus(context.Background())
+	patches := f.statusPatches(t)
+	if len(patches) != 1 || patches[0].name != "b" || patches[0].status.LinesShipped != 3 {
+		t.Fatalf("patches %+v, want the 3 lines of b", patches)
+	}
+}
+
+func TestSendStatus(t *testing.T) {
+	resource := schema.GroupResource{Group: logv1.GroupVersion.Group, Resource: "serverlogs"}
+	tests := []struct {
+		name     string
+		patchErr error
+		wantErr  bool
+		// sent is whether the progress was taken off.
+		sent bool
+	}{
+		{name: "patched", sent: true},
+		{name: "conflict", patchErr: apierrors.NewConflict(resource, "web-0", errors.New("modified"))},
+		{name: "not found", patchErr: apierrors.NewNotFound(resource, "web-0")},
+		{name: "failed", patchErr: apierrors.NewInternalError(errors.New("etcd unavailable")), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverLog := newServerLog("web-0", t.TempDir())
+			f := newFixture(t, StatusOptions{}, serverLog)
+			if tt.patchErr != nil {
+				f.client.PrependReactor("patch", "serverlogs", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tt.patchErr
+				})
+			}
+			f.ship("web-0", 2)
+			u := f.agent.statusUpdate(types.NamespacedName{Namespace: "default", Name: "web-0"}, serverLog)
+			// lines delivered while the patch is sent are reported next time
+			f.ship("web-0", 1)
+
+			err := f.agent.sendStatus(context.Background(), u)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			p := f.progress("web-0")
+			wantLines := int64(3)
+			if tt.sent {
+				wantLines = 1
+			}
+			if p.lines != wantLines || p.patched.IsZero() != !tt.sent {
+				t.Errorf("progress %d lines patched at %v, want %d lines", p.lines, p.patched, wantLines)
+			}
+		})
+	}
+}
+
+func TestSignificantChange(t *testing.T) {
+	serverLog := newServerLog("web-0", t.TempDir())
+	f := newFixture(t, StatusOptions{}, serverLog)
+	serverLog = f.settle(t, serverLog, 0)
+	old := serverLog.Status
+
+	tests := []struct {
+		name   string
+		change func(status *logv1.ServerLogStatus)
+		want   bool
+	}{
+		{name: "counters", change: func(status *logv1.ServerLogStatus) { status.LinesShipped++; status.Lag = 10 }},
+		{name: "message", change: func(status *logv1.ServerLogStatus) { status.Conditions[0].Message = "reading 2 files" }},
+		{name: "phase", change: func(status *logv1.ServerLogStatus) { status.Phase = logv1.ServerLogRunning }, want: true},
+		{name: "error", change: func(status *logv1.ServerLogStatus) { status.LastError = "failed" }, want: true},
+		{name: "reason", change: func(status *logv1.ServerLogStatus) { status.Conditions[0].Reason = logv1.ReasonReading }, want: true},
+		{name: "generation", change: func(status *logv1.ServerLogStatus) { status.Conditions[0].ObservedGeneration++ }, want: true},
+		{name: "condition", change: func(status *logv1.ServerLogStatus) { status.Conditions = status.Conditions[1:] }, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := old.DeepCopy()
+			tt.change(status)
+			if got := significantChange(&old, status); got != tt.want {
+				t.Errorf("significant %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yshaojie/log-collector/internal/atomicfile"
+	"github.com/yshaojie/log-collector/internal/tailer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const fileVersion = 1
+
+// Key identifies a file collected for a ServerLog. The file identity is part
+// of the key, so a reused pod name never resumes from another file's offset.
+type Key struct {
+	ServerLog types.NamespacedName
+	File      tailer.FileID
+}
+
+func (k Key) String() string {
+	return fmt.Sprintf("%s@%s", k.ServerLog, k.File)
+}
+
+// Position is the progress recorded for a Key.
+type Position struct {
+	// Path is the last path the file was read at.
+	Path string
+	// Position holds the offset just past the last delivered line, the
+	// truncations of the file before it and the start of the file.
+	tailer.Position
+	// UpdateTime is when the position last changed.
+	UpdateTime time.Time
+}
+
+// Store keeps the read offsets of every collected file and persists them to
+// a local JSON file.
+type Store struct {
+	path string
+
+	// flushMu serializes Flush from the snapshot to the rename, so an older
+	// snapshot is never written after a newer one.
+	flushMu sync.Mutex
+
+	mu        sync.Mutex
+	positions map[Key]Position
+	dirty     bool
+}
+
+// entry is the on-disk form of a Key and its Position.
+type entry struct {
+	Namespace  string    `json:"namespace"`
+	Name       string    `json:"name"`
+	Device     uint64    `json:"device"`
+	Inode      uint64    `json:"inode"`
+	Path       string    `json:"path"`
+	Offset     int64     `json:"offset"`
+	Generation uint64    `json:"generation,omitempty"`
+	HeadSize   int64     `json:"headSize,omitempty"`
+	HeadHash   uint64    `json:"headHash,omitempty"`
+	UpdateTime time.Time `json:"updateTime"`
+}
+
+type storeFile struct {
+	Version int     `json:"version"`
+	Entries []entry `json:"entries"`
+}
+
+// Open loads the store saved at path. A missing file yields an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:      path,
+		positions: map[Key]Position{},
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decode checkpoint file %s: %w", path, err)
+	}
+	if file.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported checkpoint file version %d in %s", file.Version, path)
+	}
+	for _, e := range file.Entries {
+		key := Key{
+			ServerLog: types.NamespacedName{Namespace: e.Namespace, Name: e.Name},
+			File:      tailer.FileID{Device: e.Device, Inode: e.Inode},
+		}
+		s.positions[key] = Position{
+			Path: e.Path,
+			Position: tailer.Position{
+				Offset:     e.Offset,
+				Generation: e.Generation,
+				Head:       tailer.Head{Size: e.HeadSize, Hash: e.HeadHash},
+			},
+			UpdateTime: e.UpdateTime,
+		}
+	}
+	return s, nil
+}
+
+// Get returns the position recorded for key.
+func (s *Store) Get(key Key) (Position, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pos, ok := s.positions[key]
+	return pos, ok
+}
+
+// Set records the position of key. It is kept in memory until the next Flush.
+func (s *Store) Set(key Key, path string, position tailer.Position) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pos, ok := s.positions[key]
+	if ok && pos.Path == path && pos.Position == position {
+		return
+	}
+	s.positions[key] = Position{Path: path, Position: position, UpdateTime: time.Now()}
+	s.dirty = true
+}
+
+// Delete forgets key.
+func (s *Store) Delete(key Key) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.positions[key]; ok {
+		delete(s.positions, key)
+		s.dirty = true
+	}
+}
+
+// Prune forgets every position for which keep returns false.
+func (s *Store) Prune(keep func(key Key, pos Position) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, pos := range s.positions {
+		if !keep(key, pos) {
+			delete(s.positions, key)
+			s.dirty = true
+		}
+	}
+}
+
+// Flush writes the store to disk if it changed since the last Flush. The file
+// is replaced atomically, so a crash never leaves a half written store.
+// Concurrent calls write one after the other.
+func (s *Store) Flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	file := storeFile{Version: fileVersion, Entries: make([]entry, 0, len(s.positions))}
+	for key, pos := range s.positions {
+		file.Entries = append(file.Entries, entry{
+			Namespace:  key.ServerLog.Namespace,
+			Name:       key.ServerLog.Name,
+			Device:     key.File.Device,
+			Inode:      key.File.Inode,
+			Path:       pos.Path,
+			Offset:     pos.Offset,
+			Generation: pos.Generation,
+			HeadSize:   pos.Head.Size,
+			HeadHash:   pos.Head.Hash,
+			UpdateTime: pos.UpdateTime,
+		})
+	}
+	s.dirty = false
+	s.mu.Unlock()
+
+	sort.Slice(file.Entries, func(i, j int) bool {
+		a, b := file.Entries[i], file.Entries[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Inode < b.Inode
+	})
+	data, err := json.Marshal(&file)
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.Write(s.path, data); err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Run flushes the store every interval until ctx is cancelled, then flushes
+// one last time.
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Flush(); err != nil {
+				klog.Error("flush checkpoint failed, path=", s.path, " err=", err)
+			}
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				klog.Error("flush checkpoint failed, path=", s.path, " err=", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/yshaojie/log-collector/internal/tailer"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "checkpoints.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := Key{
+		ServerLog: types.NamespacedName{Namespace: "default", Name: "web-0"},
+		File:      tailer.FileID{Device: 2049, Inode: 1234},
+	}
+	head := tailer.Head{Size: 1024, Hash: 0xcbf29ce484222325}
+	s.Set(key, "/data/log/app.log", tailer.Position{Offset: 42, Generation: 3, Head: head})
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos, ok := reopened.Get(key)
+	if !ok || pos.Offset != 42 || pos.Generation != 3 || pos.Head != head || pos.Path != "/data/log/app.log" {
+		t.Fatalf("unexpected position %+v, found=%v", pos, ok)
+	}
+
+	//同名ServerLog的另一个文件不能复用该位置
+	other := key
+	other.File.Inode = 5678
+	if _, ok := reopened.Get(other); ok {
+		t.Fatalf("position found for a different file")
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keep := Key{ServerLog: types.NamespacedName{Namespace: "default", Name: "a"}}
+	drop := Key{ServerLog: types.NamespacedName{Namespace: "default", Name: "b"}}
+	s.Set(keep, "/a.log", tailer.Position{Offset: 1})
+	s.Set(drop, "/b.log", tailer.Position{Offset: 1})
+	s.Prune(func(key Key, pos Position) bool { return key == keep })
+	if _, ok := s.Get(keep); !ok {
+		t.Fatalf("kept position was pruned")
+	}
+	if _, ok := s.Get(drop); ok {
+		t.Fatalf("position was not pruned")
+	}
+}
+
+func TestStoreConcurrentFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := Key{ServerLog: types.NamespacedName{Namespace: "default", Name: "a"}}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := s.Flush(); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	for offset := int64(1); offset <= 200; offset++ {
+		s.Set(key, "/a.log", tailer.Position{Offset: offset})
+	}
+	wg.Wait()
+	//最后一次Flush之后文件中必须是最新的位置
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos, _ := reopened.Get(key); pos.Offset != 200 {
+		t.Fatalf("stale offset %d written last", pos.Offset)
+	}
+}
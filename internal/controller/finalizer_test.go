@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// deletedServerLog returns the ServerLog of a deleted Pod, held by the agent
+// finalizer.
+func deletedServerLog(t *testing.T, r *ServerLogReconciler) *logv1.ServerLog {
+	t.Helper()
+	serverLog := &logv1.ServerLog{}
+	key := types.NamespacedName{Namespace: "default", Name: "web-0"}
+	if err := r.Get(context.Background(), key, serverLog); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Delete(context.Background(), serverLog); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.Background(), key, serverLog); err != nil {
+		t.Fatal(err)
+	}
+	if serverLog.DeletionTimestamp.IsZero() {
+		t.Fatal("server log is not terminating")
+	}
+	return serverLog
+}
+
+func newOwnedServerLog(nodeName string) *logv1.ServerLog {
+	controller := true
+	return &logv1.ServerLog{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "web-0",
+			Finalizers:      []string{utils.FinalizerNameAgentHolder},
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "Pod", Name: "web-0", UID: "web-0-uid", Controller: &controller}},
+		},
+		Spec: logv1.ServerLogSpec{Dir: "/data/log", NodeName: nodeName},
+	}
+}
+
+func reconcileDeleted(t *testing.T, r *ServerLogReconciler) ctrl.Result {
+	t.Helper()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-0"}}
+	result, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestFinalizerKeptWhileAgentDrains(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, node, newOwnedServerLog("node-1"))
+	deletedServerLog(t, r)
+
+	result := reconcileDeleted(t, r)
+	if result.RequeueAfter <= 0 || result.RequeueAfter > DefaultFinalizerTimeout {
+		t.Errorf("requeue after %v", result.RequeueAfter)
+	}
+	serverLog := &logv1.ServerLog{}
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web-0"}, serverLog); err != nil {
+		t.Fatal(err)
+	}
+	if !containString(serverLog.Finalizers, utils.FinalizerNameAgentHolder) {
+		t.Error("finalizer removed before the timeout")
+	}
+}
+
+func TestFinalizerRemovedAfterTimeout(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, node, newOwnedServerLog("node-1"))
+	r.FinalizerTimeout = time.Nanosecond
+	deletedServerLog(t, r)
+
+	reconcileDeleted(t, r)
+	err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web-0"}, &logv1.ServerLog{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("server log still exists, err=%v", err)
+	}
+}
+
+func TestFinalizerRemovedWhenNodeLost(t *testing.T) {
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, newOwnedServerLog("node-1"))
+	deletedServerLog(t, r)
+
+	reconcileDeleted(t, r)
+	err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web-0"}, &logv1.ServerLog{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("server log still exists, err=%v", err)
+	}
+}
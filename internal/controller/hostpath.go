@@ -0,0 +1,247 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// DefaultKubeletRootDir is the root directory of the kubelet, the volumes of
+// a Pod are under <root>/pods/<uid>/volumes.
+const DefaultKubeletRootDir = "/var/lib/kubelet"
+
+// DefaultPodLogDir is where the kubelet keeps the output of the containers,
+// in <dir>/<namespace>_<pod>_<uid>/<container>.
+const DefaultPodLogDir = "/var/log/pods"
+
+// unresolvedError tells why a directory has no path on the node.
+type unresolvedError struct {
+	reason  string
+	message string
+}
+
+func (e *unresolvedError) Error() string {
+	return e.message
+}
+
+func unresolved(reason, format string, args ...interface{}) error {
+	return &unresolvedError{reason: reason, message: fmt.Sprintf(format, args...)}
+}
+
+// setHostPaths resolves the sources of serverLog to directories on the node
+// and sets the VolumeBacked condition. A directory the LogCollectionPolicies
+// of the namespace do not allow is left unresolved. It returns an error only
+// when the claims, volumes or policies cannot be read.
+func (r *ServerLogReconciler) setHostPaths(ctx context.Context, pod *v1.Pod, serverLog *logv1.ServerLog) error {
+	policies, err := r.policiesOf(ctx, pod.Namespace)
+	if err != nil {
+		return err
+	}
+	sources := serverLog.Spec.EffectiveSources()
+	statuses := make([]logv1.SourceStatus, 0, len(sources))
+	condition := metav1.Condition{
+		Type:               logv1.ConditionVolumeBacked,
+		Status:             metav1.ConditionTrue,
+		Reason:             logv1.ReasonResolved,
+		Message:            "every source can be read from the node",
+		ObservedGeneration: serverLog.Generation,
+	}
+	var problems []string
+	for _, source := range sources {
+		if source.IsContainerStdout() {
+			//容器输出目录由kubelet创建，其下的目录和文件属于Pod
+			logDir := r.podLogDir(pod)
+			statuses = append(statuses, logv1.SourceStatus{Name: source.Name, HostPath: logDir, VolumeRoot: logDir})
+			continue
+		}
+		hostPath, volumeRoot, err := r.hostPath(ctx, pod, source.Dir)
+		if err == nil {
+			err = checkHostPath(policies, source.Dir, hostPath)
+		}
+		if err != nil {
+			e, ok := err.(*unresolvedError)
+			if !ok {
+				return err
+			}
+			//只记录第一个原因，message中列出所有source
+			if condition.Status == metav1.ConditionTrue {
+				condition.Status = metav1.ConditionFalse
+				condition.Reason = e.reason
+			}
+			problems = append(problems, "source "+source.Name+": "+e.message)
+			//不把策略不允许的目录交给agent
+			hostPath, volumeRoot = "", ""
+		}
+		statuses = append(statuses, logv1.SourceStatus{Name: source.Name, Dir: source.Dir, HostPath: hostPath, VolumeRoot: volumeRoot})
+	}
+	if len(problems) > 0 {
+		condition.Message = strings.Join(problems, "; ")
+	}
+	serverLog.Status.Sources = statuses
+	serverLog.Status.HostPath = ""
+	if len(statuses) > 0 {
+		serverLog.Status.HostPath = statuses[0].HostPath
+	}
+	meta.SetStatusCondition(&serverLog.Status.Conditions, condition)
+	return nil
+}
+
+// policiesOf returns the LogCollectionPolicies selecting namespace.
+func (r *ServerLogReconciler) policiesOf(ctx context.Context, namespace string) ([]logv1.LogCollectionPolicy, error) {
+	var policies logv1.LogCollectionPolicyList
+	if err := r.List(ctx, &policies); err != nil {
+		return nil, err
+	}
+	var selecting []logv1.LogCollectionPolicy
+	for _, policy := range policies.Items {
+		if policy.Spec.Namespaces.Selects(namespace) {
+			selecting = append(selecting, policy)
+		}
+	}
+	return selecting, nil
+}
+
+// checkHostPath returns an unresolved error when one of policies does not
+// allow hostPath, where dir is on the node.
+func checkHostPath(policies []logv1.LogCollectionPolicy, dir, hostPath string) error {
+	for i := range policies {
+		if err := policies[i].CheckHostPath(hostPath); err != nil {
+			return unresolved(logv1.ReasonPolicyViolation, "%s is %s on the node, %v", dir, hostPath, err)
+		}
+	}
+	return nil
+}
+
+// hostPath returns the directory on the node of dir, a directory in a
+// container of the Pod, and the directory of the volume holding it. dir must
+// be on an emptyDir, hostPath or persistentVolumeClaim volume, the node
+// cannot see the container filesystem. The volume root is where the Pod
+// starts to control the path: its subPath and the directories below may be
+// symlinks the agent must not follow.
+func (r *ServerLogReconciler) hostPath(ctx context.Context, pod *v1.Pod, dir string) (hostPath, volumeRoot string, err error) {
+	dir = path.Clean(dir)
+	mount := findMount(pod, dir)
+	if mount == nil {
+		return "", "", unresolved(logv1.ReasonNotVolumeBacked, "%s is not on a volume, mount an emptyDir, hostPath or persistentVolumeClaim volume there", dir)
+	}
+	if mount.SubPathExpr != "" {
+		return "", "", unresolved(logv1.ReasonVolumeUnresolved, "%s is on volume %s mounted with subPathExpr", dir, mount.Name)
+	}
+	var volume *v1.Volume
+	for i := range pod.Spec.Volumes {
+		if pod.Spec.Volumes[i].Name == mount.Name {
+			volume = &pod.Spec.Volumes[i]
+			break
+		}
+	}
+	if volume == nil {
+		return "", "", unresolved(logv1.ReasonVolumeUnresolved, "volume %s of %s not found", mount.Name, dir)
+	}
+	root, onHost, err := r.volumeHostPath(ctx, pod, volume)
+	if err != nil {
+		return "", "", err
+	}
+	rel := strings.TrimPrefix(dir, path.Clean(mount.MountPath))
+	hostPath = path.Join(root, mount.SubPath, rel)
+	//hostPath和local卷可以指向节点上任意目录
+	if sensitive := logv1.SensitiveDir(hostPath); onHost && sensitive != "" {
+		return "", "", unresolved(logv1.ReasonSensitiveHostPath, "%s is %s on the node, %s is a sensitive directory and must not be collected", dir, hostPath, sensitive)
+	}
+	return hostPath, root, nil
+}
+
+// findMount returns the volume mount of the containers of the Pod holding
+// dir, the deepest one when mounts are nested.
+func findMount(pod *v1.Pod, dir string) *v1.VolumeMount {
+	var found *v1.VolumeMount
+	for i := range pod.Spec.Containers {
+		mounts := pod.Spec.Containers[i].VolumeMounts
+		for j := range mounts {
+			mountPath := path.Clean(mounts[j].MountPath)
+			if dir != mountPath && !strings.HasPrefix(dir, strings.TrimSuffix(mountPath, "/")+"/") {
+				continue
+			}
+			if found == nil || len(mountPath) > len(path.Clean(found.MountPath)) {
+				found = &mounts[j]
+			}
+		}
+	}
+	return found
+}
+
+// podLogDir returns the directory on the node holding the output of the
+// containers of the Pod.
+func (r *ServerLogReconciler) podLogDir(pod *v1.Pod) string {
+	dir := r.PodLogDir
+	if dir == "" {
+		dir = DefaultPodLogDir
+	}
+	return path.Join(dir, pod.Namespace+"_"+pod.Name+"_"+string(pod.UID))
+}
+
+func (r *ServerLogReconciler) kubeletVolumeDir(pod *v1.Pod, plugin, name string) string {
+	root := r.KubeletRootDir
+	if root == "" {
+		root = DefaultKubeletRootDir
+	}
+	return path.Join(root, "pods", string(pod.UID), "volumes", "kubernetes.io~"+plugin, name)
+}
+
+// volumeHostPath returns the directory on the node volume is mounted from.
+// onHost is set when the path is chosen by the volume, a hostPath or local
+// volume, rather than a directory of the kubelet.
+func (r *ServerLogReconciler) volumeHostPath(ctx context.Context, pod *v1.Pod, volume *v1.Volume) (root string, onHost bool, err error) {
+	switch {
+	case volume.EmptyDir != nil:
+		return r.kubeletVolumeDir(pod, "empty-dir", volume.Name), false, nil
+	case volume.HostPath != nil:
+		return path.Clean(volume.HostPath.Path), true, nil
+	case volume.PersistentVolumeClaim != nil:
+		return r.claimHostPath(ctx, pod, volume.PersistentVolumeClaim.ClaimName)
+	case volume.Ephemeral != nil:
+		//通用临时卷的PVC名为<pod>-<volume>
+		return r.claimHostPath(ctx, pod, pod.Name+"-"+volume.Name)
+	}
+	return "", false, unresolved(logv1.ReasonVolumeUnresolved, "volume %s is not an emptyDir, hostPath or persistentVolumeClaim volume", volume.Name)
+}
+
+// claimHostPath returns the directory on the node of the persistent volume
+// bound to a claim of the Pod, onHost as volumeHostPath.
+func (r *ServerLogReconciler) claimHostPath(ctx context.Context, pod *v1.Pod, claimName string) (root string, onHost bool, err error) {
+	var claim v1.PersistentVolumeClaim
+	if err := r.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: claimName}, &claim); err != nil {
+		if errors.IsNotFound(err) {
+			return "", false, unresolved(logv1.ReasonVolumeUnresolved, "persistent volume claim %s not found", claimName)
+		}
+		return "", false, err
+	}
+	if claim.Spec.VolumeName == "" {
+		return "", false, unresolved(logv1.ReasonVolumeUnresolved, "persistent volume claim %s is not bound", claimName)
+	}
+	var pv v1.PersistentVolume
+	if err := r.Get(ctx, types.NamespacedName{Name: claim.Spec.VolumeName}, &pv); err != nil {
+		if errors.IsNotFound(err) {
+			return "", false, unresolved(logv1.ReasonVolumeUnresolved, "persistent volume %s not found", claim.Spec.VolumeName)
+		}
+		return "", false, err
+	}
+	switch {
+	case pv.Spec.HostPath != nil:
+		return path.Clean(pv.Spec.HostPath.Path), true, nil
+	case pv.Spec.Local != nil:
+		return path.Clean(pv.Spec.Local.Path), true, nil
+	case pv.Spec.CSI != nil:
+		return path.Join(r.kubeletVolumeDir(pod, "csi", pv.Name), "mount"), false, nil
+	case pv.Spec.NFS != nil:
+		return r.kubeletVolumeDir(pod, "nfs", pv.Name), false, nil
+	}
+	return "", false, unresolved(logv1.ReasonVolumeUnresolved, "persistent volume %s is of an unsupported type", pv.Name)
+}
@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func volumePod() *v1.Pod {
+	pod := newPod("default", "web-0", collect)
+	pod.Spec.Containers = []v1.Container{{
+		Name: "app",
+		VolumeMounts: []v1.VolumeMount{
+			{Name: "logs", MountPath: "/data/log"},
+			{Name: "host", MountPath: "/data/log/host"},
+			{Name: "shared", MountPath: "/data/shared", SubPath: "web"},
+			{Name: "data", MountPath: "/data/pvc/"},
+			{Name: "config", MountPath: "/etc/app"},
+		},
+	}}
+	pod.Spec.Volumes = []v1.Volume{
+		{Name: "logs", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+		{Name: "host", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/log/apps/"}}},
+		{Name: "shared", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+		{Name: "data", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}},
+		{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{}}},
+	}
+	return pod
+}
+
+func TestHostPath(t *testing.T) {
+	pod := volumePod()
+	claim := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "data"},
+		Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "pv-1"},
+	}
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-1"},
+		Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{
+			CSI: &v1.CSIPersistentVolumeSource{Driver: "ebs.csi.aws.com"},
+		}},
+	}
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, claim, pv)
+
+	const emptyDirs = "/var/lib/kubelet/pods/web-0-uid/volumes/kubernetes.io~empty-dir"
+	tests := map[string]struct{ hostPath, volumeRoot string }{
+		"/data/log":          {emptyDirs + "/logs", emptyDirs + "/logs"},
+		"/data/log/app/":     {emptyDirs + "/logs/app", emptyDirs + "/logs"},
+		"/data/log/host/gc":  {"/var/log/apps/gc", "/var/log/apps"},
+		"/data/shared/a":     {emptyDirs + "/shared/web/a", emptyDirs + "/shared"},
+		"/data/pvc/logs":     {"/var/lib/kubelet/pods/web-0-uid/volumes/kubernetes.io~csi/pv-1/mount/logs", "/var/lib/kubelet/pods/web-0-uid/volumes/kubernetes.io~csi/pv-1/mount"},
+		"/data/logs-archive": {},
+		"/etc/app":           {},
+	}
+	for dir, want := range tests {
+		got, root, err := r.hostPath(context.Background(), pod, dir)
+		if want.hostPath == "" {
+			if _, ok := err.(*unresolvedError); !ok {
+				t.Errorf("%s: got %q, %v, want unresolved", dir, got, err)
+			}
+			continue
+		}
+		if err != nil || got != want.hostPath || root != want.volumeRoot {
+			t.Errorf("%s: got %q in %q, %v, want %q in %q", dir, got, root, err, want.hostPath, want.volumeRoot)
+		}
+	}
+
+	r.KubeletRootDir = "/opt/kubelet"
+	if got, _, _ := r.hostPath(context.Background(), pod, "/data/log"); got != "/opt/kubelet/pods/web-0-uid/volumes/kubernetes.io~empty-dir/logs" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestReconcileSetsHostPaths(t *testing.T) {
+	pod := volumePod()
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, pod)
+	if !reconcilePod(t, r, pod) {
+		t.Fatal("server log not created")
+	}
+	serverLog := getServerLog(t, r, "web-0")
+	if serverLog.Status.HostPath != "/var/lib/kubelet/pods/web-0-uid/volumes/kubernetes.io~empty-dir/logs" {
+		t.Errorf("host path %q", serverLog.Status.HostPath)
+	}
+	if !meta.IsStatusConditionTrue(serverLog.Status.Conditions, logv1.ConditionVolumeBacked) {
+		t.Errorf("conditions %+v", serverLog.Status.Conditions)
+	}
+
+	// a directory in the container filesystem cannot be collected
+	pod.Annotations["server.xy.io/logDir"] = "/app/logs"
+	if err := r.Update(context.Background(), pod); err != nil {
+		t.Fatal(err)
+	}
+	reconcilePod(t, r, pod)
+	serverLog = getServerLog(t, r, "web-0")
+	condition := meta.FindStatusCondition(serverLog.Status.Conditions, logv1.ConditionVolumeBacked)
+	if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != logv1.ReasonNotVolumeBacked {
+		t.Errorf("condition %+v", condition)
+	}
+	if serverLog.Status.HostPath != "" || serverLog.Status.HostPathOf(serverLog.Spec.EffectiveSources()[0]) != "" {
+		t.Errorf("status %+v", serverLog.Status)
+	}
+}
+
+func TestContainerStdoutHostPath(t *testing.T) {
+	pod := newPod("default", "web-0", map[string]string{
+		utils.CollectKey:        "true",
+		utils.AnnotationSources: `[{"name":"stdout","type":"containerStdout"}]`,
+	})
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, pod)
+	reconcilePod(t, r, pod)
+	serverLog := getServerLog(t, r, "web-0")
+	if serverLog.Status.HostPath != "/var/log/pods/default_web-0_web-0-uid" {
+		t.Errorf("host path %q", serverLog.Status.HostPath)
+	}
+	if !meta.IsStatusConditionTrue(serverLog.Status.Conditions, logv1.ConditionVolumeBacked) {
+		t.Errorf("conditions %+v", serverLog.Status.Conditions)
+	}
+}
+
+func TestReconcileChecksPolicyHostPaths(t *testing.T) {
+	pod := volumePod()
+	pod.Annotations["server.xy.io/logDir"] = "/data/log/host"
+	policy := &logv1.LogCollectionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "restricted"},
+		Spec:       logv1.LogCollectionPolicySpec{AllowedPathPrefixes: []string{"/var/lib/kubelet/pods"}},
+	}
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, pod, policy)
+	reconcilePod(t, r, pod)
+	serverLog := getServerLog(t, r, "web-0")
+	//hostPath卷在节点上是/var/log/apps，不在策略允许的目录下
+	condition := meta.FindStatusCondition(serverLog.Status.Conditions, logv1.ConditionVolumeBacked)
+	if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != logv1.ReasonPolicyViolation {
+		t.Errorf("condition %+v", condition)
+	}
+	if serverLog.Status.HostPath != "" || serverLog.Status.HostPathOf(serverLog.Spec.EffectiveSources()[0]) != "" {
+		t.Errorf("status %+v", serverLog.Status)
+	}
+
+	pod.Annotations["server.xy.io/logDir"] = "/data/log"
+	if err := r.Update(context.Background(), pod); err != nil {
+		t.Fatal(err)
+	}
+	reconcilePod(t, r, pod)
+	serverLog = getServerLog(t, r, "web-0")
+	if serverLog.Status.HostPath != "/var/lib/kubelet/pods/web-0-uid/volumes/kubernetes.io~empty-dir/logs" {
+		t.Errorf("host path %q", serverLog.Status.HostPath)
+	}
+	if !meta.IsStatusConditionTrue(serverLog.Status.Conditions, logv1.ConditionVolumeBacked) {
+		t.Errorf("conditions %+v", serverLog.Status.Conditions)
+	}
+}
+
+func TestSensitiveHostPath(t *testing.T) {
+	pod := newPod("default", "web-0", collect)
+	pod.Spec.Containers = []v1.Container{{
+		Name: "app",
+		VolumeMounts: []v1.VolumeMount{
+			{Name: "root", MountPath: "/data/root"},
+			{Name: "kubelet", MountPath: "/data/kubelet"},
+			{Name: "local", MountPath: "/data/local"},
+			{Name: "logs", MountPath: "/data/log"},
+		},
+	}}
+	pod.Spec.Volumes = []v1.Volume{
+		{Name: "root", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/"}}},
+		{Name: "kubelet", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/lib/kubelet/pods"}}},
+		{Name: "local", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "local"}}},
+		{Name: "logs", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+	}
+	claim := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "local"},
+		Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "pv-local"},
+	}
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-local"},
+		Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{
+			Local: &v1.LocalVolumeSource{Path: "/etc"},
+		}},
+	}
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, claim, pv)
+
+	for _, dir := range []string{"/data/root", "/data/root/etc/ssl", "/data/root/proc", "/data/kubelet/other-uid", "/data/local/app"} {
+		got, _, err := r.hostPath(context.Background(), pod, dir)
+		if e, ok := err.(*unresolvedError); !ok || e.reason != logv1.ReasonSensitiveHostPath {
+			t.Errorf("%s: got %q, %v, want a sensitive host path", dir, got, err)
+		}
+	}
+	//hostPath卷中不敏感的目录和kubelet管理的卷可以采集
+	if got, _, err := r.hostPath(context.Background(), pod, "/data/root/data/log"); err != nil || got != "/data/log" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if got, _, err := r.hostPath(context.Background(), pod, "/data/log"); err != nil || got != "/var/lib/kubelet/pods/web-0-uid/volumes/kubernetes.io~empty-dir/logs" {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
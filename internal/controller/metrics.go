@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// What a reconcile of a Pod did, the action label of reconcileTotal.
+const (
+	actionNone   = "none"
+	actionCreate = "create"
+	actionUpdate = "update"
+	actionDelete = "delete"
+)
+
+var (
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_collector_reconcile_total",
+		Help: "Reconciles of Pods by what they did to the ServerLog and their result.",
+	}, []string{"action", "result"})
+
+	serverLogsDesc = prometheus.NewDesc("log_collector_serverlogs",
+		"ServerLogs by phase.", []string{"phase"}, nil)
+)
+
+func init() {
+	metrics.Registry.MustRegister(reconcileTotal)
+}
+
+// observeReconcile counts a reconcile by its outcome.
+func observeReconcile(action string, result ctrl.Result, err error) {
+	outcome := "success"
+	switch {
+	case err != nil:
+		outcome = "error"
+	case result.Requeue || result.RequeueAfter > 0:
+		outcome = "requeue"
+	}
+	reconcileTotal.WithLabelValues(action, outcome).Inc()
+}
+
+// serverLogCollector counts the ServerLogs by phase from the cache on every
+// scrape, so the counts never drift from the objects.
+type serverLogCollector struct {
+	reader client.Reader
+}
+
+func (c *serverLogCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- serverLogsDesc
+}
+
+func (c *serverLogCollector) Collect(ch chan<- prometheus.Metric) {
+	var list logv1.ServerLogList
+	if err := c.reader.List(context.Background(), &list); err != nil {
+		klog.Error("list server logs for metrics failed, err=", err)
+		return
+	}
+	counts := map[logv1.ServerLogPhase]int{
+		logv1.ServerLogPending:   0,
+		logv1.ServerLogRunning:   0,
+		logv1.ServerLogCompleted: 0,
+	}
+	for i := range list.Items {
+		phase := list.Items[i].Status.Phase
+		if phase == "" {
+			phase = logv1.ServerLogPending
+		}
+		counts[phase]++
+	}
+	for phase, count := range counts {
+		ch <- prometheus.MustNewConstMetric(serverLogsDesc, prometheus.GaugeValue, float64(count), string(phase))
+	}
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+)
+
+func TestReconcileMetrics(t *testing.T) {
+	pod := newPod("default", "web-0", collect)
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, pod)
+	created := testutil.ToFloat64(reconcileTotal.WithLabelValues(actionCreate, "success"))
+	reconcilePod(t, r, pod)
+	if got := testutil.ToFloat64(reconcileTotal.WithLabelValues(actionCreate, "success")); got != created+1 {
+		t.Errorf("create reconciles %v, want %v", got, created+1)
+	}
+
+	collector := &serverLogCollector{reader: r.Client}
+	want := `
+# HELP log_collector_serverlogs ServerLogs by phase.
+# TYPE log_collector_serverlogs gauge
+log_collector_serverlogs{phase="Completed"} 0
+log_collector_serverlogs{phase="Pending"} 1
+log_collector_serverlogs{phase="Running"} 0
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// optedIn reports whether the Pod asked for its logs to be collected.
+func optedIn(pod *v1.Pod) bool {
+	return pod.Labels[utils.CollectKey] == "true" || pod.Annotations[utils.CollectKey] == "true"
+}
+
+// namespaceSelected reports whether the Pods of namespace may be collected,
+// according to the flags merged with the LogCollectorConfig.
+func (r *ServerLogReconciler) namespaceSelected(ctx context.Context, namespace string) (bool, error) {
+	include := r.Namespaces.Include
+	exclude := r.Namespaces.Exclude
+	var config logv1.LogCollectorConfig
+	err := r.Get(ctx, types.NamespacedName{Name: logv1.LogCollectorConfigName}, &config)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	if err == nil {
+		include = append(append([]string(nil), include...), config.Spec.Namespaces.Include...)
+		exclude = append(append([]string(nil), exclude...), config.Spec.Namespaces.Exclude...)
+	}
+	if containString(exclude, namespace) {
+		return false, nil
+	}
+	return len(include) == 0 || containString(include, namespace), nil
+}
+
+// collects reports whether the Pod should have a ServerLog.
+func (r *ServerLogReconciler) collects(ctx context.Context, pod *v1.Pod) (bool, error) {
+	if !optedIn(pod) {
+		return false, nil
+	}
+	return r.namespaceSelected(ctx, pod.Namespace)
+}
+
+// podPredicate lets only the events of collected Pods reach Reconcile. An
+// update passes when the old or the new Pod is collected, so that the
+// ServerLog of a Pod opting out is deleted.
+func (r *ServerLogReconciler) podPredicate() predicate.Funcs {
+	selected := func(obj client.Object) bool {
+		pod, ok := obj.(*v1.Pod)
+		if !ok {
+			return false
+		}
+		collect, err := r.collects(context.Background(), pod)
+		if err != nil {
+			//读取配置失败时交给Reconcile重试
+			klog.Error("select pod failed, namespace=", pod.Namespace, " name=", pod.Name, " err=", err)
+			return true
+		}
+		return collect
+	}
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool { return selected(e.Object) },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return selected(e.ObjectOld) || selected(e.ObjectNew)
+		},
+		DeleteFunc:  func(e event.DeleteEvent) bool { return selected(e.Object) },
+		GenericFunc: func(e event.GenericEvent) bool { return selected(e.Object) },
+	}
+}
+
+// podsForConfig enqueues every opted in Pod when the LogCollectorConfig
+// changes, the namespaces they are allowed in may have changed.
+func (r *ServerLogReconciler) podsForConfig(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetName() != logv1.LogCollectorConfigName {
+		return nil
+	}
+	var pods v1.PodList
+	if err := r.List(ctx, &pods); err != nil {
+		klog.Error("list pods failed, err=", err)
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range pods.Items {
+		if optedIn(&pods.Items[i]) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pods.Items[i])})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func newTestReconciler(t *testing.T, namespaces logv1.NamespaceSelection, objects ...client.Object) *ServerLogReconciler {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := logv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objects...).
+		WithStatusSubresource(&logv1.ServerLog{}).
+		Build()
+	return &ServerLogReconciler{
+		Client:        c,
+		Scheme:        scheme,
+		EventRecorder: record.NewFakeRecorder(10),
+		Namespaces:    namespaces,
+	}
+}
+
+func newPod(namespace, name string, annotations map[string]string) *v1.Pod {
+	if annotations != nil {
+		//不修改调用方的map，如共用的collect
+		copied := make(map[string]string, len(annotations))
+		for k, v := range annotations {
+			copied[k] = v
+		}
+		annotations = copied
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(name + "-uid"), Annotations: annotations},
+		Spec:       v1.PodSpec{NodeName: "node-1"},
+	}
+}
+
+var collect = map[string]string{utils.CollectKey: "true"}
+
+func reconcilePod(t *testing.T, r *ServerLogReconciler, pod *v1.Pod) bool {
+	t.Helper()
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pod)}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	err := r.Get(context.Background(), req.NamespacedName, &logv1.ServerLog{})
+	if err != nil && !errors.IsNotFound(err) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func TestReconcileOptIn(t *testing.T) {
+	optedIn := newPod("default", "web-0", collect)
+	labelled := newPod("default", "web-1", nil)
+	labelled.Labels = map[string]string{utils.CollectKey: "true"}
+	other := newPod("default", "db-0", nil)
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, optedIn, labelled, other)
+
+	if !reconcilePod(t, r, optedIn) {
+		t.Error("annotated pod has no server log")
+	}
+	if !reconcilePod(t, r, labelled) {
+		t.Error("labelled pod has no server log")
+	}
+	if reconcilePod(t, r, other) {
+		t.Error("server log created for a pod that did not opt in")
+	}
+}
+
+func TestReconcileDeletesWhenOptingOut(t *testing.T) {
+	pod := newPod("default", "web-0", collect)
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, pod)
+	if !reconcilePod(t, r, pod) {
+		t.Fatal("server log not created")
+	}
+
+	pod.Annotations = nil
+	if err := r.Update(context.Background(), pod); err != nil {
+		t.Fatal(err)
+	}
+	if reconcilePod(t, r, pod) {
+		t.Error("server log not deleted")
+	}
+}
+
+func TestReconcileKeepsForeignServerLogs(t *testing.T) {
+	pod := newPod("default", "web-0", nil)
+	serverLog := &logv1.ServerLog{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-0"}}
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, pod, serverLog)
+	if !reconcilePod(t, r, pod) {
+		t.Error("server log not created by the controller was deleted")
+	}
+}
+
+func TestReconcileKeepsServerLogLabels(t *testing.T) {
+	pod := newPod("default", "web-0", collect)
+	pod.Labels = map[string]string{"app": "web"}
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, pod)
+	reconcilePod(t, r, pod)
+	serverLog := getServerLog(t, r, "web-0")
+	if !reflect.DeepEqual(serverLog.Labels, map[string]string{utils.LabelNodeName: "node-1"}) {
+		t.Fatalf("labels %v", serverLog.Labels)
+	}
+
+	//其他工具添加的label不会被覆盖
+	serverLog.Labels["team"] = "payments"
+	if err := r.Update(context.Background(), serverLog); err != nil {
+		t.Fatal(err)
+	}
+	reconcilePod(t, r, pod)
+	serverLog = getServerLog(t, r, "web-0")
+	want := map[string]string{utils.LabelNodeName: "node-1", "team": "payments"}
+	if !reflect.DeepEqual(serverLog.Labels, want) {
+		t.Errorf("labels %v, want %v", serverLog.Labels, want)
+	}
+}
+
+func TestNamespaceSelection(t *testing.T) {
+	config := &logv1.LogCollectorConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: logv1.LogCollectorConfigName},
+		Spec: logv1.LogCollectorConfigSpec{Namespaces: logv1.NamespaceSelection{
+			Include: []string{"team-b"},
+			Exclude: []string{"team-a-sandbox"},
+		}},
+	}
+	r := newTestReconciler(t, logv1.NamespaceSelection{Include: []string{"team-a", "team-a-sandbox"}}, config)
+
+	tests := map[string]bool{
+		"team-a":         true,
+		"team-b":         true,
+		"team-a-sandbox": false,
+		"kube-system":    false,
+	}
+	for namespace, want := range tests {
+		got, err := r.namespaceSelected(context.Background(), namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: got %v, want %v", namespace, got, want)
+		}
+	}
+
+	// without any include list every namespace is selected
+	r = newTestReconciler(t, logv1.NamespaceSelection{Exclude: []string{"kube-system"}})
+	for namespace, want := range map[string]bool{"default": true, "kube-system": false} {
+		if got, _ := r.namespaceSelected(context.Background(), namespace); got != want {
+			t.Errorf("%s: got %v, want %v", namespace, got, want)
+		}
+	}
+}
+
+func TestPodPredicate(t *testing.T) {
+	r := newTestReconciler(t, logv1.NamespaceSelection{Exclude: []string{"kube-system"}})
+	p := r.podPredicate()
+
+	if p.Create(event.CreateEvent{Object: newPod("default", "a", nil)}) {
+		t.Error("pod without opt-in passed")
+	}
+	if p.Create(event.CreateEvent{Object: newPod("kube-system", "a", collect)}) {
+		t.Error("pod of an excluded namespace passed")
+	}
+	if !p.Create(event.CreateEvent{Object: newPod("default", "a", collect)}) {
+		t.Error("opted in pod filtered")
+	}
+	if !p.Update(event.UpdateEvent{ObjectOld: newPod("default", "a", collect), ObjectNew: newPod("default", "a", nil)}) {
+		t.Error("opting out must reach Reconcile")
+	}
+}
+
+func TestPodsForConfig(t *testing.T) {
+	optedIn := newPod("default", "web-0", collect)
+	other := newPod("default", "db-0", nil)
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, optedIn, other)
+
+	config := &logv1.LogCollectorConfig{ObjectMeta: metav1.ObjectMeta{Name: logv1.LogCollectorConfigName}}
+	requests := r.podsForConfig(context.Background(), config)
+	if len(requests) != 1 || requests[0].Name != "web-0" {
+		t.Errorf("got %v", requests)
+	}
+	config.Name = "other"
+	if requests := r.podsForConfig(context.Background(), config); len(requests) != 0 {
+		t.Errorf("got %v", requests)
+	}
+}
@@ -18,33 +18,70 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	logv1 "github.com/yshaojie/log-collector/api/v1"
 	"github.com/yshaojie/log-collector/pkg/utils"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
+	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"time"
 )
 
+// DefaultFinalizerTimeout is how long the agent may take to drain a deleted
+// ServerLog before the controller removes its finalizer.
+const DefaultFinalizerTimeout = 5 * time.Minute
+
 // ServerLogReconciler reconciles a ServerLog object
 type ServerLogReconciler struct {
 	client.Client
 	Scheme        *runtime.Scheme
 	EventRecorder record.EventRecorder
+	// Namespaces are the namespaces given as flags, merged with the
+	// LogCollectorConfig.
+	Namespaces logv1.NamespaceSelection
+	// KubeletRootDir is the root directory of the kubelet on the nodes,
+	// DefaultKubeletRootDir when it is empty.
+	KubeletRootDir string
+	// PodLogDir is where the kubelet keeps the output of the containers,
+	// DefaultPodLogDir when it is empty.
+	PodLogDir string
+	// FinalizerTimeout is how long the agent may take to drain a deleted
+	// ServerLog, DefaultFinalizerTimeout when it is zero.
+	FinalizerTimeout time.Duration
+	// MaxConcurrentReconciles is how many Pods are reconciled at once,
+	// DefaultMaxConcurrentReconciles when it is zero.
+	MaxConcurrentReconciles int
+	// RateLimiter limits the reconciles of the workqueue, the one of
+	// controller-runtime when it is nil.
+	RateLimiter workqueue.RateLimiter
 }
 
 //+kubebuilder:rbac:groups=log.4yxy.io,resources=serverlogs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=log.4yxy.io,resources=serverlogs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=log.4yxy.io,resources=serverlogs/finalizers,verbs=update
+//+kubebuilder:rbac:groups=log.4yxy.io,resources=logcollectorconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=log.4yxy.io,resources=serverlogtemplates,verbs=get;list;watch
+//+kubebuilder:rbac:groups=log.4yxy.io,resources=logcollectionpolicies,verbs=get;list;watch
 
 //额外添加权限
 //+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=persistentvolumeclaims;persistentvolumes,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -56,17 +93,16 @@ type ServerLogReconciler struct {
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.15.0/pkg/reconcile
-func (r *ServerLogReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *ServerLogReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	action := actionNone
+	defer func() { observeReconcile(action, result, err) }()
 
 	var pod v1.Pod
 	if err := r.Get(ctx, req.NamespacedName, &pod); err != nil {
 		//不存在，则不处理
 		if errors.IsNotFound(err) {
-			result, err := r.processDelete(ctx, req)
-			if err != nil {
-				return result, err
-			}
-			return ctrl.Result{}, nil
+			action = actionDelete
+			return r.processDelete(ctx, req)
 		}
 		return ctrl.Result{}, err
 	}
@@ -74,6 +110,15 @@ func (r *ServerLogReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	if !pod.ObjectMeta.DeletionTimestamp.IsZero() {
 		return ctrl.Result{}, nil
 	}
+	//没有开启采集或namespace不在采集范围内，删除已有的ServerLog
+	collect, err := r.collects(ctx, &pod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !collect {
+		action = actionDelete
+		return r.processDelete(ctx, req)
+	}
 	//pod还没有调度，不处理
 	if len(pod.Spec.NodeName) == 0 {
 		return ctrl.Result{}, nil
@@ -84,11 +129,13 @@ func (r *ServerLogReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		if errors.IsNotFound(err) {
 			klog.Info("create server log, name=", req.Name)
 			//不存在说明需要创建
+			action = actionCreate
 			create, err := r.processCreate(ctx, req, pod)
 			return processApiServerError(create, err)
 		}
 		return ctrl.Result{}, errors.NewInternalError(err)
 	}
+	action = actionUpdate
 	update, err := r.processUpdate(ctx, serverLog, pod)
 	return processApiServerError(update, err)
 }
@@ -96,7 +143,7 @@ func (r *ServerLogReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 func getLogDir(pod v1.Pod) string {
 	logDir := pod.GetObjectMeta().GetAnnotations()["server.xy.io/logDir"]
 	if logDir == "" {
-		logDir = "/data/log"
+		logDir = logv1.DefaultDir
 	}
 	return logDir
 }
@@ -115,10 +162,13 @@ func processApiServerError(result ctrl.Result, err error) (ctrl.Result, error) {
 func (r *ServerLogReconciler) processCreate(ctx context.Context, req ctrl.Request, pod v1.Pod) (ctrl.Result, error) {
 
 	newServerLog := &logv1.ServerLog{}
-	newServerLog.Spec.Dir = getLogDir(pod)
+	if err := r.setSources(ctx, &pod, newServerLog); err != nil {
+		return ctrl.Result{}, err
+	}
 	newServerLog.Spec.NodeName = pod.Spec.NodeName
 	newServerLog.Namespace = pod.GetNamespace()
 	newServerLog.Name = pod.GetName()
+	setNodeLabel(newServerLog, pod.Spec.NodeName)
 	newServerLog.Status.Phase = logv1.ServerLogPending
 
 	//newServerLog.GetObjectMeta().SetFinalizers()
@@ -134,10 +184,17 @@ func (r *ServerLogReconciler) processCreate(ctx context.Context, req ctrl.Reques
 					return ctrl.Result{}, err
 				}
 			}
+			//被webhook拒绝时提示用户，例如违反LogCollectionPolicy
+			if errors.IsForbidden(err) || errors.IsInvalid(err) {
+				r.EventRecorder.Event(&pod, "Warning", "CreateRejected", err.Error())
+			}
 			return ctrl.Result{}, err
 		}
 	}
 	newServerLog.Status.Phase = logv1.ServerLogPending
+	if err := r.setStatus(ctx, &pod, newServerLog); err != nil {
+		return ctrl.Result{}, err
+	}
 	err := r.Status().Update(ctx, newServerLog)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -146,20 +203,96 @@ func (r *ServerLogReconciler) processCreate(ctx context.Context, req ctrl.Reques
 	return ctrl.Result{}, nil
 }
 
+// processDelete deletes the ServerLog created for the Pod req, if any.
 func (r *ServerLogReconciler) processDelete(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	serverLog := &logv1.ServerLog{}
+	if err := r.Get(ctx, req.NamespacedName, serverLog); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	//只删除由Pod创建的ServerLog
+	owner := metav1.GetControllerOf(serverLog)
+	if owner == nil || owner.Kind != "Pod" {
+		return ctrl.Result{}, nil
+	}
+	if !serverLog.DeletionTimestamp.IsZero() {
+		return r.processTerminating(ctx, serverLog)
+	}
+	klog.Info("delete server log, name=", req.NamespacedName)
+	if err := r.Delete(ctx, serverLog, client.Preconditions{UID: &serverLog.UID}); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	r.EventRecorder.Event(serverLog, "Normal", "Deleted", "pod is no longer collected")
+	return ctrl.Result{}, nil
+}
+
+// processTerminating removes the agent finalizer of a deleted ServerLog
+// when its node is gone or the agent did not drain it within the
+// FinalizerTimeout, so that it does not stay in Terminating forever.
+func (r *ServerLogReconciler) processTerminating(ctx context.Context, serverLog *logv1.ServerLog) (ctrl.Result, error) {
+	if !containString(serverLog.Finalizers, utils.FinalizerNameAgentHolder) {
+		return ctrl.Result{}, nil
+	}
+	timeout := r.FinalizerTimeout
+	if timeout <= 0 {
+		timeout = DefaultFinalizerTimeout
+	}
+	var reason, message string
+	if wait := timeout - time.Since(serverLog.DeletionTimestamp.Time); wait > 0 {
+		lost, err := r.nodeLost(ctx, serverLog.Spec.NodeName)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !lost {
+			//等待agent读完剩余日志后移除finalizer
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+		reason = "NodeLost"
+		message = fmt.Sprintf("node %q is gone, logs left on it are not collected", serverLog.Spec.NodeName)
+	} else {
+		reason = "DrainTimeout"
+		message = fmt.Sprintf("the agent did not drain the server log within %s", timeout)
+	}
+	klog.Info("remove finalizer of server log, name=", serverLog.Namespace, "/", serverLog.Name, " reason=", reason)
+	controllerutil.RemoveFinalizer(serverLog, utils.FinalizerNameAgentHolder)
+	if err := r.Update(ctx, serverLog); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	r.EventRecorder.Event(serverLog, "Warning", reason, message)
 	return ctrl.Result{}, nil
 }
 
+// nodeLost reports whether no agent can drain the ServerLogs of nodeName.
+func (r *ServerLogReconciler) nodeLost(ctx context.Context, nodeName string) (bool, error) {
+	if nodeName == "" {
+		return true, nil
+	}
+	err := r.Get(ctx, types.NamespacedName{Name: nodeName}, &v1.Node{})
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
+	return false, err
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ServerLogReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := metrics.Registry.Register(&serverLogCollector{reader: mgr.GetClient()}); err != nil {
+		return err
+	}
+	maxConcurrentReconciles := r.MaxConcurrentReconciles
+	if maxConcurrentReconciles <= 0 {
+		maxConcurrentReconciles = DefaultMaxConcurrentReconciles
+	}
 	//Pod为ServerLog的ownerReference，所以需要监听Pod和ServerLog
 	return ctrl.NewControllerManagedBy(mgr).
 		WithOptions(controller.Options{
 			//Reconcile设置并发
-			MaxConcurrentReconciles: 1,
+			MaxConcurrentReconciles: maxConcurrentReconciles,
+			RateLimiter:             r.RateLimiter,
 		}).
-		For(&v1.Pod{}).
-		Owns(&logv1.ServerLog{}).
+		For(&v1.Pod{}, builder.WithPredicates(r.podPredicate())).
+		Owns(&logv1.ServerLog{}, builder.WithPredicates(serverLogPredicate())).
+		Watches(&logv1.LogCollectorConfig{}, handler.EnqueueRequestsFromMapFunc(r.podsForConfig)).
+		Watches(&logv1.ServerLogTemplate{}, handler.EnqueueRequestsFromMapFunc(r.podsForTemplate)).
 		Complete(r)
 }
 
@@ -173,14 +306,26 @@ func (r *ServerLogReconciler) processUpdate(ctx context.Context, serverLog *logv
 		}
 	}
 
-	if serverLogChange(serverLog, pod) {
-		serverLog.Spec.Dir = getLogDir(pod)
+	desired := serverLog.DeepCopy()
+	if err := r.setSources(ctx, &pod, desired); err != nil {
+		return ctrl.Result{}, err
+	}
+	spec := &desired.Spec
+	if spec.Dir != serverLog.Spec.Dir || spec.Output != serverLog.Spec.Output ||
+		!reflect.DeepEqual(spec.Sources, serverLog.Spec.Sources) ||
+		!equality.Semantic.DeepEqual(spec.RateLimit, serverLog.Spec.RateLimit) ||
+		desired.Annotations[utils.AnnotationSpecSource] != serverLog.Annotations[utils.AnnotationSpecSource] {
+		serverLog.Spec = *spec
+		serverLog.Annotations = desired.Annotations
 		needUpdated = true
 	}
 	if serverLog.Spec.NodeName != pod.Spec.NodeName {
 		serverLog.Spec.NodeName = pod.Spec.NodeName
 		needUpdated = true
 	}
+	if setNodeLabel(serverLog, pod.Spec.NodeName) {
+		needUpdated = true
+	}
 	if needUpdated {
 		klog.Info("update serverlog ..", " name=", serverLog.Name, " version=", serverLog.ObjectMeta.ResourceVersion)
 		err := r.Update(ctx, serverLog)
@@ -189,9 +334,58 @@ func (r *ServerLogReconciler) processUpdate(ctx context.Context, serverLog *logv
 		}
 	}
 
+	//spec更新后重新计算source在节点上的路径
+	status := serverLog.Status.DeepCopy()
+	if err := r.setStatus(ctx, &pod, serverLog); err != nil {
+		return ctrl.Result{}, err
+	}
+	if !equality.Semantic.DeepEqual(*status, serverLog.Status) {
+		if err := r.Status().Update(ctx, serverLog); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 	return ctrl.Result{}, nil
 }
 
+// setStatus sets the part of the status owned by the controller: the host
+// paths, the Scheduled condition and the observed generation. The agent
+// owns the rest.
+func (r *ServerLogReconciler) setStatus(ctx context.Context, pod *v1.Pod, serverLog *logv1.ServerLog) error {
+	if err := r.setHostPaths(ctx, pod, serverLog); err != nil {
+		return err
+	}
+	condition := metav1.Condition{
+		Type:               logv1.ConditionScheduled,
+		Status:             metav1.ConditionTrue,
+		Reason:             logv1.ReasonScheduled,
+		Message:            "pod runs on node " + pod.Spec.NodeName,
+		ObservedGeneration: serverLog.Generation,
+	}
+	if pod.Spec.NodeName == "" {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = logv1.ReasonUnscheduled
+		condition.Message = "pod is not scheduled to a node yet"
+	}
+	meta.SetStatusCondition(&serverLog.Status.Conditions, condition)
+	meta.SetStatusCondition(&serverLog.Status.Conditions, sourcesCondition(pod, serverLog))
+	serverLog.Status.ObservedGeneration = serverLog.Generation
+	return nil
+}
+
+// setNodeLabel sets the node name label of serverLog and reports whether it
+// changed. It is the only label the controller owns: the agent only watches
+// the ServerLogs labelled with its node, and reads the Pod labels itself.
+func setNodeLabel(serverLog *logv1.ServerLog, nodeName string) bool {
+	if value, ok := serverLog.Labels[utils.LabelNodeName]; ok && value == nodeName {
+		return false
+	}
+	if serverLog.Labels == nil {
+		serverLog.Labels = map[string]string{}
+	}
+	serverLog.Labels[utils.LabelNodeName] = nodeName
+	return true
+}
+
 func containString(arr []string, str string) bool {
 	for _, s := range arr {
 		if s == str {
@@ -200,12 +394,3 @@ func containString(arr []string, str string) bool {
 	}
 	return false
 }
-
-func serverLogChange(log *logv1.ServerLog, pod v1.Pod) bool {
-	logDir := getLogDir(pod)
-	if logDir != log.Spec.Dir {
-		return true
-	}
-
-	return false
-}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// setSources sets the directories of serverLog, the ServerLog of the Pod.
+// The sources annotation wins over a ServerLogTemplate selecting the Pod;
+// without either the single directory of the log dir annotation is
+// collected. The output and rate limit of the template are set too. When the
+// spec comes from somewhere else than last time, e.g. the template was
+// removed or changed, the output and rate limit are cleared first, so the
+// ones of the old template do not stay: the webhook fills in the default
+// output and the agent the rate limit of the namespace.
+func (r *ServerLogReconciler) setSources(ctx context.Context, pod *v1.Pod, serverLog *logv1.ServerLog) error {
+	sources, err := annotationSources(pod)
+	if err != nil && sourcesErrorChanged(serverLog, err) {
+		//注解格式错误时提示用户，按没有注解处理；同样的错误只提示一次
+		klog.Error("invalid sources annotation, namespace=", pod.Namespace, " name=", pod.Name, " err=", err)
+		r.EventRecorder.Event(pod, "Warning", logv1.ReasonInvalidSources, err.Error())
+	}
+	specSource := "annotation"
+	output := ""
+	var rateLimit *logv1.RateLimit
+	if len(sources) == 0 {
+		template, err := r.matchingTemplate(ctx, pod)
+		if err != nil {
+			return err
+		}
+		if template != nil {
+			sources, output, rateLimit = template.Spec.Sources, template.Spec.Output, template.Spec.RateLimit
+			//模板的任何修改都可能去掉输出或限速
+			specSource = fmt.Sprintf("template/%s/%d", template.Name, template.Generation)
+		}
+	}
+	if len(sources) == 0 {
+		specSource = "logDir"
+	}
+
+	spec := &serverLog.Spec
+	if serverLog.Annotations[utils.AnnotationSpecSource] != specSource {
+		spec.Output = ""
+		spec.RateLimit = nil
+		if serverLog.Annotations == nil {
+			serverLog.Annotations = map[string]string{}
+		}
+		serverLog.Annotations[utils.AnnotationSpecSource] = specSource
+	}
+	if len(sources) == 0 {
+		spec.Dir = getLogDir(*pod)
+		spec.Sources = nil
+		return nil
+	}
+	spec.Dir = ""
+	spec.Sources = sources
+	if output != "" {
+		spec.Output = output
+	}
+	if rateLimit != nil {
+		spec.RateLimit = rateLimit.DeepCopy()
+	}
+	return nil
+}
+
+// sourcesErrorChanged reports whether the SourcesValid condition of
+// serverLog does not record err yet.
+func sourcesErrorChanged(serverLog *logv1.ServerLog, err error) bool {
+	condition := meta.FindStatusCondition(serverLog.Status.Conditions, logv1.ConditionSourcesValid)
+	return condition == nil || condition.Status != metav1.ConditionFalse || condition.Message != err.Error()
+}
+
+// sourcesCondition returns the SourcesValid condition of the ServerLog of
+// the Pod.
+func sourcesCondition(pod *v1.Pod, serverLog *logv1.ServerLog) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               logv1.ConditionSourcesValid,
+		Status:             metav1.ConditionTrue,
+		Reason:             logv1.ReasonValidSources,
+		ObservedGeneration: serverLog.Generation,
+	}
+	if _, err := annotationSources(pod); err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = logv1.ReasonInvalidSources
+		condition.Message = err.Error()
+	}
+	return condition
+}
+
+// annotationSources returns the sources in the annotation of the Pod, nil if
+// it has none.
+func annotationSources(pod *v1.Pod) ([]logv1.LogSource, error) {
+	value, ok := pod.Annotations[utils.AnnotationSources]
+	if !ok {
+		return nil, nil
+	}
+	var sources []logv1.LogSource
+	if err := json.Unmarshal([]byte(value), &sources); err != nil {
+		return nil, fmt.Errorf("annotation %s: %w", utils.AnnotationSources, err)
+	}
+	names := map[string]bool{}
+	for i, source := range sources {
+		if source.Name == "" || (!source.IsContainerStdout() && len(source.Dir) < 2) {
+			return nil, fmt.Errorf("annotation %s: sources[%d] needs a name and a dir", utils.AnnotationSources, i)
+		}
+		if names[source.Name] {
+			return nil, fmt.Errorf("annotation %s: duplicate source %q", utils.AnnotationSources, source.Name)
+		}
+		names[source.Name] = true
+	}
+	return sources, nil
+}
+
+// matchingTemplate returns the first ServerLogTemplate, by name, of the
+// namespace of the Pod selecting it, nil if there is none.
+func (r *ServerLogReconciler) matchingTemplate(ctx context.Context, pod *v1.Pod) (*logv1.ServerLogTemplate, error) {
+	var templates logv1.ServerLogTemplateList
+	if err := r.List(ctx, &templates, client.InNamespace(pod.Namespace)); err != nil {
+		return nil, err
+	}
+	sort.Slice(templates.Items, func(i, j int) bool {
+		return templates.Items[i].Name < templates.Items[j].Name
+	})
+	for i := range templates.Items {
+		template := &templates.Items[i]
+		if template.Spec.Selector == nil {
+			return template, nil
+		}
+		selector, err := metav1.LabelSelectorAsSelector(template.Spec.Selector)
+		if err != nil {
+			klog.Error("invalid server log template selector, namespace=", template.Namespace, " name=", template.Name, " err=", err)
+			continue
+		}
+		if selector.Matches(labels.Set(pod.Labels)) {
+			return template, nil
+		}
+	}
+	return nil, nil
+}
+
+// podsForTemplate enqueues the opted in Pods of the namespace of a
+// ServerLogTemplate when it changes.
+func (r *ServerLogReconciler) podsForTemplate(ctx context.Context, obj client.Object) []reconcile.Request {
+	var pods v1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(obj.GetNamespace())); err != nil {
+		klog.Error("list pods failed, namespace=", obj.GetNamespace(), " err=", err)
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range pods.Items {
+		if optedIn(&pods.Items[i]) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pods.Items[i])})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+func getServerLog(t *testing.T, r *ServerLogReconciler, name string) *logv1.ServerLog {
+	t.Helper()
+	serverLog := &logv1.ServerLog{}
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, serverLog); err != nil {
+		t.Fatal(err)
+	}
+	return serverLog
+}
+
+func TestSourcesFromAnnotation(t *testing.T) {
+	pod := newPod("default", "web-0", map[string]string{
+		utils.CollectKey:        "true",
+		utils.AnnotationSources: `[{"name":"access","dir":"/data/log/access"},{"name":"gc","dir":"/data/log/gc","fileFilter":"gc*.log"}]`,
+	})
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, pod)
+	if !reconcilePod(t, r, pod) {
+		t.Fatal("server log not created")
+	}
+	serverLog := getServerLog(t, r, "web-0")
+	if serverLog.Spec.Dir != "" || len(serverLog.Spec.Sources) != 2 || serverLog.Spec.Sources[1].FileFilter != "gc*.log" {
+		t.Errorf("unexpected spec %+v", serverLog.Spec)
+	}
+	//webhook填入的默认输出在spec来源不变时保留
+	serverLog.Spec.Output = "es"
+	if err := r.Update(context.Background(), serverLog); err != nil {
+		t.Fatal(err)
+	}
+	reconcilePod(t, r, pod)
+	if serverLog := getServerLog(t, r, "web-0"); serverLog.Spec.Output != "es" {
+		t.Errorf("output %q, want the default kept", serverLog.Spec.Output)
+	}
+
+	// an invalid annotation falls back to the log dir
+	pod.Annotations[utils.AnnotationSources] = `[{"name":"access"}]`
+	if err := r.Update(context.Background(), pod); err != nil {
+		t.Fatal(err)
+	}
+	reconcilePod(t, r, pod)
+	serverLog = getServerLog(t, r, "web-0")
+	if serverLog.Spec.Dir != "/data/log" || serverLog.Spec.Sources != nil {
+		t.Errorf("unexpected spec %+v", serverLog.Spec)
+	}
+	condition := meta.FindStatusCondition(serverLog.Status.Conditions, logv1.ConditionSourcesValid)
+	if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != logv1.ReasonInvalidSources {
+		t.Errorf("condition %+v", condition)
+	}
+	//再次调谐不重复提示同样的错误
+	reconcilePod(t, r, pod)
+	if n := invalidSourcesEvents(r); n != 1 {
+		t.Errorf("got %d InvalidSources events, want 1", n)
+	}
+	pod.Annotations[utils.AnnotationSources] = `not json`
+	if err := r.Update(context.Background(), pod); err != nil {
+		t.Fatal(err)
+	}
+	reconcilePod(t, r, pod)
+	reconcilePod(t, r, pod)
+	if n := invalidSourcesEvents(r); n != 1 {
+		t.Errorf("got %d InvalidSources events for a new error, want 1", n)
+	}
+
+	delete(pod.Annotations, utils.AnnotationSources)
+	if err := r.Update(context.Background(), pod); err != nil {
+		t.Fatal(err)
+	}
+	reconcilePod(t, r, pod)
+	serverLog = getServerLog(t, r, "web-0")
+	if !meta.IsStatusConditionTrue(serverLog.Status.Conditions, logv1.ConditionSourcesValid) {
+		t.Errorf("conditions %+v", serverLog.Status.Conditions)
+	}
+}
+
+// invalidSourcesEvents returns how many InvalidSources events were recorded
+// since the last call.
+func invalidSourcesEvents(r *ServerLogReconciler) int {
+	events := r.EventRecorder.(*record.FakeRecorder).Events
+	n := 0
+	for {
+		select {
+		case event := <-events:
+			if strings.Contains(event, logv1.ReasonInvalidSources) {
+				n++
+			}
+		default:
+			return n
+		}
+	}
+}
+
+func TestSourcesFromTemplate(t *testing.T) {
+	web := newPod("default", "web-0", collect)
+	web.Labels = map[string]string{"app": "web"}
+	db := newPod("default", "db-0", collect)
+	annotated := newPod("default", "web-1", map[string]string{
+		utils.CollectKey:        "true",
+		utils.AnnotationSources: `[{"name":"own","dir":"/own"}]`,
+	})
+	annotated.Labels = map[string]string{"app": "web"}
+	template := &logv1.ServerLogTemplate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec: logv1.ServerLogTemplateSpec{
+			Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Sources:   []logv1.LogSource{{Name: "app", Dir: "/data/log/app"}},
+			Output:    "es",
+			RateLimit: &logv1.RateLimit{LinesPerSecond: 100},
+		},
+	}
+	other := &logv1.ServerLogTemplate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "all"},
+		Spec:       logv1.ServerLogTemplateSpec{Sources: []logv1.LogSource{{Name: "x", Dir: "/x"}}},
+	}
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, web, db, annotated, template, other)
+
+	reconcilePod(t, r, web)
+	serverLog := getServerLog(t, r, "web-0")
+	if len(serverLog.Spec.Sources) != 1 || serverLog.Spec.Sources[0].Name != "app" || serverLog.Spec.Output != "es" ||
+		serverLog.Spec.RateLimit == nil || serverLog.Spec.RateLimit.LinesPerSecond != 100 {
+		t.Errorf("unexpected spec %+v", serverLog.Spec)
+	}
+	reconcilePod(t, r, db)
+	if serverLog := getServerLog(t, r, "db-0"); serverLog.Spec.Dir != "/data/log" || serverLog.Spec.Sources != nil {
+		t.Errorf("unexpected spec %+v", serverLog.Spec)
+	}
+	reconcilePod(t, r, annotated)
+	if serverLog := getServerLog(t, r, "web-1"); len(serverLog.Spec.Sources) != 1 || serverLog.Spec.Sources[0].Name != "own" {
+		t.Errorf("annotation must win over the template: %+v", serverLog.Spec)
+	}
+
+	// template changes reach the ServerLog
+	template.Spec.Sources = append(template.Spec.Sources, logv1.LogSource{Name: "gc", Dir: "/data/log/gc"})
+	template.Spec.RateLimit.LinesPerSecond = 200
+	if err := r.Update(context.Background(), template); err != nil {
+		t.Fatal(err)
+	}
+	requests := r.podsForTemplate(context.Background(), template)
+	if len(requests) != 3 {
+		t.Errorf("got %v", requests)
+	}
+	reconcilePod(t, r, web)
+	if serverLog := getServerLog(t, r, "web-0"); len(serverLog.Spec.Sources) != 2 || serverLog.Spec.RateLimit.LinesPerSecond != 200 {
+		t.Errorf("unexpected spec %+v", serverLog.Spec)
+	}
+
+	//删除模板后不能保留模板的输出和限速
+	if err := r.Delete(context.Background(), template); err != nil {
+		t.Fatal(err)
+	}
+	reconcilePod(t, r, web)
+	if serverLog := getServerLog(t, r, "web-0"); serverLog.Spec.Dir != "/data/log" || serverLog.Spec.Sources != nil ||
+		serverLog.Spec.Output != "" || serverLog.Spec.RateLimit != nil {
+		t.Errorf("spec %+v kept the removed template", serverLog.Spec)
+	}
+}
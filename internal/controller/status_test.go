@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"testing"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+func TestReconcileSetsScheduled(t *testing.T) {
+	pod := newPod("default", "web-0", collect)
+	r := newTestReconciler(t, logv1.NamespaceSelection{}, pod)
+	reconcilePod(t, r, pod)
+	serverLog := getServerLog(t, r, "web-0")
+	condition := meta.FindStatusCondition(serverLog.Status.Conditions, logv1.ConditionScheduled)
+	if condition == nil || condition.Reason != logv1.ReasonScheduled || condition.Message != "pod runs on node node-1" {
+		t.Fatalf("condition %+v", condition)
+	}
+	if serverLog.Status.ObservedGeneration != serverLog.Generation || condition.ObservedGeneration != serverLog.Generation {
+		t.Errorf("observed generation %d, generation %d", serverLog.Status.ObservedGeneration, serverLog.Generation)
+	}
+	// the agent owns the other conditions
+	if meta.FindStatusCondition(serverLog.Status.Conditions, logv1.ConditionCollecting) != nil {
+		t.Errorf("conditions %+v", serverLog.Status.Conditions)
+	}
+}
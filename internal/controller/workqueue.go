@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"reflect"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Defaults of the workqueue of the ServerLogReconciler, the same as those
+// of controller-runtime.
+const (
+	DefaultMaxConcurrentReconciles = 1
+	DefaultReconcileBaseDelay      = 5 * time.Millisecond
+	DefaultReconcileMaxDelay       = 1000 * time.Second
+	DefaultReconcileQPS            = 10
+	DefaultReconcileBurst          = 100
+)
+
+// NewRateLimiter returns the rate limiter of the workqueue. A Pod that
+// failed is retried with an exponential backoff from baseDelay to
+// maxDelay, and the retries of all Pods together are limited to qps a
+// second, burst at once. Reconciles triggered by events are not limited,
+// the workqueue only asks the rate limiter when a reconcile failed or
+// asked to be requeued.
+func NewRateLimiter(baseDelay, maxDelay time.Duration, qps float64, burst int) workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+	)
+}
+
+// serverLogPredicate ignores the updates of a ServerLog that only changed
+// its status. The agents patch the status of every ServerLog all the time,
+// the controller does not act on it.
+func serverLogPredicate() predicate.Funcs {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectOld == nil || e.ObjectNew == nil {
+				return true
+			}
+			return e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration() ||
+				!reflect.DeepEqual(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()) ||
+				!reflect.DeepEqual(e.ObjectOld.GetFinalizers(), e.ObjectNew.GetFinalizers()) ||
+				!e.ObjectOld.GetDeletionTimestamp().Equal(e.ObjectNew.GetDeletionTimestamp())
+		},
+	}
+}
@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"testing"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestServerLogPredicateIgnoresStatus(t *testing.T) {
+	old := newOwnedServerLog("node-1")
+	old.Generation = 1
+	p := serverLogPredicate()
+
+	status := old.DeepCopy()
+	status.Status.LinesShipped = 100
+	status.Status.Phase = logv1.ServerLogRunning
+	if p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: status}) {
+		t.Error("a status update must not be reconciled")
+	}
+
+	spec := old.DeepCopy()
+	spec.Generation = 2
+	finalizers := old.DeepCopy()
+	finalizers.Finalizers = nil
+	deleted := old.DeepCopy()
+	now := metav1.Now()
+	deleted.DeletionTimestamp = &now
+	labels := old.DeepCopy()
+	labels.Labels = map[string]string{utils.LabelNodeName: "node-2"}
+	for name, obj := range map[string]*logv1.ServerLog{"spec": spec, "finalizers": finalizers, "deleted": deleted, "labels": labels} {
+		if !p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: obj}) {
+			t.Errorf("a %s update must be reconciled", name)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Package cri decodes the container log files under /var/log/pods, written
+// by CRI runtimes like containerd and CRI-O or by Docker's json-file driver.
+package cri
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/yshaojie/log-collector/internal/tailer"
+)
+
+// MaxPartialBytes bounds a line joined from partial lines; a longer line is
+// handed out in pieces.
+const MaxPartialBytes = 1 << 20
+
+const (
+	tagPartial = "P"
+	tagFull    = "F"
+)
+
+// Entry is one decoded line of a container log file.
+type Entry struct {
+	Time   time.Time
+	Stream string
+	// Partial is set when the runtime split a long line, the rest of it
+	// follows in the next entries of the stream.
+	Partial bool
+	Log     string
+}
+
+var errFormat = errors.New("not a container log line")
+
+// Parse decodes a line of the CRI format,
+//
+//	2016-10-06T00:17:09.669794202Z stdout F the log
+//
+// or of the Docker json-file format,
+//
+//	{"log":"the log\n","stream":"stdout","time":"2016-10-06T00:17:09.669794202Z"}
+func Parse(line string) (Entry, error) {
+	if strings.HasPrefix(line, "{") {
+		return parseDocker(line)
+	}
+	return parseCRI(line)
+}
+
+func parseCRI(line string) (Entry, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 3 {
+		return Entry{}, errFormat
+	}
+	t, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return Entry{}, errFormat
+	}
+	entry := Entry{Time: t, Stream: fields[1]}
+	//tag可能带有其他以:分隔的标记，第一个为P或F
+	tag, _, _ := strings.Cut(fields[2], ":")
+	switch tag {
+	case tagPartial:
+		entry.Partial = true
+	case tagFull:
+	default:
+		return Entry{}, errFormat
+	}
+	if len(fields) == 4 {
+		entry.Log = fields[3]
+	}
+	return entry, nil
+}
+
+func parseDocker(line string) (Entry, error) {
+	var raw struct {
+		Log    string    `json:"log"`
+		Stream string    `json:"stream"`
+		Time   time.Time `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return Entry{}, errFormat
+	}
+	entry := Entry{Time: raw.Time, Stream: raw.Stream, Log: raw.Log}
+	//docker的完整行以换行结尾，被拆分的行没有
+	if strings.HasSuffix(entry.Log, "\n") {
+		entry.Log = strings.TrimSuffix(entry.Log, "\n")
+		entry.Log = strings.TrimSuffix(entry.Log, "\r")
+	} else {
+		entry.Partial = true
+	}
+	return entry, nil
+}
+
+type pending struct {
+	time time.Time
+	log  strings.Builder
+}
+
+// Decoder decodes the lines of one container log file and joins partial
+// lines. A joined line is handed out with the Offset of its last part, so a
+// checkpoint never points into the middle of it.
+type Decoder struct {
+	next tailer.Handler
+	// partial holds the parts read so far by stream.
+	partial map[string]*pending
+}
+
+// NewDecoder returns a Decoder handing the decoded lines to next. Lines that
+// cannot be decoded are handed out as they are.
+func NewDecoder(next tailer.Handler) *Decoder {
+	return &Decoder{next: next, partial: map[string]*pending{}}
+}
+
+// Add decodes a line read from the file.
+func (d *Decoder) Add(line tailer.Line) {
+	entry, err := Parse(line.Text)
+	if err != nil {
+		d.next(line)
+		return
+	}
+	p := d.partial[entry.Stream]
+	if entry.Partial {
+		if p == nil {
+			p = &pending{time: entry.Time}
+			d.partial[entry.Stream] = p
+		}
+		p.log.WriteString(entry.Log)
+		if p.log.Len() < MaxPartialBytes {
+			return
+		}
+	}
+	if p != nil {
+		if !entry.Partial {
+			p.log.WriteString(entry.Log)
+		}
+		entry.Time = p.time
+		entry.Log = p.log.String()
+		delete(d.partial, entry.Stream)
+	}
+	line.Text = entry.Log
+	line.Time = entry.Time
+	line.Stream = entry.Stream
+	d.next(line)
+}
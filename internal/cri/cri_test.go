@@ -0,0 +1,87 @@
+package cri
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yshaojie/log-collector/internal/tailer"
+)
+
+func TestParse(t *testing.T) {
+	ts := time.Date(2016, 10, 6, 0, 17, 9, 669794202, time.UTC)
+	tests := []struct {
+		line string
+		want Entry
+	}{
+		{"2016-10-06T00:17:09.669794202Z stdout F hello world", Entry{Time: ts, Stream: "stdout", Log: "hello world"}},
+		{"2016-10-06T00:17:09.669794202Z stderr P part", Entry{Time: ts, Stream: "stderr", Partial: true, Log: "part"}},
+		{"2016-10-06T00:17:09.669794202Z stdout F", Entry{Time: ts, Stream: "stdout"}},
+		{"2016-10-06T00:17:09.669794202Z stdout F:x two  spaces", Entry{Time: ts, Stream: "stdout", Log: "two  spaces"}},
+		{`{"log":"hello\n","stream":"stdout","time":"2016-10-06T00:17:09.669794202Z"}`, Entry{Time: ts, Stream: "stdout", Log: "hello"}},
+		{`{"log":"part","stream":"stderr","time":"2016-10-06T00:17:09.669794202Z"}`, Entry{Time: ts, Stream: "stderr", Partial: true, Log: "part"}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.line)
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		if !got.Time.Equal(tt.want.Time) || got.Stream != tt.want.Stream || got.Partial != tt.want.Partial || got.Log != tt.want.Log {
+			t.Errorf("%q: got %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+	for _, line := range []string{"plain text", "2016-10-06 stdout F x", "2016-10-06T00:17:09Z stdout X x", "{not json"} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("%q: no error", line)
+		}
+	}
+}
+
+func TestDecoderJoinsPartialLines(t *testing.T) {
+	var got []tailer.Line
+	d := NewDecoder(func(line tailer.Line) { got = append(got, line) })
+	lines := []string{
+		"2023-01-01T00:00:01Z stdout P hello ",
+		"2023-01-01T00:00:02Z stderr F error",
+		"2023-01-01T00:00:03Z stdout P big ",
+		"2023-01-01T00:00:04Z stdout F world",
+		"garbage",
+	}
+	for i, text := range lines {
+		d.Add(tailer.Line{Text: text, Offset: int64(i + 1)})
+	}
+	want := []struct {
+		text, stream string
+		offset       int64
+		second       int
+	}{
+		{"error", "stderr", 2, 2},
+		{"hello big world", "stdout", 4, 1},
+		{"garbage", "", 5, 0},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i, w := range want {
+		if got[i].Text != w.text || got[i].Stream != w.stream || got[i].Offset != w.offset {
+			t.Errorf("line %d: got %+v", i, got[i])
+		}
+		if w.second > 0 && got[i].Time.Second() != w.second {
+			t.Errorf("line %d: time %v", i, got[i].Time)
+		}
+	}
+}
+
+func TestDecoderBoundsPartialLines(t *testing.T) {
+	var got []tailer.Line
+	d := NewDecoder(func(line tailer.Line) { got = append(got, line) })
+	part := strings.Repeat("x", MaxPartialBytes/2)
+	for i := 0; i < 3; i++ {
+		d.Add(tailer.Line{Text: "2023-01-01T00:00:01Z stdout P " + part})
+	}
+	d.Add(tailer.Line{Text: "2023-01-01T00:00:01Z stdout F end"})
+	if len(got) != 2 || len(got[0].Text) != MaxPartialBytes || got[1].Text != part+"end" {
+		t.Errorf("got %d lines", len(got))
+	}
+}
@@ -0,0 +1,116 @@
+package event
+
+import (
+	"time"
+
+	"github.com/yshaojie/log-collector/internal/tailer"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Event is a single log record read by the node agent for a ServerLog.
+type Event struct {
+	// ServerLog is the namespace/name of the ServerLog the record belongs to.
+	ServerLog types.NamespacedName
+	// Source is the name of the ServerLog source the record was read from.
+	Source string
+	// Pod is the name of the Pod that wrote the record.
+	Pod string
+	// Container and Stream are set for the output of a container.
+	Container string
+	Stream    string
+	// Labels are the labels of the Pod.
+	Labels map[string]string
+	// NodeName is the node the Pod runs on.
+	NodeName string
+	// Metadata is the Kubernetes metadata of the Pod, nil until the agent
+	// knows the Pod.
+	Metadata *PodMetadata
+	// Path is the host path of the file the record was read from.
+	Path string
+	// File identifies the file the record was read from.
+	File tailer.FileID
+	// Offset is the byte offset just past the record in Path.
+	Offset int64
+	// Generation counts the truncations of the file before the record was
+	// read.
+	Generation uint64
+	// Head fingerprints the start of the file when the record was read.
+	Head tailer.Head
+	// Time is the timestamp parsed from the record, or the time it was read.
+	Time time.Time
+	// Message is the raw record without the trailing newline.
+	Message string
+	// Fields are the fields extracted by the parsers of the ServerLog.
+	Fields map[string]interface{}
+	// Severity is the normalized level of the record, e.g. "error".
+	Severity string
+}
+
+// PodMetadata is the Kubernetes metadata of the Pod a record belongs to. It
+// is shared by the events of the Pod and must not be modified.
+type PodMetadata struct {
+	UID types.UID
+	IP  string
+	// Containers are the names of the containers of the Pod.
+	Containers  []string
+	Annotations map[string]string
+	// OwnerKind and OwnerName identify the workload running the Pod, e.g.
+	// the Deployment owning its ReplicaSet.
+	OwnerKind string
+	OwnerName string
+}
+
+// Position returns the position just past the record in its file.
+func (e *Event) Position() tailer.Position {
+	return tailer.Position{Offset: e.Offset, Generation: e.Generation, Head: e.Head}
+}
+
+// Record returns the event as the flat document written by the JSON sinks.
+// Parsed fields are added at the top level, except those named like one of
+// the fields of the event itself.
+func (e *Event) Record() map[string]interface{} {
+	record := map[string]interface{}{
+		"@timestamp": e.Time.Format(time.RFC3339Nano),
+		"message":    e.Message,
+		"namespace":  e.ServerLog.Namespace,
+		"serverLog":  e.ServerLog.Name,
+		"source":     e.Source,
+		"pod":        e.Pod,
+		"path":       e.Path,
+	}
+	if e.NodeName != "" {
+		record["node"] = e.NodeName
+	}
+	if e.Container != "" {
+		record["container"] = e.Container
+	}
+	if e.Stream != "" {
+		record["stream"] = e.Stream
+	}
+	if len(e.Labels) > 0 {
+		record["labels"] = e.Labels
+	}
+	if md := e.Metadata; md != nil {
+		if md.IP != "" {
+			record["podIP"] = md.IP
+		}
+		if len(md.Containers) > 0 {
+			record["containers"] = md.Containers
+		}
+		if len(md.Annotations) > 0 {
+			record["annotations"] = md.Annotations
+		}
+		if md.OwnerKind != "" {
+			record["owner"] = map[string]string{"kind": md.OwnerKind, "name": md.OwnerName}
+		}
+	}
+	if e.Severity != "" {
+		record["severity"] = e.Severity
+	}
+	for k, v := range e.Fields {
+		if _, ok := record[k]; !ok {
+			record[k] = v
+		}
+	}
+	return record
+}
@@ -0,0 +1,116 @@
+// Package hostfs reads the files of Pod volumes on the node without
+// following symlinks inside them. A Pod can create symlinks in its volumes,
+// following one would let it read any file of the node through the agent.
+package hostfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrSymlink is returned for a path crossing a symlink below the root.
+var ErrSymlink = errors.New("symlink in a volume")
+
+// ErrOutsideRoot is returned for a path that is not below the root.
+var ErrOutsideRoot = errors.New("path outside of the volume")
+
+// CheckFunc returns why a file or directory must not be read. path is where
+// it was opened, real where it really is, with every symlink resolved.
+type CheckFunc func(path, real string) error
+
+// Root is a directory of the node, usually the directory of a volume, whose
+// files are opened without following symlinks below it. The root itself and
+// its parents are chosen by the cluster and may be symlinks.
+type Root struct {
+	dir   string
+	check CheckFunc
+}
+
+// New returns the Root of dir, a path as seen from the agent. check, if not
+// nil, is called for every file and directory opened.
+func New(dir string, check CheckFunc) *Root {
+	return &Root{dir: filepath.Clean(dir), check: check}
+}
+
+// Dir returns the directory of the root.
+func (r *Root) Dir() string {
+	return r.dir
+}
+
+// Open opens the regular file or directory at path, which must be the root
+// or below it. It fails with ErrSymlink when path or one of its parents
+// below the root is a symlink, for other kinds of files and with the error
+// of the CheckFunc.
+func (r *Root) Open(path string) (*os.File, error) {
+	parts, err := r.split("open", path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := openBelow(r.dir, parts, path)
+	if err != nil || r.check == nil {
+		return f, err
+	}
+	//检查打开的文件的真实路径，根目录之上的软链接在这里才被解析
+	real, err := realPath(f)
+	if err == nil {
+		err = r.check(filepath.Clean(path), real)
+	}
+	if err != nil {
+		f.Close()
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return f, nil
+}
+
+// Stat returns the FileInfo of path as Open would open it, without opening
+// it.
+func (r *Root) Stat(path string) (os.FileInfo, error) {
+	parts, err := r.split("stat", path)
+	if err != nil {
+		return nil, err
+	}
+	return statBelow(r.dir, parts, path)
+}
+
+// ReadDir lists the directory at path as os.ReadDir, opening it as Open.
+func (r *Root) ReadDir(path string) ([]os.DirEntry, error) {
+	f, err := r.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := f.ReadDir(-1)
+	if err != nil {
+		return nil, err
+	}
+	//与os.ReadDir一致，按名称排序
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// split returns the components of path below the root.
+func (r *Root) split(op, path string) ([]string, error) {
+	rel, err := filepath.Rel(r.dir, filepath.Clean(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, &os.PathError{Op: op, Path: path, Err: ErrOutsideRoot}
+	}
+	if rel == "." {
+		return nil, nil
+	}
+	return strings.Split(rel, string(filepath.Separator)), nil
+}
+
+// checkKind refuses the files Open does not read, opening a FIFO or a
+// device could block or have side effects.
+func checkKind(op, path string, mode os.FileMode) error {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return &os.PathError{Op: op, Path: path, Err: ErrSymlink}
+	case !mode.IsRegular() && !mode.IsDir():
+		return &os.PathError{Op: op, Path: path, Err: errors.New("not a regular file or directory")}
+	}
+	return nil
+}
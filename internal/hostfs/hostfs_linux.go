@@ -0,0 +1,153 @@
+//go:build linux
+
+package hostfs
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// walk opens the directory holding the last of parts, every directory below
+// root is opened with O_NOFOLLOW relative to its parent, so a symlink
+// swapped in after a check is not followed either.
+func walk(op, root string, parts []string, path string) (int, error) {
+	fd, err := unix.Open(root, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, &os.PathError{Op: op, Path: path, Err: err}
+	}
+	for _, part := range parts[:len(parts)-1] {
+		next, err := unix.Openat(fd, part, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if err != nil {
+			err = classify(fd, part, err)
+			unix.Close(fd)
+			return -1, &os.PathError{Op: op, Path: path, Err: err}
+		}
+		unix.Close(fd)
+		fd = next
+	}
+	return fd, nil
+}
+
+// classify tells a symlink apart from other errors opening name in dirfd.
+func classify(dirfd int, name string, err error) error {
+	if !errors.Is(err, unix.ELOOP) && !errors.Is(err, unix.ENOTDIR) {
+		return err
+	}
+	var st unix.Stat_t
+	if unix.Fstatat(dirfd, name, &st, unix.AT_SYMLINK_NOFOLLOW) == nil && st.Mode&unix.S_IFMT == unix.S_IFLNK {
+		return ErrSymlink
+	}
+	return err
+}
+
+func openBelow(root string, parts []string, path string) (*os.File, error) {
+	if len(parts) == 0 {
+		return os.Open(root)
+	}
+	dirfd, err := walk("open", root, parts, path)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(dirfd)
+	name := parts[len(parts)-1]
+	var before unix.Stat_t
+	if err := unix.Fstatat(dirfd, name, &before, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	if err := checkKind("open", path, fileMode(&before)); err != nil {
+		return nil, err
+	}
+	//O_NONBLOCK：检查之后被换成FIFO时不会阻塞
+	fd, err := unix.Openat(dirfd, name, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: classify(dirfd, name, err)}
+	}
+	var after unix.Stat_t
+	if err := unix.Fstat(fd, &after); err != nil {
+		unix.Close(fd)
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	if after.Dev != before.Dev || after.Ino != before.Ino {
+		unix.Close(fd)
+		return nil, &os.PathError{Op: "open", Path: path, Err: errors.New("file replaced while opening it")}
+	}
+	if err := unix.SetNonblock(fd, false); err != nil {
+		unix.Close(fd)
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+func statBelow(root string, parts []string, path string) (os.FileInfo, error) {
+	if len(parts) == 0 {
+		return os.Stat(root)
+	}
+	dirfd, err := walk("stat", root, parts, path)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(dirfd)
+	info := &fileInfo{name: parts[len(parts)-1]}
+	if err := unix.Fstatat(dirfd, info.name, &info.sys, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+	if err := checkKind("stat", path, info.Mode()); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// fileInfo is the os.FileInfo of a Stat_t, Sys returns a *syscall.Stat_t
+// as for os.Stat.
+type fileInfo struct {
+	name string
+	sys  unix.Stat_t
+}
+
+func (fi *fileInfo) Sys() interface{} {
+	//tailer按syscall.Stat_t取设备号和inode
+	return &syscall.Stat_t{
+		Dev:  fi.sys.Dev,
+		Ino:  fi.sys.Ino,
+		Mode: fi.sys.Mode,
+		Uid:  fi.sys.Uid,
+		Gid:  fi.sys.Gid,
+		Size: fi.sys.Size,
+	}
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.sys.Size }
+func (fi *fileInfo) Mode() os.FileMode  { return fileMode(&fi.sys) }
+func (fi *fileInfo) ModTime() time.Time { return time.Unix(fi.sys.Mtim.Unix()) }
+func (fi *fileInfo) IsDir() bool        { return fi.Mode().IsDir() }
+
+// fileMode converts the mode of st as os.Stat does.
+func fileMode(st *unix.Stat_t) os.FileMode {
+	mode := os.FileMode(st.Mode & 0o777)
+	switch st.Mode & unix.S_IFMT {
+	case unix.S_IFBLK:
+		mode |= os.ModeDevice
+	case unix.S_IFCHR:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case unix.S_IFDIR:
+		mode |= os.ModeDir
+	case unix.S_IFIFO:
+		mode |= os.ModeNamedPipe
+	case unix.S_IFLNK:
+		mode |= os.ModeSymlink
+	case unix.S_IFSOCK:
+		mode |= os.ModeSocket
+	}
+	return mode
+}
+
+// realPath returns the path f was opened at with every symlink resolved.
+func realPath(f *os.File) (string, error) {
+	return os.Readlink("/proc/self/fd/" + strconv.Itoa(int(f.Fd())))
+}
@@ -0,0 +1,54 @@
+//go:build !linux
+
+package hostfs
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// walk checks that no directory of parts below root is a symlink. The agent
+// only runs on linux nodes, here the check and the open are not atomic.
+func walk(op, root string, parts []string, path string) error {
+	dir := root
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if err != nil {
+			return &os.PathError{Op: op, Path: path, Err: err}
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return &os.PathError{Op: op, Path: path, Err: ErrSymlink}
+		}
+	}
+	return nil
+}
+
+func openBelow(root string, parts []string, path string) (*os.File, error) {
+	if _, err := statBelow(root, parts, path); err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(append([]string{root}, parts...)...))
+}
+
+func statBelow(root string, parts []string, path string) (os.FileInfo, error) {
+	if len(parts) == 0 {
+		return os.Stat(root)
+	}
+	if err := walk("stat", root, parts, path); err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(filepath.Join(append([]string{root}, parts...)...))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKind("stat", path, info.Mode()); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// realPath returns the path f was opened at with every symlink resolved.
+func realPath(f *os.File) (string, error) {
+	return filepath.EvalSymlinks(f.Name())
+}
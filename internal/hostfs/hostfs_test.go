@@ -0,0 +1,146 @@
+package hostfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// newVolume returns a volume holding logs/app.log, logs/link.log linked to
+// a file outside of it and escape linked to the directory outside of it.
+func newVolume(t *testing.T) (root, outside string) {
+	t.Helper()
+	dir := t.TempDir()
+	root = filepath.Join(dir, "volume")
+	outside = filepath.Join(dir, "outside")
+	for _, d := range []string{filepath.Join(root, "logs"), outside} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{filepath.Join(root, "logs", "app.log"), filepath.Join(outside, "secret.log")} {
+		if err := os.WriteFile(f, []byte(filepath.Base(f)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.log"), filepath.Join(root, "logs", "link.log")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../outside", filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	return root, outside
+}
+
+func TestRootOpen(t *testing.T) {
+	root, outside := newVolume(t)
+	if err := syscall.Mkfifo(filepath.Join(root, "logs", "fifo.log"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := New(root, nil)
+	tests := []struct {
+		path string
+		// want is the content, "" for an error.
+		want    string
+		wantErr error
+	}{
+		{path: filepath.Join(root, "logs", "app.log"), want: "app.log"},
+		{path: filepath.Join(root, "logs", "link.log"), wantErr: ErrSymlink},
+		{path: filepath.Join(root, "escape", "secret.log"), wantErr: ErrSymlink},
+		{path: filepath.Join(root, "logs", "..", "..", "outside", "secret.log"), wantErr: ErrOutsideRoot},
+		{path: filepath.Join(outside, "secret.log"), wantErr: ErrOutsideRoot},
+		{path: filepath.Join(root, "logs", "fifo.log")},
+		{path: filepath.Join(root, "logs", "missing.log"), wantErr: os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			f, err := r.Open(tt.path)
+			if tt.want == "" {
+				if err == nil {
+					f.Close()
+					t.Fatal("opened")
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("error %v, want %v", err, tt.wantErr)
+				}
+				if _, statErr := r.Stat(tt.path); statErr == nil {
+					t.Error("stat succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			data, err := io.ReadAll(f)
+			if err != nil || string(data) != tt.want {
+				t.Errorf("read %q, %v, want %q", data, err, tt.want)
+			}
+			info, err := r.Stat(tt.path)
+			if err != nil || !info.Mode().IsRegular() || info.Size() != int64(len(tt.want)) {
+				t.Errorf("stat %v, %v", info, err)
+			}
+		})
+	}
+}
+
+func TestRootBehindSymlink(t *testing.T) {
+	root, _ := newVolume(t)
+	// the root itself is chosen by the cluster, e.g. a hostPath volume
+	link := filepath.Join(t.TempDir(), "volume")
+	if err := os.Symlink(root, link); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := New(link, nil).ReadDir(filepath.Join(link, "logs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	// the symlink is listed as such, not as the file it points to
+	if len(names) != 2 || names[0] != "app.log" || names[1] != "link.log" || entries[1].Type()&os.ModeSymlink == 0 {
+		t.Errorf("entries %v", entries)
+	}
+}
+
+func TestRootCheck(t *testing.T) {
+	root, outside := newVolume(t)
+	link := filepath.Join(t.TempDir(), "volume")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Fatal(err)
+	}
+	realOutside, err := filepath.EvalSymlinks(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var checked []string
+	denied := errors.New("denied")
+	check := func(path, real string) error {
+		checked = append(checked, real)
+		if real == realOutside || filepath.Dir(real) == realOutside {
+			return denied
+		}
+		return nil
+	}
+
+	f, err := New(root, check).Open(filepath.Join(root, "logs", "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	// the root is a symlink out of where the check allows reading
+	if _, err := New(link, check).Open(filepath.Join(link, "secret.log")); !errors.Is(err, denied) {
+		t.Errorf("error %v, want the check to deny it", err)
+	}
+	if _, err := New(link, check).ReadDir(link); !errors.Is(err, denied) {
+		t.Errorf("error %v, want the check to deny it", err)
+	}
+	if len(checked) != 3 || checked[1] != filepath.Join(realOutside, "secret.log") {
+		t.Errorf("checked %q, want the real paths", checked)
+	}
+}
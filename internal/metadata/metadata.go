@@ -0,0 +1,198 @@
+package metadata
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/yshaojie/log-collector/internal/event"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// maxOwners bounds the ReplicaSet owners kept; the cache is emptied when it
+// is full, ReplicaSets of old rollouts are never looked up again.
+const maxOwners = 1024
+
+// Filter selects label or annotation keys. Patterns may contain "*", which
+// matches any run of characters including "/".
+type Filter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// NewFilter returns a Filter keeping the keys matching one of include and
+// none of exclude.
+func NewFilter(include, exclude []string) *Filter {
+	return &Filter{include: globs(include), exclude: globs(exclude)}
+}
+
+func globs(patterns []string) []*regexp.Regexp {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		expr := strings.ReplaceAll(regexp.QuoteMeta(p), `\*`, ".*")
+		res = append(res, regexp.MustCompile("^"+expr+"$"))
+	}
+	return res
+}
+
+func matchAny(res []*regexp.Regexp, key string) bool {
+	for _, re := range res {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the entries of m whose key is selected, nil if there are none.
+func (f *Filter) Apply(m map[string]string) map[string]string {
+	var res map[string]string
+	for k, v := range m {
+		if !matchAny(f.include, k) || matchAny(f.exclude, k) {
+			continue
+		}
+		if res == nil {
+			res = map[string]string{}
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// Options configures which Pod labels and annotations are attached to events.
+type Options struct {
+	// Labels selects the Pod labels, every label is kept when it is nil.
+	Labels *Filter
+	// Annotations selects the Pod annotations, none is kept when it is nil.
+	Annotations *Filter
+}
+
+// Pod is the metadata of a Pod attached to its events.
+type Pod struct {
+	Labels   map[string]string
+	Metadata *event.PodMetadata
+}
+
+type owner struct {
+	kind string
+	name string
+}
+
+// Cache serves the metadata of the Pods on the node from a Pod informer.
+// The owner of a ReplicaSet is looked up once and kept.
+type Cache struct {
+	informer cache.SharedIndexInformer
+	lister   corelisters.PodLister
+	client   kubernetes.Interface
+	opts     Options
+
+	mu sync.Mutex
+	// owners maps the uid of a ReplicaSet to the workload owning it.
+	owners map[types.UID]owner
+}
+
+// New returns a Cache. The informer should only watch the Pods of the node.
+func New(informer coreinformers.PodInformer, client kubernetes.Interface, opts Options) *Cache {
+	if opts.Labels == nil {
+		opts.Labels = NewFilter([]string{"*"}, nil)
+	}
+	if opts.Annotations == nil {
+		opts.Annotations = NewFilter(nil, nil)
+	}
+	return &Cache{
+		informer: informer.Informer(),
+		lister:   informer.Lister(),
+		client:   client,
+		opts:     opts,
+		owners:   map[types.UID]owner{},
+	}
+}
+
+// Informer returns the Pod informer the cache reads from.
+func (c *Cache) Informer() cache.SharedIndexInformer {
+	return c.informer
+}
+
+// FilterLabels applies the label filter to labels.
+func (c *Cache) FilterLabels(labels map[string]string) map[string]string {
+	return c.opts.Labels.Apply(labels)
+}
+
+// Pod returns the metadata of a Pod, nil if the Pod is not in the cache.
+func (c *Cache) Pod(ctx context.Context, namespace, name string) (*Pod, error) {
+	pod, err := c.lister.Pods(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	md := &event.PodMetadata{
+		UID:         pod.UID,
+		IP:          pod.Status.PodIP,
+		Annotations: c.opts.Annotations.Apply(pod.Annotations),
+	}
+	for _, container := range pod.Spec.Containers {
+		md.Containers = append(md.Containers, container.Name)
+	}
+	if ref := metav1.GetControllerOf(pod); ref != nil {
+		o := c.owner(ctx, namespace, ref)
+		md.OwnerKind, md.OwnerName = o.kind, o.name
+	}
+	return &Pod{Labels: c.FilterLabels(pod.Labels), Metadata: md}, nil
+}
+
+// owner returns the workload of a Pod controlled by ref. A ReplicaSet is
+// resolved to its Deployment; it is used itself when it has no controller
+// or cannot be read.
+func (c *Cache) owner(ctx context.Context, namespace string, ref *metav1.OwnerReference) owner {
+	o := owner{kind: ref.Kind, name: ref.Name}
+	if ref.Kind != "ReplicaSet" {
+		return o
+	}
+	c.mu.Lock()
+	cached, ok := c.owners[ref.UID]
+	c.mu.Unlock()
+	if ok {
+		return cached
+	}
+	rs, err := c.client.AppsV1().ReplicaSets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		//下次sync时再查
+		klog.Error("get replica set of pod failed, namespace=", namespace, " name=", ref.Name, " err=", err)
+		return o
+	}
+	if rsRef := metav1.GetControllerOf(rs); rsRef != nil {
+		o = owner{kind: rsRef.Kind, name: rsRef.Name}
+	}
+	c.mu.Lock()
+	if len(c.owners) >= maxOwners {
+		c.owners = map[types.UID]owner{}
+	}
+	c.owners[ref.UID] = o
+	c.mu.Unlock()
+	return o
+}
+
+// Changed reports whether the metadata attached to the events of a Pod
+// differs between old and new.
+func Changed(old, new *corev1.Pod) bool {
+	return !reflect.DeepEqual(old.Labels, new.Labels) ||
+		!reflect.DeepEqual(old.Annotations, new.Annotations) ||
+		!reflect.DeepEqual(old.OwnerReferences, new.OwnerReferences) ||
+		old.Status.PodIP != new.Status.PodIP
+}
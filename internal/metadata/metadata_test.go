@@ -0,0 +1,169 @@
+package metadata
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func controllerRef(kind, name, uid string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, UID: types.UID(uid), Controller: &controller}}
+}
+
+func newCache(t *testing.T, opts Options, objects ...runtime.Object) (*Cache, *fake.Clientset) {
+	t.Helper()
+	client := fake.NewSimpleClientset(objects...)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	c := New(factory.Core().V1().Pods(), client, opts)
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	factory.Start(stop)
+	factory.WaitForCacheSync(stop)
+	return c, client
+}
+
+func TestPodMetadata(t *testing.T) {
+	rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       "default",
+		Name:            "web-5d4f8",
+		UID:             "rs-uid",
+		OwnerReferences: controllerRef("Deployment", "web", "deploy-uid"),
+	}}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "web-5d4f8-x2k9q",
+			UID:             "pod-uid",
+			Labels:          map[string]string{"app": "web", "pod-template-hash": "5d4f8"},
+			Annotations:     map[string]string{"team.example.com/owner": "search", "kubectl.kubernetes.io/restartedAt": "now"},
+			OwnerReferences: controllerRef("ReplicaSet", "web-5d4f8", "rs-uid"),
+		},
+		Spec:   corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}, {Name: "sidecar"}}},
+		Status: corev1.PodStatus{PodIP: "10.0.0.7"},
+	}
+	c, client := newCache(t, Options{
+		Labels:      NewFilter([]string{"*"}, []string{"pod-template-hash"}),
+		Annotations: NewFilter([]string{"*.example.com/*"}, nil),
+	}, rs, pod)
+
+	got, err := c.Pod(context.Background(), "default", "web-5d4f8-x2k9q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"app": "web"}; !reflect.DeepEqual(got.Labels, want) {
+		t.Errorf("labels %v, want %v", got.Labels, want)
+	}
+	md := got.Metadata
+	if md.UID != "pod-uid" || md.IP != "10.0.0.7" || !reflect.DeepEqual(md.Containers, []string{"app", "sidecar"}) {
+		t.Errorf("unexpected metadata %+v", md)
+	}
+	if want := map[string]string{"team.example.com/owner": "search"}; !reflect.DeepEqual(md.Annotations, want) {
+		t.Errorf("annotations %v, want %v", md.Annotations, want)
+	}
+	if md.OwnerKind != "Deployment" || md.OwnerName != "web" {
+		t.Errorf("owner %s/%s", md.OwnerKind, md.OwnerName)
+	}
+
+	// the ReplicaSet is only read once
+	if _, err := c.Pod(context.Background(), "default", "web-5d4f8-x2k9q"); err != nil {
+		t.Fatal(err)
+	}
+	gets := 0
+	for _, action := range client.Actions() {
+		if action.Matches("get", "replicasets") {
+			gets++
+		}
+	}
+	if gets != 1 {
+		t.Errorf("replica set read %d times", gets)
+	}
+}
+
+func TestPodOwner(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       "default",
+		Name:            "db-0",
+		OwnerReferences: controllerRef("StatefulSet", "db", "sts-uid"),
+	}}
+	orphan := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       "default",
+		Name:            "orphan-x",
+		OwnerReferences: controllerRef("ReplicaSet", "gone", "gone-uid"),
+	}}
+	c, client := newCache(t, Options{}, pod, orphan)
+
+	got, err := c.Pod(context.Background(), "default", "db-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Metadata.OwnerKind != "StatefulSet" || got.Metadata.OwnerName != "db" {
+		t.Errorf("owner %+v", got.Metadata)
+	}
+
+	// a ReplicaSet that cannot be read is used itself and looked up again
+	got, err = c.Pod(context.Background(), "default", "orphan-x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Metadata.OwnerKind != "ReplicaSet" || got.Metadata.OwnerName != "gone" {
+		t.Errorf("owner %+v", got.Metadata)
+	}
+	if len(c.owners) != 0 {
+		t.Errorf("failed lookup cached: %v", c.owners)
+	}
+	client.PrependReactor("get", "replicasets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name:            "gone",
+			OwnerReferences: controllerRef("Deployment", "back", "d-uid"),
+		}}, nil
+	})
+	got, _ = c.Pod(context.Background(), "default", "orphan-x")
+	if got.Metadata.OwnerKind != "Deployment" || got.Metadata.OwnerName != "back" {
+		t.Errorf("owner %+v", got.Metadata)
+	}
+
+	if got, err := c.Pod(context.Background(), "default", "missing"); got != nil || err != nil {
+		t.Errorf("got %v, %v", got, err)
+	}
+}
+
+func TestFilterDefaults(t *testing.T) {
+	c, _ := newCache(t, Options{})
+	labels := map[string]string{"app": "web", "app.kubernetes.io/name": "web"}
+	if got := c.FilterLabels(labels); !reflect.DeepEqual(got, labels) {
+		t.Errorf("labels %v", got)
+	}
+	if got := c.opts.Annotations.Apply(map[string]string{"a": "b"}); got != nil {
+		t.Errorf("annotations %v", got)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	old := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"v": "1"}, ResourceVersion: "1"}}
+	statusOnly := old.DeepCopy()
+	statusOnly.ResourceVersion = "2"
+	statusOnly.Status.Phase = corev1.PodRunning
+	if Changed(old, statusOnly) {
+		t.Error("status changes do not change the metadata")
+	}
+	relabeled := old.DeepCopy()
+	relabeled.Labels["v"] = "2"
+	if !Changed(old, relabeled) {
+		t.Error("label change not detected")
+	}
+	withIP := old.DeepCopy()
+	withIP.Status.PodIP = "10.0.0.1"
+	if !Changed(old, withIP) {
+		t.Error("pod IP change not detected")
+	}
+}
@@ -0,0 +1,118 @@
+// Package metrics holds the Prometheus metrics of the agent.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "log_collector_agent"
+
+// Reasons a multiline event was flushed. FlushForced is used when the file
+// is gone or drained.
+const (
+	FlushNextEvent = "next_event"
+	FlushRotation  = "rotation"
+	FlushMaxLines  = "max_lines"
+	FlushTimeout   = "timeout"
+	FlushForced    = "forced"
+)
+
+var (
+	// LinesRead and BytesRead count the lines read from the files of a
+	// ServerLog, before multiline lines are joined.
+	LinesRead = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lines_read_total",
+		Help:      "Lines read from the files of a ServerLog.",
+	}, []string{"namespace", "serverlog"})
+	BytesRead = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_read_total",
+		Help:      "Bytes of the lines read from the files of a ServerLog.",
+	}, []string{"namespace", "serverlog"})
+	// ParseFailures counts the events shipped unparsed with _parse_error.
+	ParseFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parse_failures_total",
+		Help:      "Events of a ServerLog a parser failed on.",
+	}, []string{"namespace", "serverlog"})
+	MultilineFlushes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "multiline_flushes_total",
+		Help:      "Multiline events handed out, by the reason they were complete.",
+	}, []string{"reason"})
+	// ThrottledTime is how long the lines of a ServerLog waited for its rate
+	// limit.
+	ThrottledTime = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "throttled_seconds_total",
+		Help:      "Time the lines of a ServerLog waited for its rate limit.",
+	}, []string{"namespace", "serverlog"})
+	// CheckpointLag is the number of bytes of the files of a ServerLog that
+	// were not delivered yet, as reported in its status.
+	CheckpointLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "checkpoint_lag_bytes",
+		Help:      "Bytes of the files of a ServerLog not delivered yet.",
+	}, []string{"namespace", "serverlog"})
+
+	// BufferSize is the size of the disk buffer of the outputs.
+	BufferSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "buffer_size_bytes",
+		Help:      "Size of the segments of the disk buffer.",
+	})
+
+	// SinkBatchDuration observes every attempt to write a batch.
+	SinkBatchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sink_batch_duration_seconds",
+		Help:      "Time taken to write a batch to an output.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"output", "result"})
+	SinkRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sink_retries_total",
+		Help:      "Batches written again after an output failed.",
+	}, []string{"output"})
+	// DroppedEvents counts events given up on when an output is closed. They
+	// were not checkpointed and are read again after a restart.
+	DroppedEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dropped_events_total",
+		Help:      "Events an output gave up on when it was closed.",
+	}, []string{"output"})
+)
+
+// Register registers the agent metrics and the Go and process metrics.
+func Register(registerer prometheus.Registerer) {
+	registerer.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		LinesRead,
+		BytesRead,
+		ParseFailures,
+		MultilineFlushes,
+		ThrottledTime,
+		CheckpointLag,
+		BufferSize,
+		SinkBatchDuration,
+		SinkRetries,
+		DroppedEvents,
+	)
+}
+
+// ForgetServerLog deletes the series of a ServerLog that is gone.
+func ForgetServerLog(ns, name string) {
+	for _, vec := range []*prometheus.MetricVec{LinesRead.MetricVec, BytesRead.MetricVec, ParseFailures.MetricVec, ThrottledTime.MetricVec, CheckpointLag.MetricVec} {
+		vec.DeleteLabelValues(ns, name)
+	}
+}
+
+// ForgetOutput deletes the series of an output that was closed.
+func ForgetOutput(output string) {
+	SinkBatchDuration.DeletePartialMatch(prometheus.Labels{"output": output})
+	SinkRetries.DeleteLabelValues(output)
+	DroppedEvents.DeleteLabelValues(output)
+}
@@ -0,0 +1,167 @@
+package multiline
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/metrics"
+	"github.com/yshaojie/log-collector/internal/tailer"
+)
+
+const (
+	DefaultMaxLines = 500
+	DefaultTimeout  = 5 * time.Second
+)
+
+// Config describes how lines are grouped into events.
+type Config struct {
+	// Pattern matches the first line of an event.
+	Pattern *regexp.Regexp
+	// Negate makes lines that do not match Pattern start a new event.
+	Negate bool
+	// MaxLines flushes an event once it has this many lines.
+	MaxLines int
+	// Timeout flushes a partial event when no line arrived for this long.
+	Timeout time.Duration
+}
+
+// ConfigFromSource builds a Config from a ServerLog source. It returns nil
+// when the source has no multiline pattern.
+func ConfigFromSource(source logv1.LogSource) (*Config, error) {
+	if source.Pattern == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(source.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{
+		Pattern:  pattern,
+		Negate:   source.MultilineNegate,
+		MaxLines: int(source.MultilineMaxLines),
+	}
+	if source.MultilineTimeout != nil {
+		cfg.Timeout = source.MultilineTimeout.Duration
+	}
+	return cfg, nil
+}
+
+func (c *Config) complete() {
+	if c.MaxLines <= 0 {
+		c.MaxLines = DefaultMaxLines
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+}
+
+// isStart reports whether line starts a new event.
+func (c *Config) isStart(line string) bool {
+	return c.Pattern.MatchString(line) != c.Negate
+}
+
+// Aggregator joins the lines of one file into multiline events. An event is
+// handed out as a single Line whose Offset is the one of its last line, so a
+// checkpoint never points into the middle of an event.
+type Aggregator struct {
+	cfg     Config
+	handler tailer.Handler
+
+	mu    sync.Mutex
+	lines []string
+	last  tailer.Line
+	// start is the time of the first line of the event.
+	start   time.Time
+	lastAdd time.Time
+	timer   *time.Timer
+	stopped bool
+}
+
+// New returns an Aggregator handing complete events to handler.
+func New(cfg Config, handler tailer.Handler) *Aggregator {
+	cfg.complete()
+	return &Aggregator{
+		cfg:     cfg,
+		handler: handler,
+	}
+}
+
+// Add adds a line read from the file.
+func (a *Aggregator) Add(line tailer.Line) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stopped {
+		return
+	}
+	//新事件开始，或者文件已轮转，先发送之前的事件
+	if len(a.lines) > 0 {
+		if line.File != a.last.File {
+			a.flushLocked(metrics.FlushRotation)
+		} else if a.cfg.isStart(line.Text) {
+			a.flushLocked(metrics.FlushNextEvent)
+		}
+	}
+	if len(a.lines) == 0 {
+		a.start = line.Time
+	}
+	a.lines = append(a.lines, line.Text)
+	a.last = line
+	a.lastAdd = time.Now()
+	if len(a.lines) >= a.cfg.MaxLines {
+		a.flushLocked(metrics.FlushMaxLines)
+		return
+	}
+	if a.timer == nil {
+		a.timer = time.AfterFunc(a.cfg.Timeout, a.onTimeout)
+	} else {
+		a.timer.Reset(a.cfg.Timeout)
+	}
+}
+
+// Flush hands out the buffered event, if any.
+func (a *Aggregator) Flush() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.flushLocked(metrics.FlushForced)
+}
+
+// Stop drops the buffered lines and stops the timeout. Dropped lines were
+// never checkpointed, so they are read again after a restart.
+func (a *Aggregator) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stopped = true
+	a.lines = nil
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+}
+
+func (a *Aggregator) onTimeout() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stopped || len(a.lines) == 0 {
+		return
+	}
+	//定时器触发后又有新行加入，重新计时
+	if wait := a.cfg.Timeout - time.Since(a.lastAdd); wait > 0 {
+		a.timer.Reset(wait)
+		return
+	}
+	a.flushLocked(metrics.FlushTimeout)
+}
+
+func (a *Aggregator) flushLocked(reason string) {
+	if len(a.lines) == 0 {
+		return
+	}
+	metrics.MultilineFlushes.WithLabelValues(reason).Inc()
+	event := a.last
+	event.Text = strings.Join(a.lines, "\n")
+	event.Time = a.start
+	a.lines = a.lines[:0]
+	a.handler(event)
+}
@@ -0,0 +1,141 @@
+package multiline
+
+import (
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/yshaojie/log-collector/internal/metrics"
+	"github.com/yshaojie/log-collector/internal/tailer"
+)
+
+type events struct {
+	mu    sync.Mutex
+	lines []tailer.Line
+}
+
+func (e *events) handle(line tailer.Line) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lines = append(e.lines, line)
+}
+
+func (e *events) texts() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var texts []string
+	for _, line := range e.lines {
+		texts = append(texts, line.Text)
+	}
+	return texts
+}
+
+func feed(a *Aggregator, texts ...string) {
+	for i, text := range texts {
+		a.Add(tailer.Line{Text: text, Offset: int64(i + 1)})
+	}
+}
+
+func TestJavaStackTrace(t *testing.T) {
+	e := &events{}
+	a := New(Config{Pattern: regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`), Timeout: time.Hour}, e.handle)
+	defer a.Stop()
+	feed(a,
+		"2023-06-01 10:00:00 ERROR request failed",
+		"java.lang.IllegalStateException: boom",
+		"\tat com.example.Foo.bar(Foo.java:42)",
+		"2023-06-01 10:00:01 INFO next",
+	)
+	want := []string{"2023-06-01 10:00:00 ERROR request failed\njava.lang.IllegalStateException: boom\n\tat com.example.Foo.bar(Foo.java:42)"}
+	if got := e.texts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if e.lines[0].Offset != 3 {
+		t.Fatalf("event offset %d, want the offset of its last line", e.lines[0].Offset)
+	}
+	a.Flush()
+	if got := e.texts(); len(got) != 2 || got[1] != "2023-06-01 10:00:01 INFO next" {
+		t.Fatalf("unexpected events after flush %q", got)
+	}
+}
+
+func TestNegatedPythonTraceback(t *testing.T) {
+	e := &events{}
+	// continuation lines are indented, everything else starts an event
+	a := New(Config{Pattern: regexp.MustCompile(`^\s`), Negate: true, Timeout: time.Hour}, e.handle)
+	defer a.Stop()
+	feed(a,
+		"Traceback (most recent call last):",
+		`  File "app.py", line 1, in <module>`,
+		"ZeroDivisionError: division by zero",
+	)
+	a.Flush()
+	want := []string{
+		"Traceback (most recent call last):\n  File \"app.py\", line 1, in <module>",
+		"ZeroDivisionError: division by zero",
+	}
+	if got := e.texts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestMaxLines(t *testing.T) {
+	e := &events{}
+	a := New(Config{Pattern: regexp.MustCompile(`^start`), MaxLines: 2, Timeout: time.Hour}, e.handle)
+	defer a.Stop()
+	feed(a, "start", "a", "b")
+	a.Flush()
+	want := []string{"start\na", "b"}
+	if got := e.texts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestTimeoutFlushesPartialEvent(t *testing.T) {
+	e := &events{}
+	a := New(Config{Pattern: regexp.MustCompile(`^start`), Timeout: 20 * time.Millisecond}, e.handle)
+	defer a.Stop()
+	feed(a, "start", "last exception line")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && len(e.texts()) == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	want := []string{"start\nlast exception line"}
+	if got := e.texts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestFileChangeStartsNewEvent(t *testing.T) {
+	e := &events{}
+	a := New(Config{Pattern: regexp.MustCompile(`^start`), Timeout: time.Hour}, e.handle)
+	defer a.Stop()
+	a.Add(tailer.Line{Text: "start", File: tailer.FileID{Inode: 1}})
+	a.Add(tailer.Line{Text: "continued in new file", File: tailer.FileID{Inode: 2}})
+	a.Flush()
+	want := []string{"start", "continued in new file"}
+	if got := e.texts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestFlushReasons(t *testing.T) {
+	e := &events{}
+	a := New(Config{Pattern: regexp.MustCompile(`^\S`), MaxLines: 2, Timeout: time.Hour}, e.handle)
+	defer a.Stop()
+	before := map[string]float64{}
+	for _, reason := range []string{metrics.FlushNextEvent, metrics.FlushMaxLines, metrics.FlushForced} {
+		before[reason] = testutil.ToFloat64(metrics.MultilineFlushes.WithLabelValues(reason))
+	}
+	feed(a, "one", "two", "  continued", "three")
+	a.Flush()
+	for reason, want := range map[string]float64{metrics.FlushNextEvent: 1, metrics.FlushMaxLines: 1, metrics.FlushForced: 1} {
+		if got := testutil.ToFloat64(metrics.MultilineFlushes.WithLabelValues(reason)) - before[reason]; got != want {
+			t.Errorf("%s flushes %v, want %v", reason, got, want)
+		}
+	}
+}
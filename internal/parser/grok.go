@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// maxGrokDepth limits how deeply patterns may reference each other.
+const maxGrokDepth = 32
+
+// grokPatterns are the built-in patterns, the commonly used part of the
+// Logstash library rewritten for RE2.
+var grokPatterns = map[string]string{
+	"USERNAME":          `[a-zA-Z0-9._-]+`,
+	"USER":              `%{USERNAME}`,
+	"INT":               `[+-]?[0-9]+`,
+	"BASE10NUM":         `[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+)`,
+	"NUMBER":            `%{BASE10NUM}`,
+	"BASE16NUM":         `(?:0[xX])?[0-9A-Fa-f]+`,
+	"POSINT":            `\b[1-9][0-9]*\b`,
+	"NONNEGINT":         `\b[0-9]+\b`,
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"QUOTEDSTRING":      `"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`,
+	"QS":                `%{QUOTEDSTRING}`,
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"IPV4":              `(?:(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])`,
+	"IPV6":              `(?:[0-9A-Fa-f]{0,4}:){2,7}(?:%{IPV4}|[0-9A-Fa-f]{0,4})`,
+	"IP":                `%{IPV4}|%{IPV6}`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?`,
+	"IPORHOST":          `%{IP}|%{HOSTNAME}`,
+	"HOSTPORT":          `%{IPORHOST}:%{POSINT}`,
+	"PATH":              `(?:/[\w%!$@:.,+~-]*)+`,
+	"URIPROTO":          `[A-Za-z][A-Za-z0-9+.-]*`,
+	"URIHOST":           `%{IPORHOST}(?::%{POSINT})?`,
+	"URIPATH":           `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_-]*)+`,
+	"URIPARAM":          `\?[A-Za-z0-9$.+!*'|(){},~@#%&/=:;_?\[\]<>-]*`,
+	"URIPATHPARAM":      `%{URIPATH}(?:%{URIPARAM})?`,
+	"URI":               `%{URIPROTO}://(?:%{USER}(?::[^@]*)?@)?%{URIHOST}?(?:%{URIPATHPARAM})?`,
+	"MONTH":             `\b(?:[Jj]an(?:uary)?|[Ff]eb(?:ruary)?|[Mm]ar(?:ch)?|[Aa]pr(?:il)?|[Mm]ay|[Jj]un(?:e)?|[Jj]ul(?:y)?|[Aa]ug(?:ust)?|[Ss]ep(?:tember)?|[Oo]ct(?:ober)?|[Nn]ov(?:ember)?|[Dd]ec(?:ember)?)\b`,
+	"MONTHNUM":          `0?[1-9]|1[0-2]`,
+	"MONTHDAY":          `0[1-9]|[12][0-9]|3[01]|[1-9]`,
+	"DAY":               `Mon(?:day)?|Tue(?:sday)?|Wed(?:nesday)?|Thu(?:rsday)?|Fri(?:day)?|Sat(?:urday)?|Sun(?:day)?`,
+	"YEAR":              `(?:\d\d){1,2}`,
+	"HOUR":              `2[0123]|[01]?[0-9]`,
+	"MINUTE":            `[0-5][0-9]`,
+	"SECOND":            `(?:[0-5]?[0-9]|60)(?:[:.,][0-9]+)?`,
+	"TIME":              `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"ISO8601_TIMEZONE":  `Z|[+-]%{HOUR}:?%{MINUTE}`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?%{ISO8601_TIMEZONE}?`,
+	"DATE_US":           `%{MONTHNUM}[/-]%{MONTHDAY}[/-]%{YEAR}`,
+	"DATE_EU":           `%{MONTHDAY}[./-]%{MONTHNUM}[./-]%{YEAR}`,
+	"DATE":              `%{DATE_US}|%{DATE_EU}`,
+	"DATESTAMP":         `%{DATE}[- ]%{TIME}`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} %{INT}`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+	"LOGLEVEL":          `[Tt]race|TRACE|[Dd]ebug|DEBUG|[Nn]otice|NOTICE|[Ii]nfo(?:rmation)?|INFO(?:RMATION)?|[Ww]arn(?:ing)?|WARN(?:ING)?|[Ee]rr(?:or)?|ERR(?:OR)?|[Cc]rit(?:ical)?|CRIT(?:ICAL)?|[Ff]atal|FATAL|[Ss]evere|SEVERE|[Aa]lert|ALERT|[Ee]merg(?:ency)?|EMERG(?:ENCY)?`,
+	"COMMONAPACHELOG":   `%{IPORHOST:clientip} %{USER:ident} %{USER:auth} \[%{HTTPDATE:timestamp}\] "(?:%{WORD:verb} %{NOTSPACE:request}(?: HTTP/%{NUMBER:httpversion})?|%{DATA:rawrequest})" %{NUMBER:response:int} (?:%{NUMBER:bytes:int}|-)`,
+	"COMBINEDAPACHELOG": `%{COMMONAPACHELOG} %{QS:referrer} %{QS:agent}`,
+}
+
+// grokReference matches %{PATTERN}, %{PATTERN:field} and %{PATTERN:field:type}.
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::([\w.@-]+))?(?::(int|float))?\}`)
+
+type grok struct {
+	re *regexp.Regexp
+	// fields maps the generated group names to their field.
+	fields map[string]grokField
+}
+
+type grokField struct {
+	name string
+	// typ is int, float or empty for strings.
+	typ string
+}
+
+// compileGrok expands the references of pattern into a regular expression.
+// custom patterns take precedence over the built-in ones.
+func compileGrok(pattern string, custom map[string]string) (*grok, error) {
+	if pattern == "" {
+		return nil, errors.New("grok pattern is empty")
+	}
+	g := &grok{fields: map[string]grokField{}}
+	expr, err := g.expand(pattern, custom, 0)
+	if err != nil {
+		return nil, err
+	}
+	if g.re, err = regexp.Compile(expr); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *grok) expand(pattern string, custom map[string]string, depth int) (string, error) {
+	if depth > maxGrokDepth {
+		return "", errors.New("grok patterns reference each other too deeply")
+	}
+	var expandErr error
+	expr := grokReference.ReplaceAllStringFunc(pattern, func(ref string) string {
+		if expandErr != nil {
+			return ""
+		}
+		m := grokReference.FindStringSubmatch(ref)
+		def, ok := custom[m[1]]
+		if !ok {
+			def, ok = grokPatterns[m[1]]
+		}
+		if !ok {
+			expandErr = fmt.Errorf("unknown grok pattern %s", m[1])
+			return ""
+		}
+		sub, err := g.expand(def, custom, depth+1)
+		if err != nil {
+			expandErr = err
+			return ""
+		}
+		if m[2] == "" {
+			return "(?:" + sub + ")"
+		}
+		group := "grok" + strconv.Itoa(len(g.fields))
+		g.fields[group] = grokField{name: m[2], typ: m[3]}
+		return "(?P<" + group + ">" + sub + ")"
+	})
+	return expr, expandErr
+}
+
+func (g *grok) parse(text string) (map[string]interface{}, error) {
+	match := g.re.FindStringSubmatchIndex(text)
+	if match == nil {
+		return nil, errors.New("line does not match the grok pattern")
+	}
+	fields := map[string]interface{}{}
+	for i, group := range g.re.SubexpNames() {
+		if group == "" || match[2*i] < 0 {
+			continue
+		}
+		value := text[match[2*i]:match[2*i+1]]
+		field, ok := g.fields[group]
+		if !ok {
+			//表达式中直接写的命名分组
+			fields[group] = value
+			continue
+		}
+		switch field.typ {
+		case "int":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.name, err)
+			}
+			fields[field.name] = n
+		case "float":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.name, err)
+			}
+			fields[field.name] = f
+		default:
+			fields[field.name] = value
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGrokBuiltinPatterns(t *testing.T) {
+	// every built-in pattern must compile
+	for name := range grokPatterns {
+		if _, err := compileGrok("%{"+name+"}", nil); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestGrok(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		patterns map[string]string
+		line     string
+		want     map[string]interface{}
+	}{
+		{
+			pattern: `%{TIMESTAMP_ISO8601:time} %{LOGLEVEL:level} \[%{DATA:thread}\] %{GREEDYDATA:msg}`,
+			line:    `2023-06-01T08:30:00.123Z INFO [main] server started`,
+			want:    map[string]interface{}{"time": "2023-06-01T08:30:00.123Z", "level": "INFO", "thread": "main", "msg": "server started"},
+		},
+		{
+			pattern: `%{COMMONAPACHELOG}`,
+			line:    `10.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /index.html?x=1 HTTP/1.0" 200 2326`,
+			want: map[string]interface{}{
+				"clientip": "10.0.0.1", "ident": "-", "auth": "frank", "timestamp": "10/Oct/2000:13:55:36 -0700",
+				"verb": "GET", "request": "/index.html?x=1", "httpversion": "1.0", "response": int64(200), "bytes": int64(2326),
+			},
+		},
+		{
+			pattern:  `%{ORDER:order} took %{NUMBER:ms:float}ms (?P<status>\w+)`,
+			patterns: map[string]string{"ORDER": `ORD-%{INT}`},
+			line:     `ORD-42 took 1.5ms ok`,
+			want:     map[string]interface{}{"order": "ORD-42", "ms": 1.5, "status": "ok"},
+		},
+	}
+	for _, tt := range tests {
+		g, err := compileGrok(tt.pattern, tt.patterns)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.pattern, err)
+		}
+		got, err := g.parse(tt.line)
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\ngot  %v\nwant %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestGrokErrors(t *testing.T) {
+	if _, err := compileGrok(`%{A}`, map[string]string{"A": "%{B}", "B": "%{A}"}); err == nil {
+		t.Error("recursive patterns should fail")
+	}
+	g, err := compileGrok(`%{WORD:a} %{INT:n:int}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.parse("no-match"); err == nil {
+		t.Error("expected a match error")
+	}
+	if _, err := g.parse("x 99999999999999999999"); err == nil {
+		t.Error("expected a conversion error")
+	}
+}
@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// parseLogfmt parses key=value pairs separated by spaces. Values may be
+// double quoted; a key without a value gets an empty value. A line without
+// a single key=value pair is not logfmt.
+func parseLogfmt(text string) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	pairs := 0
+	for i := 0; i < len(text); {
+		if text[i] == ' ' || text[i] == '\t' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(text) && text[i] != '=' && text[i] != ' ' && text[i] != '\t' {
+			if text[i] == '"' {
+				return nil, fmt.Errorf("unexpected quote at %d", i)
+			}
+			i++
+		}
+		key := text[start:i]
+		if key == "" {
+			return nil, fmt.Errorf("missing key at %d", i)
+		}
+		if i == len(text) || text[i] != '=' {
+			fields[key] = ""
+			continue
+		}
+		i++
+		pairs++
+		if i < len(text) && text[i] == '"' {
+			end, err := quotedEnd(text, i)
+			if err != nil {
+				return nil, err
+			}
+			value, err := strconv.Unquote(text[i:end])
+			if err != nil {
+				return nil, fmt.Errorf("value of %s: %w", key, err)
+			}
+			fields[key] = value
+			i = end
+			continue
+		}
+		start = i
+		for i < len(text) && text[i] != ' ' && text[i] != '\t' {
+			i++
+		}
+		fields[key] = text[start:i]
+	}
+	if pairs == 0 {
+		return nil, errors.New("no key=value pairs")
+	}
+	return fields, nil
+}
+
+// quotedEnd returns the index just past the quoted string starting at i.
+func quotedEnd(text string, i int) (int, error) {
+	for j := i + 1; j < len(text); j++ {
+		switch text[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated quote at %d", i)
+}
@@ -0,0 +1,35 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLogfmt(t *testing.T) {
+	tests := []struct {
+		line string
+		want map[string]interface{}
+	}{
+		{`a=1 b=two`, map[string]interface{}{"a": "1", "b": "two"}},
+		{`msg="hello \"world\"" empty= flag`, map[string]interface{}{"msg": `hello "world"`, "empty": "", "flag": ""}},
+		{"  level=info\tcaller=main.go:12 ", map[string]interface{}{"level": "info", "caller": "main.go:12"}},
+	}
+	for _, tt := range tests {
+		got, err := parseLogfmt(tt.line)
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseLogfmtInvalid(t *testing.T) {
+	for _, line := range []string{`plain text line`, `msg="unterminated`, `=value`, `a"b=1`, ``} {
+		if fields, err := parseLogfmt(line); err == nil {
+			t.Errorf("%q: expected an error, got %v", line, fields)
+		}
+	}
+}
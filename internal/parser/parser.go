@@ -0,0 +1,278 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/event"
+)
+
+// ErrorField is the field holding the error of a record that failed to parse.
+const ErrorField = "_parse_error"
+
+// Pipeline runs the parsers of a ServerLog over its events.
+type Pipeline struct {
+	stages []*stage
+}
+
+type stage struct {
+	typ    logv1.ParserType
+	source string
+	parse  func(text string) (map[string]interface{}, error)
+
+	timeKey     string
+	timeFormat  string
+	location    *time.Location
+	severityKey string
+}
+
+// New builds the pipeline of parsers. It returns nil when there are none.
+func New(parsers []logv1.Parser) (*Pipeline, error) {
+	if len(parsers) == 0 {
+		return nil, nil
+	}
+	p := &Pipeline{}
+	for i, spec := range parsers {
+		s, err := newStage(spec)
+		if err != nil {
+			return nil, fmt.Errorf("parsers[%d]: %w", i, err)
+		}
+		p.stages = append(p.stages, s)
+	}
+	return p, nil
+}
+
+func newStage(spec logv1.Parser) (*stage, error) {
+	s := &stage{
+		typ:         spec.Type,
+		source:      spec.Source,
+		timeKey:     spec.TimeKey,
+		timeFormat:  spec.TimeFormat,
+		location:    time.UTC,
+		severityKey: spec.SeverityKey,
+	}
+	switch spec.Type {
+	case logv1.ParserJSON:
+		s.parse = parseJSON
+	case logv1.ParserLogfmt:
+		s.parse = parseLogfmt
+	case logv1.ParserRegex:
+		re, err := regexp.Compile(spec.Expression)
+		if err != nil {
+			return nil, err
+		}
+		named := false
+		for _, name := range re.SubexpNames() {
+			named = named || name != ""
+		}
+		if !named {
+			return nil, errors.New("regex has no named groups")
+		}
+		s.parse = (&regexParser{re: re}).parse
+	case logv1.ParserGrok:
+		g, err := compileGrok(spec.Expression, spec.Patterns)
+		if err != nil {
+			return nil, err
+		}
+		s.parse = g.parse
+	default:
+		return nil, fmt.Errorf("unknown parser type %q", spec.Type)
+	}
+	if spec.Timezone != "" {
+		loc, err := time.LoadLocation(spec.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		s.location = loc
+	}
+	return s, nil
+}
+
+// Parse adds the fields, timestamp and severity of the record to ev. The
+// stages run in order and stop at the first one failing, whose error is
+// kept in the ErrorField of ev and returned.
+func (p *Pipeline) Parse(ev *event.Event) error {
+	for _, s := range p.stages {
+		if err := s.run(ev); err != nil {
+			err = fmt.Errorf("%s parser: %w", s.typ, err)
+			if ev.Fields == nil {
+				ev.Fields = map[string]interface{}{}
+			}
+			ev.Fields[ErrorField] = err.Error()
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *stage) run(ev *event.Event) error {
+	text := ev.Message
+	if s.source != "" {
+		v, ok := ev.Fields[s.source]
+		if !ok {
+			return fmt.Errorf("no field %q", s.source)
+		}
+		if text, ok = v.(string); !ok {
+			return fmt.Errorf("field %q is not a string", s.source)
+		}
+	}
+	fields, err := s.parse(text)
+	if err != nil {
+		return err
+	}
+	if ev.Fields == nil {
+		ev.Fields = make(map[string]interface{}, len(fields))
+	}
+	for k, v := range fields {
+		ev.Fields[k] = v
+	}
+
+	if s.timeKey != "" {
+		v, ok := ev.Fields[s.timeKey]
+		if !ok {
+			return fmt.Errorf("no time field %q", s.timeKey)
+		}
+		t, err := parseTime(v, s.timeFormat, s.location)
+		if err != nil {
+			return err
+		}
+		ev.Time = t
+	}
+	if s.severityKey != "" {
+		if v, ok := ev.Fields[s.severityKey]; ok {
+			ev.Severity = NormalizeSeverity(fmt.Sprint(v))
+		}
+	}
+	return nil
+}
+
+// parseTime parses the value of a time field. format is a Go layout or one
+// of unix, unix_ms and unix_ns; layouts without an offset are read in loc.
+func parseTime(v interface{}, format string, loc *time.Location) (time.Time, error) {
+	switch format {
+	case "unix", "unix_ms", "unix_ns":
+		n, err := toFloat(v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("time field: %w", err)
+		}
+		switch format {
+		case "unix":
+			sec, frac := math.Modf(n)
+			return time.Unix(int64(sec), int64(frac*1e9)), nil
+		case "unix_ms":
+			return time.UnixMilli(int64(n)), nil
+		default:
+			return time.Unix(0, int64(n)), nil
+		}
+	}
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("time field is not a string: %v", v)
+	}
+	layout := format
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	t, err := time.ParseInLocation(layout, s, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t, nil
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case int64:
+		return float64(n), nil
+	case json.Number:
+		return n.Float64()
+	case string:
+		return strconv.ParseFloat(n, 64)
+	}
+	return 0, fmt.Errorf("not a number: %v", v)
+}
+
+// severities maps the spellings of common levels to their normalized name.
+var severities = map[string]string{
+	"trace":         "trace",
+	"debug":         "debug",
+	"dbg":           "debug",
+	"d":             "debug",
+	"info":          "info",
+	"information":   "info",
+	"informational": "info",
+	"notice":        "info",
+	"i":             "info",
+	"warn":          "warn",
+	"warning":       "warn",
+	"w":             "warn",
+	"error":         "error",
+	"err":           "error",
+	"severe":        "error",
+	"e":             "error",
+	"fatal":         "fatal",
+	"critical":      "fatal",
+	"crit":          "fatal",
+	"panic":         "fatal",
+	"alert":         "fatal",
+	"emerg":         "fatal",
+	"emergency":     "fatal",
+	"f":             "fatal",
+}
+
+// NormalizeSeverity returns one of trace, debug, info, warn, error and fatal
+// for a level written by a logging library, or the lower-cased level when
+// it is not known.
+func NormalizeSeverity(level string) string {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if s, ok := severities[level]; ok {
+		return s
+	}
+	return level
+}
+
+// parseJSON parses a JSON object. Numbers are kept as json.Number so large
+// integers are not rounded.
+func parseJSON(text string) (map[string]interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, errors.New("not a JSON object")
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after the JSON object")
+	}
+	return fields, nil
+}
+
+type regexParser struct {
+	re *regexp.Regexp
+}
+
+func (r *regexParser) parse(text string) (map[string]interface{}, error) {
+	match := r.re.FindStringSubmatchIndex(text)
+	if match == nil {
+		return nil, errors.New("line does not match the expression")
+	}
+	fields := map[string]interface{}{}
+	for i, name := range r.re.SubexpNames() {
+		if name == "" || match[2*i] < 0 {
+			continue
+		}
+		fields[name] = text[match[2*i]:match[2*i+1]]
+	}
+	return fields, nil
+}
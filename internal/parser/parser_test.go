@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/event"
+)
+
+var readTime = time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func parse(t *testing.T, parsers []logv1.Parser, message string) *event.Event {
+	t.Helper()
+	p, err := New(parsers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := &event.Event{Message: message, Time: readTime}
+	p.Parse(ev)
+	return ev
+}
+
+func TestJSON(t *testing.T) {
+	ev := parse(t, []logv1.Parser{{
+		Type:        logv1.ParserJSON,
+		TimeKey:     "ts",
+		SeverityKey: "level",
+	}}, `{"ts":"2023-06-01T08:30:00.123+08:00","level":"WARNING","msg":"disk full","id":12345678901234567890}`)
+
+	if err, ok := ev.Fields[ErrorField]; ok {
+		t.Fatal(err)
+	}
+	if want := time.Date(2023, 6, 1, 0, 30, 0, 123e6, time.UTC); !ev.Time.Equal(want) {
+		t.Errorf("time %v, want %v", ev.Time, want)
+	}
+	if ev.Severity != "warn" {
+		t.Errorf("severity %q", ev.Severity)
+	}
+	if ev.Fields["msg"] != "disk full" {
+		t.Errorf("msg %v", ev.Fields["msg"])
+	}
+	if ev.Fields["id"] != json.Number("12345678901234567890") {
+		t.Errorf("id %v", ev.Fields["id"])
+	}
+}
+
+func TestJSONInvalid(t *testing.T) {
+	for _, line := range []string{`not json`, `[1, 2]`, `{"a":1} trailing`, `{"a":`} {
+		ev := parse(t, []logv1.Parser{{Type: logv1.ParserJSON}}, line)
+		err, ok := ev.Fields[ErrorField].(string)
+		if !ok || !strings.HasPrefix(err, "json parser: ") {
+			t.Errorf("%s: got fields %v", line, ev.Fields)
+		}
+		if ev.Message != line || !ev.Time.Equal(readTime) {
+			t.Errorf("%s: event changed: %+v", line, ev)
+		}
+	}
+}
+
+func TestRegexWithTimezone(t *testing.T) {
+	ev := parse(t, []logv1.Parser{{
+		Type:        logv1.ParserRegex,
+		Expression:  `^(?P<time>\S+ \S+) \[(?P<level>\w+)\] (?P<msg>.*)$`,
+		TimeKey:     "time",
+		TimeFormat:  "2006-01-02 15:04:05.000",
+		Timezone:    "Asia/Shanghai",
+		SeverityKey: "level",
+	}}, `2023-06-01 08:30:00.500 [ERR] connection refused`)
+
+	if err, ok := ev.Fields[ErrorField]; ok {
+		t.Fatal(err)
+	}
+	if want := time.Date(2023, 6, 1, 0, 30, 0, 5e8, time.UTC); !ev.Time.Equal(want) {
+		t.Errorf("time %v, want %v", ev.Time, want)
+	}
+	if ev.Severity != "error" || ev.Fields["msg"] != "connection refused" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+}
+
+func TestRegexNoMatch(t *testing.T) {
+	ev := parse(t, []logv1.Parser{{Type: logv1.ParserRegex, Expression: `^(?P<n>\d+)$`}}, "abc")
+	if ev.Fields[ErrorField] != "regex parser: line does not match the expression" {
+		t.Errorf("got %v", ev.Fields)
+	}
+}
+
+func TestPipelineSource(t *testing.T) {
+	// a JSON envelope whose log field is logfmt
+	ev := parse(t, []logv1.Parser{
+		{Type: logv1.ParserJSON},
+		{Type: logv1.ParserLogfmt, Source: "log", TimeKey: "t", TimeFormat: "unix_ms"},
+	}, `{"log":"level=info t=1685579400000 msg=\"user logged in\"","stream":"stdout"}`)
+
+	if err, ok := ev.Fields[ErrorField]; ok {
+		t.Fatal(err)
+	}
+	if ev.Fields["stream"] != "stdout" || ev.Fields["msg"] != "user logged in" {
+		t.Errorf("unexpected fields %v", ev.Fields)
+	}
+	if !ev.Time.Equal(time.UnixMilli(1685579400000)) {
+		t.Errorf("time %v", ev.Time)
+	}
+
+	// the fields of the stages before the failing one are kept
+	ev = parse(t, []logv1.Parser{
+		{Type: logv1.ParserJSON},
+		{Type: logv1.ParserLogfmt, Source: "missing"},
+	}, `{"log":"x"}`)
+	if ev.Fields["log"] != "x" || ev.Fields[ErrorField] != `logfmt parser: no field "missing"` {
+		t.Errorf("unexpected fields %v", ev.Fields)
+	}
+}
+
+func TestTimeErrors(t *testing.T) {
+	ev := parse(t, []logv1.Parser{{Type: logv1.ParserLogfmt, TimeKey: "ts"}}, "a=1")
+	if ev.Fields[ErrorField] != `logfmt parser: no time field "ts"` {
+		t.Errorf("got %v", ev.Fields)
+	}
+	ev = parse(t, []logv1.Parser{{Type: logv1.ParserLogfmt, TimeKey: "ts"}}, "ts=yesterday")
+	if _, ok := ev.Fields[ErrorField]; !ok || !ev.Time.Equal(readTime) {
+		t.Errorf("got %+v", ev)
+	}
+}
+
+func TestParseTimeUnix(t *testing.T) {
+	tests := []struct {
+		value  interface{}
+		format string
+		want   time.Time
+	}{
+		{json.Number("1685579400.25"), "unix", time.Unix(1685579400, 25e7)},
+		{"1685579400123", "unix_ms", time.UnixMilli(1685579400123)},
+		{float64(1685579400123456789), "unix_ns", time.Unix(0, 1685579400123456789)},
+	}
+	for _, tt := range tests {
+		got, err := parseTime(tt.value, tt.format, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// float64 has microsecond precision for nanosecond timestamps
+		if d := got.Sub(tt.want); d > time.Microsecond || d < -time.Microsecond {
+			t.Errorf("%v %s: got %v, want %v", tt.value, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	p, err := New(nil)
+	if p != nil || err != nil {
+		t.Errorf("got %v, %v", p, err)
+	}
+	invalid := [][]logv1.Parser{
+		{{Type: "xml"}},
+		{{Type: logv1.ParserRegex, Expression: `(`}},
+		{{Type: logv1.ParserRegex, Expression: `\d+`}},
+		{{Type: logv1.ParserGrok, Expression: `%{NOPE:x}`}},
+		{{Type: logv1.ParserJSON, Timezone: "Mars/Olympus"}},
+	}
+	for _, parsers := range invalid {
+		if _, err := New(parsers); err == nil {
+			t.Errorf("%+v: expected an error", parsers)
+		}
+	}
+}
+
+func TestNormalizeSeverity(t *testing.T) {
+	got := []string{}
+	for _, level := range []string{"INFO", " Warning ", "E", "CRITICAL", "verbose"} {
+		got = append(got, NormalizeSeverity(level))
+	}
+	if want := []string{"info", "warn", "error", "fatal", "verbose"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,187 @@
+// Package ratelimit limits how fast the agent reads the files of a
+// ServerLog, so one chatty Pod cannot starve the others of the node.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Limits are the rates a ServerLog is read at, 0 is unlimited.
+type Limits struct {
+	LinesPerSecond int64
+	BytesPerSecond int64
+}
+
+// Unlimited reports whether neither rate is limited.
+func (l Limits) Unlimited() bool {
+	return l.LinesPerSecond <= 0 && l.BytesPerSecond <= 0
+}
+
+func (l Limits) String() string {
+	if l.Unlimited() {
+		return "unlimited"
+	}
+	s := ""
+	if l.LinesPerSecond > 0 {
+		s = fmt.Sprintf("%d lines/s", l.LinesPerSecond)
+	}
+	if l.BytesPerSecond > 0 {
+		if s != "" {
+			s += ", "
+		}
+		s += resource.NewQuantity(l.BytesPerSecond, resource.BinarySI).String() + " bytes/s"
+	}
+	return s
+}
+
+// Clamp returns l with each rate lowered to the one of max, an unlimited
+// rate takes the one of max.
+func (l Limits) Clamp(max Limits) Limits {
+	l.LinesPerSecond = clamp(l.LinesPerSecond, max.LinesPerSecond)
+	l.BytesPerSecond = clamp(l.BytesPerSecond, max.BytesPerSecond)
+	return l
+}
+
+func clamp(rate, max int64) int64 {
+	if max > 0 && (rate <= 0 || rate > max) {
+		return max
+	}
+	return rate
+}
+
+// LimitsOf returns the limits of a ServerLog: those of spec, each falling
+// back to the annotations of its namespace. An invalid annotation is
+// ignored and returned as the error.
+func LimitsOf(spec *logv1.RateLimit, namespaceAnnotations map[string]string) (Limits, error) {
+	var limits Limits
+	if spec != nil {
+		limits.LinesPerSecond = spec.LinesPerSecond
+		if spec.BytesPerSecond != nil {
+			limits.BytesPerSecond = spec.BytesPerSecond.Value()
+		}
+	}
+	var err error
+	if value, ok := namespaceAnnotations[utils.AnnotationRateLimitLines]; ok && limits.LinesPerSecond <= 0 {
+		lines, parseErr := strconv.ParseInt(value, 10, 64)
+		if parseErr != nil || lines < 0 {
+			err = fmt.Errorf("annotation %s: invalid value %q", utils.AnnotationRateLimitLines, value)
+		} else {
+			limits.LinesPerSecond = lines
+		}
+	}
+	if value, ok := namespaceAnnotations[utils.AnnotationRateLimitBytes]; ok && limits.BytesPerSecond <= 0 {
+		bytes, parseErr := resource.ParseQuantity(value)
+		if parseErr != nil || bytes.Sign() < 0 {
+			err = fmt.Errorf("annotation %s: invalid value %q", utils.AnnotationRateLimitBytes, value)
+		} else {
+			limits.BytesPerSecond = bytes.Value()
+		}
+	}
+	return limits, err
+}
+
+// Limiter is a token bucket for the lines and one for the bytes of a
+// ServerLog, shared by the tailers of its files. A second of the rate may
+// be read at once after an idle period.
+//
+// Tokens are reserved in the order the tailers ask for them and a tailer
+// waits for a line before it reads the next, so the tailers of a ServerLog
+// take turns instead of the busiest file using up the rate.
+type Limiter struct {
+	mu     sync.Mutex
+	limits Limits
+
+	lines *rate.Limiter
+	bytes *rate.Limiter
+}
+
+// NewLimiter returns a Limiter for limits.
+func NewLimiter(limits Limits) *Limiter {
+	l := &Limiter{
+		lines: rate.NewLimiter(rate.Inf, 0),
+		bytes: rate.NewLimiter(rate.Inf, 0),
+	}
+	l.Set(limits)
+	return l
+}
+
+// Set changes the limits, the lines waiting keep their turn.
+func (l *Limiter) Set(limits Limits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limits == l.limits {
+		return
+	}
+	l.limits = limits
+	setLimit(l.lines, limits.LinesPerSecond)
+	setLimit(l.bytes, limits.BytesPerSecond)
+}
+
+func setLimit(lim *rate.Limiter, perSecond int64) {
+	if perSecond <= 0 {
+		lim.SetLimit(rate.Inf)
+		return
+	}
+	lim.SetLimit(rate.Limit(perSecond))
+	lim.SetBurst(int(perSecond))
+}
+
+// Limits returns the current limits.
+func (l *Limiter) Limits() Limits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limits
+}
+
+// Wait waits until a line of the given size may be read and returns how
+// long it waited. It returns ctx.Err() when ctx is done first.
+func (l *Limiter) Wait(ctx context.Context, bytes int) (time.Duration, error) {
+	now := time.Now()
+	lines := reserve(l.lines, now, 1)
+	data := reserve(l.bytes, now, bytes)
+	delay := delayFrom(lines, now)
+	if d := delayFrom(data, now); d > delay {
+		delay = d
+	}
+	if delay == 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		//归还未使用的token
+		lines.Cancel()
+		data.Cancel()
+		return time.Since(now), ctx.Err()
+	}
+}
+
+// reserve reserves n tokens of lim, a line larger than the burst takes the
+// whole burst.
+func reserve(lim *rate.Limiter, now time.Time, n int) *rate.Reservation {
+	if lim.Limit() != rate.Inf && n > lim.Burst() {
+		n = lim.Burst()
+	}
+	return lim.ReserveN(now, n)
+}
+
+// delayFrom returns the delay of r, 0 if it was not granted because the
+// limits changed in between.
+func delayFrom(r *rate.Reservation, now time.Time) time.Duration {
+	if !r.OK() {
+		return 0
+	}
+	return r.DelayFrom(now)
+}
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/pkg/utils"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestLimitsOf(t *testing.T) {
+	bytes := resource.MustParse("1Mi")
+	annotations := map[string]string{
+		utils.AnnotationRateLimitLines: "500",
+		utils.AnnotationRateLimitBytes: "64Ki",
+	}
+	tests := []struct {
+		name        string
+		spec        *logv1.RateLimit
+		annotations map[string]string
+		want        Limits
+		wantErr     bool
+	}{
+		{name: "unlimited"},
+		{name: "namespace defaults", annotations: annotations, want: Limits{LinesPerSecond: 500, BytesPerSecond: 64 << 10}},
+		{
+			name:        "spec wins",
+			spec:        &logv1.RateLimit{BytesPerSecond: &bytes},
+			annotations: annotations,
+			want:        Limits{LinesPerSecond: 500, BytesPerSecond: 1 << 20},
+		},
+		{
+			name:        "invalid annotation",
+			annotations: map[string]string{utils.AnnotationRateLimitLines: "many", utils.AnnotationRateLimitBytes: "1Ki"},
+			want:        Limits{BytesPerSecond: 1 << 10},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LimitsOf(tt.spec, tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitsClamp(t *testing.T) {
+	max := Limits{LinesPerSecond: 100}
+	if got := (Limits{}).Clamp(max); got != max {
+		t.Errorf("unlimited clamped to %+v, want %+v", got, max)
+	}
+	if got := (Limits{LinesPerSecond: 50, BytesPerSecond: 1 << 10}).Clamp(max); got != (Limits{LinesPerSecond: 50, BytesPerSecond: 1 << 10}) {
+		t.Errorf("limits under the max clamped to %+v", got)
+	}
+	if got := (Limits{LinesPerSecond: 500}).Clamp(max); got != max {
+		t.Errorf("limits over the max clamped to %+v, want %+v", got, max)
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := NewLimiter(Limits{})
+	for i := 0; i < 1000; i++ {
+		if waited, err := l.Wait(context.Background(), 1<<20); waited != 0 || err != nil {
+			t.Fatalf("waited %v, err %v", waited, err)
+		}
+	}
+}
+
+func TestLimiterBytes(t *testing.T) {
+	l := NewLimiter(Limits{BytesPerSecond: 1000})
+	start := time.Now()
+	var waited time.Duration
+	// the first second of the rate is the burst, a line larger than it
+	// takes the whole burst
+	for i := 0; i < 3; i++ {
+		d, err := l.Wait(context.Background(), 5000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waited += d
+	}
+	if elapsed := time.Since(start); elapsed < 1500*time.Millisecond {
+		t.Errorf("3 lines at 1000 bytes/s took %v", elapsed)
+	}
+	if waited == 0 {
+		t.Error("waited time not reported")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Wait(ctx, 1000); err != context.Canceled {
+		t.Errorf("wait with a cancelled context returned %v", err)
+	}
+}
+
+func TestLimiterTailersTakeTurns(t *testing.T) {
+	l := NewLimiter(Limits{LinesPerSecond: 200})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	counts := make([]int, 3)
+	var wg sync.WaitGroup
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				if _, err := l.Wait(ctx, 10); err != nil {
+					return
+				}
+				counts[i]++
+			}
+		}(i)
+	}
+	wg.Wait()
+	total := counts[0] + counts[1] + counts[2]
+	if total > 450 {
+		t.Errorf("read %d lines in a second at 200 lines/s with a burst of 200", total)
+	}
+	for i, count := range counts {
+		if count < total/6 {
+			t.Errorf("tailer %d read %d of %d lines", i, count, total)
+		}
+	}
+}
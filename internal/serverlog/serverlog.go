@@ -1 +1,733 @@
 package serverlog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/checkpoint"
+	"github.com/yshaojie/log-collector/internal/cri"
+	"github.com/yshaojie/log-collector/internal/event"
+	"github.com/yshaojie/log-collector/internal/hostfs"
+	"github.com/yshaojie/log-collector/internal/metrics"
+	"github.com/yshaojie/log-collector/internal/multiline"
+	"github.com/yshaojie/log-collector/internal/parser"
+	"github.com/yshaojie/log-collector/internal/ratelimit"
+	"github.com/yshaojie/log-collector/internal/tailer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultScanInterval = 5 * time.Second
+	defaultFileFilter   = "*"
+	// defaultStdoutFilter matches the current log file of a container, the
+	// runtime renames it when rotating.
+	defaultStdoutFilter = "*.log"
+)
+
+// Handler receives the events collected for a ServerLog.
+type Handler interface {
+	Handle(ev *event.Event)
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(ev *event.Event)
+
+// Handle calls f(ev).
+func (f HandlerFunc) Handle(ev *event.Event) {
+	f(ev)
+}
+
+// Options configures a Collector.
+type Options struct {
+	// HostRoot is where the host filesystem is mounted in the agent container.
+	HostRoot string
+	// ScanInterval is how often the source directories are listed for new files.
+	ScanInterval time.Duration
+	// Tailer configures the tailer of every file.
+	Tailer tailer.Options
+	// Checkpoints is where reading resumes from. The Collector only reads it;
+	// offsets are recorded once the handler delivered the events. Files are
+	// read from the beginning on every start when it is nil.
+	Checkpoints *checkpoint.Store
+	// CheckPath, if set, is called with the path on the node of every source
+	// directory listed and file opened and its real path, with the symlinks
+	// above the volume root resolved. Reading fails with its error. The
+	// output of the containers is not checked.
+	CheckPath func(path, real string) error
+}
+
+func (o *Options) complete() {
+	if o.HostRoot == "" {
+		o.HostRoot = "/"
+	}
+	if o.ScanInterval <= 0 {
+		o.ScanInterval = defaultScanInterval
+	}
+}
+
+// Collector tails every file in the source directories of one ServerLog.
+type Collector struct {
+	key  types.NamespacedName
+	pod  string
+	spec logv1.ServerLogSpec
+	// hostPaths are the resolved source directories of the ServerLog status.
+	hostPaths []logv1.SourceStatus
+	// labels holds the Pod labels as a map[string]string and metadata the
+	// *event.PodMetadata, they may change while the collector runs.
+	labels   atomic.Value
+	metadata atomic.Value
+	// files holds the []FileStat of the last scan and lastError the
+	// message of the last error, they are read by the status reporter.
+	files     atomic.Value
+	lastError atomic.Value
+	handler   Handler
+	opts      Options
+	// the counters of the ServerLog, looked up once.
+	linesRead     prometheus.Counter
+	bytesRead     prometheus.Counter
+	parseFailures prometheus.Counter
+	throttledTime prometheus.Counter
+	sources       []*source
+
+	// limiter is shared by the readers of every file, throttled is the
+	// total time lines waited for it in nanoseconds.
+	limiter   *ratelimit.Limiter
+	throttled atomic.Int64
+
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	drain     chan struct{}
+	drainOnce sync.Once
+
+	// tailers and finished are only touched by the scan goroutine.
+	tailers map[string]*runningTailer
+	// finished holds the compressed files that were read to the end.
+	finished map[string]tailer.FileID
+}
+
+// FileStat is a file read by a Collector.
+type FileStat struct {
+	// Path is the path of the file on the node.
+	Path string
+	File tailer.FileID
+	Size int64
+	// root is the volume the file is read from.
+	root *hostfs.Root
+}
+
+// source is a directory of the ServerLog with its settings.
+type source struct {
+	name string
+	// dir is the directory on the node, under Options.HostRoot.
+	dir string
+	// root is the volume holding dir, as seen from the agent. Every file is
+	// opened through it, so a symlink the Pod created in the volume is not
+	// followed.
+	root       *hostfs.Root
+	fileFilter string
+	// stdout is set for the output of the containers, dir then holds a
+	// directory per container.
+	stdout     bool
+	containers []string
+	// multiline is nil when every line is an event.
+	multiline *multiline.Config
+	// parsers is nil when events are sent unparsed.
+	parsers *parser.Pipeline
+}
+
+type runningTailer struct {
+	// tailer is nil for compressed files, which are read once.
+	tailer *tailer.Tailer
+	// id is the file found by the scan, until the tailer opened it.
+	id     tailer.FileID
+	src    *source
+	agg    *multiline.Aggregator
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// stop stops reading and waits for the reader to return. The partial
+// multiline event is sent when flush is set, otherwise it is dropped and
+// read again from the checkpoint next time.
+func (rt *runningTailer) stop(flush bool) {
+	rt.cancel()
+	<-rt.done
+	if rt.agg != nil {
+		if flush {
+			rt.agg.Flush()
+		}
+		rt.agg.Stop()
+	}
+}
+
+// drain reads the file to the end, sends the partial multiline event and
+// stops reading. A compressed file is read to the end anyway.
+func (rt *runningTailer) drain() {
+	if rt.tailer != nil {
+		rt.tailer.Drain()
+	}
+	<-rt.done
+	rt.cancel()
+	if rt.agg != nil {
+		rt.agg.Flush()
+		rt.agg.Stop()
+	}
+}
+
+func (rt *runningTailer) fileID() tailer.FileID {
+	if rt.tailer != nil {
+		if id := rt.tailer.FileID(); id != (tailer.FileID{}) {
+			return id
+		}
+	}
+	return rt.id
+}
+
+// NewCollector returns a Collector for serverLog. It does nothing until Start.
+func NewCollector(serverLog *logv1.ServerLog, handler Handler, opts Options) *Collector {
+	opts.complete()
+	c := &Collector{
+		key:       types.NamespacedName{Namespace: serverLog.Namespace, Name: serverLog.Name},
+		pod:       PodName(serverLog),
+		spec:      serverLog.Spec,
+		hostPaths: serverLog.Status.Sources,
+		handler:   handler,
+		opts:      opts,
+		tailers:   map[string]*runningTailer{},
+		finished:  map[string]tailer.FileID{},
+		drain:     make(chan struct{}),
+		limiter:   ratelimit.NewLimiter(ratelimit.Limits{}),
+	}
+	c.linesRead = metrics.LinesRead.WithLabelValues(c.key.Namespace, c.key.Name)
+	c.bytesRead = metrics.BytesRead.WithLabelValues(c.key.Namespace, c.key.Name)
+	c.parseFailures = metrics.ParseFailures.WithLabelValues(c.key.Namespace, c.key.Name)
+	c.throttledTime = metrics.ThrottledTime.WithLabelValues(c.key.Namespace, c.key.Name)
+	for _, spec := range serverLog.Spec.EffectiveSources() {
+		hostPath := serverLog.Status.HostPathOf(spec)
+		if hostPath == "" {
+			//目录不在volume上，节点上看不到
+			klog.Info("source has no host path, skip it, name=", c.key, " source=", spec.Name, " dir=", spec.Dir)
+			continue
+		}
+		volumeRoot := serverLog.Status.VolumeRootOf(spec)
+		if volumeRoot == "" {
+			//旧版本controller没有记录volume根目录，只信任目录本身
+			volumeRoot = hostPath
+		}
+		src := &source{
+			name:       spec.Name,
+			dir:        hostPath,
+			fileFilter: spec.FileFilter,
+			stdout:     spec.IsContainerStdout(),
+			containers: spec.Containers,
+		}
+		var check hostfs.CheckFunc
+		if opts.CheckPath != nil && !src.stdout {
+			check = c.checkPath
+		}
+		src.root = hostfs.New(filepath.Join(opts.HostRoot, volumeRoot), check)
+		if src.fileFilter == "" {
+			src.fileFilter = defaultFileFilter
+			if src.stdout {
+				src.fileFilter = defaultStdoutFilter
+			}
+		}
+		cfg, err := multiline.ConfigFromSource(spec)
+		if err != nil {
+			klog.Error("invalid multiline pattern, every line is sent as an event, name=", c.key, " source=", spec.Name, " err=", err)
+		}
+		src.multiline = cfg
+		parsers, err := parser.New(spec.Parsers)
+		if err != nil {
+			klog.Error("invalid parsers, lines are sent unparsed, name=", c.key, " source=", spec.Name, " err=", err)
+		}
+		src.parsers = parsers
+		c.sources = append(c.sources, src)
+	}
+	c.SetLabels(nil)
+	c.SetMetadata(nil)
+	c.files.Store([]FileStat(nil))
+	c.lastError.Store("")
+	return c
+}
+
+// PodName returns the name of the Pod owning serverLog.
+func PodName(serverLog *logv1.ServerLog) string {
+	if owner := metav1.GetControllerOf(serverLog); owner != nil && owner.Kind == "Pod" {
+		return owner.Name
+	}
+	//ServerLog与Pod同名
+	return serverLog.Name
+}
+
+// SetLabels updates the Pod labels attached to new events.
+func (c *Collector) SetLabels(labels map[string]string) {
+	podLabels := make(map[string]string, len(labels))
+	for k, v := range labels {
+		podLabels[k] = v
+	}
+	c.labels.Store(podLabels)
+}
+
+// SetMetadata updates the Pod metadata attached to new events.
+func (c *Collector) SetMetadata(md *event.PodMetadata) {
+	c.metadata.Store(md)
+}
+
+// SetRateLimit changes how fast the files are read, it may be called while
+// the collector runs.
+func (c *Collector) SetRateLimit(limits ratelimit.Limits) {
+	c.limiter.Set(limits)
+}
+
+// RateLimit returns the current limits.
+func (c *Collector) RateLimit() ratelimit.Limits {
+	return c.limiter.Limits()
+}
+
+// Throttled returns how long lines waited for the rate limit in total.
+func (c *Collector) Throttled() time.Duration {
+	return time.Duration(c.throttled.Load())
+}
+
+// Spec returns the ServerLog spec the collector was created for.
+func (c *Collector) Spec() logv1.ServerLogSpec {
+	return c.spec
+}
+
+// HostPaths returns the source directories on the node the collector was
+// created for.
+func (c *Collector) HostPaths() []logv1.SourceStatus {
+	return c.hostPaths
+}
+
+// Files returns the files found by the last scan with their current size.
+func (c *Collector) Files() []FileStat {
+	files := c.files.Load().([]FileStat)
+	stats := make([]FileStat, 0, len(files))
+	for _, f := range files {
+		info, err := f.root.Stat(filepath.Join(c.opts.HostRoot, f.Path))
+		if err != nil {
+			//文件已被删除，等下次扫描移除
+			continue
+		}
+		f.Size = info.Size()
+		stats = append(stats, f)
+	}
+	return stats
+}
+
+// LastError returns the message of the last error listing the directories
+// or reading the files, "" if there was none.
+func (c *Collector) LastError() string {
+	return c.lastError.Load().(string)
+}
+
+func (c *Collector) setError(err error) {
+	c.lastError.Store(err.Error())
+}
+
+// Start starts scanning the directories in the background.
+func (c *Collector) Start(ctx context.Context) {
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.run(ctx)
+	}()
+}
+
+// Stop stops every tailer and waits for them to return.
+func (c *Collector) Stop() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wg.Wait()
+}
+
+// Drain reads every file to the end, hands out the events still buffered
+// and stops the collector. It is used once the Pod is gone and its files are
+// not written anymore. The collector is stopped as by Stop when ctx is done
+// first, Drain then returns ctx.Err().
+func (c *Collector) Drain(ctx context.Context) error {
+	c.drainOnce.Do(func() { close(c.drain) })
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		klog.Error("drain server log timed out, name=", c.key)
+		c.Stop()
+		return ctx.Err()
+	}
+}
+
+func (c *Collector) run(ctx context.Context) {
+	dirs := make([]string, 0, len(c.sources))
+	for _, src := range c.sources {
+		dirs = append(dirs, src.dir)
+	}
+	klog.Info("start collecting server log, name=", c.key, " dirs=", dirs)
+	ticker := time.NewTicker(c.opts.ScanInterval)
+	defer ticker.Stop()
+	for {
+		c.scan(ctx)
+		select {
+		case <-ctx.Done():
+			c.stopAll()
+			c.publishFiles()
+			klog.Info("stop collecting server log, name=", c.key)
+			return
+		case <-c.drain:
+			//最后扫描一次，读取新出现的文件
+			c.scan(ctx)
+			c.drainAll()
+			c.publishFiles()
+			klog.Info("drained server log, name=", c.key)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkPath calls Options.CheckPath with path and real, paths in the agent
+// container, as paths on the node.
+func (c *Collector) checkPath(path, real string) error {
+	onNode := make([]string, 0, 2)
+	for _, p := range []string{path, real} {
+		rel, err := filepath.Rel(c.opts.HostRoot, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			return fmt.Errorf("%s is not on the node", p)
+		}
+		onNode = append(onNode, filepath.Join("/", rel))
+	}
+	return c.opts.CheckPath(onNode[0], onNode[1])
+}
+
+// hostDir returns the directory of src as seen from the agent.
+func (c *Collector) hostDir(src *source) string {
+	return filepath.Join(c.opts.HostRoot, src.dir)
+}
+
+// scan starts a tailer for every new matching file and stops the tailers
+// of files that are gone. A file matched by several sources is read with
+// the settings of the first one.
+func (c *Collector) scan(ctx context.Context) {
+	for path, rt := range c.tailers {
+		select {
+		case <-rt.done:
+			rt.stop(true)
+			delete(c.tailers, path)
+		default:
+		}
+	}
+
+	following := make(map[tailer.FileID]bool, len(c.tailers))
+	for _, rt := range c.tailers {
+		following[rt.fileID()] = true
+	}
+	seen := map[string]bool{}
+	for _, src := range c.sources {
+		files, err := c.matchingFiles(src)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				klog.Error("scan server log dir failed, name=", c.key, " source=", src.name, " err=", err)
+				c.setError(err)
+			}
+			//目录暂时不可读时保留它的tailer
+			for path, rt := range c.tailers {
+				if rt.src == src {
+					seen[path] = true
+				}
+			}
+			continue
+		}
+		for _, path := range files {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			if _, ok := c.tailers[path]; ok {
+				continue
+			}
+			info, err := src.root.Stat(path)
+			if err != nil {
+				continue
+			}
+			id := tailer.FileIDOf(info)
+			//文件刚被轮转改名，原路径的tailer还在读它，等读完再处理
+			if following[id] {
+				continue
+			}
+			if tailer.IsCompressed(path) {
+				if c.finished[path] != id {
+					c.startCompressedReader(ctx, src, path, id)
+				}
+				continue
+			}
+			c.startTailer(ctx, src, path, id)
+		}
+	}
+	for path, rt := range c.tailers {
+		if !seen[path] {
+			rt.stop(true)
+			delete(c.tailers, path)
+		}
+	}
+	for path := range c.finished {
+		if !seen[path] {
+			delete(c.finished, path)
+		}
+	}
+	c.publishFiles()
+}
+
+// publishFiles records the files being read for Files.
+func (c *Collector) publishFiles() {
+	files := make([]FileStat, 0, len(c.tailers))
+	for path, rt := range c.tailers {
+		//路径相对于HostRoot，状态中展示节点上的路径
+		rel, err := filepath.Rel(c.opts.HostRoot, path)
+		if err != nil {
+			continue
+		}
+		files = append(files, FileStat{Path: filepath.Join("/", rel), File: rt.fileID(), root: rt.src.root})
+	}
+	c.files.Store(files)
+}
+
+// matchingFiles lists the files in the directory of src matching its
+// filter, or in the directories of its containers for container output.
+// Compressed rotated files are skipped unless the filter itself selects
+// compressed files, e.g. "*.log.gz", and the format can be read, xz files
+// are always skipped. Symlinks are skipped, and listing fails
+// when the directory is reached through one.
+func (c *Collector) matchingFiles(src *source) ([]string, error) {
+	dirs := []string{c.hostDir(src)}
+	if src.stdout {
+		var err error
+		if dirs, err = c.containerDirs(src); err != nil {
+			return nil, err
+		}
+	}
+	wantCompressed := tailer.IsCompressed(src.fileFilter)
+	var files []string
+	for _, dir := range dirs {
+		entries, err := src.root.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			if tailer.IsCompressed(entry.Name()) && (!wantCompressed || !tailer.CanDecompress(entry.Name())) {
+				continue
+			}
+			matched, err := filepath.Match(src.fileFilter, entry.Name())
+			if err != nil {
+				return nil, err
+			}
+			if matched {
+				files = append(files, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+// containerDirs lists the directories of the containers read by src, the
+// runtime writes the output of a container to <pod log dir>/<container>.
+func (c *Collector) containerDirs(src *source) ([]string, error) {
+	entries, err := src.root.ReadDir(c.hostDir(src))
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if len(src.containers) > 0 && !containsString(src.containers, entry.Name()) {
+			continue
+		}
+		dirs = append(dirs, filepath.Join(c.hostDir(src), entry.Name()))
+	}
+	return dirs, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// lineHandler returns the handler for the lines of one file. Lines wait for
+// the rate limit, container output is decoded first, then lines are joined
+// into multiline events when the source asks for it.
+func (c *Collector) lineHandler(ctx context.Context, src *source, path string) (tailer.Handler, *multiline.Aggregator) {
+	container := ""
+	if src.stdout {
+		container = filepath.Base(filepath.Dir(path))
+	}
+	var handle tailer.Handler = func(line tailer.Line) { c.handleLine(src, container, line) }
+	var agg *multiline.Aggregator
+	if src.multiline != nil {
+		agg = multiline.New(*src.multiline, handle)
+		handle = agg.Add
+	}
+	if src.stdout {
+		handle = cri.NewDecoder(handle).Add
+	}
+	next := handle
+	handle = func(line tailer.Line) {
+		c.waitRateLimit(ctx, len(line.Text))
+		c.linesRead.Inc()
+		c.bytesRead.Add(float64(len(line.Text)))
+		next(line)
+	}
+	return handle, agg
+}
+
+// waitRateLimit waits until a line of size bytes may be read. A draining
+// ServerLog is read at full speed, its Pod does not write anymore.
+func (c *Collector) waitRateLimit(ctx context.Context, size int) {
+	select {
+	case <-c.drain:
+		return
+	default:
+	}
+	waited, _ := c.limiter.Wait(ctx, size)
+	if waited > 0 {
+		c.throttled.Add(int64(waited))
+		c.throttledTime.Add(waited.Seconds())
+	}
+}
+
+func (c *Collector) startTailer(ctx context.Context, src *source, path string, id tailer.FileID) {
+	ctx, cancel := context.WithCancel(ctx)
+	handler, agg := c.lineHandler(ctx, src, path)
+	rt := &runningTailer{
+		tailer: tailer.New(path, c.resumeOffset, handler, c.tailerOptions(src)),
+		id:     id,
+		src:    src,
+		agg:    agg,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	c.tailers[path] = rt
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer close(rt.done)
+		if err := rt.tailer.Run(ctx); err != nil {
+			klog.Error("tail file failed, name=", c.key, " path=", path, " err=", err)
+			c.setError(err)
+		}
+	}()
+}
+
+// tailerOptions returns the tailer options for the files of src, opened
+// through its volume.
+func (c *Collector) tailerOptions(src *source) tailer.Options {
+	opts := c.opts.Tailer
+	opts.FS = src.root
+	return opts
+}
+
+// startCompressedReader reads a compressed rotated file once. It stays in
+// tailers until the next scan so that it is not started twice.
+func (c *Collector) startCompressedReader(ctx context.Context, src *source, path string, id tailer.FileID) {
+	ctx, cancel := context.WithCancel(ctx)
+	handler, agg := c.lineHandler(ctx, src, path)
+	rt := &runningTailer{
+		id:     id,
+		src:    src,
+		agg:    agg,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	c.tailers[path] = rt
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer close(rt.done)
+		if err := tailer.ReadCompressed(ctx, path, c.resumeOffset, handler, c.tailerOptions(src)); err != nil {
+			klog.Error("read compressed file failed, name=", c.key, " path=", path, " err=", err)
+			c.setError(err)
+		}
+	}()
+	c.finished[path] = id
+}
+
+// drainAll reads every file to the end and stops its reader.
+func (c *Collector) drainAll() {
+	for path, rt := range c.tailers {
+		rt.drain()
+		delete(c.tailers, path)
+	}
+}
+
+func (c *Collector) stopAll() {
+	for path, rt := range c.tailers {
+		rt.stop(false)
+		delete(c.tailers, path)
+	}
+}
+
+func (c *Collector) resumeOffset(id tailer.FileID) tailer.Position {
+	if c.opts.Checkpoints == nil {
+		return tailer.Position{}
+	}
+	pos, ok := c.opts.Checkpoints.Get(checkpoint.Key{ServerLog: c.key, File: id})
+	if !ok {
+		return tailer.Position{}
+	}
+	return pos.Position
+}
+
+func (c *Collector) handleLine(src *source, container string, line tailer.Line) {
+	ev := &event.Event{
+		ServerLog:  c.key,
+		Source:     src.name,
+		Pod:        c.pod,
+		Container:  container,
+		Stream:     line.Stream,
+		Labels:     c.labels.Load().(map[string]string),
+		NodeName:   c.spec.NodeName,
+		Metadata:   c.metadata.Load().(*event.PodMetadata),
+		Path:       line.Path,
+		File:       line.File,
+		Offset:     line.Offset,
+		Generation: line.Generation,
+		Head:       line.Head,
+		Time:       time.Now(),
+		Message:    line.Text,
+	}
+	if !line.Time.IsZero() {
+		ev.Time = line.Time
+	}
+	if src.parsers != nil {
+		if err := src.parsers.Parse(ev); err != nil {
+			c.parseFailures.Inc()
+		}
+	}
+	c.handler.Handle(ev)
+}
@@ -0,0 +1,529 @@
+package serverlog
+
+import (
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/checkpoint"
+	"github.com/yshaojie/log-collector/internal/event"
+	"github.com/yshaojie/log-collector/internal/tailer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// recorder records every event and, like a sink delivering it, its offset.
+type recorder struct {
+	store    *checkpoint.Store
+	mu       sync.Mutex
+	messages []string
+}
+
+func (r *recorder) Handle(ev *event.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, filepath.Base(ev.Path)+":"+ev.Message)
+	if r.store != nil {
+		r.store.Set(checkpoint.Key{ServerLog: ev.ServerLog, File: ev.File}, ev.Path, ev.Position())
+	}
+}
+
+func (r *recorder) sorted() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	messages := append([]string(nil), r.messages...)
+	sort.Strings(messages)
+	return messages
+}
+
+func (r *recorder) waitFor(t *testing.T, want []string) {
+	t.Helper()
+	sort.Strings(want)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if reflect.DeepEqual(r.sorted(), want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("got %q, want %q", r.sorted(), want)
+}
+
+// resolve sets the host paths of the sources as the controller does, the
+// directories are on the node in the tests.
+func resolve(serverLog *logv1.ServerLog) {
+	for _, source := range serverLog.Spec.EffectiveSources() {
+		serverLog.Status.Sources = append(serverLog.Status.Sources,
+			logv1.SourceStatus{Name: source.Name, Dir: source.Dir, HostPath: source.Dir})
+	}
+}
+
+func startCollector(t *testing.T, dir, filter string, store *checkpoint.Store) *recorder {
+	t.Helper()
+	serverLog := &logv1.ServerLog{}
+	serverLog.Namespace = "default"
+	serverLog.Name = "web-0"
+	serverLog.Spec.Dir = dir
+	serverLog.Spec.FileFilter = filter
+	resolve(serverLog)
+	r := &recorder{store: store}
+	c := NewCollector(serverLog, r, Options{
+		ScanInterval: 20 * time.Millisecond,
+		Tailer:       tailer.Options{PollInterval: 10 * time.Millisecond},
+		Checkpoints:  store,
+	})
+	c.Start(context.Background())
+	t.Cleanup(c.Stop)
+	return r
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeGzip(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorSkipsCompressedFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.log"), "current\n")
+	writeGzip(t, filepath.Join(dir, "app.log.1.gz"), "rotated\n")
+	writeFile(t, filepath.Join(dir, "app.log.2.zst"), "rotated\n")
+
+	r := startCollector(t, dir, "app.log*", nil)
+	r.waitFor(t, []string{"app.log:current"})
+	time.Sleep(100 * time.Millisecond)
+	r.waitFor(t, []string{"app.log:current"})
+}
+
+func TestCollectorReadsCompressedFilesWhenSelected(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.log"), "current\n")
+	writeGzip(t, filepath.Join(dir, "app.log.1.gz"), "rotated\n")
+
+	r := startCollector(t, dir, "*.gz", nil)
+	r.waitFor(t, []string{"app.log.1.gz:rotated"})
+	// the file is read once, not on every scan
+	time.Sleep(100 * time.Millisecond)
+	r.waitFor(t, []string{"app.log.1.gz:rotated"})
+
+	//无法解压的xz文件即使被选中也不读
+	writeFile(t, filepath.Join(dir, "app.log.2.xz"), "rotated\n")
+	r = startCollector(t, dir, "*.xz", nil)
+	time.Sleep(100 * time.Millisecond)
+	if got := r.sorted(); len(got) != 0 {
+		t.Errorf("got %q from an xz file", got)
+	}
+}
+
+// TestCollectorRenamedFileNotReadTwice rotates a file to a name that also
+// matches the filter; its lines must only be delivered once.
+func TestCollectorRenamedFileNotReadTwice(t *testing.T) {
+	dir := t.TempDir()
+	store, err := checkpoint.Open(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "before\n")
+	r := startCollector(t, dir, "", store)
+	r.waitFor(t, []string{"app.log:before"})
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "after\n")
+	r.waitFor(t, []string{"app.log:before", "app.log:after"})
+	time.Sleep(100 * time.Millisecond)
+	r.waitFor(t, []string{"app.log:before", "app.log:after"})
+}
+
+func TestCollectorParsesLines(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.log"), "{\"level\":\"ERROR\",\"msg\":\"boom\"}\nnot json\n")
+
+	serverLog := &logv1.ServerLog{}
+	serverLog.Namespace = "default"
+	serverLog.Name = "web-0"
+	serverLog.Spec.Dir = dir
+	serverLog.Spec.Parsers = []logv1.Parser{{Type: logv1.ParserJSON, SeverityKey: "level"}}
+	resolve(serverLog)
+	events := make(chan *event.Event, 2)
+	c := NewCollector(serverLog, HandlerFunc(func(ev *event.Event) { events <- ev }), Options{
+		ScanInterval: 20 * time.Millisecond,
+		Tailer:       tailer.Options{PollInterval: 10 * time.Millisecond},
+	})
+	c.Start(context.Background())
+	defer c.Stop()
+
+	ev := <-events
+	if ev.Severity != "error" || ev.Fields["msg"] != "boom" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	// lines that fail to parse are still sent
+	ev = <-events
+	if ev.Message != "not json" || ev.Fields["_parse_error"] == nil {
+		t.Errorf("unexpected event %+v", ev)
+	}
+}
+
+func TestCollectorSources(t *testing.T) {
+	access, app := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(access, "access.log"), "{\"status\":200}\n")
+	writeFile(t, filepath.Join(app, "app.log"), "2023-01-01 boom\n  at main\n2023-01-01 ok\n")
+	writeFile(t, filepath.Join(app, "gc.txt"), "ignored\n")
+
+	serverLog := &logv1.ServerLog{}
+	serverLog.Namespace = "default"
+	serverLog.Name = "web-0"
+	// the top level dir is ignored when sources are set
+	serverLog.Spec.Dir = t.TempDir()
+	serverLog.Spec.Sources = []logv1.LogSource{
+		{Name: "access", Dir: access, Parsers: []logv1.Parser{{Type: logv1.ParserJSON}}},
+		{Name: "app", Dir: app, FileFilter: "*.log", Pattern: `^\d{4}-`, MultilineTimeout: &metav1.Duration{Duration: 50 * time.Millisecond}},
+	}
+	resolve(serverLog)
+	events := make(chan *event.Event, 3)
+	c := NewCollector(serverLog, HandlerFunc(func(ev *event.Event) { events <- ev }), Options{
+		ScanInterval: 20 * time.Millisecond,
+		Tailer:       tailer.Options{PollInterval: 10 * time.Millisecond},
+	})
+	c.Start(context.Background())
+	defer c.Stop()
+
+	got := map[string]*event.Event{}
+	for i := 0; i < 3; i++ {
+		select {
+		case ev := <-events:
+			got[ev.Source+":"+ev.Message] = ev
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d events", len(got))
+		}
+	}
+	if ev := got[`access:{"status":200}`]; ev == nil || ev.Fields["status"] == nil {
+		t.Errorf("access line not parsed: %v", got)
+	}
+	if got["app:2023-01-01 boom\n  at main"] == nil || got["app:2023-01-01 ok"] == nil {
+		t.Errorf("app lines not joined: %v", got)
+	}
+}
+
+func TestCollectorContainerStdout(t *testing.T) {
+	podDir := t.TempDir()
+	for _, container := range []string{"app", "sidecar"} {
+		if err := os.Mkdir(filepath.Join(podDir, container), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(podDir, "app", "0.log"),
+		"2023-01-01T00:00:01Z stdout P hello \n2023-01-01T00:00:02Z stdout F world\n")
+	writeFile(t, filepath.Join(podDir, "app", "0.log.20230101-000000"), "2023-01-01T00:00:00Z stdout F rotated\n")
+	writeFile(t, filepath.Join(podDir, "sidecar", "0.log"), "{\"log\":\"skipped\\n\",\"stream\":\"stdout\",\"time\":\"2023-01-01T00:00:01Z\"}\n")
+
+	serverLog := &logv1.ServerLog{}
+	serverLog.Namespace = "default"
+	serverLog.Name = "web-0"
+	serverLog.Spec.Sources = []logv1.LogSource{{Name: "stdout", Type: logv1.SourceContainerStdout, Containers: []string{"app"}}}
+	serverLog.Status.Sources = []logv1.SourceStatus{{Name: "stdout", HostPath: podDir}}
+	events := make(chan *event.Event, 2)
+	c := NewCollector(serverLog, HandlerFunc(func(ev *event.Event) { events <- ev }), Options{
+		ScanInterval: 20 * time.Millisecond,
+		Tailer:       tailer.Options{PollInterval: 10 * time.Millisecond},
+	})
+	c.Start(context.Background())
+	defer c.Stop()
+
+	ev := <-events
+	if ev.Message != "hello world" || ev.Container != "app" || ev.Stream != "stdout" || ev.Time.Second() != 1 {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestCollectorDrain(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "one\n")
+
+	serverLog := &logv1.ServerLog{}
+	serverLog.Namespace = "default"
+	serverLog.Name = "web-0"
+	serverLog.Spec.Dir = dir
+	serverLog.Spec.Pattern = `^\S`
+	resolve(serverLog)
+	r := &recorder{}
+	c := NewCollector(serverLog, r, Options{
+		// only Drain reads what is written after the first read
+		ScanInterval: time.Hour,
+		Tailer:       tailer.Options{PollInterval: time.Hour},
+	})
+	c.Start(context.Background())
+	defer c.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("two\n  continued")
+	f.Close()
+	writeFile(t, filepath.Join(dir, "new.log"), "new\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Drain(ctx); err != nil {
+		t.Fatal("drain timed out")
+	}
+	want := []string{"app.log:one", "app.log:two\n  continued", "new.log:new"}
+	sort.Strings(want)
+	if got := r.sorted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCollectorFiles(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "logs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "logs", "app.log"), "one\ntwo\n")
+
+	serverLog := &logv1.ServerLog{}
+	serverLog.Namespace = "default"
+	serverLog.Name = "web-0"
+	serverLog.Spec.Dir = "/logs"
+	resolve(serverLog)
+	r := &recorder{}
+	c := NewCollector(serverLog, r, Options{
+		HostRoot:     root,
+		ScanInterval: 20 * time.Millisecond,
+		Tailer:       tailer.Options{PollInterval: 10 * time.Millisecond},
+	})
+	c.Start(context.Background())
+	defer c.Stop()
+	r.waitFor(t, []string{"app.log:one", "app.log:two"})
+
+	// the path on the node, not in the agent container
+	files := c.Files()
+	if len(files) != 1 || files[0].Path != "/logs/app.log" || files[0].Size != 8 {
+		t.Fatalf("files %+v", files)
+	}
+	id, err := tailer.StatFileID(filepath.Join(root, "logs", "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[0].File != id {
+		t.Errorf("file id %v, want %v", files[0].File, id)
+	}
+	if c.LastError() != "" {
+		t.Errorf("last error %q", c.LastError())
+	}
+}
+
+func TestCollectorSymlinks(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"volume/logs", "etc"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(root, "etc", "shadow"), "secret\n")
+	writeFile(t, filepath.Join(root, "volume", "logs", "app.log"), "app\n")
+	// the Pod links files and directories of its volume out of it
+	if err := os.Symlink("../../etc/shadow", filepath.Join(root, "volume", "logs", "shadow.log")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../etc", filepath.Join(root, "volume", "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	newCollector := func(dir string) (*Collector, *recorder) {
+		serverLog := &logv1.ServerLog{}
+		serverLog.Namespace = "default"
+		serverLog.Name = "web-0"
+		serverLog.Spec.Dir = dir
+		serverLog.Status.Sources = []logv1.SourceStatus{{Name: "default", Dir: dir, HostPath: dir, VolumeRoot: "/volume"}}
+		r := &recorder{}
+		c := NewCollector(serverLog, r, Options{
+			HostRoot:     root,
+			ScanInterval: 20 * time.Millisecond,
+			Tailer:       tailer.Options{PollInterval: 10 * time.Millisecond},
+		})
+		c.Start(context.Background())
+		t.Cleanup(c.Stop)
+		return c, r
+	}
+
+	_, r := newCollector("/volume/logs")
+	r.waitFor(t, []string{"app.log:app"})
+	c, r := newCollector("/volume/escape")
+	time.Sleep(100 * time.Millisecond)
+	if got := r.sorted(); len(got) != 0 {
+		t.Errorf("read %q through a symlinked directory", got)
+	}
+	if !strings.Contains(c.LastError(), "symlink") {
+		t.Errorf("last error %q, want the symlink", c.LastError())
+	}
+}
+
+func TestCollectorFileFilter(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.log"), "app\n")
+	writeFile(t, filepath.Join(dir, "gc.txt"), "gc\n")
+	if err := os.Mkdir(filepath.Join(dir, "nested.log"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "nested.log", "app.log"), "nested\n")
+
+	r := startCollector(t, dir, "*.log", nil)
+	r.waitFor(t, []string{"app.log:app"})
+
+	// files created later are picked up by the next scan
+	writeFile(t, filepath.Join(dir, "late.log"), "late\n")
+	writeFile(t, filepath.Join(dir, "late.txt"), "ignored\n")
+	r.waitFor(t, []string{"app.log:app", "late.log:late"})
+	time.Sleep(100 * time.Millisecond)
+	r.waitFor(t, []string{"app.log:app", "late.log:late"})
+}
+
+func TestCollectorResumesFromCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "one\ntwo\n")
+	store, err := checkpoint.Open(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverLog := &logv1.ServerLog{}
+	serverLog.Namespace = "default"
+	serverLog.Name = "web-0"
+	serverLog.Spec.Dir = dir
+	resolve(serverLog)
+	opts := Options{
+		ScanInterval: 20 * time.Millisecond,
+		Tailer:       tailer.Options{PollInterval: 10 * time.Millisecond},
+		Checkpoints:  store,
+	}
+	r := &recorder{store: store}
+	c := NewCollector(serverLog, r, opts)
+	c.Start(context.Background())
+	r.waitFor(t, []string{"app.log:one", "app.log:two"})
+	c.Stop()
+
+	// the agent restarts, only what was written since is read
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("three\n")
+	f.Close()
+	r = &recorder{store: store}
+	c = NewCollector(serverLog, r, opts)
+	c.Start(context.Background())
+	defer c.Stop()
+	r.waitFor(t, []string{"app.log:three"})
+}
+
+func TestCollectorEvents(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "one\ntwo\n")
+
+	serverLog := &logv1.ServerLog{}
+	serverLog.Namespace = "default"
+	serverLog.Name = "web-0-app"
+	serverLog.Spec.Dir = dir
+	serverLog.Spec.NodeName = "node-1"
+	controller := true
+	serverLog.OwnerReferences = []metav1.OwnerReference{{Kind: "Pod", Name: "web-0", Controller: &controller}}
+	resolve(serverLog)
+	events := make(chan *event.Event, 2)
+	c := NewCollector(serverLog, HandlerFunc(func(ev *event.Event) { events <- ev }), Options{
+		ScanInterval: 20 * time.Millisecond,
+		Tailer:       tailer.Options{PollInterval: 10 * time.Millisecond},
+	})
+	c.SetLabels(map[string]string{"app": "web"})
+	c.Start(context.Background())
+	defer c.Stop()
+
+	id, err := tailer.StatFileID(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []struct {
+		message string
+		offset  int64
+	}{{"one", 4}, {"two", 8}} {
+		var ev *event.Event
+		select {
+		case ev = <-events:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event for %q", want.message)
+		}
+		if ev.Message != want.message || ev.Offset != want.offset || ev.File != id || ev.Path != path {
+			t.Errorf("event %q at %s:%d, want %q at %s:%d", ev.Message, ev.Path, ev.Offset, want.message, path, want.offset)
+		}
+		if ev.ServerLog.String() != "default/web-0-app" || ev.Pod != "web-0" || ev.NodeName != "node-1" ||
+			ev.Source != "default" || ev.Labels["app"] != "web" || ev.Time.IsZero() {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	}
+}
+
+func TestCollectorMissingDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	r := startCollector(t, dir, "", nil)
+	time.Sleep(50 * time.Millisecond)
+
+	// the directory is created once the application starts
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "app.log"), "started\n")
+	r.waitFor(t, []string{"app.log:started"})
+}
+
+func TestCollectorRemovedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "one\n")
+	r := startCollector(t, dir, "", nil)
+	r.waitFor(t, []string{"app.log:one"})
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	// the tailer of the removed file is stopped by the next scan, a new
+	// file of the same name is read from the beginning
+	time.Sleep(100 * time.Millisecond)
+	writeFile(t, path, "two\n")
+	r.waitFor(t, []string{"app.log:one", "app.log:two"})
+}
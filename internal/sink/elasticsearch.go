@@ -0,0 +1,338 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/event"
+	"github.com/yshaojie/log-collector/internal/tailer"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultElasticsearchIndex      = "logs-{{ .Namespace }}-{{ .Date }}"
+	defaultElasticsearchTimeout    = 30 * time.Second
+	defaultElasticsearchMaxRetries = 3
+	elasticsearchRetryBackoff      = 200 * time.Millisecond
+)
+
+// Elasticsearch indexes events with the _bulk API of Elasticsearch or
+// OpenSearch. Every document read from a known file gets an id derived from
+// the file, its generation and the offset and is sent with the create
+// action, so a batch that is written again after a failure does not
+// duplicate the documents that were already indexed. Elasticsearch picks
+// the id of the other documents.
+type Elasticsearch struct {
+	health
+	urls       []string
+	next       atomic.Uint32
+	index      *template.Template
+	pipeline   string
+	headers    map[string]string
+	maxRetries int
+	deadLetter *File
+	client     *http.Client
+}
+
+// bulkItem is one document of a bulk request.
+type bulkItem struct {
+	index string
+	// id is empty when the event has no stable id.
+	id  string
+	doc []byte
+}
+
+// bulkResponse is the part of the _bulk response the sink looks at.
+type bulkResponse struct {
+	Errors bool                                `json:"errors"`
+	Items  []map[string]bulkResponseItemResult `json:"items"`
+}
+
+type bulkResponseItemResult struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// statusError is a bulk request rejected as a whole.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("bulk request failed with status %d: %s", e.code, e.msg)
+}
+
+// NewElasticsearch returns an Elasticsearch bulk sink.
+func NewElasticsearch(cfg logv1.ElasticsearchOutput) (*Elasticsearch, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, fmt.Errorf("elasticsearch output requires at least one url")
+	}
+	indexTemplate := cfg.Index
+	if indexTemplate == "" {
+		indexTemplate = defaultElasticsearchIndex
+	}
+	index, err := parseNameTemplate("index", indexTemplate)
+	if err != nil {
+		return nil, err
+	}
+	e := &Elasticsearch{
+		index:      index,
+		pipeline:   cfg.Pipeline,
+		headers:    cfg.Headers,
+		maxRetries: defaultElasticsearchMaxRetries,
+	}
+	for _, u := range cfg.URLs {
+		e.urls = append(e.urls, strings.TrimRight(u, "/"))
+	}
+	if cfg.MaxRetries != nil {
+		e.maxRetries = int(*cfg.MaxRetries)
+	}
+	if cfg.DeadLetterPath != "" {
+		if e.deadLetter, err = NewFile(logv1.FileOutput{Path: cfg.DeadLetterPath}); err != nil {
+			return nil, err
+		}
+	}
+	timeout := defaultElasticsearchTimeout
+	if cfg.Timeout != nil {
+		timeout = cfg.Timeout.Duration
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	e.client = &http.Client{Timeout: timeout, Transport: transport}
+	return e, nil
+}
+
+// Write indexes events. Documents failing with 429 or 5xx are sent again up
+// to maxRetries times, documents rejected for any other reason go to the
+// dead-letter file.
+func (e *Elasticsearch) Write(ctx context.Context, events []*event.Event) error {
+	items := make([]*bulkItem, 0, len(events))
+	for _, ev := range events {
+		item, err := e.newItem(ev)
+		if err != nil {
+			return e.set(err)
+		}
+		items = append(items, item)
+	}
+
+	backoff := elasticsearchRetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := e.bulk(ctx, items)
+		if err == nil && len(retry) == 0 {
+			return e.set(nil)
+		}
+		var se *statusError
+		if errors.As(err, &se) && !retryableStatus(se.code) {
+			return e.set(err)
+		}
+		if attempt >= e.maxRetries {
+			if err == nil {
+				err = fmt.Errorf("%d documents still failing after %d retries", len(retry), attempt)
+			}
+			return e.set(err)
+		}
+		klog.Info("retry bulk request, documents=", len(retry), " attempt=", attempt+1, " err=", err)
+		items = retry
+		select {
+		case <-ctx.Done():
+			return e.set(ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (e *Elasticsearch) newItem(ev *event.Event) (*bulkItem, error) {
+	index, err := renderName(e.index, ev)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := json.Marshal(ev.Record())
+	if err != nil {
+		return nil, err
+	}
+	return &bulkItem{index: strings.ToLower(index), id: documentID(ev), doc: doc}, nil
+}
+
+// documentID identifies an event by the file, generation and offset it was
+// read from, the generation tells apart the lines a copytruncate writes
+// again at the same offsets. It is empty for an event without file identity,
+// whose id would not be stable.
+func documentID(ev *event.Event) string {
+	if ev.File == (tailer.FileID{}) {
+		return ""
+	}
+	h := sha1.New()
+	fmt.Fprintf(h, "%s/%s/%d/%d/%d/%d", ev.ServerLog.Namespace, ev.ServerLog.Name, ev.File.Device, ev.File.Inode, ev.Generation, ev.Offset)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// bulk sends items and returns the ones to send again. A request that is too
+// large is split in halves.
+func (e *Elasticsearch) bulk(ctx context.Context, items []*bulkItem) ([]*bulkItem, error) {
+	body, err := encodeBulk(items)
+	if err != nil {
+		return items, err
+	}
+	status, respBody, err := e.do(ctx, body)
+	if err != nil {
+		return items, err
+	}
+	switch {
+	case status == http.StatusRequestEntityTooLarge && len(items) > 1:
+		//请求过大时拆成两半分别发送
+		half := len(items) / 2
+		retry1, err1 := e.bulk(ctx, items[:half])
+		retry2, err2 := e.bulk(ctx, items[half:])
+		return append(retry1, retry2...), errors.Join(err1, err2)
+	case status == http.StatusRequestEntityTooLarge:
+		return nil, e.reject(items[0], status, respBody)
+	case status < 200 || status >= 300:
+		return items, &statusError{code: status, msg: string(bytes.TrimSpace(truncate(respBody, 512)))}
+	}
+
+	var resp bulkResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return items, fmt.Errorf("decode bulk response: %w", err)
+	}
+	if !resp.Errors {
+		return nil, nil
+	}
+	if len(resp.Items) != len(items) {
+		return items, fmt.Errorf("bulk response has %d items, want %d", len(resp.Items), len(items))
+	}
+	var retry []*bulkItem
+	for i, result := range resp.Items {
+		for _, r := range result {
+			switch {
+			case r.Status >= 200 && r.Status < 300:
+			//文档id稳定时，409说明文档已经写入过
+			case r.Status == http.StatusConflict && items[i].id != "":
+			case retryableStatus(r.Status):
+				retry = append(retry, items[i])
+			default:
+				if err := e.reject(items[i], r.Status, r.Error); err != nil {
+					return append(retry, items[i:]...), err
+				}
+			}
+		}
+	}
+	return retry, nil
+}
+
+func encodeBulk(items []*bulkItem) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, item := range items {
+		meta := map[string]string{"_index": item.index}
+		if item.id != "" {
+			meta["_id"] = item.id
+		}
+		action, err := json.Marshal(map[string]interface{}{"create": meta})
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(action)
+		buf.WriteByte('\n')
+		buf.Write(item.doc)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// do posts body to the next URL. A URL failing to respond or answering with
+// 5xx moves the following requests to the next URL.
+func (e *Elasticsearch) do(ctx context.Context, body []byte) (int, []byte, error) {
+	n := e.next.Load()
+	endpoint := e.urls[int(n)%len(e.urls)] + "/_bulk"
+	if e.pipeline != "" {
+		endpoint += "?pipeline=" + url.QueryEscape(e.pipeline)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		e.next.CompareAndSwap(n, n+1)
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	if resp.StatusCode >= 500 {
+		e.next.CompareAndSwap(n, n+1)
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// reject writes a document Elasticsearch refused to the dead-letter file.
+func (e *Elasticsearch) reject(item *bulkItem, status int, reason []byte) error {
+	if e.deadLetter == nil {
+		klog.Error("drop rejected document, index=", item.index, " status=", status, " reason=", string(truncate(reason, 512)))
+		return nil
+	}
+	if len(reason) == 0 || !json.Valid(reason) {
+		reason, _ = json.Marshal(string(reason))
+	}
+	line, err := json.Marshal(map[string]interface{}{
+		"@timestamp": time.Now().Format(time.RFC3339Nano),
+		"index":      item.index,
+		"id":         item.id,
+		"status":     status,
+		"error":      json.RawMessage(reason),
+		"document":   json.RawMessage(item.doc),
+	})
+	if err != nil {
+		return err
+	}
+	return e.deadLetter.append(append(line, '\n'))
+}
+
+func truncate(b []byte, n int) []byte {
+	if len(b) > n {
+		return b[:n]
+	}
+	return b
+}
+
+func (e *Elasticsearch) Flush(ctx context.Context) error {
+	if e.deadLetter == nil {
+		return nil
+	}
+	return e.deadLetter.Flush(ctx)
+}
+
+func (e *Elasticsearch) Close() error {
+	e.client.CloseIdleConnections()
+	if e.deadLetter == nil {
+		return nil
+	}
+	return e.deadLetter.Close()
+}
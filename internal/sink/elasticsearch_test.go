@@ -0,0 +1,288 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/tailer"
+)
+
+// bulkAction is one document of a bulk request seen by fakeBulk.
+type bulkAction struct {
+	Index   string
+	ID      string
+	Message string
+}
+
+// fakeBulk is a _bulk endpoint answering every request with respond.
+type fakeBulk struct {
+	mu       sync.Mutex
+	requests [][]bulkAction
+	respond  func(req int, actions []bulkAction) (int, interface{})
+}
+
+func (f *fakeBulk) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var actions []bulkAction
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		var action map[string]struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil || !scanner.Scan() {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var doc struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(scanner.Bytes(), &doc)
+		actions = append(actions, bulkAction{Index: action["create"].Index, ID: action["create"].ID, Message: doc.Message})
+	}
+
+	f.mu.Lock()
+	req := len(f.requests)
+	f.requests = append(f.requests, actions)
+	f.mu.Unlock()
+
+	status, body := f.respond(req, actions)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// bulkResult builds a bulk response with one status per action.
+func bulkResult(statuses ...int) map[string]interface{} {
+	var items []interface{}
+	hasErrors := false
+	for _, status := range statuses {
+		result := map[string]interface{}{"status": status}
+		if status >= 300 {
+			hasErrors = true
+			result["error"] = map[string]string{"type": "error", "reason": http.StatusText(status)}
+		}
+		items = append(items, map[string]interface{}{"create": result})
+	}
+	return map[string]interface{}{"errors": hasErrors, "items": items}
+}
+
+func allCreated(req int, actions []bulkAction) (int, interface{}) {
+	statuses := make([]int, len(actions))
+	for i := range statuses {
+		statuses[i] = http.StatusCreated
+	}
+	return http.StatusOK, bulkResult(statuses...)
+}
+
+func newElasticsearch(t *testing.T, cfg logv1.ElasticsearchOutput, f *fakeBulk) *Elasticsearch {
+	t.Helper()
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	cfg.URLs = append(cfg.URLs, server.URL)
+	e, err := NewElasticsearch(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+func TestElasticsearchIndexTemplate(t *testing.T) {
+	f := &fakeBulk{respond: allCreated}
+	e := newElasticsearch(t, logv1.ElasticsearchOutput{
+		Index: `{{ .Namespace }}-{{ index .Labels "app" }}-{{ .Pod }}-{{ .Date }}`,
+	}, f)
+	events := newEvents("a", "b")
+	for _, ev := range events {
+		ev.Pod = "web-0"
+		ev.Labels = map[string]string{"app": "Web"}
+	}
+	if err := e.Write(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.requests) != 1 || len(f.requests[0]) != 2 {
+		t.Fatalf("unexpected requests %v", f.requests)
+	}
+	for _, action := range f.requests[0] {
+		if action.Index != "default-web-web-0-1970.01.01" {
+			t.Errorf("index %q", action.Index)
+		}
+	}
+	if a, b := f.requests[0][0].ID, f.requests[0][1].ID; a == "" || a == b {
+		t.Errorf("documents need distinct ids, got %q and %q", a, b)
+	}
+}
+
+func TestElasticsearchRetriesFailedItems(t *testing.T) {
+	deadLetter := filepath.Join(t.TempDir(), "dead-letter.log")
+	f := &fakeBulk{respond: func(req int, actions []bulkAction) (int, interface{}) {
+		if req == 0 {
+			// a: indexed, b: throttled, c: mapping error, d: indexed before
+			return http.StatusOK, bulkResult(http.StatusCreated, http.StatusTooManyRequests, http.StatusBadRequest, http.StatusConflict)
+		}
+		return allCreated(req, actions)
+	}}
+	e := newElasticsearch(t, logv1.ElasticsearchOutput{DeadLetterPath: deadLetter}, f)
+	if err := e.Write(context.Background(), newEvents("a", "b", "c", "d")); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.requests) != 2 || len(f.requests[1]) != 1 || f.requests[1][0].Message != "b" {
+		t.Fatalf("only the throttled document should be sent again, requests %v", f.requests)
+	}
+
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(deadLetter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("dead letter has %d lines: %s", len(lines), data)
+	}
+	var rejected struct {
+		Status   int `json:"status"`
+		Document struct {
+			Message string `json:"message"`
+		} `json:"document"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &rejected); err != nil {
+		t.Fatal(err)
+	}
+	if rejected.Status != http.StatusBadRequest || rejected.Document.Message != "c" {
+		t.Errorf("unexpected dead letter %s", lines[0])
+	}
+}
+
+func TestElasticsearchDocumentID(t *testing.T) {
+	events := newEvents("a", "b")
+	//截断后同一偏移量的行
+	events[1].Offset = events[0].Offset
+	events[1].Generation = 1
+	if a, b := documentID(events[0]), documentID(events[1]); a == "" || a == b {
+		t.Errorf("generations need distinct ids, got %q and %q", a, b)
+	}
+	if id := documentID(newEvents("a")[0]); id != documentID(events[0]) {
+		t.Errorf("id %q changed to %q", documentID(events[0]), id)
+	}
+	events[0].File = tailer.FileID{}
+	if id := documentID(events[0]); id != "" {
+		t.Errorf("id %q for an event without file", id)
+	}
+}
+
+func TestElasticsearchConflictWithoutID(t *testing.T) {
+	deadLetter := filepath.Join(t.TempDir(), "dead-letter.log")
+	f := &fakeBulk{respond: func(req int, actions []bulkAction) (int, interface{}) {
+		return http.StatusOK, bulkResult(http.StatusConflict)
+	}}
+	e := newElasticsearch(t, logv1.ElasticsearchOutput{DeadLetterPath: deadLetter}, f)
+	events := newEvents("a")
+	events[0].File = tailer.FileID{}
+	if err := e.Write(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.requests) != 1 || f.requests[0][0].ID != "" {
+		t.Fatalf("unexpected requests %v", f.requests)
+	}
+	//没有稳定id的文档，409不能说明它已经写入过
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(deadLetter)
+	if err != nil || !strings.Contains(string(data), `"status":409`) {
+		t.Errorf("dead letter %s, %v", data, err)
+	}
+}
+
+func TestElasticsearchRetriesUnavailableCluster(t *testing.T) {
+	f := &fakeBulk{respond: func(req int, actions []bulkAction) (int, interface{}) {
+		if req == 0 {
+			return http.StatusServiceUnavailable, map[string]string{"error": "unavailable"}
+		}
+		return allCreated(req, actions)
+	}}
+	e := newElasticsearch(t, logv1.ElasticsearchOutput{}, f)
+	if err := e.Write(context.Background(), newEvents("a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.requests) != 2 || len(f.requests[1]) != 2 {
+		t.Fatalf("the whole batch should be sent again, requests %v", f.requests)
+	}
+}
+
+func TestElasticsearchGivesUpAfterMaxRetries(t *testing.T) {
+	f := &fakeBulk{respond: func(req int, actions []bulkAction) (int, interface{}) {
+		return http.StatusTooManyRequests, map[string]string{"error": "throttled"}
+	}}
+	retries := int32(1)
+	e := newElasticsearch(t, logv1.ElasticsearchOutput{MaxRetries: &retries}, f)
+	if err := e.Write(context.Background(), newEvents("a")); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(f.requests) != 2 {
+		t.Errorf("got %d requests, want 2", len(f.requests))
+	}
+	if e.Healthy() == nil {
+		t.Error("sink should be unhealthy")
+	}
+}
+
+func TestElasticsearchDoesNotRetryRejectedRequest(t *testing.T) {
+	f := &fakeBulk{respond: func(req int, actions []bulkAction) (int, interface{}) {
+		return http.StatusUnauthorized, map[string]string{"error": "unauthorized"}
+	}}
+	e := newElasticsearch(t, logv1.ElasticsearchOutput{}, f)
+	if err := e.Write(context.Background(), newEvents("a")); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(f.requests) != 1 {
+		t.Errorf("got %d requests, want 1", len(f.requests))
+	}
+}
+
+func TestElasticsearchSplitsLargeRequests(t *testing.T) {
+	f := &fakeBulk{respond: func(req int, actions []bulkAction) (int, interface{}) {
+		if len(actions) > 1 {
+			return http.StatusRequestEntityTooLarge, map[string]string{"error": "too large"}
+		}
+		return allCreated(req, actions)
+	}}
+	e := newElasticsearch(t, logv1.ElasticsearchOutput{}, f)
+	if err := e.Write(context.Background(), newEvents("a", "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+	var sent []string
+	for _, actions := range f.requests {
+		if len(actions) == 1 {
+			sent = append(sent, actions[0].Message)
+		}
+	}
+	if strings.Join(sent, ",") != "a,b,c" {
+		t.Errorf("documents sent one by one %v", sent)
+	}
+}
+
+func TestElasticsearchFailsOverToNextURL(t *testing.T) {
+	f := &fakeBulk{respond: allCreated}
+	e := newElasticsearch(t, logv1.ElasticsearchOutput{URLs: []string{"http://127.0.0.1:1"}}, f)
+	if err := e.Write(context.Background(), newEvents("a")); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.requests) != 1 {
+		t.Errorf("got %d requests, want 1", len(f.requests))
+	}
+}
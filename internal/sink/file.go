@@ -0,0 +1,141 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/event"
+)
+
+const (
+	defaultFileMaxSizeMB  = 100
+	defaultFileMaxBackups = 5
+)
+
+// File appends events as JSON lines to a local file and rotates it to
+// path.1, path.2, ... once it grows past the size limit.
+type File struct {
+	health
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFile returns a rolling file sink.
+func NewFile(cfg logv1.FileOutput) (*File, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("file output requires a path")
+	}
+	f := &File{
+		path:       cfg.Path,
+		maxSize:    int64(cfg.MaxSizeMB) * 1024 * 1024,
+		maxBackups: defaultFileMaxBackups,
+	}
+	if f.maxSize <= 0 {
+		f.maxSize = defaultFileMaxSizeMB * 1024 * 1024
+	}
+	if cfg.MaxBackups != nil {
+		f.maxBackups = int(*cfg.MaxBackups)
+	}
+	return f, nil
+}
+
+func (f *File) Write(ctx context.Context, events []*event.Event) error {
+	var buf bytes.Buffer
+	if err := writeJSONLines(&buf, events); err != nil {
+		return f.set(err)
+	}
+	return f.set(f.append(buf.Bytes()))
+}
+
+// append writes data, rotating the file first if data does not fit.
+func (f *File) append(data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+	if f.size > 0 && f.size+int64(len(data)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(data)
+	f.size += int64(n)
+	return err
+}
+
+func (f *File) Flush(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *File) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// rotate shifts path.N to path.N+1, drops the oldest backup and starts a
+// new file.
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	if f.maxBackups == 0 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return f.open()
+	}
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", f.path, i)
+		to := fmt.Sprintf("%s.%d", f.path, i+1)
+		if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return f.open()
+}
@@ -0,0 +1,45 @@
+package sink
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+)
+
+func TestFileRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "events.log")
+	backups := int32(1)
+	f, err := NewFile(logv1.FileOutput{Path: path, MaxBackups: &backups})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.maxSize = 200
+	defer f.Close()
+
+	message := strings.Repeat("x", 100)
+	for i := 0; i < 3; i++ {
+		if err := f.Write(context.Background(), newEvents(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{path, path + ".1"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(string(data), "\n"); n != 1 {
+			t.Errorf("%s has %d events, want 1", name, n)
+		}
+	}
+	if _, err := os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Errorf("only one backup should be kept, stat err=%v", err)
+	}
+}
@@ -0,0 +1,25 @@
+package sink
+
+import (
+	"sync"
+)
+
+// health remembers the outcome of the last delivery of a sink.
+type health struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (h *health) set(err error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.err = err
+	return err
+}
+
+// Healthy returns the error of the last failed delivery, or nil.
+func (h *health) Healthy() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
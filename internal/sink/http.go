@@ -0,0 +1,107 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/event"
+)
+
+const defaultHTTPTimeout = 10 * time.Second
+
+// HTTP sends every batch as a JSON request to a URL.
+type HTTP struct {
+	health
+	url     string
+	method  string
+	headers map[string]string
+	format  logv1.HTTPOutputFormat
+	client  *http.Client
+}
+
+// NewHTTP returns an HTTP/JSON sink.
+func NewHTTP(cfg logv1.HTTPOutput) (*HTTP, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("http output requires a url")
+	}
+	h := &HTTP{
+		url:     cfg.URL,
+		method:  cfg.Method,
+		headers: cfg.Headers,
+		format:  cfg.Format,
+	}
+	if h.method == "" {
+		h.method = http.MethodPost
+	}
+	if h.format == "" {
+		h.format = logv1.HTTPFormatJSON
+	}
+	timeout := defaultHTTPTimeout
+	if cfg.Timeout != nil {
+		timeout = cfg.Timeout.Duration
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	h.client = &http.Client{Timeout: timeout, Transport: transport}
+	return h, nil
+}
+
+func (h *HTTP) Write(ctx context.Context, events []*event.Event) error {
+	body, contentType, err := h.encode(events)
+	if err != nil {
+		return h.set(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, h.method, h.url, bytes.NewReader(body))
+	if err != nil {
+		return h.set(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return h.set(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return h.set(fmt.Errorf("%s %s: unexpected status %d: %s", h.method, h.url, resp.StatusCode, bytes.TrimSpace(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return h.set(nil)
+}
+
+func (h *HTTP) encode(events []*event.Event) ([]byte, string, error) {
+	if h.format == logv1.HTTPFormatNDJSON {
+		var buf bytes.Buffer
+		if err := writeJSONLines(&buf, events); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "application/x-ndjson", nil
+	}
+	records := make([]map[string]interface{}, 0, len(events))
+	for _, ev := range events {
+		records = append(records, ev.Record())
+	}
+	body, err := json.Marshal(records)
+	return body, "application/json", err
+}
+
+func (h *HTTP) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (h *HTTP) Close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,96 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+)
+
+func TestHTTPWritesJSONArray(t *testing.T) {
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	h, err := NewHTTP(logv1.HTTPOutput{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Write(context.Background(), newEvents("a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("content type %q", got)
+	}
+	if got := header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("authorization %q", got)
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal(body, &records); err != nil {
+		t.Fatalf("body %q: %v", body, err)
+	}
+	if len(records) != 2 || records[0]["message"] != "a" || records[1]["serverLog"] != "web-0" {
+		t.Errorf("unexpected records %v", records)
+	}
+}
+
+func TestHTTPWritesNDJSON(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Type"); got != "application/x-ndjson" {
+			t.Errorf("content type %q", got)
+		}
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	h, err := NewHTTP(logv1.HTTPOutput{URL: server.URL, Format: logv1.HTTPFormatNDJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Write(context.Background(), newEvents("a", "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines: %q", len(lines), body)
+	}
+}
+
+func TestHTTPErrorStatusIsUnhealthy(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("overloaded"))
+	}))
+	defer server.Close()
+
+	h, err := NewHTTP(logv1.HTTPOutput{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.Write(context.Background(), newEvents("a"))
+	if err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+	if h.Healthy() == nil {
+		t.Error("sink should be unhealthy after a failed write")
+	}
+
+	status = http.StatusOK
+	if err := h.Write(context.Background(), newEvents("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Healthy(); err != nil {
+		t.Errorf("sink should be healthy again, got %v", err)
+	}
+}
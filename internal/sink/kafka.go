@@ -0,0 +1,173 @@
+package sink
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/event"
+)
+
+const (
+	defaultKafkaTopic      = "logs-{{ .Namespace }}"
+	defaultKafkaClientID   = "log-collector"
+	defaultKafkaMaxRetries = 3
+	defaultKafkaTimeout    = 30 * time.Second
+)
+
+// kafkaAcks has no kgo.NoAck, the checkpoints of a batch are saved once the
+// producer returns and must not be for records the broker may not have.
+var kafkaAcks = map[logv1.KafkaAcks]kgo.Acks{
+	"":                    kgo.AllISRAcks(),
+	logv1.KafkaAcksAll:    kgo.AllISRAcks(),
+	logv1.KafkaAcksLeader: kgo.LeaderAck(),
+}
+
+var kafkaCodecs = map[string]kgo.CompressionCodec{
+	"":       kgo.NoCompression(),
+	"none":   kgo.NoCompression(),
+	"gzip":   kgo.GzipCompression(),
+	"snappy": kgo.SnappyCompression(),
+	"lz4":    kgo.Lz4Compression(),
+	"zstd":   kgo.ZstdCompression(),
+}
+
+// Kafka produces every event as a JSON record keyed by its Pod name. Write
+// returns once the brokers acknowledged the batch, so offsets are only
+// checkpointed for records Kafka has.
+type Kafka struct {
+	health
+	topic  *template.Template
+	client *kgo.Client
+}
+
+// NewKafka returns a Kafka sink.
+func NewKafka(cfg logv1.KafkaOutput) (*Kafka, error) {
+	topicTemplate := cfg.Topic
+	if topicTemplate == "" {
+		topicTemplate = defaultKafkaTopic
+	}
+	topic, err := parseNameTemplate("topic", topicTemplate)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := kafkaOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Kafka{topic: topic, client: client}, nil
+}
+
+// kafkaOptions returns the options of the client of cfg.
+func kafkaOptions(cfg logv1.KafkaOutput) ([]kgo.Opt, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka output requires at least one broker")
+	}
+	acks, ok := kafkaAcks[cfg.Acks]
+	if !ok {
+		return nil, fmt.Errorf("unknown kafka acks %q", cfg.Acks)
+	}
+	codec, ok := kafkaCodecs[cfg.Compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown kafka compression %q", cfg.Compression)
+	}
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = defaultKafkaClientID
+	}
+	maxRetries := defaultKafkaMaxRetries
+	if cfg.MaxRetries != nil {
+		maxRetries = int(*cfg.MaxRetries)
+	}
+	timeout := defaultKafkaTimeout
+	if cfg.Timeout != nil {
+		timeout = cfg.Timeout.Duration
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.ClientID(clientID),
+		kgo.RequiredAcks(acks),
+		kgo.ProducerBatchCompression(codec),
+		//与Java客户端一致，按key的murmur2哈希选择分区
+		kgo.RecordPartitioner(kgo.StickyKeyPartitioner(nil)),
+		//第一次发送不算重试
+		kgo.RecordRetries(maxRetries + 1),
+		kgo.ProduceRequestTimeout(timeout),
+		kgo.AllowAutoTopicCreation(),
+	}
+	//幂等写入要求acks=all
+	if cfg.Acks == logv1.KafkaAcksLeader {
+		opts = append(opts, kgo.DisableIdempotentWrite())
+	}
+	if cfg.MaxBatchBytes > 0 {
+		opts = append(opts, kgo.ProducerBatchMaxBytes(cfg.MaxBatchBytes))
+	}
+	if cfg.TLS != nil {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{
+			ServerName:         cfg.TLS.ServerName,
+			InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+		}))
+	}
+	if cfg.SASL != nil {
+		mechanism, err := kafkaSASL(*cfg.SASL)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+	return opts, nil
+}
+
+func kafkaSASL(cfg logv1.KafkaSASL) (sasl.Mechanism, error) {
+	switch cfg.Mechanism {
+	case "", logv1.KafkaSASLPlain:
+		return plain.Auth{User: cfg.Username, Pass: cfg.Password}.AsMechanism(), nil
+	case logv1.KafkaSASLScramSHA256:
+		return scram.Auth{User: cfg.Username, Pass: cfg.Password}.AsSha256Mechanism(), nil
+	case logv1.KafkaSASLScramSHA512:
+		return scram.Auth{User: cfg.Username, Pass: cfg.Password}.AsSha512Mechanism(), nil
+	}
+	return nil, fmt.Errorf("unknown kafka sasl mechanism %q", cfg.Mechanism)
+}
+
+func (k *Kafka) Write(ctx context.Context, events []*event.Event) error {
+	records := make([]*kgo.Record, 0, len(events))
+	for _, ev := range events {
+		topic, err := renderName(k.topic, ev)
+		if err != nil {
+			return k.set(err)
+		}
+		value, err := json.Marshal(ev.Record())
+		if err != nil {
+			return k.set(err)
+		}
+		records = append(records, &kgo.Record{
+			Topic:     topic,
+			Key:       []byte(ev.Pod),
+			Value:     value,
+			Timestamp: ev.Time,
+		})
+	}
+	return k.set(k.client.ProduceSync(ctx, records...).FirstErr())
+}
+
+func (k *Kafka) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (k *Kafka) Close() error {
+	k.client.Close()
+	return nil
+}
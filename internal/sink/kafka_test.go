@@ -0,0 +1,164 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+)
+
+func newKafka(t *testing.T, cfg logv1.KafkaOutput, opts ...kfake.Opt) (*Kafka, *kfake.Cluster) {
+	t.Helper()
+	opts = append(opts, kfake.NumBrokers(1), kfake.DefaultNumPartitions(4), kfake.AllowAutoTopicCreation())
+	cluster, err := kfake.NewCluster(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cluster.Close)
+	cfg.Brokers = cluster.ListenAddrs()
+	k, err := NewKafka(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { k.Close() })
+	return k, cluster
+}
+
+// consume reads n records of topic from cluster.
+func consume(t *testing.T, cluster *kfake.Cluster, topic string, n int) []*kgo.Record {
+	t.Helper()
+	client, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...), kgo.ConsumeTopics(topic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var records []*kgo.Record
+	for len(records) < n && ctx.Err() == nil {
+		records = append(records, client.PollFetches(ctx).Records()...)
+	}
+	return records
+}
+
+func TestKafkaTopicAndKey(t *testing.T) {
+	k, cluster := newKafka(t, logv1.KafkaOutput{
+		Topic:       "logs-{{ .Namespace }}-{{ .ServerLog }}",
+		Compression: "zstd",
+	})
+	codecs := make(chan int8, 10)
+	cluster.ControlKey(kmsg.Produce.Int16(), func(req kmsg.Request) (kmsg.Response, error, bool) {
+		cluster.KeepControl()
+		for _, topic := range req.(*kmsg.ProduceRequest).Topics {
+			for _, partition := range topic.Partitions {
+				var batch kmsg.RecordBatch
+				if err := batch.ReadFrom(partition.Records); err == nil {
+					codecs <- int8(batch.Attributes & 0x07)
+				}
+			}
+		}
+		return nil, nil, false
+	})
+	events := newEvents("a", "b")
+	events[0].Pod = "web-0"
+	events[1].Pod = "web-1"
+	if err := k.Write(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	//zstd的编码为4
+	if codec := <-codecs; codec != 4 {
+		t.Errorf("batch compressed with codec %d, want zstd", codec)
+	}
+
+	records := consume(t, cluster, "logs-default-web-0", 2)
+	if len(records) != 2 {
+		t.Fatalf("got %d records", len(records))
+	}
+	keys := map[string]string{}
+	for _, r := range records {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(r.Value, &doc); err != nil {
+			t.Fatal(err)
+		}
+		keys[string(r.Key)] = doc["message"].(string)
+	}
+	if keys["web-0"] != "a" || keys["web-1"] != "b" {
+		t.Errorf("records must be keyed by pod, got %v", keys)
+	}
+}
+
+func TestKafkaDeliveredAfterAck(t *testing.T) {
+	k, cluster := newKafka(t, logv1.KafkaOutput{})
+	release := make(chan struct{})
+	cluster.ControlKey(kmsg.Produce.Int16(), func(kmsg.Request) (kmsg.Response, error, bool) {
+		cluster.SleepControl(func() { <-release })
+		return nil, nil, false
+	})
+	d := &deliveries{}
+	o := NewOutput("kafka", k, OutputOptions{FlushInterval: 10 * time.Millisecond}, d.add)
+	defer o.Close(context.Background())
+	o.Handle(newEvents("a")[0])
+
+	time.Sleep(100 * time.Millisecond)
+	if d.len() != 0 {
+		t.Fatal("event reported as delivered before the broker acknowledged it")
+	}
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for d.len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if d.len() != 1 {
+		t.Fatal("event was not delivered after the ack")
+	}
+}
+
+func TestKafkaRejectedBatchNotDelivered(t *testing.T) {
+	retries := int32(0)
+	k, cluster := newKafka(t, logv1.KafkaOutput{MaxRetries: &retries})
+	cluster.ControlKey(kmsg.Produce.Int16(), func(req kmsg.Request) (kmsg.Response, error, bool) {
+		cluster.KeepControl()
+		produce := req.(*kmsg.ProduceRequest)
+		resp := produce.ResponseKind().(*kmsg.ProduceResponse)
+		for _, t := range produce.Topics {
+			topic := kmsg.NewProduceResponseTopic()
+			topic.Topic = t.Topic
+			for _, p := range t.Partitions {
+				partition := kmsg.NewProduceResponseTopicPartition()
+				partition.Partition = p.Partition
+				partition.ErrorCode = kerr.NotEnoughReplicas.Code
+				topic.Partitions = append(topic.Partitions, partition)
+			}
+			resp.Topics = append(resp.Topics, topic)
+		}
+		return resp, nil, true
+	})
+	if err := k.Write(context.Background(), newEvents("a")); err == nil {
+		t.Fatal("expected an error")
+	}
+	if k.Healthy() == nil {
+		t.Error("sink should be unhealthy")
+	}
+}
+
+func TestKafkaSASL(t *testing.T) {
+	k, _ := newKafka(t, logv1.KafkaOutput{
+		SASL: &logv1.KafkaSASL{Mechanism: logv1.KafkaSASLScramSHA256, Username: "collector", Password: "secret"},
+	}, kfake.EnableSASL(), kfake.Superuser("SCRAM-SHA-256", "collector", "secret"))
+	if err := k.Write(context.Background(), newEvents("a")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKafkaRejectsAcksNone(t *testing.T) {
+	//不等待broker确认时无法保证写checkpoint前记录已送达
+	if _, err := NewKafka(logv1.KafkaOutput{Brokers: []string{"localhost:9092"}, Acks: "none"}); err == nil {
+		t.Error("acks none must be rejected")
+	}
+}
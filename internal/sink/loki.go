@@ -0,0 +1,400 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/event"
+	"google.golang.org/protobuf/encoding/protowire"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultLokiTimeout        = 10 * time.Second
+	defaultLokiMaxLabelValues = 100
+	// lokiStreamIdle is how long the last timestamp of a stream is kept.
+	lokiStreamIdle = time.Hour
+	// lokiLabelValueIdle is how long a Pod label value not seen anymore
+	// still counts towards maxLabelValues, e.g. the value of a deleted Pod.
+	lokiLabelValueIdle = time.Hour
+	// lokiPodLabelPrefix is put before the name of a Pod label named like
+	// one of the labels the sink sets itself.
+	lokiPodLabelPrefix = "pod_"
+)
+
+// invalidLokiLabelChars are the characters Loki does not allow in label names.
+var invalidLokiLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// reservedLokiLabels are the labels of every stream.
+var reservedLokiLabels = map[string]bool{
+	"namespace":  true,
+	"server_log": true,
+	"node_name":  true,
+}
+
+// Loki pushes events to the Loki push API. Every event becomes an entry of
+// the stream identified by its labels; entries of a stream are sent in
+// timestamp order.
+type Loki struct {
+	health
+	url               string
+	tenantID          string
+	format            logv1.LokiFormat
+	headers           map[string]string
+	labels            []lokiLabel
+	maxLabelValues    int
+	onHighCardinality logv1.LokiCardinalityAction
+	client            *http.Client
+
+	mu sync.Mutex
+	// values holds when the values of every Pod label were last seen, up to
+	// maxLabelValues.
+	values map[string]map[string]time.Time
+	// last is the last entry sent for every stream.
+	last      map[string]lokiLast
+	lastPrune time.Time
+}
+
+type lokiLast struct {
+	// time is the timestamp of the entry, sent when it was pushed.
+	time time.Time
+	sent time.Time
+}
+
+type lokiLabel struct {
+	podLabel string
+	name     string
+}
+
+type lokiStream struct {
+	// key is the label set in Loki's {name="value", ...} notation.
+	key     string
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+type lokiEntry struct {
+	time time.Time
+	line string
+}
+
+// NewLoki returns a Loki push sink.
+func NewLoki(cfg logv1.LokiOutput) (*Loki, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("loki output requires a url")
+	}
+	l := &Loki{
+		url:               cfg.URL,
+		tenantID:          cfg.TenantID,
+		format:            cfg.Format,
+		headers:           cfg.Headers,
+		maxLabelValues:    int(cfg.MaxLabelValues),
+		onHighCardinality: cfg.OnHighCardinality,
+		values:            map[string]map[string]time.Time{},
+		last:              map[string]lokiLast{},
+	}
+	if l.format == "" {
+		l.format = logv1.LokiFormatProtobuf
+	}
+	if l.maxLabelValues <= 0 {
+		l.maxLabelValues = defaultLokiMaxLabelValues
+	}
+	if l.onHighCardinality == "" {
+		l.onHighCardinality = logv1.LokiCardinalityDrop
+	}
+	for _, label := range cfg.Labels {
+		name := label.Name
+		if name == "" {
+			name = sanitizeLokiLabel(label.PodLabel)
+		}
+		//不能覆盖namespace等固定的label
+		if reservedLokiLabels[name] {
+			name = lokiPodLabelPrefix + name
+		}
+		l.labels = append(l.labels, lokiLabel{podLabel: label.PodLabel, name: name})
+	}
+	timeout := defaultLokiTimeout
+	if cfg.Timeout != nil {
+		timeout = cfg.Timeout.Duration
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	l.client = &http.Client{Timeout: timeout, Transport: transport}
+	return l, nil
+}
+
+// sanitizeLokiLabel turns a Pod label key into a valid Loki label name.
+func sanitizeLokiLabel(key string) string {
+	name := invalidLokiLabelChars.ReplaceAllString(key, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// Write pushes events. Loki rejecting the entries as invalid (400, e.g. out
+// of order or too old) is logged and the events are dropped, as sending them
+// again would fail the same way. Any other status, such as a failed
+// authentication or a wrong URL, is returned and the push is retried.
+func (l *Loki) Write(ctx context.Context, events []*event.Event) error {
+	streams, rejected := l.streams(events)
+	if rejected > 0 {
+		klog.Info("drop loki entries with high cardinality labels, entries=", rejected)
+	}
+	if len(streams) == 0 {
+		return l.set(nil)
+	}
+	body, contentType, err := l.encode(streams)
+	if err != nil {
+		return l.set(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url, bytes.NewReader(body))
+	if err != nil {
+		return l.set(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if l.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.tenantID)
+	}
+	for k, v := range l.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return l.set(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		l.sent(streams)
+		return l.set(nil)
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("push to %s: unexpected status %d: %s", l.url, resp.StatusCode, bytes.TrimSpace(msg))
+	if resp.StatusCode != http.StatusBadRequest {
+		return l.set(err)
+	}
+	klog.Error("loki rejected entries, they are dropped, entries=", len(events), " err=", err)
+	l.set(err)
+	return nil
+}
+
+// streams groups events by stream and orders the entries of every stream.
+// It returns how many events were rejected for high cardinality labels.
+func (l *Loki) streams(events []*event.Event) ([]*lokiStream, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	byLabels := map[string]*lokiStream{}
+	var streams []*lokiStream
+	rejected := 0
+	for _, ev := range events {
+		labels, ok := l.streamLabels(ev, now)
+		if !ok {
+			rejected++
+			continue
+		}
+		key := lokiLabelsKey(labels)
+		s, ok := byLabels[key]
+		if !ok {
+			s = &lokiStream{key: key, labels: labels}
+			byLabels[key] = s
+			streams = append(streams, s)
+		}
+		s.entries = append(s.entries, lokiEntry{time: ev.Time, line: ev.Message})
+	}
+
+	for _, s := range streams {
+		sort.SliceStable(s.entries, func(i, j int) bool { return s.entries[i].time.Before(s.entries[j].time) })
+		//早于上次发送的entry使用上次的时间，保证stream内有序
+		last := l.last[s.key].time
+		for i := range s.entries {
+			if s.entries[i].time.Before(last) {
+				s.entries[i].time = last
+			}
+		}
+	}
+	return streams, rejected
+}
+
+// sent records the last timestamp of every stream Loki accepted.
+func (l *Loki) sent(streams []*lokiStream) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for _, s := range streams {
+		l.last[s.key] = lokiLast{time: s.entries[len(s.entries)-1].time, sent: now}
+	}
+	if now.Sub(l.lastPrune) > lokiStreamIdle {
+		for key, last := range l.last {
+			if now.Sub(last.sent) > lokiStreamIdle {
+				delete(l.last, key)
+			}
+		}
+		l.lastPrune = now
+	}
+}
+
+// streamLabels returns the labels of the stream of ev. It returns false if
+// ev is rejected because a label has too many values.
+func (l *Loki) streamLabels(ev *event.Event, now time.Time) (map[string]string, bool) {
+	labels := map[string]string{
+		"namespace":  ev.ServerLog.Namespace,
+		"server_log": ev.ServerLog.Name,
+	}
+	if ev.NodeName != "" {
+		labels["node_name"] = ev.NodeName
+	}
+	for _, label := range l.labels {
+		value, ok := ev.Labels[label.podLabel]
+		if !ok || value == "" {
+			continue
+		}
+		if !l.allowValue(label.podLabel, value, now) {
+			if l.onHighCardinality == logv1.LokiCardinalityReject {
+				return nil, false
+			}
+			continue
+		}
+		labels[label.name] = value
+	}
+	return labels, true
+}
+
+// lokiLabelsKey returns labels in Loki's {name="value", ...} notation.
+func lokiLabelsKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// allowValue records value for a Pod label and reports whether it is within
+// maxLabelValues. Only the values seen in the last lokiLabelValueIdle count,
+// the Pods of the others are gone or do not log anymore.
+func (l *Loki) allowValue(podLabel, value string, now time.Time) bool {
+	values, ok := l.values[podLabel]
+	if !ok {
+		values = map[string]time.Time{}
+		l.values[podLabel] = values
+	}
+	if _, ok := values[value]; ok {
+		values[value] = now
+		return true
+	}
+	if len(values) >= l.maxLabelValues {
+		for v, seen := range values {
+			if now.Sub(seen) > lokiLabelValueIdle {
+				delete(values, v)
+			}
+		}
+	}
+	if len(values) >= l.maxLabelValues {
+		return false
+	}
+	values[value] = now
+	if len(values) == l.maxLabelValues {
+		klog.Info("loki label reached its value limit, label=", podLabel, " limit=", l.maxLabelValues, " action=", l.onHighCardinality)
+	}
+	return true
+}
+
+func (l *Loki) encode(streams []*lokiStream) ([]byte, string, error) {
+	if l.format == logv1.LokiFormatJSON {
+		body, err := encodeLokiJSON(streams)
+		return body, "application/json", err
+	}
+	return s2.EncodeSnappy(nil, encodeLokiProtobuf(streams)), "application/x-protobuf", nil
+}
+
+// encodeLokiProtobuf encodes a logproto.PushRequest:
+//
+//	PushRequest   { repeated StreamAdapter streams = 1; }
+//	StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	EntryAdapter  { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+func encodeLokiProtobuf(streams []*lokiStream) []byte {
+	var req []byte
+	for _, s := range streams {
+		var stream []byte
+		stream = protowire.AppendTag(stream, 1, protowire.BytesType)
+		stream = protowire.AppendString(stream, s.key)
+		for _, e := range s.entries {
+			var ts []byte
+			ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(e.time.Unix()))
+			ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(e.time.Nanosecond()))
+
+			var entry []byte
+			entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+			entry = protowire.AppendBytes(entry, ts)
+			entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+			entry = protowire.AppendString(entry, e.line)
+
+			stream = protowire.AppendTag(stream, 2, protowire.BytesType)
+			stream = protowire.AppendBytes(stream, entry)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, stream)
+	}
+	return req
+}
+
+// encodeLokiJSON encodes the JSON push body:
+//
+//	{"streams": [{"stream": {"label": "value"}, "values": [["<unix ns>", "line"]]}]}
+func encodeLokiJSON(streams []*lokiStream) ([]byte, error) {
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	body := struct {
+		Streams []jsonStream `json:"streams"`
+	}{}
+	for _, s := range streams {
+		js := jsonStream{Stream: s.labels}
+		for _, e := range s.entries {
+			js.Values = append(js.Values, [2]string{strconv.FormatInt(e.time.UnixNano(), 10), e.line})
+		}
+		body.Streams = append(body.Streams, js)
+	}
+	return json.Marshal(body)
+}
+
+func (l *Loki) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (l *Loki) Close() error {
+	l.client.CloseIdleConnections()
+	return nil
+}
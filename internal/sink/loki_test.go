@@ -0,0 +1,306 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/event"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type pushedEntry struct {
+	labels string
+	time   time.Time
+	line   string
+}
+
+// fakeLoki decodes protobuf and JSON push requests.
+type fakeLoki struct {
+	t       *testing.T
+	status  int
+	tenant  string
+	entries []pushedEntry
+	// streams are the JSON stream labels.
+	streams []map[string]string
+}
+
+func (f *fakeLoki) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.tenant = r.Header.Get("X-Scope-OrgID")
+	body, _ := io.ReadAll(r.Body)
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+	switch r.Header.Get("Content-Type") {
+	case "application/x-protobuf":
+		raw, err := s2.Decode(nil, body)
+		if err != nil {
+			f.t.Errorf("snappy: %v", err)
+		}
+		f.decodeProtobuf(raw)
+	case "application/json":
+		var req struct {
+			Streams []struct {
+				Stream map[string]string `json:"stream"`
+				Values [][2]string       `json:"values"`
+			} `json:"streams"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			f.t.Errorf("json: %v", err)
+		}
+		for _, s := range req.Streams {
+			f.streams = append(f.streams, s.Stream)
+			for _, v := range s.Values {
+				ns, _ := strconv.ParseInt(v[0], 10, 64)
+				f.entries = append(f.entries, pushedEntry{time: time.Unix(0, ns), line: v[1]})
+			}
+		}
+	default:
+		f.t.Errorf("content type %q", r.Header.Get("Content-Type"))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fields returns the fields of a protobuf message by number.
+func fields(t *testing.T, b []byte, fn func(num protowire.Number, v []byte, n uint64)) {
+	for len(b) > 0 {
+		num, typ, l := protowire.ConsumeTag(b)
+		b = b[l:]
+		switch typ {
+		case protowire.BytesType:
+			v, l := protowire.ConsumeBytes(b)
+			fn(num, v, 0)
+			b = b[l:]
+		case protowire.VarintType:
+			v, l := protowire.ConsumeVarint(b)
+			fn(num, nil, v)
+			b = b[l:]
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+	}
+}
+
+func (f *fakeLoki) decodeProtobuf(b []byte) {
+	fields(f.t, b, func(_ protowire.Number, stream []byte, _ uint64) {
+		var labels string
+		fields(f.t, stream, func(num protowire.Number, v []byte, _ uint64) {
+			if num == 1 {
+				labels = string(v)
+				return
+			}
+			e := pushedEntry{labels: labels}
+			var sec, nsec uint64
+			fields(f.t, v, func(num protowire.Number, v []byte, _ uint64) {
+				if num == 2 {
+					e.line = string(v)
+					return
+				}
+				fields(f.t, v, func(num protowire.Number, _ []byte, n uint64) {
+					if num == 1 {
+						sec = n
+					} else {
+						nsec = n
+					}
+				})
+			})
+			e.time = time.Unix(int64(sec), int64(nsec))
+			f.entries = append(f.entries, e)
+		})
+	})
+}
+
+func newLoki(t *testing.T, cfg logv1.LokiOutput) (*Loki, *fakeLoki) {
+	t.Helper()
+	f := &fakeLoki{t: t}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	cfg.URL = server.URL + "/loki/api/v1/push"
+	l, err := NewLoki(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, f
+}
+
+func podEvents(messages ...string) []*event.Event {
+	events := newEvents(messages...)
+	for _, ev := range events {
+		ev.NodeName = "node-1"
+		ev.Labels = map[string]string{"app.kubernetes.io/name": "web", "pod-template-hash": "abc"}
+	}
+	return events
+}
+
+func TestLokiProtobufLabels(t *testing.T) {
+	l, f := newLoki(t, logv1.LokiOutput{
+		TenantID: "team-a",
+		Labels:   []logv1.LokiLabel{{PodLabel: "app.kubernetes.io/name"}, {PodLabel: "missing"}},
+	})
+	if err := l.Write(context.Background(), podEvents("a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if f.tenant != "team-a" {
+		t.Errorf("tenant %q", f.tenant)
+	}
+	if len(f.entries) != 2 {
+		t.Fatalf("got %d entries", len(f.entries))
+	}
+	want := `{app_kubernetes_io_name="web", namespace="default", node_name="node-1", server_log="web-0"}`
+	for _, e := range f.entries {
+		if e.labels != want {
+			t.Errorf("labels %s, want %s", e.labels, want)
+		}
+	}
+	if f.entries[0].line != "a" || f.entries[1].line != "b" {
+		t.Errorf("unexpected entries %+v", f.entries)
+	}
+}
+
+func TestLokiJSON(t *testing.T) {
+	l, f := newLoki(t, logv1.LokiOutput{
+		Format: logv1.LokiFormatJSON,
+		Labels: []logv1.LokiLabel{{PodLabel: "app.kubernetes.io/name", Name: "app"}},
+	})
+	events := podEvents("a")
+	events[0].Time = time.Unix(10, 5)
+	if err := l.Write(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.streams) != 1 || f.streams[0]["app"] != "web" || f.streams[0]["namespace"] != "default" {
+		t.Errorf("unexpected streams %v", f.streams)
+	}
+	if len(f.entries) != 1 || !f.entries[0].time.Equal(time.Unix(10, 5)) {
+		t.Errorf("unexpected entries %+v", f.entries)
+	}
+}
+
+func TestLokiOrdersEntriesPerStream(t *testing.T) {
+	l, f := newLoki(t, logv1.LokiOutput{})
+	events := podEvents("late", "early")
+	events[0].Time = time.Unix(20, 0)
+	events[1].Time = time.Unix(10, 0)
+	if err := l.Write(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	if f.entries[0].line != "early" || f.entries[1].line != "late" {
+		t.Fatalf("entries not sorted: %+v", f.entries)
+	}
+
+	// an entry older than what the stream already has is moved forward
+	older := podEvents("older")
+	older[0].Time = time.Unix(5, 0)
+	if err := l.Write(context.Background(), older); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.entries[2].time; !got.Equal(time.Unix(20, 0)) {
+		t.Errorf("older entry sent at %v", got)
+	}
+}
+
+func TestLokiHighCardinality(t *testing.T) {
+	for _, action := range []logv1.LokiCardinalityAction{logv1.LokiCardinalityDrop, logv1.LokiCardinalityReject} {
+		l, f := newLoki(t, logv1.LokiOutput{
+			Labels:            []logv1.LokiLabel{{PodLabel: "pod-template-hash", Name: "hash"}},
+			MaxLabelValues:    2,
+			OnHighCardinality: action,
+		})
+		events := podEvents("a", "b", "c", "d")
+		for i, ev := range events {
+			ev.Labels = map[string]string{"pod-template-hash": strconv.Itoa(i % 3)}
+		}
+		if err := l.Write(context.Background(), events); err != nil {
+			t.Fatal(err)
+		}
+		var withoutHash []string
+		for _, e := range f.entries {
+			if e.labels == `{namespace="default", node_name="node-1", server_log="web-0"}` {
+				withoutHash = append(withoutHash, e.line)
+			}
+		}
+		switch action {
+		case logv1.LokiCardinalityDrop:
+			if len(f.entries) != 4 || len(withoutHash) != 1 || withoutHash[0] != "c" {
+				t.Errorf("drop: got %+v", f.entries)
+			}
+		case logv1.LokiCardinalityReject:
+			if len(f.entries) != 3 || len(withoutHash) != 0 {
+				t.Errorf("reject: got %+v", f.entries)
+			}
+		}
+	}
+}
+
+func TestLokiLabelValuesExpire(t *testing.T) {
+	l, f := newLoki(t, logv1.LokiOutput{
+		Labels:            []logv1.LokiLabel{{PodLabel: "pod-template-hash", Name: "hash"}},
+		MaxLabelValues:    1,
+		OnHighCardinality: logv1.LokiCardinalityReject,
+	})
+	write := func(hash string) {
+		t.Helper()
+		events := podEvents(hash)
+		events[0].Labels = map[string]string{"pod-template-hash": hash}
+		if err := l.Write(context.Background(), events); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a")
+	write("b")
+	if len(f.entries) != 1 {
+		t.Fatalf("got %+v, want the second value rejected", f.entries)
+	}
+	//旧Pod的值长时间未出现后不再占用名额
+	l.mu.Lock()
+	l.values["pod-template-hash"]["a"] = time.Now().Add(-2 * lokiLabelValueIdle)
+	l.mu.Unlock()
+	write("b")
+	if len(f.entries) != 2 || f.entries[1].line != "b" {
+		t.Errorf("got %+v, want the value accepted once the old one expired", f.entries)
+	}
+}
+
+func TestLokiReservedLabels(t *testing.T) {
+	l, f := newLoki(t, logv1.LokiOutput{
+		Labels: []logv1.LokiLabel{{PodLabel: "namespace"}, {PodLabel: "app", Name: "server_log"}},
+	})
+	events := podEvents("a")
+	events[0].Labels = map[string]string{"namespace": "team-a", "app": "web"}
+	if err := l.Write(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	want := `{namespace="default", node_name="node-1", pod_namespace="team-a", pod_server_log="web", server_log="web-0"}`
+	if len(f.entries) != 1 || f.entries[0].labels != want {
+		t.Errorf("got %+v, want %s", f.entries, want)
+	}
+}
+
+func TestLokiErrors(t *testing.T) {
+	l, f := newLoki(t, logv1.LokiOutput{})
+	f.status = http.StatusTooManyRequests
+	if err := l.Write(context.Background(), podEvents("a")); err == nil {
+		t.Error("429 should be retried")
+	}
+	f.status = http.StatusBadRequest
+	if err := l.Write(context.Background(), podEvents("a")); err != nil {
+		t.Errorf("400 should drop the entries, got %v", err)
+	}
+	if l.Healthy() == nil {
+		t.Error("sink should report the rejected push")
+	}
+	//认证或配置错误不能丢弃事件
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound} {
+		f.status = status
+		if err := l.Write(context.Background(), podEvents("a")); err == nil {
+			t.Errorf("%d should be retried", status)
+		}
+	}
+}
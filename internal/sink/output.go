@@ -0,0 +1,366 @@
+package sink
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/event"
+	"github.com/yshaojie/log-collector/internal/metrics"
+	"github.com/yshaojie/log-collector/internal/wal"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultBatchMaxEvents     = 500
+	defaultBatchFlushInterval = time.Second
+	defaultQueueSize          = 4096
+	minRetryBackoff           = 100 * time.Millisecond
+	maxRetryBackoff           = 30 * time.Second
+)
+
+// DeliveredFunc is called with every batch a sink accepted.
+type DeliveredFunc func(events []*event.Event)
+
+// OutputOptions configures the batching in front of a sink.
+type OutputOptions struct {
+	// MaxEvents is the largest batch handed to the sink.
+	MaxEvents int
+	// FlushInterval sends a partial batch after this long.
+	FlushInterval time.Duration
+	// QueueSize is how many events may wait for the sink before Handle blocks.
+	QueueSize int
+	// Buffer queues the events on disk instead of in memory when it is set.
+	// The output reads them back through its cursor, named like the output.
+	Buffer *wal.WAL
+}
+
+// OptionsFromSpec returns the OutputOptions of a LogOutput.
+func OptionsFromSpec(spec *logv1.BatchConfig) OutputOptions {
+	var opts OutputOptions
+	if spec != nil {
+		opts.MaxEvents = int(spec.MaxEvents)
+		if spec.FlushInterval != nil {
+			opts.FlushInterval = spec.FlushInterval.Duration
+		}
+	}
+	return opts
+}
+
+func (o *OutputOptions) complete() {
+	if o.MaxEvents <= 0 {
+		o.MaxEvents = defaultBatchMaxEvents
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaultBatchFlushInterval
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaultQueueSize
+	}
+}
+
+// Output queues the events of any number of ServerLogs, writes them to a
+// Sink in batches and retries a failed batch until it is delivered. Events
+// are only reported as delivered once the sink accepted them, so a crash
+// never loses an event that was not checkpointed. With a Buffer the events
+// are checkpointed once the buffer synced them instead.
+type Output struct {
+	name      string
+	opts      OutputOptions
+	delivered DeliveredFunc
+
+	// cursor is set when the events are queued in opts.Buffer, queue is
+	// unused then.
+	cursor *wal.Cursor
+	queue  chan *event.Event
+	flush  chan chan error
+	stop   chan struct{}
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	// stopCtx is done once Close was called.
+	stopCtx    context.Context
+	stopCancel context.CancelFunc
+
+	mu   sync.Mutex
+	sink Sink
+	// next is the sink set by SetSink, swapped in by the goroutine writing
+	// the batches before its next write.
+	next     Sink
+	stopOnce sync.Once
+}
+
+// NewOutput starts an Output writing to s.
+func NewOutput(name string, s Sink, opts OutputOptions, delivered DeliveredFunc) *Output {
+	opts.complete()
+	o := &Output{
+		name:      name,
+		opts:      opts,
+		delivered: delivered,
+		queue:     make(chan *event.Event, opts.QueueSize),
+		flush:     make(chan chan error),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		sink:      s,
+	}
+	o.ctx, o.cancel = context.WithCancel(context.Background())
+	o.stopCtx, o.stopCancel = context.WithCancel(context.Background())
+	if opts.Buffer != nil {
+		o.cursor = opts.Buffer.Cursor(name)
+		go o.runBuffered()
+		return o
+	}
+	go o.run()
+	return o
+}
+
+// Name returns the name the output was created with.
+func (o *Output) Name() string {
+	return o.name
+}
+
+// Handle queues ev, blocking while the queue is full so that a slow sink
+// slows down reading instead of growing memory. Events handed in after
+// Close are dropped; they were never checkpointed and are read again.
+func (o *Output) Handle(ev *event.Event) {
+	if o.cursor != nil {
+		if err := o.opts.Buffer.Append(o.stopCtx, o.name, ev); err != nil {
+			metrics.DroppedEvents.WithLabelValues(o.name).Inc()
+			if o.stopCtx.Err() == nil {
+				klog.Error("buffer event failed, output=", o.name, " err=", err)
+			}
+		}
+		return
+	}
+	select {
+	case o.queue <- ev:
+	case <-o.stop:
+		metrics.DroppedEvents.WithLabelValues(o.name).Inc()
+	}
+}
+
+// Pending reports whether buffered events of the output were not delivered
+// yet. Without a Buffer Close delivers the queued events, it is false.
+func (o *Output) Pending() bool {
+	return o.cursor != nil && o.cursor.Pending()
+}
+
+// SetSink replaces the sink, e.g. after its LogOutput changed. The old one
+// is closed once the batch being written to it is done, the next batch goes
+// to s.
+func (o *Output) SetSink(s Sink) {
+	o.mu.Lock()
+	old := o.next
+	o.next = s
+	o.mu.Unlock()
+	//还没用过的sink直接关闭
+	if old != nil {
+		o.closeSink(old)
+	}
+}
+
+// swapSink switches to the sink set by SetSink and closes the old one. Only
+// the goroutine writing the batches calls it, so the old sink is not in use.
+func (o *Output) swapSink() {
+	o.mu.Lock()
+	next := o.next
+	if next == nil {
+		o.mu.Unlock()
+		return
+	}
+	old := o.sink
+	o.sink, o.next = next, nil
+	o.mu.Unlock()
+	o.closeSink(old)
+}
+
+func (o *Output) closeSink(s Sink) {
+	if err := s.Close(); err != nil {
+		klog.Error("close sink failed, output=", o.name, " err=", err)
+	}
+}
+
+// Healthy returns the last delivery error of the sink, or nil.
+func (o *Output) Healthy() error {
+	return o.currentSink().Healthy()
+}
+
+// Flush writes the queued events and flushes the sink. Once it returns nil
+// the events handed to Handle before are delivered. Flush gives up when ctx
+// is done, the events are still delivered later.
+func (o *Output) Flush(ctx context.Context) error {
+	result := make(chan error, 1)
+	select {
+	case o.flush <- result:
+	case <-o.done:
+		//Close已经写完了所有事件
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close writes the queued events and closes the sink. Events that could not
+// be delivered before ctx is done are dropped, or stay in the Buffer.
+func (o *Output) Close(ctx context.Context) error {
+	o.stopOnce.Do(func() {
+		close(o.stop)
+		o.stopCancel()
+	})
+	select {
+	case <-o.done:
+	case <-ctx.Done():
+		o.cancel()
+		<-o.done
+	}
+	o.cancel()
+	o.swapSink()
+	s := o.currentSink()
+	if err := s.Flush(ctx); err != nil {
+		s.Close()
+		return err
+	}
+	return s.Close()
+}
+
+func (o *Output) currentSink() Sink {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.sink
+}
+
+func (o *Output) run() {
+	defer close(o.done)
+	ticker := time.NewTicker(o.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*event.Event, 0, o.opts.MaxEvents)
+	for {
+		select {
+		case ev := <-o.queue:
+			batch = append(batch, ev)
+			if len(batch) >= o.opts.MaxEvents {
+				o.write(batch)
+				batch = make([]*event.Event, 0, o.opts.MaxEvents)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				o.write(batch)
+				batch = make([]*event.Event, 0, o.opts.MaxEvents)
+			}
+		case result := <-o.flush:
+			o.drain(batch)
+			batch = make([]*event.Event, 0, o.opts.MaxEvents)
+			o.swapSink()
+			result <- o.currentSink().Flush(o.ctx)
+		case <-o.stop:
+			o.drain(batch)
+			return
+		}
+	}
+}
+
+// runBuffered is run in place of run when the events are queued in the
+// buffer. Partial batches are sent every FlushInterval.
+func (o *Output) runBuffered() {
+	defer close(o.done)
+	ticker := time.NewTicker(o.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			o.drainBuffer()
+		case result := <-o.flush:
+			o.drainBuffer()
+			o.swapSink()
+			result <- o.currentSink().Flush(o.ctx)
+		case <-o.stop:
+			o.drainBuffer()
+			return
+		}
+	}
+}
+
+// drainBuffer writes the buffered events of the output in batches until it
+// reached the end of the buffer or the output is cancelled. The cursor only
+// moves past delivered events.
+func (o *Output) drainBuffer() {
+	for o.ctx.Err() == nil {
+		batch, pos, more, err := o.cursor.Read(o.opts.MaxEvents)
+		if err != nil {
+			klog.Error("read buffer failed, output=", o.name, " err=", err)
+			return
+		}
+		if len(batch) > 0 && !o.write(batch) {
+			return
+		}
+		if err := o.cursor.Commit(pos); err != nil {
+			klog.Error("commit buffer cursor failed, output=", o.name, " err=", err)
+			return
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+// drain writes batch and what is left in the queue.
+func (o *Output) drain(batch []*event.Event) {
+	for {
+		select {
+		case ev := <-o.queue:
+			batch = append(batch, ev)
+			if len(batch) >= o.opts.MaxEvents {
+				o.write(batch)
+				batch = make([]*event.Event, 0, o.opts.MaxEvents)
+			}
+		default:
+			if len(batch) > 0 {
+				o.write(batch)
+			}
+			return
+		}
+	}
+}
+
+// write delivers batch, retrying with backoff until it succeeds or the
+// output is cancelled. It reports whether the batch was delivered.
+func (o *Output) write(batch []*event.Event) bool {
+	backoff := minRetryBackoff
+	for {
+		//在两次写之间切换sink，不会关闭正在写的sink
+		o.swapSink()
+		start := time.Now()
+		err := o.currentSink().Write(o.ctx, batch)
+		if err == nil {
+			metrics.SinkBatchDuration.WithLabelValues(o.name, "success").Observe(time.Since(start).Seconds())
+			if o.delivered != nil {
+				o.delivered(batch)
+			}
+			return true
+		}
+		metrics.SinkBatchDuration.WithLabelValues(o.name, "error").Observe(time.Since(start).Seconds())
+		klog.Error("write batch failed, output=", o.name, " events=", len(batch), " retry in ", backoff, " err=", err)
+		select {
+		case <-o.ctx.Done():
+			//buffer中的事件没有提交cursor，重启后重新发送
+			if o.cursor == nil {
+				metrics.DroppedEvents.WithLabelValues(o.name).Add(float64(len(batch)))
+			}
+			return false
+		case <-time.After(backoff):
+		}
+		metrics.SinkRetries.WithLabelValues(o.name).Inc()
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package sink
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yshaojie/log-collector/internal/event"
+	"github.com/yshaojie/log-collector/internal/wal"
+)
+
+type deliveries struct {
+	mu      sync.Mutex
+	offsets []int64
+}
+
+func (d *deliveries) add(events []*event.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, ev := range events {
+		d.offsets = append(d.offsets, ev.Offset)
+	}
+}
+
+func (d *deliveries) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.offsets)
+}
+
+func TestOutputBatches(t *testing.T) {
+	s := &fakeSink{}
+	d := &deliveries{}
+	o := NewOutput("test", s, OutputOptions{MaxEvents: 2, FlushInterval: time.Hour}, d.add)
+	for _, ev := range newEvents("a", "b", "c") {
+		o.Handle(ev)
+	}
+	if err := o.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"a", "b"}, {"c"}}
+	if !reflect.DeepEqual(s.batches, want) {
+		t.Errorf("batches %q, want %q", s.batches, want)
+	}
+	if !s.flushed || !s.closed {
+		t.Error("sink should be flushed and closed")
+	}
+	if !reflect.DeepEqual(d.offsets, []int64{1, 2, 3}) {
+		t.Errorf("delivered %v", d.offsets)
+	}
+}
+
+func TestOutputRetriesBeforeDelivery(t *testing.T) {
+	s := &fakeSink{failures: 2}
+	d := &deliveries{}
+	o := NewOutput("test", s, OutputOptions{FlushInterval: 10 * time.Millisecond}, d.add)
+	defer o.Close(context.Background())
+	o.Handle(newEvents("a")[0])
+
+	deadline := time.Now().Add(5 * time.Second)
+	for d.len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if d.len() != 1 {
+		t.Fatal("event was not delivered")
+	}
+	if err := o.Healthy(); err != nil {
+		t.Errorf("output should be healthy after the retry succeeded, got %v", err)
+	}
+}
+
+func TestOutputCloseGivesUpAtDeadline(t *testing.T) {
+	s := &fakeSink{failures: 1 << 30}
+	d := &deliveries{}
+	o := NewOutput("test", s, OutputOptions{}, d.add)
+	o.Handle(newEvents("a")[0])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	o.Close(ctx)
+	if d.len() != 0 {
+		t.Error("undelivered events must not be reported as delivered")
+	}
+}
+
+func TestOutputFlush(t *testing.T) {
+	s := &fakeSink{failures: 1}
+	d := &deliveries{}
+	o := NewOutput("test", s, OutputOptions{FlushInterval: time.Hour}, d.add)
+	defer o.Close(context.Background())
+	for _, ev := range newEvents("a", "b") {
+		o.Handle(ev)
+	}
+	if err := o.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d.len() != 2 {
+		t.Errorf("delivered %d events", d.len())
+	}
+	s.mu.Lock()
+	flushed := s.flushed
+	s.mu.Unlock()
+	if !flushed {
+		t.Error("sink not flushed")
+	}
+	// the output keeps running
+	o.Handle(newEvents("c")[0])
+	if err := o.Flush(context.Background()); err != nil || d.len() != 3 {
+		t.Errorf("flush returned %v, delivered %d", err, d.len())
+	}
+}
+
+func TestOutputSetSinkBetweenBatches(t *testing.T) {
+	old := &fakeSink{failures: 1 << 30}
+	d := &deliveries{}
+	o := NewOutput("test", old, OutputOptions{FlushInterval: 10 * time.Millisecond}, d.add)
+	defer o.Close(context.Background())
+	//旧sink一直失败，batch在重试中
+	o.Handle(newEvents("a")[0])
+	time.Sleep(50 * time.Millisecond)
+
+	s := &fakeSink{}
+	o.SetSink(s)
+	deadline := time.Now().Add(5 * time.Second)
+	for d.len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if d.len() != 1 {
+		t.Fatal("event was not delivered to the new sink")
+	}
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	if !old.closed || old.writtenAfterClose {
+		t.Errorf("old sink closed=%v, written after close=%v", old.closed, old.writtenAfterClose)
+	}
+}
+
+func TestOutputBufferedRedeliversAfterClose(t *testing.T) {
+	buffer, err := wal.Open(wal.Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buffer.Close()
+
+	down := &fakeSink{failures: 1 << 30}
+	o := NewOutput("test", down, OutputOptions{FlushInterval: 10 * time.Millisecond, Buffer: buffer}, nil)
+	for _, ev := range newEvents("a", "b") {
+		o.Handle(ev)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	o.Close(ctx)
+	if !o.Pending() {
+		t.Fatal("undelivered events must stay in the buffer")
+	}
+
+	// the events are delivered by the next output of the same name
+	s := &fakeSink{}
+	d := &deliveries{}
+	o = NewOutput("test", s, OutputOptions{FlushInterval: time.Hour, Buffer: buffer}, d.add)
+	if err := o.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s.batches, [][]string{{"a", "b"}}) {
+		t.Errorf("batches %q", s.batches)
+	}
+	if !reflect.DeepEqual(d.offsets, []int64{1, 2}) {
+		t.Errorf("delivered %v", d.offsets)
+	}
+	if o.Pending() {
+		t.Error("delivered events are left in the buffer")
+	}
+}
@@ -0,0 +1,58 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/internal/event"
+)
+
+// Sink delivers batches of events to a backend.
+type Sink interface {
+	// Write delivers a batch. Once it returns nil the events are considered
+	// delivered and their offsets may be checkpointed. A failed batch is
+	// retried as a whole, so a sink must tolerate duplicates.
+	Write(ctx context.Context, events []*event.Event) error
+	// Flush pushes out anything the sink buffers internally.
+	Flush(ctx context.Context) error
+	// Close releases the sink. It is not used afterwards.
+	Close() error
+	// Healthy returns the error of the last failed delivery, or nil.
+	Healthy() error
+}
+
+// New builds the sink described by spec.
+func New(spec logv1.LogOutputSpec) (Sink, error) {
+	switch spec.Type {
+	case logv1.LogOutputStdout:
+		return NewStdout(), nil
+	case logv1.LogOutputFile:
+		if spec.File == nil {
+			return nil, fmt.Errorf("output type %s requires spec.file", spec.Type)
+		}
+		return NewFile(*spec.File)
+	case logv1.LogOutputHTTP:
+		if spec.HTTP == nil {
+			return nil, fmt.Errorf("output type %s requires spec.http", spec.Type)
+		}
+		return NewHTTP(*spec.HTTP)
+	case logv1.LogOutputElasticsearch:
+		if spec.Elasticsearch == nil {
+			return nil, fmt.Errorf("output type %s requires spec.elasticsearch", spec.Type)
+		}
+		return NewElasticsearch(*spec.Elasticsearch)
+	case logv1.LogOutputKafka:
+		if spec.Kafka == nil {
+			return nil, fmt.Errorf("output type %s requires spec.kafka", spec.Type)
+		}
+		return NewKafka(*spec.Kafka)
+	case logv1.LogOutputLoki:
+		if spec.Loki == nil {
+			return nil, fmt.Errorf("output type %s requires spec.loki", spec.Type)
+		}
+		return NewLoki(*spec.Loki)
+	default:
+		return nil, fmt.Errorf("unknown output type %q", spec.Type)
+	}
+}
@@ -0,0 +1,72 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/yshaojie/log-collector/internal/event"
+	"github.com/yshaojie/log-collector/internal/tailer"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newEvents(messages ...string) []*event.Event {
+	events := make([]*event.Event, 0, len(messages))
+	for i, msg := range messages {
+		events = append(events, &event.Event{
+			ServerLog: types.NamespacedName{Namespace: "default", Name: "web-0"},
+			Path:      "/data/log/app.log",
+			File:      tailer.FileID{Device: 2049, Inode: 1234},
+			Offset:    int64(i + 1),
+			Time:      time.Unix(0, 0).UTC(),
+			Message:   msg,
+		})
+	}
+	return events
+}
+
+// fakeSink records the batches it accepted and fails the first failures
+// writes.
+type fakeSink struct {
+	health
+	mu       sync.Mutex
+	failures int
+	batches  [][]string
+	flushed  bool
+	closed   bool
+	// writtenAfterClose is set when Write is called on a closed sink.
+	writtenAfterClose bool
+}
+
+func (f *fakeSink) Write(ctx context.Context, events []*event.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		f.writtenAfterClose = true
+	}
+	if f.failures > 0 {
+		f.failures--
+		return f.set(errors.New("unavailable"))
+	}
+	batch := make([]string, 0, len(events))
+	for _, ev := range events {
+		batch = append(batch, ev.Message)
+	}
+	f.batches = append(f.batches, batch)
+	return f.set(nil)
+}
+
+func (f *fakeSink) Flush(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flushed = true
+	return nil
+}
+
+func (f *fakeSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,50 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/yshaojie/log-collector/internal/event"
+)
+
+// Stdout writes every event as a JSON line to the agent's stdout.
+type Stdout struct {
+	health
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdout returns a sink writing to os.Stdout.
+func NewStdout() *Stdout {
+	return &Stdout{w: os.Stdout}
+}
+
+func (s *Stdout) Write(ctx context.Context, events []*event.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.set(writeJSONLines(s.w, events))
+}
+
+func (s *Stdout) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *Stdout) Close() error {
+	return nil
+}
+
+// writeJSONLines writes one JSON document per event.
+func writeJSONLines(w io.Writer, events []*event.Event) error {
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	for _, ev := range events {
+		if err := encoder.Encode(ev.Record()); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,46 @@
+package sink
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/yshaojie/log-collector/internal/event"
+)
+
+// TemplateFields are the fields the name templates of an output, such as
+// the Elasticsearch index or the Kafka topic, can use.
+type TemplateFields struct {
+	Namespace string
+	Pod       string
+	ServerLog string
+	Labels    map[string]string
+	// Date is the day of the event as yyyy.MM.dd.
+	Date string
+	Time time.Time
+}
+
+func parseNameTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template %q: %w", name, text, err)
+	}
+	return t, nil
+}
+
+// renderName renders t for ev.
+func renderName(t *template.Template, ev *event.Event) (string, error) {
+	var name strings.Builder
+	if err := t.Execute(&name, TemplateFields{
+		Namespace: ev.ServerLog.Namespace,
+		Pod:       ev.Pod,
+		ServerLog: ev.ServerLog.Name,
+		Labels:    ev.Labels,
+		Date:      ev.Time.UTC().Format("2006.01.02"),
+		Time:      ev.Time,
+	}); err != nil {
+		return "", fmt.Errorf("render %s name: %w", t.Name(), err)
+	}
+	return name.String(), nil
+}
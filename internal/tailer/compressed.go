@@ -0,0 +1,96 @@
+package tailer
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressedExts are the extensions of compressed rotated files, which are
+// never followed as text.
+var compressedExts = map[string]bool{
+	".gz":  true,
+	".zst": true,
+	".bz2": true,
+	".xz":  true,
+}
+
+// decompressors open the compressed rotated files ReadCompressed reads, by
+// extension. xz is not supported, it would need another dependency and
+// logrotate does not use it by default.
+var decompressors = map[string]func(r io.Reader) (io.ReadCloser, error){
+	".gz": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	".bz2": func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	},
+	".zst": func(r io.Reader) (io.ReadCloser, error) {
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	},
+}
+
+// IsCompressed reports whether name looks like a compressed rotated file.
+func IsCompressed(name string) bool {
+	return compressedExts[filepath.Ext(name)]
+}
+
+// CanDecompress reports whether ReadCompressed reads name.
+func CanDecompress(name string) bool {
+	_, ok := decompressors[filepath.Ext(name)]
+	return ok
+}
+
+// ReadCompressed reads a compressed rotated file once from the offset
+// returned by resume. Offsets are counted in uncompressed bytes. gzip, bzip2
+// and zstd are supported.
+func ReadCompressed(ctx context.Context, path string, resume ResumeFunc, handler Handler, opts Options) error {
+	decompress, ok := decompressors[filepath.Ext(path)]
+	if !ok {
+		return fmt.Errorf("unsupported compressed file %s", path)
+	}
+	t := New(path, resume, handler, opts)
+	f, err := t.opts.FS.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	t.id = fileIDOf(info)
+	if resume != nil {
+		pos := resume(t.id)
+		t.offset, t.generation = pos.Offset, pos.Generation
+	}
+	r, err := decompress(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if _, err := io.CopyN(io.Discard, r, t.offset); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	t.reader = r
+	if err := t.readToEOF(ctx); err != nil {
+		return err
+	}
+	if ctx.Err() == nil {
+		t.flushPending()
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package tailer
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compress writes data to path compressed as its extension says. There is
+// no bzip2 writer in the standard library, the bzip2 file is in testdata.
+func compress(t *testing.T, path, data string) {
+	t.Helper()
+	if filepath.Ext(path) == ".bz2" {
+		b, err := os.ReadFile(filepath.Join("testdata", "app.log.1.bz2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.WriteCloser
+	switch filepath.Ext(path) {
+	case ".gz":
+		w = gzip.NewWriter(f)
+	case ".zst":
+		if w, err = zstd.NewWriter(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadCompressed(t *testing.T) {
+	for _, name := range []string{"app.log.1.gz", "app.log.1.bz2", "app.log.1.zst"} {
+		path := filepath.Join(t.TempDir(), name)
+		compress(t, path, "one\ntwo\nthree")
+		if !IsCompressed(path) || !CanDecompress(path) {
+			t.Errorf("%s: not read as a compressed file", name)
+		}
+
+		c := &collector{}
+		resume := func(FileID) Position { return Position{Offset: int64(len("one\n"))} }
+		if err := ReadCompressed(context.Background(), path, resume, c.handle, Options{}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, want := c.texts(), []string{"two", "three"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got lines %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestReadCompressedUnsupported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log.1.xz")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !IsCompressed(path) || CanDecompress(path) {
+		t.Error("xz files are compressed but cannot be read")
+	}
+	c := &collector{}
+	if err := ReadCompressed(context.Background(), path, nil, c.handle, Options{}); err == nil {
+		t.Fatal("expected an error for xz files")
+	}
+}
@@ -0,0 +1,31 @@
+package tailer
+
+import (
+	"fmt"
+	"os"
+)
+
+// FileID identifies a file independently of its path, so a renamed file is
+// still recognised and a new file at an old path is not.
+type FileID struct {
+	Device uint64 `json:"device"`
+	Inode  uint64 `json:"inode"`
+}
+
+func (id FileID) String() string {
+	return fmt.Sprintf("%d:%d", id.Device, id.Inode)
+}
+
+// StatFileID returns the FileID of the file at path.
+func StatFileID(path string) (FileID, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileID{}, err
+	}
+	return fileIDOf(info), nil
+}
+
+// FileIDOf returns the FileID of the file info describes.
+func FileIDOf(info os.FileInfo) FileID {
+	return fileIDOf(info)
+}
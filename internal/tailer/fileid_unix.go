@@ -0,0 +1,16 @@
+//go:build !windows
+
+package tailer
+
+import (
+	"os"
+	"syscall"
+)
+
+func fileIDOf(info os.FileInfo) FileID {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return FileID{}
+	}
+	return FileID{Device: uint64(st.Dev), Inode: uint64(st.Ino)}
+}
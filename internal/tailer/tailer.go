@@ -0,0 +1,375 @@
+package tailer
+
+import (
+	"bytes"
+	"context"
+	"hash/fnv"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultPollInterval = 250 * time.Millisecond
+	defaultMaxLineBytes = 1024 * 1024
+	readBufferSize      = 32 * 1024
+	// headBytes is how much of the start of a file its Head covers.
+	headBytes = 1024
+)
+
+// Line is a single line read from a followed file.
+type Line struct {
+	// Path is the file the line was read from.
+	Path string
+	// Text is the line without the trailing newline.
+	Text string
+	// File identifies the file the line was read from.
+	File FileID
+	// Offset is the byte offset just past the line.
+	Offset int64
+	// Generation counts the truncations of the file before the line was
+	// read. A truncated file is written again at the same offsets, File,
+	// Generation and Offset still identify the line.
+	Generation uint64
+	// Head fingerprints the start of the file when the line was read.
+	Head Head
+	// Time is when the line was written, zero unless the file records it,
+	// like the log files of the container runtime.
+	Time time.Time
+	// Stream is stdout or stderr for the output of a container.
+	Stream string
+}
+
+// Handler receives every line read by a Tailer. It is called from the
+// tailer goroutine, so a slow handler slows down reading.
+type Handler func(line Line)
+
+// Head fingerprints the first bytes of a file. A file truncated and written
+// again past the old offset has the same size and identity, but another
+// start.
+type Head struct {
+	// Size is how many bytes are hashed, up to headBytes.
+	Size int64
+	Hash uint64
+}
+
+// Position is where reading a file stopped, usually taken from a checkpoint.
+type Position struct {
+	// Offset is the byte offset to continue reading at.
+	Offset int64
+	// Generation counts the truncations of the file seen so far.
+	Generation uint64
+	// Head is the start of the file when it was read, zero if unknown.
+	Head Head
+}
+
+// ResumeFunc returns the position to start reading a file at. It is called
+// every time the tailer opens the file.
+type ResumeFunc func(id FileID) Position
+
+// FS opens the files followed by a Tailer.
+type FS interface {
+	Open(path string) (*os.File, error)
+	Stat(path string) (os.FileInfo, error)
+}
+
+// osFS opens the files of the agent container.
+type osFS struct{}
+
+func (osFS) Open(path string) (*os.File, error)    { return os.Open(path) }
+func (osFS) Stat(path string) (os.FileInfo, error) { return os.Stat(path) }
+
+// Options configures a Tailer.
+type Options struct {
+	// PollInterval is how long to wait after reaching EOF before reading again.
+	PollInterval time.Duration
+	// MaxLineBytes cuts lines longer than this into several lines.
+	MaxLineBytes int
+	// FS opens the file, the files of the agent container when nil. The
+	// collector opens the files of Pod volumes without following symlinks.
+	FS FS
+}
+
+func (o *Options) complete() {
+	if o.FS == nil {
+		o.FS = osFS{}
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = defaultPollInterval
+	}
+	if o.MaxLineBytes <= 0 {
+		o.MaxLineBytes = defaultMaxLineBytes
+	}
+}
+
+// Tailer follows a single path and hands every complete line to a Handler.
+//
+// Rotation is handled the way logrotate does it: when the path is renamed
+// away and recreated ("create" mode) the old file is read to the end before
+// the new one is opened, and when the file shrinks below the read position
+// or its first bytes change ("copytruncate" mode) reading restarts at the
+// beginning.
+type Tailer struct {
+	path    string
+	resume  ResumeFunc
+	handler Handler
+	opts    Options
+
+	file       *os.File
+	reader     io.Reader
+	offset     int64
+	generation uint64
+	head       Head
+	pending    []byte
+	// size and modTime are the size and mtime of the file at the last check.
+	size    int64
+	modTime time.Time
+
+	mu sync.Mutex
+	id FileID
+
+	drain     chan struct{}
+	drainOnce sync.Once
+}
+
+// New returns a Tailer for path. Reading starts at the offset returned by
+// resume, or at the beginning of the file if resume is nil.
+func New(path string, resume ResumeFunc, handler Handler, opts Options) *Tailer {
+	opts.complete()
+	return &Tailer{
+		path:    path,
+		resume:  resume,
+		handler: handler,
+		opts:    opts,
+		drain:   make(chan struct{}),
+	}
+}
+
+// Path returns the path followed by the tailer.
+func (t *Tailer) Path() string {
+	return t.path
+}
+
+// FileID returns the identity of the file currently being read.
+func (t *Tailer) FileID() FileID {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.id
+}
+
+// Drain makes Run read the file to the end, hand out a last line without
+// trailing newline and return. It is used once the file is not written
+// anymore.
+func (t *Tailer) Drain() {
+	t.drainOnce.Do(func() { close(t.drain) })
+}
+
+// Run reads the file until ctx is cancelled or it is drained.
+func (t *Tailer) Run(ctx context.Context) error {
+	if err := t.open(); err != nil {
+		return err
+	}
+	defer func() {
+		t.file.Close()
+	}()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.drain:
+			if err := t.readToEOF(ctx); err != nil {
+				return err
+			}
+			if ctx.Err() == nil {
+				t.flushPending()
+			}
+			return nil
+		case <-timer.C:
+		}
+		if err := t.readToEOF(ctx); err != nil {
+			return err
+		}
+		if err := t.checkRotation(ctx); err != nil {
+			return err
+		}
+		timer.Reset(t.opts.PollInterval)
+	}
+}
+
+func (t *Tailer) open() error {
+	f, err := t.opts.FS.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	id := fileIDOf(info)
+	var pos Position
+	if t.resume != nil {
+		pos = t.resume(id)
+	}
+	t.offset, t.generation = pos.Offset, pos.Generation
+	//文件比记录的位置还短或开头变了，说明被截断过，从头开始读
+	truncated := t.offset > info.Size()
+	if !truncated && pos.Head.Size > 0 {
+		head, err := headOf(f, pos.Head.Size)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		truncated = head != pos.Head
+	}
+	if truncated {
+		t.offset = 0
+		t.generation++
+	}
+	if t.head, err = headOf(f, headBytes); err != nil {
+		f.Close()
+		return err
+	}
+	t.size, t.modTime = info.Size(), info.ModTime()
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	t.file = f
+	t.reader = f
+	t.pending = t.pending[:0]
+	t.mu.Lock()
+	t.id = id
+	t.mu.Unlock()
+	return nil
+}
+
+// checkRotation compares the open file with what is at the path now.
+func (t *Tailer) checkRotation(ctx context.Context) error {
+	info, err := t.opts.FS.Stat(t.path)
+	if os.IsNotExist(err) {
+		//旧文件已被重命名，新文件还没创建，继续读旧文件
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if id := fileIDOf(info); id != t.FileID() {
+		//logrotate create模式：先读完旧文件，再切换到新文件
+		if err := t.readToEOF(ctx); err != nil {
+			return err
+		}
+		t.flushPending()
+		klog.V(2).Info("file rotated, path=", t.path, " old=", t.FileID(), " new=", id)
+		t.file.Close()
+		return t.open()
+	}
+
+	if info.Size() == t.size && info.ModTime().Equal(t.modTime) {
+		return nil
+	}
+	t.size, t.modTime = info.Size(), info.ModTime()
+	//logrotate copytruncate模式：文件被截断，写入的内容可能已经超过原来的位置，
+	//所以还要比较文件开头
+	truncated := info.Size() < t.offset+int64(len(t.pending))
+	if !truncated && t.head.Size > 0 {
+		head, err := headOf(t.file, t.head.Size)
+		if err != nil {
+			return err
+		}
+		truncated = head != t.head
+	}
+	if truncated {
+		klog.V(2).Info("file truncated, path=", t.path, " size=", info.Size(), " offset=", t.offset)
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		t.offset = 0
+		t.generation++
+		t.pending = t.pending[:0]
+	}
+	if t.head.Size < headBytes {
+		head, err := headOf(t.file, headBytes)
+		if err != nil {
+			return err
+		}
+		t.head = head
+	}
+	return nil
+}
+
+// headOf returns the Head of the first size bytes of f, of all of it when
+// it is shorter.
+func headOf(f *os.File, size int64) (Head, error) {
+	buf := make([]byte, size)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return Head{}, err
+	}
+	h := fnv.New64a()
+	h.Write(buf[:n])
+	return Head{Size: int64(n), Hash: h.Sum64()}, nil
+}
+
+// readToEOF hands out every complete line currently in the file.
+func (t *Tailer) readToEOF(ctx context.Context) error {
+	buf := make([]byte, readBufferSize)
+	for ctx.Err() == nil {
+		n, err := t.reader.Read(buf)
+		if n > 0 {
+			t.pending = append(t.pending, buf[:n]...)
+			t.emitLines()
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Tailer) emitLines() {
+	for {
+		i := bytes.IndexByte(t.pending, '\n')
+		if i < 0 {
+			if len(t.pending) >= t.opts.MaxLineBytes {
+				t.emit(t.opts.MaxLineBytes, t.opts.MaxLineBytes)
+				continue
+			}
+			return
+		}
+		if i > t.opts.MaxLineBytes {
+			t.emit(t.opts.MaxLineBytes, t.opts.MaxLineBytes)
+			continue
+		}
+		t.emit(i, i+1)
+	}
+}
+
+// flushPending hands out a last line that has no trailing newline. It is
+// only used once a file will not be written anymore.
+func (t *Tailer) flushPending() {
+	if len(t.pending) > 0 {
+		t.emit(len(t.pending), len(t.pending))
+	}
+}
+
+// emit hands out pending[:end] and drops consumed bytes from pending.
+func (t *Tailer) emit(end, consumed int) {
+	text := t.pending[:end]
+	if len(text) > 0 && text[len(text)-1] == '\r' {
+		text = text[:len(text)-1]
+	}
+	t.offset += int64(consumed)
+	t.handler(Line{Path: t.path, Text: string(text), File: t.id, Offset: t.offset, Generation: t.generation, Head: t.head})
+	t.pending = append(t.pending[:0], t.pending[consumed:]...)
+}
@@ -0,0 +1,275 @@
+package tailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector records the lines handed out by a tailer.
+type collector struct {
+	mu    sync.Mutex
+	lines []Line
+}
+
+func (c *collector) handle(line Line) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lines = append(c.lines, line)
+}
+
+func (c *collector) texts() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	texts := make([]string, 0, len(c.lines))
+	for _, line := range c.lines {
+		texts = append(texts, line.Text)
+	}
+	return texts
+}
+
+func (c *collector) waitFor(t *testing.T, want []string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if reflect.DeepEqual(c.texts(), want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("got lines %q, want %q", c.texts(), want)
+}
+
+func startTailer(t *testing.T, path string, resume ResumeFunc) *collector {
+	t.Helper()
+	c := &collector{}
+	tailer := New(path, resume, c.handle, Options{PollInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- tailer.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("tailer returned %v", err)
+		}
+	})
+	return c
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTailerFollowsAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "one\ntw")
+	c := startTailer(t, path, nil)
+	c.waitFor(t, []string{"one"})
+
+	appendFile(t, path, "o\r\nthree\n")
+	c.waitFor(t, []string{"one", "two", "three"})
+}
+
+func TestTailerResumesFromOffset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "one\ntwo\nthree\n")
+	id, err := StatFileID(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := startTailer(t, path, func(got FileID) Position {
+		if got != id {
+			return Position{}
+		}
+		return Position{Offset: int64(len("one\n")), Generation: 2}
+	})
+	c.waitFor(t, []string{"two", "three"})
+
+	c.mu.Lock()
+	last := c.lines[len(c.lines)-1]
+	c.mu.Unlock()
+	if last.Offset != int64(len("one\ntwo\nthree\n")) || last.File != id || last.Generation != 2 {
+		t.Fatalf("unexpected last line %+v", last)
+	}
+}
+
+// TestTailerRenameRotation covers logrotate "create" mode: the file is
+// renamed, still written through the old descriptor and then recreated.
+func TestTailerRenameRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "before-1\n")
+	c := startTailer(t, path, nil)
+	c.waitFor(t, []string{"before-1"})
+
+	old, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	if err := os.Rename(path, filepath.Join(dir, "app.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.WriteString("before-2\nunterminated"); err != nil {
+		t.Fatal(err)
+	}
+	c.waitFor(t, []string{"before-1", "before-2"})
+
+	appendFile(t, path, "after-1\n")
+	c.waitFor(t, []string{"before-1", "before-2", "unterminated", "after-1"})
+}
+
+// TestTailerCopyTruncateRotation covers logrotate "copytruncate" mode.
+func TestTailerCopyTruncateRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "before-1\nbefore-2\n")
+	c := startTailer(t, path, nil)
+	c.waitFor(t, []string{"before-1", "before-2"})
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	// give the tailer a chance to notice the truncation before new data
+	// grows the file past the old offset again
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, path, "after-1\n")
+	c.waitFor(t, []string{"before-1", "before-2", "after-1"})
+	//截断后的行偏移量会重复，代数区分它们
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lines[0].Generation != 0 || c.lines[2].Generation != 1 {
+		t.Errorf("generations %d and %d, want 0 and 1", c.lines[0].Generation, c.lines[2].Generation)
+	}
+}
+
+// TestTailerCopyTruncateRefilled covers a truncation the tailer only sees
+// after the file grew past the old offset again.
+func TestTailerCopyTruncateRefilled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "before-1\n")
+	c := &collector{}
+	tailer := New(path, nil, c.handle, Options{})
+	if err := tailer.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer tailer.file.Close()
+	ctx := context.Background()
+	if err := tailer.readToEOF(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("after-1\nafter-2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := tailer.checkRotation(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tailer.readToEOF(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c.waitFor(t, []string{"before-1", "after-1", "after-2"})
+	if c.lines[1].Generation != 1 {
+		t.Errorf("generation %d, want 1", c.lines[1].Generation)
+	}
+}
+
+func TestTailerResumeChangedHead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "before-1\n")
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := headOf(f, headBytes)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the file was truncated and refilled while the agent was down
+	if err := os.WriteFile(path, []byte("after-1\nafter-2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := startTailer(t, path, func(FileID) Position {
+		return Position{Offset: int64(len("before-1\n")), Generation: 1, Head: head}
+	})
+	c.waitFor(t, []string{"after-1", "after-2"})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lines[0].Generation != 2 {
+		t.Errorf("generation %d, want 2", c.lines[0].Generation)
+	}
+}
+
+func TestTailerDrain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &collector{}
+	// a long poll interval, only Drain reads the lines written later
+	tailer := New(path, nil, c.handle, Options{PollInterval: time.Hour})
+	done := make(chan error, 1)
+	go func() { done <- tailer.Run(context.Background()) }()
+	c.waitFor(t, []string{"one"})
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("two\nunterminated")
+	f.Close()
+	tailer.Drain()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tailer did not return")
+	}
+	c.waitFor(t, []string{"one", "two", "unterminated"})
+}
+
+func TestTailerMaxLineBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "abcdefghij\nshort\nklmnop")
+	c := &collector{}
+	tailer := New(path, nil, c.handle, Options{PollInterval: 10 * time.Millisecond, MaxLineBytes: 4})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tailer.Run(ctx)
+	// a long line without newline is cut as well
+	c.waitFor(t, []string{"abcd", "efgh", "ij", "shor", "t", "klmn"})
+}
+
+func TestTailerResumeBeyondSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "one\n")
+	// the file was truncated while the agent was down
+	c := startTailer(t, path, func(FileID) Position { return Position{Offset: 100, Generation: 1} })
+	c.waitFor(t, []string{"one"})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lines[0].Generation != 2 {
+		t.Errorf("generation %d, want 2", c.lines[0].Generation)
+	}
+}
+
+func TestTailerMissingFile(t *testing.T) {
+	tailer := New(filepath.Join(t.TempDir(), "app.log"), nil, func(Line) {}, Options{})
+	if err := tailer.Run(context.Background()); !os.IsNotExist(err) {
+		t.Errorf("error %v, want not exist", err)
+	}
+}
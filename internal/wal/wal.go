@@ -0,0 +1,701 @@
+// Package wal is the disk buffer between the collectors and the outputs of
+// the agent. Events are appended to segment files and every output reads
+// them back through its own cursor, so a sink that is down only holds back
+// its own events while the files keep being read.
+package wal
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yshaojie/log-collector/internal/atomicfile"
+	"github.com/yshaojie/log-collector/internal/event"
+	"github.com/yshaojie/log-collector/internal/metrics"
+	"k8s.io/klog/v2"
+)
+
+// OverflowPolicy decides what Append does when the buffer is full.
+type OverflowPolicy string
+
+const (
+	// Block makes Append wait until the slowest output caught up, reading
+	// stops until then.
+	Block OverflowPolicy = "block"
+	// DropOldest drops the oldest segment, with the events the outputs did
+	// not read yet.
+	DropOldest OverflowPolicy = "drop-oldest"
+	// DropNewest drops the appended event.
+	DropNewest OverflowPolicy = "drop-newest"
+)
+
+const (
+	defaultMaxSize     = 1 << 30
+	defaultSegmentSize = 16 << 20
+
+	segmentSuffix = ".seg"
+	cursorFile    = "cursors.json"
+	// a record is the payload length, the CRC of output and payload, the
+	// output length, the output name and the JSON encoded event.
+	headerSize = 10
+	// maxScanBytes bounds what a Read looks at, reads of one output do not
+	// hold back appends for long when it is far behind.
+	maxScanBytes = 4 << 20
+)
+
+var (
+	// ErrClosed is returned by Append once the WAL is closed.
+	ErrClosed = errors.New("wal is closed")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// Options configures a WAL.
+type Options struct {
+	// Dir holds the segments and the cursors.
+	Dir string
+	// MaxSize caps the size of all segments together.
+	MaxSize int64
+	// SegmentSize is the size at which a new segment is started.
+	SegmentSize int64
+	// Policy is what happens to events appended while the WAL is full.
+	Policy OverflowPolicy
+}
+
+func (o *Options) complete() {
+	if o.MaxSize <= 0 {
+		o.MaxSize = defaultMaxSize
+	}
+	if o.SegmentSize <= 0 {
+		o.SegmentSize = defaultSegmentSize
+	}
+	//至少保留两个segment，drop-oldest才有可删除的
+	if o.SegmentSize > o.MaxSize/2 {
+		o.SegmentSize = o.MaxSize / 2
+	}
+	if o.Policy == "" {
+		o.Policy = Block
+	}
+}
+
+// ParseOverflowPolicy returns the policy named s.
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(s); p {
+	case Block, DropOldest, DropNewest:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown overflow policy %q, use %s, %s or %s", s, Block, DropOldest, DropNewest)
+}
+
+// Position is a place in the WAL, Offset bytes into segment Segment.
+type Position struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+func (p Position) less(q Position) bool {
+	if p.Segment != q.Segment {
+		return p.Segment < q.Segment
+	}
+	return p.Offset < q.Offset
+}
+
+type segment struct {
+	id   uint64
+	file *os.File
+	size int64
+}
+
+// WAL is a size capped queue of events on disk with a cursor per output.
+// Appended events are not durable until Sync returns them.
+type WAL struct {
+	opts Options
+
+	mu sync.RWMutex
+	// segments are ordered by id, the last one is written.
+	segments []*segment
+	size     int64
+	cursors  map[string]*Cursor
+	dirty    bool
+	// unsynced are the events appended or dropped since the last Sync.
+	unsynced []*event.Event
+	// space is closed when segments were removed.
+	space  chan struct{}
+	closed bool
+
+	syncMu sync.Mutex
+}
+
+// Open opens the WAL in opts.Dir, creating it when it does not exist. The
+// last segment is cut after its last complete record, a crash may have
+// left a partial one.
+func Open(opts Options) (*WAL, error) {
+	opts.complete()
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	w := &WAL{
+		opts:    opts,
+		cursors: map[string]*Cursor{},
+		space:   make(chan struct{}),
+	}
+	ids, err := segmentIDs(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		seg, err := w.openSegment(id)
+		if err != nil {
+			w.closeSegments()
+			return nil, err
+		}
+		w.segments = append(w.segments, seg)
+		w.size += seg.size
+	}
+	if len(w.segments) == 0 {
+		seg, err := w.openSegment(1)
+		if err != nil {
+			return nil, err
+		}
+		w.segments = append(w.segments, seg)
+	} else if err := w.repair(w.active()); err != nil {
+		w.closeSegments()
+		return nil, err
+	}
+	if err := w.loadCursors(); err != nil {
+		w.closeSegments()
+		return nil, err
+	}
+	metrics.BufferSize.Set(float64(w.size))
+	klog.Info("opened buffer, dir=", opts.Dir, " segments=", len(w.segments), " size=", w.size, " cursors=", len(w.cursors))
+	return w, nil
+}
+
+func segmentIDs(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (w *WAL) segmentPath(id uint64) string {
+	return filepath.Join(w.opts.Dir, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
+
+func (w *WAL) openSegment(id uint64) (*segment, error) {
+	f, err := os.OpenFile(w.segmentPath(id), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &segment{id: id, file: f, size: info.Size()}, nil
+}
+
+// repair truncates seg after its last valid record.
+func (w *WAL) repair(seg *segment) error {
+	var offset int64
+	for offset < seg.size {
+		_, _, next, err := readRecord(seg.file, offset, seg.size, true)
+		if err != nil {
+			klog.Error("truncate partial buffer segment, segment=", seg.id, " offset=", offset, " size=", seg.size, " err=", err)
+			if err := seg.file.Truncate(offset); err != nil {
+				return err
+			}
+			w.size -= seg.size - offset
+			seg.size = offset
+			break
+		}
+		offset = next
+	}
+	return nil
+}
+
+func (w *WAL) active() *segment {
+	return w.segments[len(w.segments)-1]
+}
+
+func (w *WAL) end() Position {
+	active := w.active()
+	return Position{Segment: active.id, Offset: active.size}
+}
+
+func (w *WAL) closeSegments() {
+	for _, seg := range w.segments {
+		seg.file.Close()
+	}
+}
+
+// encode returns the record of ev for output.
+func encode(output string, ev *event.Event) ([]byte, error) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	rec := make([]byte, headerSize+len(output)+len(payload))
+	binary.BigEndian.PutUint32(rec[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint16(rec[8:10], uint16(len(output)))
+	copy(rec[headerSize:], output)
+	copy(rec[headerSize+len(output):], payload)
+	binary.BigEndian.PutUint32(rec[4:8], crc32.Checksum(rec[headerSize:], crcTable))
+	return rec, nil
+}
+
+// readRecord reads the record at offset of r, which holds size bytes, and
+// returns the offset of the next record. The payload is only read and its
+// checksum verified when withPayload is set.
+func readRecord(r io.ReaderAt, offset, size int64, withPayload bool) (output string, payload []byte, next int64, err error) {
+	if size-offset < headerSize {
+		return "", nil, 0, io.ErrUnexpectedEOF
+	}
+	var header [headerSize]byte
+	if _, err := r.ReadAt(header[:], offset); err != nil {
+		return "", nil, 0, err
+	}
+	payloadLen := int64(binary.BigEndian.Uint32(header[0:4]))
+	sum := binary.BigEndian.Uint32(header[4:8])
+	outputLen := int64(binary.BigEndian.Uint16(header[8:10]))
+	next = offset + headerSize + outputLen + payloadLen
+	if next > size {
+		return "", nil, 0, io.ErrUnexpectedEOF
+	}
+	if !withPayload {
+		name := make([]byte, outputLen)
+		if _, err := r.ReadAt(name, offset+headerSize); err != nil {
+			return "", nil, 0, err
+		}
+		return string(name), nil, next, nil
+	}
+	body := make([]byte, outputLen+payloadLen)
+	if _, err := r.ReadAt(body, offset+headerSize); err != nil {
+		return "", nil, 0, err
+	}
+	if crc32.Checksum(body, crcTable) != sum {
+		return "", nil, 0, fmt.Errorf("checksum mismatch")
+	}
+	return string(body[:outputLen]), body[outputLen:], next, nil
+}
+
+// Append adds ev for output. When the WAL is full it waits for space, drops
+// the oldest segment or drops ev, depending on the policy; a dropped event
+// is returned by Sync like a stored one so its file moves on. It returns
+// ctx.Err() when ctx is done while waiting.
+func (w *WAL) Append(ctx context.Context, output string, ev *event.Event) error {
+	rec, err := encode(output, ev)
+	if err != nil {
+		return err
+	}
+	size := int64(len(rec))
+	for {
+		w.mu.Lock()
+		if w.closed {
+			w.mu.Unlock()
+			return ErrClosed
+		}
+		if w.size+size <= w.opts.MaxSize || size > w.opts.MaxSize {
+			break
+		}
+		//先删除所有cursor都已读完的segment
+		if err := w.collect(); err != nil {
+			w.mu.Unlock()
+			return err
+		}
+		if w.size+size <= w.opts.MaxSize {
+			break
+		}
+		switch w.opts.Policy {
+		case DropNewest:
+			w.unsynced = append(w.unsynced, ev)
+			w.mu.Unlock()
+			metrics.DroppedEvents.WithLabelValues(output).Inc()
+			return nil
+		case DropOldest:
+			err := w.dropOldest()
+			w.mu.Unlock()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		space := w.space
+		w.mu.Unlock()
+		select {
+		case <-space:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	defer w.mu.Unlock()
+	if active := w.active(); active.size > 0 && active.size+size > w.opts.SegmentSize {
+		if err := w.roll(); err != nil {
+			return err
+		}
+	}
+	active := w.active()
+	if _, err := active.file.WriteAt(rec, active.size); err != nil {
+		return err
+	}
+	active.size += size
+	w.size += size
+	w.unsynced = append(w.unsynced, ev)
+	metrics.BufferSize.Set(float64(w.size))
+	return nil
+}
+
+// roll syncs the active segment and starts a new one, w.mu must be held.
+func (w *WAL) roll() error {
+	active := w.active()
+	if err := active.file.Sync(); err != nil {
+		return err
+	}
+	seg, err := w.openSegment(active.id + 1)
+	if err != nil {
+		return err
+	}
+	w.segments = append(w.segments, seg)
+	return nil
+}
+
+// dropOldest removes the oldest segment, moving the cursors still in it to
+// the next one. w.mu must be held.
+func (w *WAL) dropOldest() error {
+	if len(w.segments) == 1 {
+		if w.active().size == 0 {
+			return nil
+		}
+		if err := w.roll(); err != nil {
+			return err
+		}
+	}
+	oldest := w.segments[0]
+	next := Position{Segment: w.segments[1].id}
+	for _, c := range w.cursors {
+		if c.pos.Segment > oldest.id {
+			continue
+		}
+		if dropped := countRecords(oldest, c.name, c.pos.Offset); dropped > 0 {
+			metrics.DroppedEvents.WithLabelValues(c.name).Add(float64(dropped))
+			klog.Error("buffer is full, dropped oldest events, output=", c.name, " events=", dropped)
+		}
+		c.pos = next
+		w.dirty = true
+	}
+	return w.removeSegments(1)
+}
+
+// countRecords counts the records of output in seg from offset on.
+func countRecords(seg *segment, output string, offset int64) int {
+	count := 0
+	for offset < seg.size {
+		name, _, next, err := readRecord(seg.file, offset, seg.size, false)
+		if err != nil {
+			break
+		}
+		if name == output {
+			count++
+		}
+		offset = next
+	}
+	return count
+}
+
+// removeSegments removes the n oldest segments, w.mu must be held.
+func (w *WAL) removeSegments(n int) error {
+	if n == 0 {
+		return nil
+	}
+	for _, seg := range w.segments[:n] {
+		seg.file.Close()
+		if err := os.Remove(w.segmentPath(seg.id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		w.size -= seg.size
+	}
+	w.segments = append([]*segment(nil), w.segments[n:]...)
+	metrics.BufferSize.Set(float64(w.size))
+	close(w.space)
+	w.space = make(chan struct{})
+	return nil
+}
+
+// collect removes the segments every cursor is done with, w.mu must be
+// held.
+func (w *WAL) collect() error {
+	min := w.end()
+	for _, c := range w.cursors {
+		if c.pos.less(min) {
+			min = c.pos
+		}
+	}
+	n := 0
+	for n < len(w.segments)-1 && w.segments[n].id < min.Segment {
+		n++
+	}
+	return w.removeSegments(n)
+}
+
+// Sync makes the appended events durable and saves the cursors. It returns
+// the events appended or dropped since the last Sync, in order; their read
+// offsets may be checkpointed now.
+func (w *WAL) Sync() ([]*event.Event, error) {
+	w.syncMu.Lock()
+	defer w.syncMu.Unlock()
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil, nil
+	}
+	if err := w.active().file.Sync(); err != nil {
+		w.mu.Unlock()
+		return nil, err
+	}
+	events := w.unsynced
+	w.unsynced = nil
+	var data []byte
+	var err error
+	if w.dirty {
+		data, err = w.marshalCursors()
+		w.dirty = false
+	}
+	w.mu.Unlock()
+	if err != nil {
+		return events, err
+	}
+	if data != nil {
+		if err := atomicfile.Write(filepath.Join(w.opts.Dir, cursorFile), data); err != nil {
+			w.mu.Lock()
+			w.dirty = true
+			w.mu.Unlock()
+			return events, err
+		}
+	}
+	return events, nil
+}
+
+// Close syncs the WAL and closes its files. The events returned by the last
+// Sync are lost, call Sync first.
+func (w *WAL) Close() error {
+	if _, err := w.Sync(); err != nil {
+		klog.Error("sync buffer failed, dir=", w.opts.Dir, " err=", err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.closeSegments()
+	close(w.space)
+	return nil
+}
+
+func (w *WAL) marshalCursors() ([]byte, error) {
+	positions := make(map[string]Position, len(w.cursors))
+	for name, c := range w.cursors {
+		positions[name] = c.pos
+	}
+	return json.Marshal(positions)
+}
+
+// loadCursors reads the saved cursors and moves those pointing at removed
+// or cut segments to the nearest record.
+func (w *WAL) loadCursors() error {
+	data, err := os.ReadFile(filepath.Join(w.opts.Dir, cursorFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var positions map[string]Position
+	if err := json.Unmarshal(data, &positions); err != nil {
+		return fmt.Errorf("decode buffer cursors: %w", err)
+	}
+	first := Position{Segment: w.segments[0].id}
+	end := w.end()
+	for name, pos := range positions {
+		switch {
+		case pos.less(first):
+			pos = first
+		case end.less(pos):
+			pos = end
+		}
+		w.cursors[name] = &Cursor{w: w, name: name, pos: pos}
+	}
+	return nil
+}
+
+// Cursor returns the cursor of output. A new cursor starts at the end of
+// the WAL, a saved one where it was committed last.
+func (w *WAL) Cursor(output string) *Cursor {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c, ok := w.cursors[output]
+	if !ok {
+		c = &Cursor{w: w, name: output, pos: w.end()}
+		w.cursors[output] = c
+		w.dirty = true
+	}
+	return c
+}
+
+// Cursors returns the names of the outputs with a cursor.
+func (w *WAL) Cursors() []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	names := make([]string, 0, len(w.cursors))
+	for name := range w.cursors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RemoveCursor drops the cursor of an output that is gone, the events it
+// did not read are dropped with it.
+func (w *WAL) RemoveCursor(output string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.cursors[output]; !ok || w.closed {
+		return nil
+	}
+	delete(w.cursors, output)
+	w.dirty = true
+	return w.collect()
+}
+
+// Cursor reads the events of one output. It is used by one goroutine.
+type Cursor struct {
+	w    *WAL
+	name string
+	// pos is the position after the last committed record, guarded by w.mu.
+	pos Position
+}
+
+// Read returns up to max events of the output after the committed
+// position, and the position after the last record it looked at. more is
+// set when it stopped before the end of the WAL.
+func (c *Cursor) Read(max int) (events []*event.Event, pos Position, more bool, err error) {
+	w := c.w
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return nil, c.pos, false, ErrClosed
+	}
+	pos = c.pos
+	var scanned int64
+	for _, seg := range w.segments {
+		if seg.id < pos.Segment {
+			continue
+		}
+		if seg.id > pos.Segment {
+			pos = Position{Segment: seg.id}
+		}
+		for pos.Offset < seg.size {
+			if len(events) >= max || scanned >= maxScanBytes {
+				return events, pos, true, nil
+			}
+			name, _, next, err := readRecord(seg.file, pos.Offset, seg.size, false)
+			if err != nil {
+				return events, pos, false, err
+			}
+			if name == c.name {
+				_, payload, _, err := readRecord(seg.file, pos.Offset, seg.size, true)
+				if err != nil {
+					//损坏的记录无法恢复，跳过
+					klog.Error("skip corrupt buffer record, output=", c.name, " segment=", seg.id, " offset=", pos.Offset, " err=", err)
+				} else {
+					ev := &event.Event{}
+					if err := json.Unmarshal(payload, ev); err != nil {
+						klog.Error("skip undecodable buffer record, output=", c.name, " segment=", seg.id, " offset=", pos.Offset, " err=", err)
+					} else {
+						events = append(events, ev)
+					}
+				}
+			}
+			scanned += next - pos.Offset
+			pos.Offset = next
+		}
+	}
+	return events, pos, false, nil
+}
+
+// Commit records that the events read up to pos were delivered. Segments
+// no cursor needs anymore are removed.
+func (c *Cursor) Commit(pos Position) error {
+	w := c.w
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	//drop-oldest可能已经把cursor移到了后面
+	if !c.pos.less(pos) {
+		return nil
+	}
+	c.pos = pos
+	w.dirty = true
+	return w.collect()
+}
+
+// Pending reports whether events of the output may be left after the
+// committed position. It gives up, returning true, when that takes long to
+// find out.
+func (c *Cursor) Pending() bool {
+	w := c.w
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	pos := c.pos
+	var scanned int64
+	for _, seg := range w.segments {
+		if seg.id < pos.Segment {
+			continue
+		}
+		if seg.id > pos.Segment {
+			pos = Position{Segment: seg.id}
+		}
+		for pos.Offset < seg.size {
+			if scanned >= maxScanBytes {
+				return true
+			}
+			name, _, next, err := readRecord(seg.file, pos.Offset, seg.size, false)
+			if err != nil {
+				return false
+			}
+			if name == c.name {
+				return true
+			}
+			scanned += next - pos.Offset
+			pos.Offset = next
+		}
+	}
+	return false
+}
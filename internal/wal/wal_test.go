@@ -0,0 +1,228 @@
+package wal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yshaojie/log-collector/internal/event"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newEvent(msg string, offset int64) *event.Event {
+	return &event.Event{
+		ServerLog: types.NamespacedName{Namespace: "default", Name: "web-0"},
+		Path:      "/data/log/app.log",
+		Offset:    offset,
+		Time:      time.Unix(0, 0).UTC(),
+		Message:   msg,
+	}
+}
+
+func appendAll(t *testing.T, w *WAL, output string, messages ...string) {
+	t.Helper()
+	for i, msg := range messages {
+		if err := w.Append(context.Background(), output, newEvent(msg, int64(i+1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func messages(events []*event.Event) []string {
+	var msgs []string
+	for _, ev := range events {
+		msgs = append(msgs, ev.Message)
+	}
+	return msgs
+}
+
+// readAll reads and commits what is left for c.
+func readAll(t *testing.T, c *Cursor) []string {
+	t.Helper()
+	var msgs []string
+	for {
+		events, pos, more, err := c.Read(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, messages(events)...)
+		if err := c.Commit(pos); err != nil {
+			t.Fatal(err)
+		}
+		if !more {
+			return msgs
+		}
+	}
+}
+
+func TestCursorsAreIndependent(t *testing.T) {
+	w, err := Open(Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	a, b := w.Cursor("a"), w.Cursor("b")
+	appendAll(t, w, "a", "a1", "a2", "a3")
+	appendAll(t, w, "b", "b1")
+
+	if got := readAll(t, a); !reflect.DeepEqual(got, []string{"a1", "a2", "a3"}) {
+		t.Errorf("cursor a read %q", got)
+	}
+	if a.Pending() {
+		t.Error("cursor a read everything")
+	}
+	if !b.Pending() {
+		t.Error("cursor b has events left")
+	}
+	events, _, _, err := b.Read(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messages(events); !reflect.DeepEqual(got, []string{"b1"}) {
+		t.Errorf("cursor b read %q", got)
+	}
+	// b did not commit, it reads the event again
+	if got := readAll(t, b); !reflect.DeepEqual(got, []string{"b1"}) {
+		t.Errorf("cursor b read %q after no commit", got)
+	}
+
+	synced, err := w.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(synced) != 4 {
+		t.Errorf("sync returned %d events, want 4", len(synced))
+	}
+}
+
+func TestReopenReplaysUncommitted(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := w.Cursor("out")
+	appendAll(t, w, "out", "a", "b", "c")
+	events, pos, _, err := c.Read(1)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("read %d events, err %v", len(events), err)
+	}
+	if err := c.Commit(pos); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a crash in the middle of a record leaves a partial one behind
+	seg := filepath.Join(dir, "00000000000000000001.seg")
+	f, err := os.OpenFile(seg, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 9})
+	f.Close()
+
+	w, err = Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if got := w.Cursors(); !reflect.DeepEqual(got, []string{"out"}) {
+		t.Errorf("cursors %q", got)
+	}
+	if got := readAll(t, w.Cursor("out")); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("replayed %q, want the uncommitted events", got)
+	}
+	appendAll(t, w, "out", "d")
+	if got := readAll(t, w.Cursor("out")); !reflect.DeepEqual(got, []string{"d"}) {
+		t.Errorf("read %q after the repaired tail", got)
+	}
+}
+
+// fullWAL returns a WAL with a cursor for "out" that is full after about
+// ten events.
+func fullWAL(t *testing.T, policy OverflowPolicy) (*WAL, *Cursor) {
+	t.Helper()
+	rec, err := encode("out", newEvent("x", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// offsets of two digits make a record a byte longer
+	w, err := Open(Options{Dir: t.TempDir(), MaxSize: int64(10*len(rec) + 10), SegmentSize: int64(2 * len(rec)), Policy: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w, w.Cursor("out")
+}
+
+func TestDropNewest(t *testing.T) {
+	w, c := fullWAL(t, DropNewest)
+	for i := 0; i < 15; i++ {
+		if err := w.Append(context.Background(), "out", newEvent("x", int64(i+1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	synced, err := w.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(synced) != 15 {
+		t.Errorf("sync returned %d events, dropped ones move the files on too", len(synced))
+	}
+	events := readAll(t, c)
+	if len(events) != 10 {
+		t.Errorf("kept %d events, want 10", len(events))
+	}
+}
+
+func TestDropOldest(t *testing.T) {
+	w, c := fullWAL(t, DropOldest)
+	for i := 0; i < 15; i++ {
+		if err := w.Append(context.Background(), "out", newEvent(string(rune('a'+i)), int64(i+1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := readAll(t, c)
+	if len(got) == 0 || got[len(got)-1] != "o" {
+		t.Fatalf("read %q, the newest event must be kept", got)
+	}
+	if got[0] == "a" {
+		t.Errorf("read %q, the oldest events must be dropped", got)
+	}
+}
+
+func TestBlockWaitsForCommit(t *testing.T) {
+	w, c := fullWAL(t, Block)
+	for i := 0; i < 10; i++ {
+		if err := w.Append(context.Background(), "out", newEvent("x", int64(i+1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := w.Append(ctx, "out", newEvent("y", 11)); err != context.DeadlineExceeded {
+		t.Fatalf("append to a full WAL returned %v, want it to block", err)
+	}
+
+	appended := make(chan error, 1)
+	go func() {
+		appended <- w.Append(context.Background(), "out", newEvent("y", 11))
+	}()
+	readAll(t, c)
+	select {
+	case err := <-appended:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("append still blocked after the cursor caught up")
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	v1 "github.com/yshaojie/log-collector/pkg/client/clientset/versioned/typed/log/v1"
+	rest "k8s.io/client-go/rest"
+	testing "k8s.io/client-go/testing"
+)
+
+type FakeLogV1 struct {
+	*testing.Fake
+}
+
+func (c *FakeLogV1) LogCollectionPolicies() v1.LogCollectionPolicyInterface {
+	return &FakeLogCollectionPolicies{c}
+}
+
+func (c *FakeLogV1) LogCollectorConfigs() v1.LogCollectorConfigInterface {
+	return &FakeLogCollectorConfigs{c}
+}
+
+func (c *FakeLogV1) LogOutputs(namespace string) v1.LogOutputInterface {
+	return &FakeLogOutputs{c, namespace}
+}
+
+func (c *FakeLogV1) ServerLogs(namespace string) v1.ServerLogInterface {
+	return &FakeServerLogs{c, namespace}
+}
+
+func (c *FakeLogV1) ServerLogTemplates(namespace string) v1.ServerLogTemplateInterface {
+	return &FakeServerLogTemplates{c, namespace}
+}
+
+// RESTClient returns a RESTClient that is used to communicate
+// with API server by this client implementation.
+func (c *FakeLogV1) RESTClient() rest.Interface {
+	var ret *rest.RESTClient
+	return ret
+}
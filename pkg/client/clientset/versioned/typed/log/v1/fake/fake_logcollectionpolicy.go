@@ -0,0 +1,121 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeLogCollectionPolicies implements LogCollectionPolicyInterface
+type FakeLogCollectionPolicies struct {
+	Fake *FakeLogV1
+}
+
+var logcollectionpoliciesResource = schema.GroupVersionResource{Group: "log.4yxy.io", Version: "v1", Resource: "logcollectionpolicies"}
+
+var logcollectionpoliciesKind = schema.GroupVersionKind{Group: "log.4yxy.io", Version: "v1", Kind: "LogCollectionPolicy"}
+
+// Get takes name of the logCollectionPolicy, and returns the corresponding logCollectionPolicy object, and an error if there is any.
+func (c *FakeLogCollectionPolicies) Get(ctx context.Context, name string, options v1.GetOptions) (result *logv1.LogCollectionPolicy, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootGetAction(logcollectionpoliciesResource, name), &logv1.LogCollectionPolicy{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.LogCollectionPolicy), err
+}
+
+// List takes label and field selectors, and returns the list of LogCollectionPolicies that match those selectors.
+func (c *FakeLogCollectionPolicies) List(ctx context.Context, opts v1.ListOptions) (result *logv1.LogCollectionPolicyList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootListAction(logcollectionpoliciesResource, logcollectionpoliciesKind, opts), &logv1.LogCollectionPolicyList{})
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &logv1.LogCollectionPolicyList{ListMeta: obj.(*logv1.LogCollectionPolicyList).ListMeta}
+	for _, item := range obj.(*logv1.LogCollectionPolicyList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested logCollectionPolicies.
+func (c *FakeLogCollectionPolicies) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewRootWatchAction(logcollectionpoliciesResource, opts))
+}
+
+// Create takes the representation of a logCollectionPolicy and creates it.  Returns the server's representation of the logCollectionPolicy, and an error, if there is any.
+func (c *FakeLogCollectionPolicies) Create(ctx context.Context, logCollectionPolicy *logv1.LogCollectionPolicy, opts v1.CreateOptions) (result *logv1.LogCollectionPolicy, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootCreateAction(logcollectionpoliciesResource, logCollectionPolicy), &logv1.LogCollectionPolicy{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.LogCollectionPolicy), err
+}
+
+// Update takes the representation of a logCollectionPolicy and updates it. Returns the server's representation of the logCollectionPolicy, and an error, if there is any.
+func (c *FakeLogCollectionPolicies) Update(ctx context.Context, logCollectionPolicy *logv1.LogCollectionPolicy, opts v1.UpdateOptions) (result *logv1.LogCollectionPolicy, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateAction(logcollectionpoliciesResource, logCollectionPolicy), &logv1.LogCollectionPolicy{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.LogCollectionPolicy), err
+}
+
+// Delete takes name of the logCollectionPolicy and deletes it. Returns an error if one occurs.
+func (c *FakeLogCollectionPolicies) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewRootDeleteActionWithOptions(logcollectionpoliciesResource, name, opts), &logv1.LogCollectionPolicy{})
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeLogCollectionPolicies) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewRootDeleteCollectionAction(logcollectionpoliciesResource, listOpts)
+
+	_, err := c.Fake.Invokes(action, &logv1.LogCollectionPolicyList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched logCollectionPolicy.
+func (c *FakeLogCollectionPolicies) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *logv1.LogCollectionPolicy, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootPatchSubresourceAction(logcollectionpoliciesResource, name, pt, data, subresources...), &logv1.LogCollectionPolicy{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.LogCollectionPolicy), err
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeLogCollectorConfigs implements LogCollectorConfigInterface
+type FakeLogCollectorConfigs struct {
+	Fake *FakeLogV1
+}
+
+var logcollectorconfigsResource = schema.GroupVersionResource{Group: "log.4yxy.io", Version: "v1", Resource: "logcollectorconfigs"}
+
+var logcollectorconfigsKind = schema.GroupVersionKind{Group: "log.4yxy.io", Version: "v1", Kind: "LogCollectorConfig"}
+
+// Get takes name of the logCollectorConfig, and returns the corresponding logCollectorConfig object, and an error if there is any.
+func (c *FakeLogCollectorConfigs) Get(ctx context.Context, name string, options v1.GetOptions) (result *logv1.LogCollectorConfig, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootGetAction(logcollectorconfigsResource, name), &logv1.LogCollectorConfig{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.LogCollectorConfig), err
+}
+
+// List takes label and field selectors, and returns the list of LogCollectorConfigs that match those selectors.
+func (c *FakeLogCollectorConfigs) List(ctx context.Context, opts v1.ListOptions) (result *logv1.LogCollectorConfigList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootListAction(logcollectorconfigsResource, logcollectorconfigsKind, opts), &logv1.LogCollectorConfigList{})
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &logv1.LogCollectorConfigList{ListMeta: obj.(*logv1.LogCollectorConfigList).ListMeta}
+	for _, item := range obj.(*logv1.LogCollectorConfigList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested logCollectorConfigs.
+func (c *FakeLogCollectorConfigs) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewRootWatchAction(logcollectorconfigsResource, opts))
+}
+
+// Create takes the representation of a logCollectorConfig and creates it.  Returns the server's representation of the logCollectorConfig, and an error, if there is any.
+func (c *FakeLogCollectorConfigs) Create(ctx context.Context, logCollectorConfig *logv1.LogCollectorConfig, opts v1.CreateOptions) (result *logv1.LogCollectorConfig, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootCreateAction(logcollectorconfigsResource, logCollectorConfig), &logv1.LogCollectorConfig{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.LogCollectorConfig), err
+}
+
+// Update takes the representation of a logCollectorConfig and updates it. Returns the server's representation of the logCollectorConfig, and an error, if there is any.
+func (c *FakeLogCollectorConfigs) Update(ctx context.Context, logCollectorConfig *logv1.LogCollectorConfig, opts v1.UpdateOptions) (result *logv1.LogCollectorConfig, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateAction(logcollectorconfigsResource, logCollectorConfig), &logv1.LogCollectorConfig{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.LogCollectorConfig), err
+}
+
+// Delete takes name of the logCollectorConfig and deletes it. Returns an error if one occurs.
+func (c *FakeLogCollectorConfigs) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewRootDeleteActionWithOptions(logcollectorconfigsResource, name, opts), &logv1.LogCollectorConfig{})
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeLogCollectorConfigs) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewRootDeleteCollectionAction(logcollectorconfigsResource, listOpts)
+
+	_, err := c.Fake.Invokes(action, &logv1.LogCollectorConfigList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched logCollectorConfig.
+func (c *FakeLogCollectorConfigs) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *logv1.LogCollectorConfig, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootPatchSubresourceAction(logcollectorconfigsResource, name, pt, data, subresources...), &logv1.LogCollectorConfig{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.LogCollectorConfig), err
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeLogOutputs implements LogOutputInterface
+type FakeLogOutputs struct {
+	Fake *FakeLogV1
+	ns   string
+}
+
+var logoutputsResource = schema.GroupVersionResource{Group: "log.4yxy.io", Version: "v1", Resource: "logoutputs"}
+
+var logoutputsKind = schema.GroupVersionKind{Group: "log.4yxy.io", Version: "v1", Kind: "LogOutput"}
+
+// Get takes name of the logOutput, and returns the corresponding logOutput object, and an error if there is any.
+func (c *FakeLogOutputs) Get(ctx context.Context, name string, options v1.GetOptions) (result *logv1.LogOutput, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(logoutputsResource, c.ns, name), &logv1.LogOutput{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.LogOutput), err
+}
+
+// List takes label and field selectors, and returns the list of LogOutputs that match those selectors.
+func (c *FakeLogOutputs) List(ctx context.Context, opts v1.ListOptions) (result *logv1.LogOutputList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(logoutputsResource, logoutputsKind, c.ns, opts), &logv1.LogOutputList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &logv1.LogOutputList{ListMeta: obj.(*logv1.LogOutputList).ListMeta}
+	for _, item := range obj.(*logv1.LogOutputList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested logOutputs.
+func (c *FakeLogOutputs) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(logoutputsResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a logOutput and creates it.  Returns the server's representation of the logOutput, and an error, if there is any.
+func (c *FakeLogOutputs) Create(ctx context.Context, logOutput *logv1.LogOutput, opts v1.CreateOptions) (result *logv1.LogOutput, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(logoutputsResource, c.ns, logOutput), &logv1.LogOutput{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.LogOutput), err
+}
+
+// Update takes the representation of a logOutput and updates it. Returns the server's representation of the logOutput, and an error, if there is any.
+func (c *FakeLogOutputs) Update(ctx context.Context, logOutput *logv1.LogOutput, opts v1.UpdateOptions) (result *logv1.LogOutput, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(logoutputsResource, c.ns, logOutput), &logv1.LogOutput{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.LogOutput), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeLogOutputs) UpdateStatus(ctx context.Context, logOutput *logv1.LogOutput, opts v1.UpdateOptions) (*logv1.LogOutput, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(logoutputsResource, "status", c.ns, logOutput), &logv1.LogOutput{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.LogOutput), err
+}
+
+// Delete takes name of the logOutput and deletes it. Returns an error if one occurs.
+func (c *FakeLogOutputs) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteActionWithOptions(logoutputsResource, c.ns, name, opts), &logv1.LogOutput{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeLogOutputs) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(logoutputsResource, c.ns, listOpts)
+
+	_, err := c.Fake.Invokes(action, &logv1.LogOutputList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched logOutput.
+func (c *FakeLogOutputs) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *logv1.LogOutput, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(logoutputsResource, c.ns, name, pt, data, subresources...), &logv1.LogOutput{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.LogOutput), err
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeServerLogs implements ServerLogInterface
+type FakeServerLogs struct {
+	Fake *FakeLogV1
+	ns   string
+}
+
+var serverlogsResource = schema.GroupVersionResource{Group: "log.4yxy.io", Version: "v1", Resource: "serverlogs"}
+
+var serverlogsKind = schema.GroupVersionKind{Group: "log.4yxy.io", Version: "v1", Kind: "ServerLog"}
+
+// Get takes name of the serverLog, and returns the corresponding serverLog object, and an error if there is any.
+func (c *FakeServerLogs) Get(ctx context.Context, name string, options v1.GetOptions) (result *logv1.ServerLog, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(serverlogsResource, c.ns, name), &logv1.ServerLog{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.ServerLog), err
+}
+
+// List takes label and field selectors, and returns the list of ServerLogs that match those selectors.
+func (c *FakeServerLogs) List(ctx context.Context, opts v1.ListOptions) (result *logv1.ServerLogList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(serverlogsResource, serverlogsKind, c.ns, opts), &logv1.ServerLogList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &logv1.ServerLogList{ListMeta: obj.(*logv1.ServerLogList).ListMeta}
+	for _, item := range obj.(*logv1.ServerLogList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested serverLogs.
+func (c *FakeServerLogs) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(serverlogsResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a serverLog and creates it.  Returns the server's representation of the serverLog, and an error, if there is any.
+func (c *FakeServerLogs) Create(ctx context.Context, serverLog *logv1.ServerLog, opts v1.CreateOptions) (result *logv1.ServerLog, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(serverlogsResource, c.ns, serverLog), &logv1.ServerLog{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.ServerLog), err
+}
+
+// Update takes the representation of a serverLog and updates it. Returns the server's representation of the serverLog, and an error, if there is any.
+func (c *FakeServerLogs) Update(ctx context.Context, serverLog *logv1.ServerLog, opts v1.UpdateOptions) (result *logv1.ServerLog, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(serverlogsResource, c.ns, serverLog), &logv1.ServerLog{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.ServerLog), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeServerLogs) UpdateStatus(ctx context.Context, serverLog *logv1.ServerLog, opts v1.UpdateOptions) (*logv1.ServerLog, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(serverlogsResource, "status", c.ns, serverLog), &logv1.ServerLog{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.ServerLog), err
+}
+
+// Delete takes name of the serverLog and deletes it. Returns an error if one occurs.
+func (c *FakeServerLogs) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteActionWithOptions(serverlogsResource, c.ns, name, opts), &logv1.ServerLog{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeServerLogs) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(serverlogsResource, c.ns, listOpts)
+
+	_, err := c.Fake.Invokes(action, &logv1.ServerLogList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched serverLog.
+func (c *FakeServerLogs) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *logv1.ServerLog, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(serverlogsResource, c.ns, name, pt, data, subresources...), &logv1.ServerLog{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.ServerLog), err
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeServerLogTemplates implements ServerLogTemplateInterface
+type FakeServerLogTemplates struct {
+	Fake *FakeLogV1
+	ns   string
+}
+
+var serverlogtemplatesResource = schema.GroupVersionResource{Group: "log.4yxy.io", Version: "v1", Resource: "serverlogtemplates"}
+
+var serverlogtemplatesKind = schema.GroupVersionKind{Group: "log.4yxy.io", Version: "v1", Kind: "ServerLogTemplate"}
+
+// Get takes name of the serverLogTemplate, and returns the corresponding serverLogTemplate object, and an error if there is any.
+func (c *FakeServerLogTemplates) Get(ctx context.Context, name string, options v1.GetOptions) (result *logv1.ServerLogTemplate, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(serverlogtemplatesResource, c.ns, name), &logv1.ServerLogTemplate{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.ServerLogTemplate), err
+}
+
+// List takes label and field selectors, and returns the list of ServerLogTemplates that match those selectors.
+func (c *FakeServerLogTemplates) List(ctx context.Context, opts v1.ListOptions) (result *logv1.ServerLogTemplateList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(serverlogtemplatesResource, serverlogtemplatesKind, c.ns, opts), &logv1.ServerLogTemplateList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &logv1.ServerLogTemplateList{ListMeta: obj.(*logv1.ServerLogTemplateList).ListMeta}
+	for _, item := range obj.(*logv1.ServerLogTemplateList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested serverLogTemplates.
+func (c *FakeServerLogTemplates) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(serverlogtemplatesResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a serverLogTemplate and creates it.  Returns the server's representation of the serverLogTemplate, and an error, if there is any.
+func (c *FakeServerLogTemplates) Create(ctx context.Context, serverLogTemplate *logv1.ServerLogTemplate, opts v1.CreateOptions) (result *logv1.ServerLogTemplate, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(serverlogtemplatesResource, c.ns, serverLogTemplate), &logv1.ServerLogTemplate{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.ServerLogTemplate), err
+}
+
+// Update takes the representation of a serverLogTemplate and updates it. Returns the server's representation of the serverLogTemplate, and an error, if there is any.
+func (c *FakeServerLogTemplates) Update(ctx context.Context, serverLogTemplate *logv1.ServerLogTemplate, opts v1.UpdateOptions) (result *logv1.ServerLogTemplate, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(serverlogtemplatesResource, c.ns, serverLogTemplate), &logv1.ServerLogTemplate{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.ServerLogTemplate), err
+}
+
+// Delete takes name of the serverLogTemplate and deletes it. Returns an error if one occurs.
+func (c *FakeServerLogTemplates) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteActionWithOptions(serverlogtemplatesResource, c.ns, name, opts), &logv1.ServerLogTemplate{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeServerLogTemplates) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(serverlogtemplatesResource, c.ns, listOpts)
+
+	_, err := c.Fake.Invokes(action, &logv1.ServerLogTemplateList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched serverLogTemplate.
+func (c *FakeServerLogTemplates) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *logv1.ServerLogTemplate, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(serverlogtemplatesResource, c.ns, name, pt, data, subresources...), &logv1.ServerLogTemplate{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*logv1.ServerLogTemplate), err
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	"net/http"
+
+	v1 "github.com/yshaojie/log-collector/api/v1"
+	"github.com/yshaojie/log-collector/pkg/client/clientset/versioned/scheme"
+	rest "k8s.io/client-go/rest"
+)
+
+type LogV1Interface interface {
+	RESTClient() rest.Interface
+	LogCollectionPoliciesGetter
+	LogCollectorConfigsGetter
+	LogOutputsGetter
+	ServerLogsGetter
+	ServerLogTemplatesGetter
+}
+
+// LogV1Client is used to interact with features provided by the log.4yxy.io group.
+type LogV1Client struct {
+	restClient rest.Interface
+}
+
+func (c *LogV1Client) LogCollectionPolicies() LogCollectionPolicyInterface {
+	return newLogCollectionPolicies(c)
+}
+
+func (c *LogV1Client) LogCollectorConfigs() LogCollectorConfigInterface {
+	return newLogCollectorConfigs(c)
+}
+
+func (c *LogV1Client) LogOutputs(namespace string) LogOutputInterface {
+	return newLogOutputs(c, namespace)
+}
+
+func (c *LogV1Client) ServerLogs(namespace string) ServerLogInterface {
+	return newServerLogs(c, namespace)
+}
+
+func (c *LogV1Client) ServerLogTemplates(namespace string) ServerLogTemplateInterface {
+	return newServerLogTemplates(c, namespace)
+}
+
+// NewForConfig creates a new LogV1Client for the given config.
+// NewForConfig is equivalent to NewForConfigAndClient(c, httpClient),
+// where httpClient was generated with rest.HTTPClientFor(c).
+func NewForConfig(c *rest.Config) (*LogV1Client, error) {
+	config := *c
+	if err := setConfigDefaults(&config); err != nil {
+		return nil, err
+	}
+	httpClient, err := rest.HTTPClientFor(&config)
+	if err != nil {
+		return nil, err
+	}
+	return NewForConfigAndClient(&config, httpClient)
+}
+
+// NewForConfigAndClient creates a new LogV1Client for the given config and http client.
+// Note the http client provided takes precedence over the configured transport values.
+func NewForConfigAndClient(c *rest.Config, h *http.Client) (*LogV1Client, error) {
+	config := *c
+	if err := setConfigDefaults(&config); err != nil {
+		return nil, err
+	}
+	client, err := rest.RESTClientForConfigAndClient(&config, h)
+	if err != nil {
+		return nil, err
+	}
+	return &LogV1Client{client}, nil
+}
+
+// NewForConfigOrDie creates a new LogV1Client for the given config and
+// panics if there is an error in the config.
+func NewForConfigOrDie(c *rest.Config) *LogV1Client {
+	client, err := NewForConfig(c)
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+// New creates a new LogV1Client for the given RESTClient.
+func New(c rest.Interface) *LogV1Client {
+	return &LogV1Client{c}
+}
+
+func setConfigDefaults(config *rest.Config) error {
+	gv := v1.SchemeGroupVersion
+	config.GroupVersion = &gv
+	config.APIPath = "/apis"
+	config.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
+
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+
+	return nil
+}
+
+// RESTClient returns a RESTClient that is used to communicate
+// with API server by this client implementation.
+func (c *LogV1Client) RESTClient() rest.Interface {
+	if c == nil {
+		return nil
+	}
+	return c.restClient
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/yshaojie/log-collector/api/v1"
+	scheme "github.com/yshaojie/log-collector/pkg/client/clientset/versioned/scheme"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// LogCollectionPoliciesGetter has a method to return a LogCollectionPolicyInterface.
+// A group's client should implement this interface.
+type LogCollectionPoliciesGetter interface {
+	LogCollectionPolicies() LogCollectionPolicyInterface
+}
+
+// LogCollectionPolicyInterface has methods to work with LogCollectionPolicy resources.
+type LogCollectionPolicyInterface interface {
+	Create(ctx context.Context, logCollectionPolicy *v1.LogCollectionPolicy, opts metav1.CreateOptions) (*v1.LogCollectionPolicy, error)
+	Update(ctx context.Context, logCollectionPolicy *v1.LogCollectionPolicy, opts metav1.UpdateOptions) (*v1.LogCollectionPolicy, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1.LogCollectionPolicy, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*v1.LogCollectionPolicyList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *v1.LogCollectionPolicy, err error)
+	LogCollectionPolicyExpansion
+}
+
+// logCollectionPolicies implements LogCollectionPolicyInterface
+type logCollectionPolicies struct {
+	client rest.Interface
+}
+
+// newLogCollectionPolicies returns a LogCollectionPolicies
+func newLogCollectionPolicies(c *LogV1Client) *logCollectionPolicies {
+	return &logCollectionPolicies{
+		client: c.RESTClient(),
+	}
+}
+
+// Get takes name of the logCollectionPolicy, and returns the corresponding logCollectionPolicy object, and an error if there is any.
+func (c *logCollectionPolicies) Get(ctx context.Context, name string, options metav1.GetOptions) (result *v1.LogCollectionPolicy, err error) {
+	result = &v1.LogCollectionPolicy{}
+	err = c.client.Get().
+		Resource("logcollectionpolicies").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of LogCollectionPolicies that match those selectors.
+func (c *logCollectionPolicies) List(ctx context.Context, opts metav1.ListOptions) (result *v1.LogCollectionPolicyList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1.LogCollectionPolicyList{}
+	err = c.client.Get().
+		Resource("logcollectionpolicies").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested logCollectionPolicies.
+func (c *logCollectionPolicies) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Resource("logcollectionpolicies").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a logCollectionPolicy and creates it.  Returns the server's representation of the logCollectionPolicy, and an error, if there is any.
+func (c *logCollectionPolicies) Create(ctx context.Context, logCollectionPolicy *v1.LogCollectionPolicy, opts metav1.CreateOptions) (result *v1.LogCollectionPolicy, err error) {
+	result = &v1.LogCollectionPolicy{}
+	err = c.client.Post().
+		Resource("logcollectionpolicies").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(logCollectionPolicy).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a logCollectionPolicy and updates it. Returns the server's representation of the logCollectionPolicy, and an error, if there is any.
+func (c *logCollectionPolicies) Update(ctx context.Context, logCollectionPolicy *v1.LogCollectionPolicy, opts metav1.UpdateOptions) (result *v1.LogCollectionPolicy, err error) {
+	result = &v1.LogCollectionPolicy{}
+	err = c.client.Put().
+		Resource("logcollectionpolicies").
+		Name(logCollectionPolicy.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(logCollectionPolicy).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the logCollectionPolicy and deletes it. Returns an error if one occurs.
+func (c *logCollectionPolicies) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.client.Delete().
+		Resource("logcollectionpolicies").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *logCollectionPolicies) DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Resource("logcollectionpolicies").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched logCollectionPolicy.
+func (c *logCollectionPolicies) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *v1.LogCollectionPolicy, err error) {
+	result = &v1.LogCollectionPolicy{}
+	err = c.client.Patch(pt).
+		Resource("logcollectionpolicies").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/yshaojie/log-collector/api/v1"
+	scheme "github.com/yshaojie/log-collector/pkg/client/clientset/versioned/scheme"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// LogCollectorConfigsGetter has a method to return a LogCollectorConfigInterface.
+// A group's client should implement this interface.
+type LogCollectorConfigsGetter interface {
+	LogCollectorConfigs() LogCollectorConfigInterface
+}
+
+// LogCollectorConfigInterface has methods to work with LogCollectorConfig resources.
+type LogCollectorConfigInterface interface {
+	Create(ctx context.Context, logCollectorConfig *v1.LogCollectorConfig, opts metav1.CreateOptions) (*v1.LogCollectorConfig, error)
+	Update(ctx context.Context, logCollectorConfig *v1.LogCollectorConfig, opts metav1.UpdateOptions) (*v1.LogCollectorConfig, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1.LogCollectorConfig, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*v1.LogCollectorConfigList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *v1.LogCollectorConfig, err error)
+	LogCollectorConfigExpansion
+}
+
+// logCollectorConfigs implements LogCollectorConfigInterface
+type logCollectorConfigs struct {
+	client rest.Interface
+}
+
+// newLogCollectorConfigs returns a LogCollectorConfigs
+func newLogCollectorConfigs(c *LogV1Client) *logCollectorConfigs {
+	return &logCollectorConfigs{
+		client: c.RESTClient(),
+	}
+}
+
+// Get takes name of the logCollectorConfig, and returns the corresponding logCollectorConfig object, and an error if there is any.
+func (c *logCollectorConfigs) Get(ctx context.Context, name string, options metav1.GetOptions) (result *v1.LogCollectorConfig, err error) {
+	result = &v1.LogCollectorConfig{}
+	err = c.client.Get().
+		Resource("logcollectorconfigs").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of LogCollectorConfigs that match those selectors.
+func (c *logCollectorConfigs) List(ctx context.Context, opts metav1.ListOptions) (result *v1.LogCollectorConfigList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1.LogCollectorConfigList{}
+	err = c.client.Get().
+		Resource("logcollectorconfigs").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested logCollectorConfigs.
+func (c *logCollectorConfigs) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Resource("logcollectorconfigs").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a logCollectorConfig and creates it.  Returns the server's representation of the logCollectorConfig, and an error, if there is any.
+func (c *logCollectorConfigs) Create(ctx context.Context, logCollectorConfig *v1.LogCollectorConfig, opts metav1.CreateOptions) (result *v1.LogCollectorConfig, err error) {
+	result = &v1.LogCollectorConfig{}
+	err = c.client.Post().
+		Resource("logcollectorconfigs").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(logCollectorConfig).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a logCollectorConfig and updates it. Returns the server's representation of the logCollectorConfig, and an error, if there is any.
+func (c *logCollectorConfigs) Update(ctx context.Context, logCollectorConfig *v1.LogCollectorConfig, opts metav1.UpdateOptions) (result *v1.LogCollectorConfig, err error) {
+	result = &v1.LogCollectorConfig{}
+	err = c.client.Put().
+		Resource("logcollectorconfigs").
+		Name(logCollectorConfig.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(logCollectorConfig).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the logCollectorConfig and deletes it. Returns an error if one occurs.
+func (c *logCollectorConfigs) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.client.Delete().
+		Resource("logcollectorconfigs").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *logCollectorConfigs) DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Resource("logcollectorconfigs").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched logCollectorConfig.
+func (c *logCollectorConfigs) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *v1.LogCollectorConfig, err error) {
+	result = &v1.LogCollectorConfig{}
+	err = c.client.Patch(pt).
+		Resource("logcollectorconfigs").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
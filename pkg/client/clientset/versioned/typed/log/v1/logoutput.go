@@ -0,0 +1,194 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/yshaojie/log-collector/api/v1"
+	scheme "github.com/yshaojie/log-collector/pkg/client/clientset/versioned/scheme"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// LogOutputsGetter has a method to return a LogOutputInterface.
+// A group's client should implement this interface.
+type LogOutputsGetter interface {
+	LogOutputs(namespace string) LogOutputInterface
+}
+
+// LogOutputInterface has methods to work with LogOutput resources.
+type LogOutputInterface interface {
+	Create(ctx context.Context, logOutput *v1.LogOutput, opts metav1.CreateOptions) (*v1.LogOutput, error)
+	Update(ctx context.Context, logOutput *v1.LogOutput, opts metav1.UpdateOptions) (*v1.LogOutput, error)
+	UpdateStatus(ctx context.Context, logOutput *v1.LogOutput, opts metav1.UpdateOptions) (*v1.LogOutput, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1.LogOutput, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*v1.LogOutputList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *v1.LogOutput, err error)
+	LogOutputExpansion
+}
+
+// logOutputs implements LogOutputInterface
+type logOutputs struct {
+	client rest.Interface
+	ns     string
+}
+
+// newLogOutputs returns a LogOutputs
+func newLogOutputs(c *LogV1Client, namespace string) *logOutputs {
+	return &logOutputs{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the logOutput, and returns the corresponding logOutput object, and an error if there is any.
+func (c *logOutputs) Get(ctx context.Context, name string, options metav1.GetOptions) (result *v1.LogOutput, err error) {
+	result = &v1.LogOutput{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("logoutputs").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of LogOutputs that match those selectors.
+func (c *logOutputs) List(ctx context.Context, opts metav1.ListOptions) (result *v1.LogOutputList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1.LogOutputList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("logoutputs").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested logOutputs.
+func (c *logOutputs) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("logoutputs").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a logOutput and creates it.  Returns the server's representation of the logOutput, and an error, if there is any.
+func (c *logOutputs) Create(ctx context.Context, logOutput *v1.LogOutput, opts metav1.CreateOptions) (result *v1.LogOutput, err error) {
+	result = &v1.LogOutput{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("logoutputs").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(logOutput).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a logOutput and updates it. Returns the server's representation of the logOutput, and an error, if there is any.
+func (c *logOutputs) Update(ctx context.Context, logOutput *v1.LogOutput, opts metav1.UpdateOptions) (result *v1.LogOutput, err error) {
+	result = &v1.LogOutput{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("logoutputs").
+		Name(logOutput.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(logOutput).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *logOutputs) UpdateStatus(ctx context.Context, logOutput *v1.LogOutput, opts metav1.UpdateOptions) (result *v1.LogOutput, err error) {
+	result = &v1.LogOutput{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("logoutputs").
+		Name(logOutput.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(logOutput).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the logOutput and deletes it. Returns an error if one occurs.
+func (c *logOutputs) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("logoutputs").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *logOutputs) DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("logoutputs").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched logOutput.
+func (c *logOutputs) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *v1.LogOutput, err error) {
+	result = &v1.LogOutput{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("logoutputs").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
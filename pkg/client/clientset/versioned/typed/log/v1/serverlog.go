@@ -0,0 +1,194 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/yshaojie/log-collector/api/v1"
+	scheme "github.com/yshaojie/log-collector/pkg/client/clientset/versioned/scheme"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// ServerLogsGetter has a method to return a ServerLogInterface.
+// A group's client should implement this interface.
+type ServerLogsGetter interface {
+	ServerLogs(namespace string) ServerLogInterface
+}
+
+// ServerLogInterface has methods to work with ServerLog resources.
+type ServerLogInterface interface {
+	Create(ctx context.Context, serverLog *v1.ServerLog, opts metav1.CreateOptions) (*v1.ServerLog, error)
+	Update(ctx context.Context, serverLog *v1.ServerLog, opts metav1.UpdateOptions) (*v1.ServerLog, error)
+	UpdateStatus(ctx context.Context, serverLog *v1.ServerLog, opts metav1.UpdateOptions) (*v1.ServerLog, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1.ServerLog, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*v1.ServerLogList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *v1.ServerLog, err error)
+	ServerLogExpansion
+}
+
+// serverLogs implements ServerLogInterface
+type serverLogs struct {
+	client rest.Interface
+	ns     string
+}
+
+// newServerLogs returns a ServerLogs
+func newServerLogs(c *LogV1Client, namespace string) *serverLogs {
+	return &serverLogs{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the serverLog, and returns the corresponding serverLog object, and an error if there is any.
+func (c *serverLogs) Get(ctx context.Context, name string, options metav1.GetOptions) (result *v1.ServerLog, err error) {
+	result = &v1.ServerLog{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("serverlogs").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of ServerLogs that match those selectors.
+func (c *serverLogs) List(ctx context.Context, opts metav1.ListOptions) (result *v1.ServerLogList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1.ServerLogList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("serverlogs").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested serverLogs.
+func (c *serverLogs) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("serverlogs").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a serverLog and creates it.  Returns the server's representation of the serverLog, and an error, if there is any.
+func (c *serverLogs) Create(ctx context.Context, serverLog *v1.ServerLog, opts metav1.CreateOptions) (result *v1.ServerLog, err error) {
+	result = &v1.ServerLog{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("serverlogs").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(serverLog).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a serverLog and updates it. Returns the server's representation of the serverLog, and an error, if there is any.
+func (c *serverLogs) Update(ctx context.Context, serverLog *v1.ServerLog, opts metav1.UpdateOptions) (result *v1.ServerLog, err error) {
+	result = &v1.ServerLog{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("serverlogs").
+		Name(serverLog.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(serverLog).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *serverLogs) UpdateStatus(ctx context.Context, serverLog *v1.ServerLog, opts metav1.UpdateOptions) (result *v1.ServerLog, err error) {
+	result = &v1.ServerLog{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("serverlogs").
+		Name(serverLog.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(serverLog).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the serverLog and deletes it. Returns an error if one occurs.
+func (c *serverLogs) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("serverlogs").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *serverLogs) DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("serverlogs").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched serverLog.
+func (c *serverLogs) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *v1.ServerLog, err error) {
+	result = &v1.ServerLog{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("serverlogs").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/yshaojie/log-collector/api/v1"
+	scheme "github.com/yshaojie/log-collector/pkg/client/clientset/versioned/scheme"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// ServerLogTemplatesGetter has a method to return a ServerLogTemplateInterface.
+// A group's client should implement this interface.
+type ServerLogTemplatesGetter interface {
+	ServerLogTemplates(namespace string) ServerLogTemplateInterface
+}
+
+// ServerLogTemplateInterface has methods to work with ServerLogTemplate resources.
+type ServerLogTemplateInterface interface {
+	Create(ctx context.Context, serverLogTemplate *v1.ServerLogTemplate, opts metav1.CreateOptions) (*v1.ServerLogTemplate, error)
+	Update(ctx context.Context, serverLogTemplate *v1.ServerLogTemplate, opts metav1.UpdateOptions) (*v1.ServerLogTemplate, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1.ServerLogTemplate, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*v1.ServerLogTemplateList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *v1.ServerLogTemplate, err error)
+	ServerLogTemplateExpansion
+}
+
+// serverLogTemplates implements ServerLogTemplateInterface
+type serverLogTemplates struct {
+	client rest.Interface
+	ns     string
+}
+
+// newServerLogTemplates returns a ServerLogTemplates
+func newServerLogTemplates(c *LogV1Client, namespace string) *serverLogTemplates {
+	return &serverLogTemplates{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the serverLogTemplate, and returns the corresponding serverLogTemplate object, and an error if there is any.
+func (c *serverLogTemplates) Get(ctx context.Context, name string, options metav1.GetOptions) (result *v1.ServerLogTemplate, err error) {
+	result = &v1.ServerLogTemplate{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("serverlogtemplates").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of ServerLogTemplates that match those selectors.
+func (c *serverLogTemplates) List(ctx context.Context, opts metav1.ListOptions) (result *v1.ServerLogTemplateList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1.ServerLogTemplateList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("serverlogtemplates").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested serverLogTemplates.
+func (c *serverLogTemplates) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("serverlogtemplates").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a serverLogTemplate and creates it.  Returns the server's representation of the serverLogTemplate, and an error, if there is any.
+func (c *serverLogTemplates) Create(ctx context.Context, serverLogTemplate *v1.ServerLogTemplate, opts metav1.CreateOptions) (result *v1.ServerLogTemplate, err error) {
+	result = &v1.ServerLogTemplate{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("serverlogtemplates").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(serverLogTemplate).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a serverLogTemplate and updates it. Returns the server's representation of the serverLogTemplate, and an error, if there is any.
+func (c *serverLogTemplates) Update(ctx context.Context, serverLogTemplate *v1.ServerLogTemplate, opts metav1.UpdateOptions) (result *v1.ServerLogTemplate, err error) {
+	result = &v1.ServerLogTemplate{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("serverlogtemplates").
+		Name(serverLogTemplate.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(serverLogTemplate).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the serverLogTemplate and deletes it. Returns an error if one occurs.
+func (c *serverLogTemplates) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("serverlogtemplates").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *serverLogTemplates) DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("serverlogtemplates").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched serverLogTemplate.
+func (c *serverLogTemplates) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *v1.ServerLogTemplate, err error) {
+	result = &v1.ServerLogTemplate{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("serverlogtemplates").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by informer-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	internalinterfaces "github.com/yshaojie/log-collector/pkg/client/informers/externalversions/internalinterfaces"
+)
+
+// Interface provides access to all the informers in this group version.
+type Interface interface {
+	// LogCollectionPolicies returns a LogCollectionPolicyInformer.
+	LogCollectionPolicies() LogCollectionPolicyInformer
+	// LogCollectorConfigs returns a LogCollectorConfigInformer.
+	LogCollectorConfigs() LogCollectorConfigInformer
+	// LogOutputs returns a LogOutputInformer.
+	LogOutputs() LogOutputInformer
+	// ServerLogs returns a ServerLogInformer.
+	ServerLogs() ServerLogInformer
+	// ServerLogTemplates returns a ServerLogTemplateInformer.
+	ServerLogTemplates() ServerLogTemplateInformer
+}
+
+type version struct {
+	factory          internalinterfaces.SharedInformerFactory
+	namespace        string
+	tweakListOptions internalinterfaces.TweakListOptionsFunc
+}
+
+// New returns a new Interface.
+func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakListOptions internalinterfaces.TweakListOptionsFunc) Interface {
+	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
+}
+
+// LogCollectionPolicies returns a LogCollectionPolicyInformer.
+func (v *version) LogCollectionPolicies() LogCollectionPolicyInformer {
+	return &logCollectionPolicyInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
+// LogCollectorConfigs returns a LogCollectorConfigInformer.
+func (v *version) LogCollectorConfigs() LogCollectorConfigInformer {
+	return &logCollectorConfigInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
+// LogOutputs returns a LogOutputInformer.
+func (v *version) LogOutputs() LogOutputInformer {
+	return &logOutputInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
+// ServerLogs returns a ServerLogInformer.
+func (v *version) ServerLogs() ServerLogInformer {
+	return &serverLogInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
+// ServerLogTemplates returns a ServerLogTemplateInformer.
+func (v *version) ServerLogTemplates() ServerLogTemplateInformer {
+	return &serverLogTemplateInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by informer-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	"context"
+	time "time"
+
+	logv1 "github.com/yshaojie/log-collector/api/v1"
+	versioned "github.com/yshaojie/log-collector/pkg/client/clientset/versioned"
+	internalinterfaces "github.com/yshaojie/log-collector/pkg/client/informers/externalversions/internalinterfaces"
+	v1 "github.com/yshaojie/log-collector/pkg/client/listers/log/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	watch "k8s.io/apimachinery/pkg/watch"
+	cache "k8s.io/client-go/tools/cache"
+)
+
+// LogCollectorConfigInformer provides access to a shared informer and lister for
+// LogCollectorConfigs.
+type LogCollectorConfigInformer interface {
+	Informer() cache.SharedIndexInformer
+	Lister() v1.LogCollectorConfigLister
+}
+
+type logCollectorConfigInformer struct {
+	factory          internalinterfaces.SharedInformerFactory
+	tweakListOptions internalinterfaces.TweakListOptionsFunc
+}
+
+// NewLogCollectorConfigInformer constructs a new informer for LogCollectorConfig type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewLogCollectorConfigInformer(client versioned.Interface, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	return NewFilteredLogCollectorConfigInformer(client, resyncPeriod, indexers, nil)
+}
+
+// NewFilteredLogCollectorConfigInformer constructs a new informer for LogCollectorConfig type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewFilteredLogCollectorConfigInformer(client versioned.Interface, resyncPeriod time.Duration, indexers cache.Indexers, tweakListOptions internalinterfaces.TweakListOptionsFunc) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.LogV1().LogCollectorConfigs().List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.LogV1().LogCollectorConfigs().Watch(context.TODO(), options)
+			},
+		},
+		&logv1.LogCollectorConfig{},
+		resyncPeriod,
+		indexers,
+	)
+}
+
+func (f *logCollectorConfigInformer) defaultInformer(client versioned.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return NewFilteredLogCollectorConfigInformer(client, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, f.tweakListOptions)
+}
+
+func (f *logCollectorConfigInformer) Informer() cache.SharedIndexInformer {
+	return f.factory.InformerFor(&logv1.LogCollectorConfig{}, f.defaultInformer)
+}
+
+func (f *logCollectorConfigInformer) Lister() v1.LogCollectorConfigLister {
+	return v1.NewLogCollectorConfigLister(f.Informer().GetIndexer())
+}
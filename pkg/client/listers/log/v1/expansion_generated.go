@@ -0,0 +1,50 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1
+
+// LogCollectionPolicyListerExpansion allows custom methods to be added to
+// LogCollectionPolicyLister.
+type LogCollectionPolicyListerExpansion interface{}
+
+// LogCollectorConfigListerExpansion allows custom methods to be added to
+// LogCollectorConfigLister.
+type LogCollectorConfigListerExpansion interface{}
+
+// LogOutputListerExpansion allows custom methods to be added to
+// LogOutputLister.
+type LogOutputListerExpansion interface{}
+
+// LogOutputNamespaceListerExpansion allows custom methods to be added to
+// LogOutputNamespaceLister.
+type LogOutputNamespaceListerExpansion interface{}
+
+// ServerLogListerExpansion allows custom methods to be added to
+// ServerLogLister.
+type ServerLogListerExpansion interface{}
+
+// ServerLogNamespaceListerExpansion allows custom methods to be added to
+// ServerLogNamespaceLister.
+type ServerLogNamespaceListerExpansion interface{}
+
+// ServerLogTemplateListerExpansion allows custom methods to be added to
+// ServerLogTemplateLister.
+type ServerLogTemplateListerExpansion interface{}
+
+// ServerLogTemplateNamespaceListerExpansion allows custom methods to be added to
+// ServerLogTemplateNamespaceLister.
+type ServerLogTemplateNamespaceListerExpansion interface{}
@@ -0,0 +1,67 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	v1 "github.com/yshaojie/log-collector/api/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// LogCollectorConfigLister helps list LogCollectorConfigs.
+// All objects returned here must be treated as read-only.
+type LogCollectorConfigLister interface {
+	// List lists all LogCollectorConfigs in the indexer.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v1.LogCollectorConfig, err error)
+	// Get retrieves the LogCollectorConfig from the index for a given name.
+	// Objects returned here must be treated as read-only.
+	Get(name string) (*v1.LogCollectorConfig, error)
+	LogCollectorConfigListerExpansion
+}
+
+// logCollectorConfigLister implements the LogCollectorConfigLister interface.
+type logCollectorConfigLister struct {
+	indexer cache.Indexer
+}
+
+// NewLogCollectorConfigLister returns a new LogCollectorConfigLister.
+func NewLogCollectorConfigLister(indexer cache.Indexer) LogCollectorConfigLister {
+	return &logCollectorConfigLister{indexer: indexer}
+}
+
+// List lists all LogCollectorConfigs in the indexer.
+func (s *logCollectorConfigLister) List(selector labels.Selector) (ret []*v1.LogCollectorConfig, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1.LogCollectorConfig))
+	})
+	return ret, err
+}
+
+// Get retrieves the LogCollectorConfig from the index for a given name.
+func (s *logCollectorConfigLister) Get(name string) (*v1.LogCollectorConfig, error) {
+	obj, exists, err := s.indexer.GetByKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1.Resource("logcollectorconfig"), name)
+	}
+	return obj.(*v1.LogCollectorConfig), nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	v1 "github.com/yshaojie/log-collector/api/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// LogOutputLister helps list LogOutputs.
+// All objects returned here must be treated as read-only.
+type LogOutputLister interface {
+	// List lists all LogOutputs in the indexer.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v1.LogOutput, err error)
+	// LogOutputs returns an object that can list and get LogOutputs.
+	LogOutputs(namespace string) LogOutputNamespaceLister
+	LogOutputListerExpansion
+}
+
+// logOutputLister implements the LogOutputLister interface.
+type logOutputLister struct {
+	indexer cache.Indexer
+}
+
+// NewLogOutputLister returns a new LogOutputLister.
+func NewLogOutputLister(indexer cache.Indexer) LogOutputLister {
+	return &logOutputLister{indexer: indexer}
+}
+
+// List lists all LogOutputs in the indexer.
+func (s *logOutputLister) List(selector labels.Selector) (ret []*v1.LogOutput, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1.LogOutput))
+	})
+	return ret, err
+}
+
+// LogOutputs returns an object that can list and get LogOutputs.
+func (s *logOutputLister) LogOutputs(namespace string) LogOutputNamespaceLister {
+	return logOutputNamespaceLister{indexer: s.indexer, namespace: namespace}
+}
+
+// LogOutputNamespaceLister helps list and get LogOutputs.
+// All objects returned here must be treated as read-only.
+type LogOutputNamespaceLister interface {
+	// List lists all LogOutputs in the indexer for a given namespace.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v1.LogOutput, err error)
+	// Get retrieves the LogOutput from the indexer for a given namespace and name.
+	// Objects returned here must be treated as read-only.
+	Get(name string) (*v1.LogOutput, error)
+	LogOutputNamespaceListerExpansion
+}
+
+// logOutputNamespaceLister implements the LogOutputNamespaceLister
+// interface.
+type logOutputNamespaceLister struct {
+	indexer   cache.Indexer
+	namespace string
+}
+
+// List lists all LogOutputs in the indexer for a given namespace.
+func (s logOutputNamespaceLister) List(selector labels.Selector) (ret []*v1.LogOutput, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1.LogOutput))
+	})
+	return ret, err
+}
+
+// Get retrieves the LogOutput from the indexer for a given namespace and name.
+func (s logOutputNamespaceLister) Get(name string) (*v1.LogOutput, error) {
+	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1.Resource("logoutput"), name)
+	}
+	return obj.(*v1.LogOutput), nil
+}
@@ -1,8 +1,24 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by lister-gen. DO NOT EDIT.
+
 package v1
 
 import (
-	apiv1 "github.com/yshaojie/log-collector/api/v1"
-	v1 "k8s.io/api/apps/v1"
+	v1 "github.com/yshaojie/log-collector/api/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/tools/cache"
@@ -13,12 +29,13 @@ import (
 type ServerLogLister interface {
 	// List lists all ServerLogs in the indexer.
 	// Objects returned here must be treated as read-only.
-	List(selector labels.Selector) (ret []*apiv1.ServerLog, err error)
+	List(selector labels.Selector) (ret []*v1.ServerLog, err error)
 	// ServerLogs returns an object that can list and get ServerLogs.
 	ServerLogs(namespace string) ServerLogNamespaceLister
+	ServerLogListerExpansion
 }
 
-// ServerLogLister implements the ServerLogLister interface.
+// serverLogLister implements the ServerLogLister interface.
 type serverLogLister struct {
 	indexer cache.Indexer
 }
@@ -29,9 +46,9 @@ func NewServerLogLister(indexer cache.Indexer) ServerLogLister {
 }
 
 // List lists all ServerLogs in the indexer.
-func (s *serverLogLister) List(selector labels.Selector) (ret []*apiv1.ServerLog, err error) {
+func (s *serverLogLister) List(selector labels.Selector) (ret []*v1.ServerLog, err error) {
 	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
-		ret = append(ret, m.(*apiv1.ServerLog))
+		ret = append(ret, m.(*v1.ServerLog))
 	})
 	return ret, err
 }
@@ -46,13 +63,14 @@ func (s *serverLogLister) ServerLogs(namespace string) ServerLogNamespaceLister
 type ServerLogNamespaceLister interface {
 	// List lists all ServerLogs in the indexer for a given namespace.
 	// Objects returned here must be treated as read-only.
-	List(selector labels.Selector) (ret []*apiv1.ServerLog, err error)
+	List(selector labels.Selector) (ret []*v1.ServerLog, err error)
 	// Get retrieves the ServerLog from the indexer for a given namespace and name.
 	// Objects returned here must be treated as read-only.
-	Get(name string) (*apiv1.ServerLog, error)
+	Get(name string) (*v1.ServerLog, error)
+	ServerLogNamespaceListerExpansion
 }
 
-// ServerLogNamespaceLister implements the ServerLogNamespaceLister
+// serverLogNamespaceLister implements the ServerLogNamespaceLister
 // interface.
 type serverLogNamespaceLister struct {
 	indexer   cache.Indexer
@@ -60,21 +78,21 @@ type serverLogNamespaceLister struct {
 }
 
 // List lists all ServerLogs in the indexer for a given namespace.
-func (s serverLogNamespaceLister) List(selector labels.Selector) (ret []*apiv1.ServerLog, err error) {
+func (s serverLogNamespaceLister) List(selector labels.Selector) (ret []*v1.ServerLog, err error) {
 	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
-		ret = append(ret, m.(*apiv1.ServerLog))
+		ret = append(ret, m.(*v1.ServerLog))
 	})
 	return ret, err
 }
 
 // Get retrieves the ServerLog from the indexer for a given namespace and name.
-func (s serverLogNamespaceLister) Get(name string) (*apiv1.ServerLog, error) {
+func (s serverLogNamespaceLister) Get(name string) (*v1.ServerLog, error) {
 	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
 	if err != nil {
 		return nil, err
 	}
 	if !exists {
-		return nil, errors.NewNotFound(v1.Resource("ServerLog"), name)
+		return nil, errors.NewNotFound(v1.Resource("serverlog"), name)
 	}
-	return obj.(*apiv1.ServerLog), nil
+	return obj.(*v1.ServerLog), nil
 }
@@ -0,0 +1,98 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	v1 "github.com/yshaojie/log-collector/api/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ServerLogTemplateLister helps list ServerLogTemplates.
+// All objects returned here must be treated as read-only.
+type ServerLogTemplateLister interface {
+	// List lists all ServerLogTemplates in the indexer.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v1.ServerLogTemplate, err error)
+	// ServerLogTemplates returns an object that can list and get ServerLogTemplates.
+	ServerLogTemplates(namespace string) ServerLogTemplateNamespaceLister
+	ServerLogTemplateListerExpansion
+}
+
+// serverLogTemplateLister implements the ServerLogTemplateLister interface.
+type serverLogTemplateLister struct {
+	indexer cache.Indexer
+}
+
+// NewServerLogTemplateLister returns a new ServerLogTemplateLister.
+func NewServerLogTemplateLister(indexer cache.Indexer) ServerLogTemplateLister {
+	return &serverLogTemplateLister{indexer: indexer}
+}
+
+// List lists all ServerLogTemplates in the indexer.
+func (s *serverLogTemplateLister) List(selector labels.Selector) (ret []*v1.ServerLogTemplate, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1.ServerLogTemplate))
+	})
+	return ret, err
+}
+
+// ServerLogTemplates returns an object that can list and get ServerLogTemplates.
+func (s *serverLogTemplateLister) ServerLogTemplates(namespace string) ServerLogTemplateNamespaceLister {
+	return serverLogTemplateNamespaceLister{indexer: s.indexer, namespace: namespace}
+}
+
+// ServerLogTemplateNamespaceLister helps list and get ServerLogTemplates.
+// All objects returned here must be treated as read-only.
+type ServerLogTemplateNamespaceLister interface {
+	// List lists all ServerLogTemplates in the indexer for a given namespace.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v1.ServerLogTemplate, err error)
+	// Get retrieves the ServerLogTemplate from the indexer for a given namespace and name.
+	// Objects returned here must be treated as read-only.
+	Get(name string) (*v1.ServerLogTemplate, error)
+	ServerLogTemplateNamespaceListerExpansion
+}
+
+// serverLogTemplateNamespaceLister implements the ServerLogTemplateNamespaceLister
+// interface.
+type serverLogTemplateNamespaceLister struct {
+	indexer   cache.Indexer
+	namespace string
+}
+
+// List lists all ServerLogTemplates in the indexer for a given namespace.
+func (s serverLogTemplateNamespaceLister) List(selector labels.Selector) (ret []*v1.ServerLogTemplate, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1.ServerLogTemplate))
+	})
+	return ret, err
+}
+
+// Get retrieves the ServerLogTemplate from the indexer for a given namespace and name.
+func (s serverLogTemplateNamespaceLister) Get(name string) (*v1.ServerLogTemplate, error) {
+	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1.Resource("serverlogtemplate"), name)
+	}
+	return obj.(*v1.ServerLogTemplate), nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v2
+
+import (
+	v2 "github.com/yshaojie/log-collector/api/v2"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ServerLogLister helps list ServerLogs.
+// All objects returned here must be treated as read-only.
+type ServerLogLister interface {
+	// List lists all ServerLogs in the indexer.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v2.ServerLog, err error)
+	// ServerLogs returns an object that can list and get ServerLogs.
+	ServerLogs(namespace string) ServerLogNamespaceLister
+	ServerLogListerExpansion
+}
+
+// serverLogLister implements the ServerLogLister interface.
+type serverLogLister struct {
+	indexer cache.Indexer
+}
+
+// NewServerLogLister returns a new ServerLogLister.
+func NewServerLogLister(indexer cache.Indexer) ServerLogLister {
+	return &serverLogLister{indexer: indexer}
+}
+
+// List lists all ServerLogs in the indexer.
+func (s *serverLogLister) List(selector labels.Selector) (ret []*v2.ServerLog, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v2.ServerLog))
+	})
+	return ret, err
+}
+
+// ServerLogs returns an object that can list and get ServerLogs.
+func (s *serverLogLister) ServerLogs(namespace string) ServerLogNamespaceLister {
+	return serverLogNamespaceLister{indexer: s.indexer, namespace: namespace}
+}
+
+// ServerLogNamespaceLister helps list and get ServerLogs.
+// All objects returned here must be treated as read-only.
+type ServerLogNamespaceLister interface {
+	// List lists all ServerLogs in the indexer for a given namespace.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v2.ServerLog, err error)
+	// Get retrieves the ServerLog from the indexer for a given namespace and name.
+	// Objects returned here must be treated as read-only.
+	Get(name string) (*v2.ServerLog, error)
+	ServerLogNamespaceListerExpansion
+}
+
+// serverLogNamespaceLister implements the ServerLogNamespaceLister
+// interface.
+type serverLogNamespaceLister struct {
+	indexer   cache.Indexer
+	namespace string
+}
+
+// List lists all ServerLogs in the indexer for a given namespace.
+func (s serverLogNamespaceLister) List(selector labels.Selector) (ret []*v2.ServerLog, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*v2.ServerLog))
+	})
+	return ret, err
+}
+
+// Get retrieves the ServerLog from the indexer for a given namespace and name.
+func (s serverLogNamespaceLister) Get(name string) (*v2.ServerLog, error) {
+	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v2.Resource("serverlog"), name)
+	}
+	return obj.(*v2.ServerLog), nil
+}
@@ -2,4 +2,33 @@ package utils
 
 const (
 	FinalizerNameAgentHolder = "log.4yxy.io/agent-holder"
+	// LabelNodeName mirrors ServerLog.Spec.NodeName so node agents can list
+	// only their own ServerLogs; CRDs do not support spec field selectors.
+	LabelNodeName = "log.4yxy.io/node-name"
+	// CollectKey opts a Pod in to collection when it is set to "true" as a
+	// label or an annotation.
+	CollectKey = "log.4yxy.io/collect"
+	// AnnotationSources holds the sources of a Pod as a JSON list of
+	// LogSource. It wins over a matching ServerLogTemplate.
+	AnnotationSources = "log.4yxy.io/sources"
+	// AnnotationSpecSource records on a ServerLog where the controller took
+	// its spec from: the sources annotation of the Pod, a ServerLogTemplate
+	// or the log dir annotation.
+	AnnotationSpecSource = "log.4yxy.io/spec-source"
+	// AnnotationRateLimitLines and AnnotationRateLimitBytes set on a
+	// Namespace are the rate limits of its ServerLogs that have none in
+	// their spec, e.g. "1000" lines and "1Mi" bytes per second.
+	AnnotationRateLimitLines = "log.4yxy.io/rate-limit-lines"
+	AnnotationRateLimitBytes = "log.4yxy.io/rate-limit-bytes"
+	// AnnotationDefaultDir, AnnotationDefaultFileFilter,
+	// AnnotationDefaultPattern and AnnotationDefaultOutput set on a
+	// Namespace are filled in by the webhook on its ServerLogs that do not
+	// set them, winning over the defaults of the LogCollectorConfig.
+	AnnotationDefaultDir        = "log.4yxy.io/default-dir"
+	AnnotationDefaultFileFilter = "log.4yxy.io/default-file-filter"
+	AnnotationDefaultPattern    = "log.4yxy.io/default-pattern"
+	AnnotationDefaultOutput     = "log.4yxy.io/default-output"
+	// AnnotationV1Fields holds, as JSON, the fields of a v1 ServerLog its
+	// v2 version cannot hold, so it converts back to v1 unchanged.
+	AnnotationV1Fields = "log.4yxy.io/v1-fields"
 )